@@ -2,18 +2,32 @@ module test.com/scale
 
 go 1.18
 
+require (
+	github.com/cespare/xxhash v1.1.0
+	github.com/dustin/go-humanize v1.0.0
+	github.com/golang/protobuf v1.5.3
+	github.com/google/gopacket v1.1.19
+	github.com/klauspost/compress v1.15.9
+	github.com/klauspost/pgzip v1.2.5
+	github.com/uncatchable-de/goml v0.0.0-20190809191221-70531a547d49
+	github.com/xitongsys/parquet-go v1.6.2
+	google.golang.org/grpc v1.56.3
+	gopkg.in/yaml.v3 v3.0.1
+)
+
 require (
 	github.com/Fabse333/goml v0.0.0-20190809191221-70531a547d49 // indirect
-	github.com/cespare/xxhash v1.1.0 // indirect
-	github.com/dustin/go-humanize v1.0.0 // indirect
-	github.com/golang/protobuf v1.5.2 // indirect
-	github.com/google/gopacket v1.1.19 // indirect
-	github.com/klauspost/compress v1.15.9 // indirect
-	github.com/klauspost/pgzip v1.2.5 // indirect
-	github.com/uncatchable-de/goml v0.0.0-20190809191221-70531a547d49 // indirect
-	golang.org/x/net v0.0.0-20190620200207-3b0461eec859 // indirect
-	golang.org/x/sys v0.0.0-20190412213103-97732733099d // indirect
-	google.golang.org/protobuf v1.26.0 // indirect
+	github.com/apache/arrow/go/arrow v0.0.0-20200730104253-651201b0f516 // indirect
+	github.com/apache/thrift v0.14.2 // indirect
+	github.com/golang/snappy v0.0.3 // indirect
+	github.com/pierrec/lz4/v4 v4.1.8 // indirect
+	github.com/xitongsys/parquet-go-source v0.0.0-20200817004010-026bad9b25d0 // indirect
+	golang.org/x/net v0.9.0 // indirect
+	golang.org/x/sys v0.7.0 // indirect
+	golang.org/x/text v0.9.0 // indirect
+	golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543 // indirect
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
+	google.golang.org/protobuf v1.30.0 // indirect
 )
 
 replace github.com/google/gopacket => ./pkg/mod/github.com/google/gopacket@v1.1.19/
@@ -0,0 +1,228 @@
+// Package analyzer wires the reader, parser, pools and metrics into an analysis.
+// It can be embedded into other applications, several analyzers can run concurrently in one process.
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"test.com/scale/src/analysis/metrics/common"
+	flowMetrics "test.com/scale/src/analysis/metrics/flows"
+	standardMetrics "test.com/scale/src/analysis/metrics/standard"
+	"test.com/scale/src/analysis/parser"
+	"test.com/scale/src/analysis/pool"
+	"test.com/scale/src/analysis/reader"
+	"test.com/scale/src/analysis/utils"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Analyzer analyzes packets according to its Options.
+type Analyzer struct {
+	opts Options
+}
+
+// Result contains the outcome of a run.
+// FlowMetric is set if Options.ComputeFlowMetrics is set, StandardMetric if Options.ComputeStandardMetrics is set.
+type Result struct {
+	Packets              int64 // Number of read packets
+	FirstPacketTimestamp int64
+	LastPacketTimestamp  int64
+	PacketStopReached    bool
+	FlowMetric           *flowMetrics.Metric
+	StandardMetric       *standardMetrics.Metric
+}
+
+// New creates a new Analyzer. Returns a ConfigError if the options are invalid.
+func New(opts Options) (*Analyzer, error) {
+	if err := opts.validate(); err != nil {
+		return nil, newError(ConfigError, err)
+	}
+	return &Analyzer{opts: opts}, nil
+}
+
+// Options returns the options of the analyzer
+func (a *Analyzer) Options() Options {
+	return a.opts
+}
+
+// Run analyzes all packets of source and exports the metrics to the export directory.
+// Each run is independent of previous runs (except of the carry over file).
+// If ctx is cancelled, reading is stopped, but the packets read so far are still analyzed and exported.
+// In this case, the result is returned together with ctx.Err().
+//
+// Errors are returned as *Error. If reading, processing or exporting fails, the results computed so far
+// are still exported if possible. The first error is returned, further errors are logged.
+func (a *Analyzer) Run(ctx context.Context, source Source) (*Result, error) {
+	opts := &a.opts
+	startTime := time.Now()
+	result := &Result{}
+
+	// Create export Directory if it does not exist
+	if !utils.DirectoryExists(opts.ExportDirectory) {
+		if err := utils.CreateDir(opts.ExportDirectory); err != nil {
+			return nil, newError(ExportError, err)
+		}
+	}
+	if opts.InfoDirectory != "" && !utils.DirectoryExists(opts.InfoDirectory) {
+		if err := utils.CreateDir(opts.InfoDirectory); err != nil {
+			return nil, newError(ExportError, err)
+		}
+	}
+
+	var state *carryOver
+	if opts.CarryOverLoad != "" {
+		var err error
+		state, err = loadCarryOver(opts.CarryOverLoad)
+		if err != nil {
+			return nil, newError(InputError, fmt.Errorf("could not load carry over file %s: %v", opts.CarryOverLoad, err))
+		}
+	}
+
+	// Initialize Metrics. The standard metrics load the cluster models, so this is done before anything is started.
+	// The flow metrics are created last, as they start the listeners of the stream output.
+	if opts.ComputeStandardMetrics {
+		var err error
+		result.StandardMetric, err = standardMetrics.NewMetric(
+			opts.SessionTimeout.Nanoseconds(), opts.InfoDirectory,
+			opts.ClusterModelDirectory, opts.CommunityIDSeed, opts.DropUnidirectional,
+			opts.TCPReconstructResponse, opts.StatisticTCPReconstruction, opts.TruncatedFlows,
+			opts.StandardMetrics, opts.DisabledStandardMetrics,
+		)
+		if err != nil {
+			return nil, newError(ConfigError, err)
+		}
+	}
+	if opts.ComputeFlowMetrics {
+		var err error
+		result.FlowMetric, err = flowMetrics.NewMetric(opts.flowMetricConfig(), opts.flowMetrics(),
+			opts.DropUnidirectional, opts.TCPReconstructResponse, opts.flowExport())
+		if err != nil {
+			return nil, newError(ConfigError, err)
+		}
+	}
+
+	// Initialize Pool
+	pools := pool.NewPools(opts.TCPFilter, opts.UDPFilter, opts.TCPDropIncomplete, opts.timeouts(),
+		opts.NumFlowThreads, opts.AddPacketChannelSize, opts.PacketInformationCacheSize)
+
+	// Initialize Parser
+	packetParser := parser.NewParser(pools, opts.SortingRingBufferSize, opts.NumParser, opts.SamplingRate, opts.NumParserChannel, opts.ParserBatchSize)
+
+	// Register Metrics. If both are computed, the request/response pairs are identified once for both.
+	switch {
+	case opts.ComputeFlowMetrics && opts.ComputeStandardMetrics:
+		pools.RegisterMetric(common.NewReqResDispatcher(result.StandardMetric.ReqResIdentifier, result.StandardMetric, result.FlowMetric))
+	case opts.ComputeFlowMetrics:
+		pools.RegisterMetric(result.FlowMetric)
+	default:
+		pools.RegisterMetric(result.StandardMetric)
+	}
+	if opts.ComputeFlowMetrics {
+		go result.FlowMetric.ExportRoutine(opts.ExportDirectory)
+	}
+
+	// Preload open flows and sessions of the previous run
+	if state != nil {
+		pools.Preload(state.TCPFlows, state.UDPFlows)
+		if opts.ComputeStandardMetrics {
+			result.StandardMetric.PreloadSessions(state.Sessions)
+		}
+	}
+
+	// Initialize Reader
+	var packetReader = reader.NewPacketReader(pools, packetParser)
+	packetStopReached, readErr := source.read(ctx, packetReader, opts)
+	errs := []error{newError(InputError, readErr)}
+	result.Packets = packetReader.PacketIdx
+	result.FirstPacketTimestamp = packetReader.FirstPacketTimestamp
+	result.LastPacketTimestamp = packetReader.LastPacketTimestamp
+	result.PacketStopReached = packetStopReached
+
+	a.createMemoryProfile("PacketStop")
+	secondsAnalyzed := float64(packetReader.LastPacketTimestamp-packetReader.FirstPacketTimestamp) / float64(time.Second)
+	fmt.Println("Analyzed\t\t\t", humanize.CommafWithDigits(secondsAnalyzed, 2), "seconds of traffic")
+
+	packetParser.Close()
+	fmt.Println("Decoded\t\t\t\t", humanize.Comma(packetReader.PacketIdx), "packets")
+	fmt.Println("Time until Parsing Completed:\t", time.Since(startTime))
+	pools.PrintStatistics()
+
+	state = nil
+	if opts.CarryOverSave != "" {
+		state = &carryOver{LastTimestamp: packetReader.LastPacketTimestamp}
+		state.TCPFlows, state.UDPFlows = pools.CloseAndDetach()
+	} else {
+		pools.Close()
+	}
+	fmt.Println("Time until Pool Closed:\t\t", time.Since(startTime))
+
+	if state != nil && opts.ComputeStandardMetrics {
+		state.Sessions = result.StandardMetric.DetachOpenSessions(state.LastTimestamp)
+	}
+	if state != nil {
+		if err := saveCarryOver(opts.CarryOverSave, state); err != nil {
+			errs = append(errs, newError(ExportError, fmt.Errorf("could not save carry over file %s: %v", opts.CarryOverSave, err)))
+		}
+	}
+
+	if opts.ComputeFlowMetrics {
+		result.FlowMetric.Flush()
+		errs = append(errs, newError(ExportError, result.FlowMetric.Wait()))
+	}
+	if opts.ComputeStandardMetrics {
+		standardMetric := result.StandardMetric
+		errs = append(errs, newError(ExportError, standardMetric.ForceFlush()))
+		errs = append(errs, newError(ProcessingError, standardMetric.Err()))
+		a.createMemoryProfile("MetricFlush")
+		fmt.Println("Time until Metric flushed:\t", time.Since(startTime))
+
+		standardMetric.PrintStatistics()
+
+		fmt.Println("Time until export start:", time.Since(startTime))
+		errs = append(errs, newError(ExportError, standardMetric.Export(opts.ExportDirectory)))
+		fmt.Println("Time until export finished:", time.Since(startTime))
+	}
+
+	if err := firstError(errs); err != nil {
+		return result, err
+	}
+	return result, ctx.Err()
+}
+
+// firstError returns the first error which is not nil and logs all further errors
+func firstError(errs []error) error {
+	var first error
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if first == nil {
+			first = err
+		} else {
+			log.Println(err)
+		}
+	}
+	return first
+}
+
+// createMemoryProfile writes a heap profile, if a MemProfile is specified.
+func (a *Analyzer) createMemoryProfile(prefix string) {
+	utils.PrintMemUsage()
+	if a.opts.MemProfile != "" {
+		f, err := os.Create(prefix + a.opts.MemProfile)
+		if err != nil {
+			log.Println("could not create memory profile: ", err)
+			return
+		}
+		defer f.Close()
+		runtime.GC() // get up-to-date statistics
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			log.Println("could not write memory profile: ", err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package analyzer
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"test.com/scale/src/analysis/flows"
+	standardMetrics "test.com/scale/src/analysis/metrics/standard"
+
+	gzip "github.com/klauspost/pgzip"
+)
+
+// carryOverVersion must be increased whenever the layout of carryOver or of the contained flows changes.
+// Version 2 added the termination reason, TCP flags, truncation, fragment and timeout profile of the flows,
+// version 3 removed their expiry bucket, version 4 added the flags of the first packet of the flow (flows.TCPFlags.FlowFirst).
+const carryOverVersion = 4
+
+// carryOver contains the state which is still open at the end of a run.
+// It is stored to a file, so that the next run (e.g. the trace of the next day) can complete the flows and sessions.
+type carryOver struct {
+	Version       int
+	LastTimestamp int64
+	TCPFlows      []*flows.TCPFlow
+	UDPFlows      []*flows.UDPFlow
+	Sessions      []standardMetrics.CarriedSession
+}
+
+// loadCarryOver reads a carry over file written by saveCarryOver.
+func loadCarryOver(filename string) (*carryOver, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	state := &carryOver{}
+	if err = gob.NewDecoder(reader).Decode(state); err != nil {
+		return nil, err
+	}
+	if state.Version != carryOverVersion {
+		return nil, fmt.Errorf("carry over file %s has version %d, expected %d", filename, state.Version, carryOverVersion)
+	}
+	return state, nil
+}
+
+// saveCarryOver writes the open flows and sessions to a file.
+// The file is written to a temporary file first, so that an existing carry over file is only replaced if writing succeeded.
+func saveCarryOver(filename string, state *carryOver) error {
+	state.Version = carryOverVersion
+	tmpFilename := filename + ".tmp"
+	file, err := os.Create(tmpFilename)
+	if err != nil {
+		return err
+	}
+
+	writer := gzip.NewWriter(file)
+	if err = gob.NewEncoder(writer).Encode(state); err != nil {
+		file.Close()
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFilename, filename)
+}
@@ -0,0 +1,72 @@
+package analyzer
+
+import (
+	"encoding/gob"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"test.com/scale/src/analysis/flows"
+	standardMetrics "test.com/scale/src/analysis/metrics/standard"
+	"testing"
+
+	gzip "github.com/klauspost/pgzip"
+)
+
+func TestCarryOverRoundTrip(t *testing.T) {
+	tcpFlow := &flows.TCPFlow{
+		Flow: flows.Flow{
+			FlowKey:        1,
+			Timeout:        2000,
+			ServerPort:     443,
+			Protocol:       flows.TCP,
+			Packets:        []flows.Packet{{Timestamp: 1000}},
+			TCPFlags:       flows.TCPFlags{All: 0x12, Client: 0x02, Server: 0x12, First: 0x02, Last: 0x12, HandshakeStep: flows.HandshakeCompleted},
+			Truncated:      flows.TruncatedStart,
+			Fragment:       3,
+			TimeoutProfile: "tcp/443",
+		},
+		RSTIndex:      -1,
+		FirstFINIndex: flows.PreviousFragment,
+	}
+	udpFlow := &flows.UDPFlow{Flow: flows.Flow{FlowKey: 2, Timeout: 3000, ServerPort: 53, Protocol: flows.UDP, TimeoutProfile: flows.DefaultTimeoutProfile}}
+	state := &carryOver{
+		LastTimestamp: 2500,
+		TCPFlows:      []*flows.TCPFlow{tcpFlow},
+		UDPFlows:      []*flows.UDPFlow{udpFlow},
+		Sessions:      []standardMetrics.CarriedSession{{ClientAddr: 7, Start: 1000, End: 2000, Flows: []standardMetrics.CarriedSessionFlow{{Start: 1000, End: 2000, ServerAddr: 8}}}},
+	}
+
+	filename := path.Join(t.TempDir(), "carryover")
+	if err := saveCarryOver(filename, state); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadCarryOver(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, state) {
+		t.Fatalf("loaded %+v, expected %+v", loaded, state)
+	}
+	if _, err = os.Stat(filename + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temporary file was not removed: %v", err)
+	}
+}
+
+func TestCarryOverRejectsOtherVersions(t *testing.T) {
+	filename := path.Join(t.TempDir(), "carryover")
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := gzip.NewWriter(file)
+	if err = gob.NewEncoder(writer).Encode(&carryOver{Version: carryOverVersion - 1}); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+	file.Close()
+
+	if _, err = loadCarryOver(filename); err == nil || !strings.Contains(err.Error(), "has version") {
+		t.Fatalf("error is %v, expected a version mismatch", err)
+	}
+}
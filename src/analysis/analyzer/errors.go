@@ -0,0 +1,54 @@
+package analyzer
+
+import "fmt"
+
+// ErrorKind classifies the errors returned by an Analyzer
+type ErrorKind int
+
+const (
+	// ConfigError is returned if the options are invalid or the cluster models can not be loaded
+	ConfigError ErrorKind = iota + 1
+	// InputError is returned if the packets can not be read
+	InputError
+	// ProcessingError is returned if the packets or flows can not be processed
+	ProcessingError
+	// ExportError is returned if the results can not be stored
+	ExportError
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ConfigError:
+		return "config error"
+	case InputError:
+		return "input error"
+	case ProcessingError:
+		return "processing error"
+	case ExportError:
+		return "export error"
+	default:
+		return fmt.Sprintf("error kind %d", int(k))
+	}
+}
+
+// Error is the error returned by an Analyzer. Use errors.As to get the Kind of an error.
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Kind.String() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// newError wraps err into an Error of the given kind. Returns nil if err is nil.
+func newError(kind ErrorKind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
@@ -0,0 +1,301 @@
+package analyzer
+
+// This file contains the options of an analyzer and their defaults.
+// The defaults of the pipeline sizes are derived from the number of CPUs and the available memory.
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"strings"
+	"test.com/scale/src/analysis/flows"
+	flowMetrics "test.com/scale/src/analysis/metrics/flows"
+	standardMetrics "test.com/scale/src/analysis/metrics/standard"
+	"test.com/scale/src/analysis/parser"
+	"test.com/scale/src/analysis/pool"
+	"test.com/scale/src/analysis/utils"
+	"time"
+	"unsafe"
+)
+
+const million = 1000000
+
+// maxSortingRingBufferSize is the upper bound of the default SortingRingBufferSize
+const maxSortingRingBufferSize = 4 * million
+
+// minSortingRingBufferSize is the lower bound of the default SortingRingBufferSize
+const minSortingRingBufferSize = 64 * 1024
+
+// estimatedPacketDataSize is the estimated size of the packet data referenced by a waiting packet
+const estimatedPacketDataSize = 1024
+
+// Options configures an Analyzer. Use DefaultOptions to get the defaults and modify them as required.
+type Options struct {
+	// Flow construction
+	TCPFilter         []uint16 // Only TCP flows with one of these ports are analyzed
+	UDPFilter         []uint16 // Only UDP flows with one of these ports are analyzed
+	TCPDropIncomplete bool     // Drop all TCP flows without a SYN packet
+	SamplingRate      float64  // Sampling rate of flows in percent
+	TCPTimeout        time.Duration
+	TCPFinTimeout     time.Duration // Timeout after a FIN is received
+	TCPRstTimeout     time.Duration // Timeout after a RST is received
+	UDPTimeout        time.Duration
+	ActiveTimeout     time.Duration          // Only used by the flow metrics. Flows open for longer are exported as several records (fragments), 0 disables it
+	TimeoutProfiles   []flows.TimeoutProfile // Override the timeouts for some protocols, server ports and networks, see flows.ParseTimeoutProfile
+
+	// Metrics
+	ComputeFlowMetrics     bool     // Compute the flow metrics (one record per flow)
+	ComputeStandardMetrics bool     // Compute the standard metrics (distributions per protocol). Can be combined with the flow metrics.
+	ComputeFlowRRPs        bool     // Compute the size of rrps in the flow metrics (adds the rrps metric to FlowMetrics)
+	FlowMetrics            []string // Names of the flow metrics to compute, see flows.RegisteredMetrics
+	SamplingRateFlows      int64    // Sampling rate for the flow rate metric in ms (0: average over entire flow)
+	ExportBufferSize       uint     // Number of serialized flow metrics which can be buffered before being written
+	CommunityIDSeed        uint16   // Seed of the Community ID of the flows in the flow metrics and the info files
+
+	SessionTimeout             time.Duration // Only used by the standard metrics
+	DropUnidirectional         bool          // Drop unidirectional flows (after the reconstruction, if TCPReconstructResponse is set)
+	TCPReconstructResponse     bool          // Reconstruct the responses of unidirectional TCP flows
+	StatisticTCPReconstruction bool          // Only used by the standard metrics, requires TCPReconstructResponse
+	TruncatedFlows             string        // Only used by the standard metrics. How flows truncated by the start or end of the trace are handled, see standard.TruncatedFlows
+	ClusterModelDirectory      string        // Only used by the standard metrics. If set, the clustering models are loaded from there.
+	StandardMetrics            []string      // Only used by the standard metrics. Names of the enabled metrics, if nil all metrics are enabled. See standard.MetricNames
+	DisabledStandardMetrics    []string      // Only used by the standard metrics. Names of the disabled metrics
+
+	// Export
+	ExportDirectory string                          // Directory to store the metrics files. Required.
+	InfoDirectory   string                          // If set, information files about rrps, flows, sessions and users are stored there.
+	FlowFormats     []string                        // Output formats of the flow metrics, see flows.Formats
+	JSON            flowMetrics.JSONConfig          // Only used by the JSON output of the flow metrics (compression and rotation)
+	Parquet         flowMetrics.ParquetConfig       // Only used by the Parquet output of the flow metrics
+	CSV             flowMetrics.CSVConfig           // Only used by the CSV and TSV output of the flow metrics
+	Elasticsearch   flowMetrics.ElasticsearchConfig // Only used by the Elasticsearch output of the flow metrics
+	Stream          flowMetrics.StreamConfig        // Only used by the streaming output of the flow metrics
+
+	// Reading
+	ReaderThreads int           // Number of goroutines which copy packets of uncompressed pcap files. If 0, a single goroutine reads the packets.
+	PacketStop    int64         // Stop after this number of packets. If 0, all packets are read.
+	FlushRate     time.Duration // Flush the pools every FlushRate (relative to packet timestamps, not processing time)
+	CarryOverLoad string        // If set, the open flows and sessions stored by a previous run are preloaded from this file
+	CarryOverSave string        // If set, the open flows and sessions are not flushed at the end, but stored to this file
+	MemProfile    string        // If set, heap profiles are written after reading and after flushing the metrics, prefixed accordingly
+
+	// Pipeline sizes
+	NumParser                  int   // Number of parser goroutines
+	NumParserChannel           int   // Number of parser channels, at most NumParser
+	ParserBatchSize            int   // Number of packets which are sent to the parsers at once
+	SortingRingBufferSize      int64 // Maximal number of parsed packets which can wait to be sorted. Must be larger than ParserBatchSize.
+	NumFlowThreads             int   // Number of pools, each uses two goroutines (TCP & UDP)
+	AddPacketChannelSize       int   // Number of batches which can wait in the channels to each pool
+	PacketInformationCacheSize int   // Number of packets which are sent to a pool at once
+}
+
+// DefaultOptions returns the default options. Only the ExportDirectory must be set.
+func DefaultOptions() Options {
+	return Options{
+		TCPFilter:          allPorts(),
+		UDPFilter:          allPorts(),
+		SamplingRate:       100,
+		TCPTimeout:         5 * time.Minute,
+		TCPFinTimeout:      2 * time.Second,
+		TCPRstTimeout:      time.Second,
+		UDPTimeout:         5 * time.Minute,
+		ComputeFlowMetrics: true,
+		FlowMetrics:        append([]string(nil), flowMetrics.DefaultMetrics...),
+		ExportBufferSize:   flowMetrics.DefaultExportConfig().BufferSize,
+		FlowFormats:        flowMetrics.DefaultExportConfig().Formats,
+		JSON:               flowMetrics.DefaultJSONConfig(),
+		Parquet:            flowMetrics.DefaultParquetConfig(),
+		CSV:                flowMetrics.DefaultCSVConfig(),
+		Elasticsearch:      flowMetrics.DefaultElasticsearchConfig(),
+		Stream:             flowMetrics.DefaultStreamConfig(),
+		SessionTimeout:     10 * time.Minute,
+		TruncatedFlows:     standardMetrics.TruncatedFlowsInclude,
+		FlushRate:          20 * time.Second,
+
+		NumParser:                  defaultNumParser(),
+		NumParserChannel:           maxInt(1, defaultNumParser()/2),
+		ParserBatchSize:            parser.DefaultBatchSize,
+		SortingRingBufferSize:      defaultSortingRingBufferSize(),
+		NumFlowThreads:             maxInt(1, runtime.NumCPU()*2/5),
+		AddPacketChannelSize:       pool.DefaultAddPacketChannelSize,
+		PacketInformationCacheSize: pool.DefaultPacketInformationCacheSize,
+	}
+}
+
+// validate returns an error listing all invalid options
+func (o *Options) validate() error {
+	var problems []string
+	invalid := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if !o.ComputeFlowMetrics && !o.ComputeStandardMetrics {
+		invalid("At least one of ComputeFlowMetrics and ComputeStandardMetrics must be set.")
+	}
+	if o.ExportDirectory == "" {
+		invalid("ExportDirectory must be set.")
+	}
+	if o.SamplingRate <= 0 || o.SamplingRate > 100 {
+		invalid("SamplingRate must be larger than 0 and at most 100 percent.")
+	}
+	if o.TCPTimeout <= 0 || o.TCPFinTimeout <= 0 || o.TCPRstTimeout <= 0 || o.UDPTimeout <= 0 || o.SessionTimeout <= 0 {
+		invalid("All timeouts must be positive.")
+	}
+	for _, profile := range o.TimeoutProfiles {
+		if profile.Idle <= 0 || profile.TCPFin < 0 || profile.TCPRst < 0 {
+			invalid("The timeouts of the timeout profile %s must be positive.", profile.Name)
+		}
+	}
+	if o.ActiveTimeout < 0 {
+		invalid("ActiveTimeout must not be negative.")
+	}
+	if o.ActiveTimeout > 0 && o.ComputeStandardMetrics {
+		invalid("ActiveTimeout can only be used without the standard metrics, which require complete flows.")
+	}
+	if o.ComputeFlowMetrics && len(o.flowMetrics()) == 0 {
+		invalid("At least one flow metric must be selected.")
+	}
+	if err := flowMetrics.CheckMetrics(o.FlowMetrics); err != nil {
+		invalid("FlowMetrics is invalid: %v (available: %s)", err, strings.Join(flowMetrics.RegisteredMetrics(), ","))
+	}
+	if err := o.flowExport().Check(); o.ComputeFlowMetrics && err != nil {
+		invalid("The output of the flow metrics is invalid: %v", err)
+	}
+	if _, err := standardMetrics.ResolveMetrics(o.StandardMetrics, o.DisabledStandardMetrics, o.InfoDirectory != "" || o.ClusterModelDirectory != ""); err != nil {
+		invalid("StandardMetrics is invalid: %v (available: %s)", err, strings.Join(standardMetrics.MetricNames(), ","))
+	}
+	if o.SamplingRateFlows < 0 {
+		invalid("SamplingRateFlows must not be negative.")
+	}
+	if err := standardMetrics.CheckTruncatedFlows(o.TruncatedFlows); err != nil {
+		invalid("TruncatedFlows is invalid: %v", err)
+	}
+	if o.StatisticTCPReconstruction && !o.TCPReconstructResponse {
+		invalid("StatisticTCPReconstruction can only be set in combination with TCPReconstructResponse.")
+	}
+	if o.ClusterModelDirectory != "" && !utils.DirectoryExists(o.ClusterModelDirectory) {
+		invalid("Cluster model directory does not exist: %s", o.ClusterModelDirectory)
+	}
+	if o.CarryOverLoad != "" && !utils.FileExists(o.CarryOverLoad) {
+		invalid("Carry over file does not exist: %s", o.CarryOverLoad)
+	}
+	if o.ReaderThreads < 0 || o.PacketStop < 0 {
+		invalid("ReaderThreads and PacketStop must not be negative.")
+	}
+	if o.FlushRate <= 0 {
+		invalid("FlushRate must be positive.")
+	}
+
+	if o.NumParser < 1 || o.NumParserChannel < 1 || o.ParserBatchSize < 1 || o.NumFlowThreads < 1 || o.PacketInformationCacheSize < 1 {
+		invalid("NumParser, NumParserChannel, ParserBatchSize, NumFlowThreads and PacketInformationCacheSize must be positive.")
+	}
+	if o.AddPacketChannelSize < 0 {
+		invalid("AddPacketChannelSize must not be negative.")
+	}
+	if o.NumParserChannel > o.NumParser {
+		invalid("NumParserChannel must not be larger than NumParser.")
+	}
+	if o.SortingRingBufferSize <= int64(o.ParserBatchSize) {
+		invalid("SortingRingBufferSize must be larger than ParserBatchSize.")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid options:\n\t%s", strings.Join(problems, "\n\t"))
+	}
+	return nil
+}
+
+// timeouts returns the flow timeouts in nanoseconds
+func (o *Options) timeouts() flows.Timeouts {
+	return flows.Timeouts{
+		TCP:    o.TCPTimeout.Nanoseconds(),
+		TCPRst: o.TCPRstTimeout.Nanoseconds(),
+		TCPFin: o.TCPFinTimeout.Nanoseconds(),
+		UDP:    o.UDPTimeout.Nanoseconds(),
+		Active: o.ActiveTimeout.Nanoseconds(),
+		// The profiles are not modified by the pools, hence they are shared
+		Profiles: o.TimeoutProfiles,
+	}
+}
+
+// flowMetricConfig returns the configuration of the flow metrics
+func (o *Options) flowMetricConfig() flowMetrics.MetricConfig {
+	return flowMetrics.MetricConfig{
+		SamplingRate:    o.SamplingRateFlows,
+		CommunityIDSeed: o.CommunityIDSeed,
+	}
+}
+
+// flowMetrics returns the names of the flow metrics to compute
+func (o *Options) flowMetrics() []string {
+	names := append([]string(nil), o.FlowMetrics...)
+	if o.ComputeFlowRRPs {
+		names = append(names, "rrps")
+	}
+	if o.ActiveTimeout > 0 {
+		names = append(names, "fragment")
+	}
+	if len(o.TimeoutProfiles) > 0 {
+		names = append(names, "termination")
+	}
+	return names
+}
+
+// flowExport returns the configuration of the output of the flow metrics
+func (o *Options) flowExport() flowMetrics.ExportConfig {
+	return flowMetrics.ExportConfig{
+		BufferSize:    o.ExportBufferSize,
+		Formats:       o.FlowFormats,
+		JSON:          o.JSON,
+		Parquet:       o.Parquet,
+		CSV:           o.CSV,
+		Elasticsearch: o.Elasticsearch,
+		Stream:        o.Stream,
+	}
+}
+
+// packetStop returns the number of packets after which reading is stopped
+func (o *Options) packetStop() int64 {
+	if o.PacketStop == 0 {
+		return math.MaxInt64
+	}
+	return o.PacketStop
+}
+
+func allPorts() []uint16 {
+	ports := make([]uint16, 65536)
+	for i := range ports {
+		ports[i] = uint16(i)
+	}
+	return ports
+}
+
+// defaultNumParser returns the default number of parser goroutines (about every tenth CPU).
+func defaultNumParser() int {
+	return maxInt(1, runtime.NumCPU()/10)
+}
+
+// defaultSortingRingBufferSize returns the default number of packets which can wait to be sorted.
+// At most an eighth of the available memory is used for waiting packets.
+func defaultSortingRingBufferSize() int64 {
+	availableMemory := utils.AvailableMemory()
+	if availableMemory == 0 {
+		return maxSortingRingBufferSize
+	}
+	packetSize := uint64(unsafe.Sizeof(flows.PacketInformation{})) + estimatedPacketDataSize
+	size := int64(availableMemory / 8 / packetSize)
+	if size > maxSortingRingBufferSize {
+		return maxSortingRingBufferSize
+	}
+	if size < minSortingRingBufferSize {
+		return minSortingRingBufferSize
+	}
+	return size
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,106 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"test.com/scale/src/analysis/reader"
+	"test.com/scale/src/analysis/utils"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcap"
+)
+
+// liveReadTimeout is the time after which reading from an interface returns without packet, so that cancellation is noticed
+const liveReadTimeout = time.Second
+
+// Source provides the packets to analyze.
+// Use FileSource, InterfaceSource or PacketDataSource to create a Source.
+type Source interface {
+	// read hands all packets to packetReader. Returns whether the PacketStop has been reached.
+	read(ctx context.Context, packetReader *reader.PacketReader, opts *Options) (bool, error)
+}
+
+// FileSource returns a Source which reads a pcap/pcapng file or all of these files in a directory (in alphabetical order).
+// The files can optionally be zipped.
+func FileSource(input string) Source {
+	return fileSource{input: input}
+}
+
+// InterfaceSource returns a Source which captures packets from a network interface until the context is cancelled.
+func InterfaceSource(interfaceName string) Source {
+	return interfaceSource{interfaceName: interfaceName}
+}
+
+// PacketDataSource returns a Source which reads the packets from an arbitrary gopacket.PacketDataSource until io.EOF.
+func PacketDataSource(source gopacket.PacketDataSource) Source {
+	return packetDataSource{source: source}
+}
+
+type fileSource struct {
+	input string
+}
+
+func (s fileSource) read(ctx context.Context, packetReader *reader.PacketReader, opts *Options) (bool, error) {
+	if !utils.FileExists(s.input) && !utils.DirectoryExists(s.input) {
+		return false, fmt.Errorf("input does not exist: %s", s.input)
+	}
+	pcapFiles, err := utils.GetPcapFiles(s.input)
+	if err != nil {
+		return false, err
+	}
+	for _, pcapFile := range pcapFiles {
+		if ctx.Err() != nil {
+			return false, nil
+		}
+		fmt.Println("Read file: ", pcapFile)
+		fmt.Println("Already read", humanize.Comma(packetReader.PacketIdx), "packets")
+
+		if opts.ReaderThreads > 0 && reader.CanReadChunked(pcapFile) {
+			packetStopReached, err := packetReader.ReadPcapFileChunked(ctx, pcapFile, opts.packetStop(), opts.FlushRate.Nanoseconds(), opts.ReaderThreads)
+			if err != nil || packetStopReached {
+				return packetStopReached, err
+			}
+			continue
+		}
+
+		packetDataSource, ioHandle, deleteFile, fileName, err := reader.ReadPcapFile(pcapFile)
+		if err != nil {
+			return false, err
+		}
+		packetStopReached := packetReader.Read(ctx, opts.packetStop(), opts.FlushRate.Nanoseconds(), packetDataSource)
+
+		// Delete uncompressed filed
+		if deleteFile {
+			_ = os.Remove(fileName)
+		}
+		_ = ioHandle.Close()
+		if packetStopReached {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type interfaceSource struct {
+	interfaceName string
+}
+
+func (s interfaceSource) read(ctx context.Context, packetReader *reader.PacketReader, opts *Options) (bool, error) {
+	handle, err := pcap.OpenLive(s.interfaceName, 152200, true, liveReadTimeout)
+	if err != nil {
+		return false, err
+	}
+	defer handle.Close()
+	return packetReader.Read(ctx, opts.packetStop(), opts.FlushRate.Nanoseconds(), handle), nil
+}
+
+type packetDataSource struct {
+	source gopacket.PacketDataSource
+}
+
+func (s packetDataSource) read(ctx context.Context, packetReader *reader.PacketReader, opts *Options) (bool, error) {
+	return packetReader.Read(ctx, opts.packetStop(), opts.FlushRate.Nanoseconds(), s.source), nil
+}
@@ -0,0 +1,206 @@
+package main
+
+// This file contains the configuration file support.
+// Every flag can also be specified in a YAML configuration file, grouped into sections:
+//
+//	timeouts:
+//	  tcpTimeout: 5m
+//	filters:
+//	  tcpFilter: 80,443,8000-8080
+//
+// Flags which are specified on the command line override the values of the configuration file.
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// resolvedConfigFilename is the name of the file in the export directory containing the resolved configuration
+const resolvedConfigFilename = "config.yaml"
+
+// configSection groups options in the configuration file. The options are the names of the flags.
+type configSection struct {
+	name    string
+	options []string
+}
+
+// configSections contains every option of the analyzer. Each new flag must be added here.
+var configSections = []configSection{
+	{"input", []string{"i", "interface", "readerThreads", "carryOverLoad", "carryOverSave"}},
+	{"filters", []string{"tcpFilter", "udpFilter", "tcpDropIncomplete", "dropUnidirectional", "sampling"}},
+	{"timeouts", []string{"tcpTimeout", "tcpFinTimeout", "tcpRstTimeout", "udpTimeout", "timeoutProfiles", "activeTimeout", "sessionTimeout"}},
+	{"metrics", []string{"flow", "standard", "flowMetrics", "flowRRPs", "samplingFlows", "communityIDSeed", "tcpReconstructResponse", "statisticTCPReconstruction", "truncatedFlows", "clusterModelDirectory", "standardMetrics", "disableStandardMetrics"}},
+	{"export", []string{"export", "infoDirectory", "exportBufferSize", "flowFormat", "flowCompression", "flowRotateSize", "flowRotateInterval", "flowRotateFlows", "parquetRowGroupSize", "parquetCompression", "csvArrays", "esURL", "esIndex", "esBatchSize", "esFlushInterval", "esQueueSize", "esMaxRetries", "esRetryBackoff", "esTimeout", "streamListen", "streamGRPC", "streamBufferSize"}},
+	{"pipeline", []string{"numParser", "numParserChannel", "parserBatchSize", "sortingRingBufferSize", "numFlowThreads", "addPacketChannelSize", "packetInformationCacheSize", "maxProcs"}},
+	{"profiling", []string{"cpuprofile", "memprofile", "blockprofile"}},
+}
+
+// setOptions contains all options which are explicitly set, either by a flag or the configuration file
+var setOptions = make(map[string]bool)
+
+// isSet returns whether an option is explicitly set by a flag or the configuration file
+func isSet(option string) bool {
+	return setOptions[option]
+}
+
+// recordSetFlags marks the flags of the command line as set. Must be called after flag.Parse and before applyConfigFile.
+func recordSetFlags() {
+	flag.Visit(func(f *flag.Flag) {
+		setOptions[f.Name] = true
+	})
+}
+
+// applyConfigFile sets the options of the configuration file, which are not already set (see recordSetFlags).
+// Unknown sections or options and invalid values are reported as error.
+func applyConfigFile(filename string) error {
+	if filename == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var document yaml.Node
+	if err = yaml.Unmarshal(data, &document); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	// Empty file
+	if len(document.Content) == 0 {
+		return nil
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: expected sections at top level", filename)
+	}
+
+	for i := 0; i < len(root.Content); i += 2 {
+		sectionName := root.Content[i].Value
+		section := findConfigSection(sectionName)
+		if section == nil {
+			return fmt.Errorf("%s:%d: unknown section %s", filename, root.Content[i].Line, sectionName)
+		}
+		options := root.Content[i+1]
+		if options.Kind == yaml.ScalarNode && options.Tag == "!!null" {
+			continue
+		}
+		if options.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s:%d: expected options in section %s", filename, options.Line, sectionName)
+		}
+		for j := 0; j < len(options.Content); j += 2 {
+			option := options.Content[j].Value
+			if !containsOption(section, option) {
+				return fmt.Errorf("%s:%d: unknown option %s in section %s", filename, options.Content[j].Line, option, sectionName)
+			}
+			value, err := configValue(options.Content[j+1])
+			if err != nil {
+				return fmt.Errorf("%s:%d: option %s: %v", filename, options.Content[j+1].Line, option, err)
+			}
+			// Flags override the configuration file
+			if setOptions[option] {
+				continue
+			}
+			if err = flag.Set(option, value); err != nil {
+				return fmt.Errorf("%s:%d: option %s: %v", filename, options.Content[j+1].Line, option, err)
+			}
+			setOptions[option] = true
+		}
+	}
+	return nil
+}
+
+// configValue returns the value of an option as it would be passed as flag.
+// Lists (e.g. of ports) are joined by commas.
+func configValue(node *yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Value, nil
+	case yaml.SequenceNode:
+		values := make([]string, len(node.Content))
+		for i, element := range node.Content {
+			if element.Kind != yaml.ScalarNode {
+				return "", fmt.Errorf("lists must only contain values")
+			}
+			values[i] = element.Value
+		}
+		return strings.Join(values, ","), nil
+	default:
+		return "", fmt.Errorf("expected a value or a list of values")
+	}
+}
+
+func findConfigSection(name string) *configSection {
+	for i := range configSections {
+		if configSections[i].name == name {
+			return &configSections[i]
+		}
+	}
+	return nil
+}
+
+func containsOption(section *configSection, option string) bool {
+	for _, o := range section.options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// writeResolvedConfig writes the values of the options which are explicitly set or differ from their defaults to filename.
+// Options with default values are left out, since options which are set are validated against the selected metrics (see checkFlags).
+// The file is a valid configuration file, hence it can be used to repeat the run.
+func writeResolvedConfig(filename string) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	for _, section := range configSections {
+		options := &yaml.Node{Kind: yaml.MappingNode}
+		for _, option := range section.options {
+			if !isSet(option) && isDefault(option) {
+				continue
+			}
+			value, err := resolvedValue(option)
+			if err != nil {
+				return err
+			}
+			options.Content = append(options.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: option}, value)
+		}
+		if len(options.Content) == 0 {
+			continue
+		}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: section.name}, options)
+	}
+	data, err := yaml.Marshal(root)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+// isDefault returns whether an option has its default value
+func isDefault(option string) bool {
+	f := flag.Lookup(option)
+	return f != nil && f.Value.String() == f.DefValue
+}
+
+// resolvedValue returns the yaml representation of the current value of an option
+func resolvedValue(option string) (*yaml.Node, error) {
+	f := flag.Lookup(option)
+	if f == nil {
+		return nil, fmt.Errorf("option %s is not defined", option)
+	}
+	value := f.Value.(flag.Getter).Get()
+	node := &yaml.Node{}
+	// Durations are written in a human readable format (e.g. 5m0s)
+	if duration, ok := value.(time.Duration); ok {
+		value = duration.String()
+	}
+	if err := node.Encode(value); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
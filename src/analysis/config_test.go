@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// resetOptions sets all options of the configuration file back to their defaults
+func resetOptions(t *testing.T) {
+	t.Helper()
+	for _, section := range configSections {
+		for _, option := range section.options {
+			f := flag.Lookup(option)
+			if err := flag.Set(option, f.DefValue); err != nil {
+				t.Fatalf("could not reset %s: %v", option, err)
+			}
+		}
+	}
+	setOptions = make(map[string]bool)
+}
+
+func TestResolvedConfigRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		options map[string]string
+	}{
+		{"flow metrics", map[string]string{"flowFormat": "csv", "flowMetrics": "protocol,termination", "tcpTimeout": "2m0s"}},
+		{"standard metrics", map[string]string{"flow": "false", "infoDirectory": "info", "sessionTimeout": "10m0s", "truncatedFlows": "separate"}},
+		{"both", map[string]string{"standard": "true", "flowFormat": "json", "truncatedFlows": "exclude", "timeoutProfiles": "udp/53=30s"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			directory := t.TempDir()
+			input := path.Join(directory, "trace.pcap")
+			if err := os.WriteFile(input, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			resetOptions(t)
+			defer resetOptions(t)
+
+			options := map[string]string{"i": input}
+			for option, value := range test.options {
+				options[option] = value
+			}
+			for option, value := range options {
+				if err := flag.Set(option, value); err != nil {
+					t.Fatalf("could not set %s: %v", option, err)
+				}
+				setOptions[option] = true
+			}
+			if problems := checkFlags(); len(problems) > 0 {
+				t.Fatalf("the options are invalid: %s", strings.Join(problems, ", "))
+			}
+			filename := path.Join(directory, resolvedConfigFilename)
+			if err := writeResolvedConfig(filename); err != nil {
+				t.Fatal(err)
+			}
+			export := *exportDirectory
+
+			// Repeat the run with the resolved configuration
+			resetOptions(t)
+			if err := applyConfigFile(filename); err != nil {
+				t.Fatal(err)
+			}
+			if problems := checkFlags(); len(problems) > 0 {
+				t.Fatalf("the resolved configuration is invalid: %s", strings.Join(problems, ", "))
+			}
+			for option, value := range options {
+				if actual := flag.Lookup(option).Value.String(); actual != value {
+					t.Errorf("option %s is %s, expected %s", option, actual, value)
+				}
+			}
+			if *exportDirectory != export {
+				t.Errorf("export is %s, expected %s", *exportDirectory, export)
+			}
+		})
+	}
+}
+
+func TestConfigFileValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"unknown section", "unknown:\n  tcpTimeout: 5m\n", "unknown section unknown"},
+		{"unknown option", "timeouts:\n  tcpFilter: 80\n", "unknown option tcpFilter in section timeouts"},
+		{"invalid value", "timeouts:\n  tcpTimeout: five\n", "option tcpTimeout"},
+		{"nested list", "filters:\n  tcpFilter: [[80]]\n", "lists must only contain values"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetOptions(t)
+			defer resetOptions(t)
+			filename := path.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(filename, []byte(test.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := applyConfigFile(filename)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("error is %v, expected %s", err, test.err)
+			}
+		})
+	}
+}
+
+func TestConfigFileLists(t *testing.T) {
+	resetOptions(t)
+	defer resetOptions(t)
+	filename := path.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(filename, []byte("filters:\n  tcpFilter: [80, 443, 8000-8080]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfigFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	if *tcpFilter != "80,443,8000-8080" || !isSet("tcpFilter") {
+		t.Fatalf("tcpFilter is %s (set: %v), expected 80,443,8000-8080", *tcpFilter, isSet("tcpFilter"))
+	}
+}
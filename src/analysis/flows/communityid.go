@@ -0,0 +1,55 @@
+package flows
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"net"
+)
+
+// IANA numbers of the transport protocols, used by the Community ID
+const (
+	ianaTCP = 6
+	ianaUDP = 17
+)
+
+// CommunityID returns the Community ID (version 1) of the flow, see https://github.com/corelight/community-id-spec.
+// It identifies the flow independently of the tool which recorded it, e.g. to match the flows with the records of Zeek or Suricata.
+// The seed must be the same as the one of the other tools (default: 0).
+// Returns an empty string if the full addresses of the flow are unknown.
+func (f *Flow) CommunityID(seed uint16) string {
+	return CommunityID(seed, f.Protocol, f.FullClientAddr, f.FullServerAddr, f.ClientPort, f.ServerPort)
+}
+
+// CommunityID returns the Community ID (version 1) of a flow between the two endpoints, the order of the endpoints is irrelevant.
+// protocol is TCP or UDP. Returns an empty string if an address is missing or the addresses are of different families.
+func CommunityID(seed uint16, protocol uint8, addr1, addr2 net.IP, port1, port2 uint16) string {
+	if ip4 := addr1.To4(); ip4 != nil {
+		addr1 = ip4
+	}
+	if ip4 := addr2.To4(); ip4 != nil {
+		addr2 = ip4
+	}
+	if len(addr1) == 0 || len(addr1) != len(addr2) {
+		return ""
+	}
+	// The endpoint with the smaller address (or port, if the addresses are equal) comes first
+	if order := bytes.Compare(addr1, addr2); order > 0 || (order == 0 && port1 > port2) {
+		addr1, addr2 = addr2, addr1
+		port1, port2 = port2, port1
+	}
+
+	ianaProtocol := byte(ianaUDP)
+	if protocol == TCP {
+		ianaProtocol = ianaTCP
+	}
+	data := make([]byte, 0, 2+2*net.IPv6len+6)
+	data = append(data, byte(seed>>8), byte(seed))
+	data = append(data, addr1...)
+	data = append(data, addr2...)
+	data = append(data, ianaProtocol, 0)
+	data = append(data, byte(port1>>8), byte(port1), byte(port2>>8), byte(port2))
+
+	hash := sha1.Sum(data)
+	return "1:" + base64.StdEncoding.EncodeToString(hash[:])
+}
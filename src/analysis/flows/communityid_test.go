@@ -0,0 +1,37 @@
+package flows
+
+import (
+	"net"
+	"testing"
+)
+
+// The IPv4 values are test vectors of the specification, see https://github.com/corelight/community-id-spec.
+// The IPv6 value was computed independently from the definition in the specification.
+func TestCommunityID(t *testing.T) {
+	tests := []struct {
+		name         string
+		seed         uint16
+		protocol     uint8
+		addr1, addr2 string
+		port1, port2 uint16
+		expected     string
+	}{
+		{"tcp", 0, TCP, "128.232.110.120", "66.35.250.204", 34855, 80, "1:LQU9qZlK+B5F3KDmev6m5PMibrg="},
+		{"tcp reversed", 0, TCP, "66.35.250.204", "128.232.110.120", 80, 34855, "1:LQU9qZlK+B5F3KDmev6m5PMibrg="},
+		{"tcp with seed", 1, TCP, "128.232.110.120", "66.35.250.204", 34855, 80, "1:3V71V58M3Ksw/yuFALMcW0LAHvc="},
+		{"udp", 0, UDP, "192.168.1.52", "8.8.8.8", 54585, 53, "1:d/FP5EW3wiY1vCndhwleRRKHowQ="},
+		{"udp reversed", 0, UDP, "8.8.8.8", "192.168.1.52", 53, 54585, "1:d/FP5EW3wiY1vCndhwleRRKHowQ="},
+		{"udp with seed", 1, UDP, "192.168.1.52", "8.8.8.8", 54585, 53, "1:Q9We8WO3piVF8yEQBNJF4uiSVrI="},
+		{"ipv6 tcp", 0, TCP, "fe80::2c23:b96c:78d:e116", "fe80::3c4c:7e0d:e6a1:55f0", 58544, 2222, "1:j6gKQxoaiJq2zJ/nasKm9C0BSxc="},
+		{"missing address", 0, TCP, "", "66.35.250.204", 34855, 80, ""},
+		{"mixed families", 0, TCP, "fe80::1", "66.35.250.204", 34855, 80, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id := CommunityID(test.seed, test.protocol, net.ParseIP(test.addr1), net.ParseIP(test.addr2), test.port1, test.port2)
+			if id != test.expected {
+				t.Fatalf("community ID is %q, expected %q", id, test.expected)
+			}
+		})
+	}
+}
@@ -2,17 +2,139 @@ package flows
 
 import "net"
 
-// TCPTimeout in Nanoseconds
-var TCPTimeout int64
+// Timeouts defines after which time (in Nanoseconds) without packets a flow is timed out.
+type Timeouts struct {
+	TCP      int64
+	TCPRst   int64 // Timeout after a RST is received
+	TCPFin   int64 // Timeout after a FIN is received
+	UDP      int64
+	Active   int64            // Flows open for longer are flushed as fragments (interim records), 0 disables the active timeout
+	Profiles []TimeoutProfile // Override the timeouts for some protocols, server ports and networks
+}
+
+// TerminationReason is the reason why the pools flushed a flow
+type TerminationReason uint8
+
+const (
+	TerminationUnknown  TerminationReason = iota // The flow was not flushed yet
+	TerminationIdle                              // No packet was received within the idle timeout (Timeouts.TCP or Timeouts.UDP)
+	TerminationFIN                               // Timed out after a FIN was received
+	TerminationRST                               // Timed out after a RST was received
+	TerminationForced                            // A new connection (SYN) started after the flow was terminated by FIN or RST
+	TerminationShutdown                          // The flow was still open at the end of the analysis (Pools.Close)
+	TerminationActive                            // The flow is still open, an interim record was flushed after the active timeout (Timeouts.Active)
+)
+
+func (r TerminationReason) String() string {
+	switch r {
+	case TerminationIdle:
+		return "idle"
+	case TerminationFIN:
+		return "fin"
+	case TerminationRST:
+		return "rst"
+	case TerminationForced:
+		return "forced"
+	case TerminationShutdown:
+		return "shutdown"
+	case TerminationActive:
+		return "active"
+	default:
+		return "unknown"
+	}
+}
+
+// IsTimeout returns whether the flow timed out (idle, after FIN or after RST)
+func (r TerminationReason) IsTimeout() bool {
+	return r == TerminationIdle || r == TerminationFIN || r == TerminationRST
+}
 
-// TCPRstTimeout in Nanoseconds
-var TCPRstTimeout int64
+// Truncation marks flows which were not observed completely, because they were already open when the trace started
+// or still open when it ended. Truncated flows bias the distributions of e.g. the duration and size of the flows.
+type Truncation uint8
+
+const (
+	TruncatedStart Truncation = 1 << iota // The first packet of a TCP flow is no SYN, or the first packet of a UDP flow lies within its idle timeout after the start of the trace
+	TruncatedEnd                          // The flow was still open at the end of the analysis (TerminationShutdown)
+)
+
+func (t Truncation) String() string {
+	switch t {
+	case 0:
+		return ""
+	case TruncatedStart:
+		return "start"
+	case TruncatedEnd:
+		return "end"
+	default:
+		return "start,end"
+	}
+}
 
-// TCPFinTimeout in Nanoseconds
-var TCPFinTimeout int64
+// Bits of the TCP flags, as in the TCP header. Only the flags recorded by the pools are set.
+const (
+	TCPFlagFIN uint8 = 0x01
+	TCPFlagSYN uint8 = 0x02
+	TCPFlagRST uint8 = 0x04
+	TCPFlagACK uint8 = 0x10
+)
+
+// Steps of the TCP handshake
+const (
+	HandshakeNone      uint8 = iota // No SYN of the client
+	HandshakeSYN                    // SYN of the client
+	HandshakeSYNACK                 // SYN ACK of the server after the SYN
+	HandshakeCompleted              // ACK of the client after the SYN ACK
+)
+
+// TCPFlags summarizes the TCP flags of the packets of a flow (see TCPFlagFIN etc.).
+// It is updated with each packet and reset after each interim record (see Timeouts.Active), hence it covers the packets
+// of the current fragment. Only FlowFirst and HandshakeStep cover all packets of the flow.
+type TCPFlags struct {
+	All           uint8 // Flags of all packets
+	Client        uint8 // Flags of the packets of the client
+	Server        uint8 // Flags of the packets of the server
+	First         uint8 // Flags of the first packet
+	Last          uint8 // Flags of the last packet
+	FlowFirst     uint8 // Flags of the first packet of the flow, equal to First in the first fragment
+	HandshakeStep uint8 // Step of the handshake reached, see HandshakeNone etc.
+}
 
-// UDPTimeout in Nanoseconds
-var UDPTimeout int64
+// HandshakeCompleted returns whether SYN, SYN ACK and ACK were seen in this order
+func (t TCPFlags) HandshakeCompleted() bool {
+	return t.HandshakeStep == HandshakeCompleted
+}
+
+// add adds the flags of a packet. first is set for the first packet of the fragment, firstOfFlow for the first packet of the flow.
+func (t *TCPFlags) add(flags uint8, fromClient, first, firstOfFlow bool) {
+	t.All |= flags
+	if fromClient {
+		t.Client |= flags
+	} else {
+		t.Server |= flags
+	}
+	if first {
+		t.First = flags
+	}
+	if firstOfFlow {
+		t.FlowFirst = flags
+	}
+	t.Last = flags
+
+	switch {
+	case t.HandshakeStep == HandshakeNone && fromClient && flags&(TCPFlagSYN|TCPFlagACK) == TCPFlagSYN:
+		t.HandshakeStep = HandshakeSYN
+	case t.HandshakeStep == HandshakeSYN && !fromClient && flags&(TCPFlagSYN|TCPFlagACK) == TCPFlagSYN|TCPFlagACK:
+		t.HandshakeStep = HandshakeSYNACK
+	case t.HandshakeStep == HandshakeSYNACK && fromClient && flags&(TCPFlagSYN|TCPFlagACK|TCPFlagRST) == TCPFlagACK:
+		t.HandshakeStep = HandshakeCompleted
+	}
+}
+
+// nextFragment resets the flags of the packets after an interim record
+func (t *TCPFlags) nextFragment() {
+	*t = TCPFlags{FlowFirst: t.FlowFirst, HandshakeStep: t.HandshakeStep}
+}
 
 // TCP Protocol
 const TCP uint8 = 1
@@ -62,6 +184,24 @@ type PacketInformation struct {
 	IpId      uint16
 }
 
+// tcpFlags returns the TCP flags of the packet as bitmap
+func (p *PacketInformation) tcpFlags() uint8 {
+	var flags uint8
+	if p.TCPFIN {
+		flags |= TCPFlagFIN
+	}
+	if p.TCPSYN {
+		flags |= TCPFlagSYN
+	}
+	if p.TCPRST {
+		flags |= TCPFlagRST
+	}
+	if p.TCPACK {
+		flags |= TCPFlagACK
+	}
+	return flags
+}
+
 // Packet defines a TCP or UDP Packet
 // Take care of field order to ensure no wasted memory due to memalign
 type Packet struct {
@@ -107,14 +247,53 @@ type Flow struct {
 	FullServerAddr      net.IP
 	FirstPacketWasZMap  bool
 	AllPacketsZMap      bool
+	TerminationReason   TerminationReason // Set by the pools when the flow is flushed
+	TCPFlags            TCPFlags          // Only set for TCP flows
+	Truncated           Truncation        // Set by the pools, see TruncatedStart and TruncatedEnd
+	Fragment            uint32            // Sequence number of the record of the flow, incremented after each interim record (Timeouts.Active)
+	TimeoutProfile      string            // Name of the TimeoutProfile of the flow, DefaultTimeoutProfile if the global timeouts apply
+
+	timeoutProfile         *TimeoutProfile // Resolved on the first packet (see Timeouts.forFlow), nil for the global timeouts
+	timeoutProfileResolved bool
 }
 
+// IsLastFragment returns whether the flow is flushed for the last time, i.e. the record is no interim record of the active timeout.
+// If no packet arrives after an interim record until the flow ends, the pools do not flush the flow again,
+// hence the interim record remains the last record of the flow.
+func (f *Flow) IsLastFragment() bool {
+	return f.TerminationReason != TerminationActive
+}
+
+// nextFragment removes the packets of the flushed fragment
+func (f *Flow) nextFragment() {
+	f.Packets = nil
+	f.Fragment++
+	f.TerminationReason = TerminationUnknown
+}
+
+// PreviousFragment is the index of the first FIN and the RST, if the packet belonged to a previous fragment of the flow
+const PreviousFragment int32 = -2
+
 // TCPFlow is a Flow with special fields for TCP connections
 type TCPFlow struct {
 	Flow
 	TCPPacket     []TCPPacket
-	RSTIndex      int32
-	FirstFINIndex int32
+	RSTIndex      int32 // Index of the RST in Packets, -1 if no RST was received or PreviousFragment
+	FirstFINIndex int32 // Index of the first FIN in Packets, -1 if no FIN was received or PreviousFragment
+}
+
+// NextFragment removes the packets of the flow after an interim record was flushed (see Timeouts.Active),
+// so that the next record covers the following packets. The TCP flags are reset as well.
+func (f *TCPFlow) NextFragment() {
+	f.Flow.nextFragment()
+	f.TCPPacket = nil
+	f.TCPFlags.nextFragment()
+	if f.RSTIndex != -1 {
+		f.RSTIndex = PreviousFragment
+	}
+	if f.FirstFINIndex != -1 {
+		f.FirstFINIndex = PreviousFragment
+	}
 }
 
 // UDPFlow is a Flow with special fields for UDP connections
@@ -122,8 +301,14 @@ type UDPFlow struct {
 	Flow
 }
 
+// NextFragment removes the packets of the flow after an interim record was flushed (see Timeouts.Active),
+// so that the next record covers the following packets.
+func (f *UDPFlow) NextFragment() {
+	f.Flow.nextFragment()
+}
+
 // NewTCPFlow creates a new TCP Flow with default values
-func NewTCPFlow(packetInfo PacketInformation) *TCPFlow {
+func NewTCPFlow(packetInfo PacketInformation, timeouts *Timeouts) *TCPFlow {
 	f := TCPFlow{
 		Flow: Flow{
 			Protocol: TCP,
@@ -134,13 +319,13 @@ func NewTCPFlow(packetInfo PacketInformation) *TCPFlow {
 	}
 
 	f.setClientServer(packetInfo)
-	f.AddPacket(packetInfo)
+	f.AddPacket(packetInfo, timeouts)
 	// if not a syn packet then set Client and server based on first package
 	return &f
 }
 
 // NewUDPFlow creates a new TCP Flow with default values
-func NewUDPFlow(packetInfo PacketInformation) *UDPFlow {
+func NewUDPFlow(packetInfo PacketInformation, timeouts *Timeouts) *UDPFlow {
 	f := UDPFlow{
 		Flow: Flow{
 			Protocol: UDP,
@@ -148,7 +333,7 @@ func NewUDPFlow(packetInfo PacketInformation) *UDPFlow {
 		},
 	}
 	f.setClientServer(packetInfo)
-	f.AddPacket(packetInfo)
+	f.AddPacket(packetInfo, timeouts)
 	return &f
 }
 
@@ -179,8 +364,8 @@ func (f *Flow) addPacket(packetInfo PacketInformation) {
 	f.Packets = append(f.Packets, newPacket)
 }
 
-// AddPacket to TCP Flow
-func (f *TCPFlow) AddPacket(packetInfo PacketInformation) {
+// AddPacket to TCP Flow. The timeout of the flow is updated according to timeouts (and the timeout profile of the flow).
+func (f *TCPFlow) AddPacket(packetInfo PacketInformation, timeouts *Timeouts) {
 	f.Flow.addPacket(packetInfo) // super method
 	f.TCPPacket = append(f.TCPPacket, TCPPacket{
 		SeqNr: packetInfo.TCPSeqNr,
@@ -189,6 +374,7 @@ func (f *TCPFlow) AddPacket(packetInfo PacketInformation) {
 		FIN:   packetInfo.TCPFIN,
 		RST:   packetInfo.TCPRST,
 		SYN:   packetInfo.TCPSYN})
+	f.TCPFlags.add(packetInfo.tcpFlags(), f.Packets[len(f.Packets)-1].FromClient, len(f.Packets) == 1, len(f.Packets) == 1 && f.Fragment == 0)
 	/*if !packetInfo.TCPSYN { // only append if not already appended for SYN as TCPOptionsClient/server
 		if packetInfo.TCPOptions != nil && len(packetInfo.TCPOptions) > 0 {
 			f.TCPOptionsinFlow = append(f.TCPOptionsinFlow, packetInfo.TCPOptions)
@@ -229,15 +415,28 @@ func (f *TCPFlow) AddPacket(packetInfo PacketInformation) {
 		}
 	}
 	*/
+	idle, fin, rst := timeouts.forFlow(&f.Flow)
 	switch {
 	case packetInfo.TCPRST:
 		f.RSTIndex = int32(len(f.Packets) - 1)
-		f.Timeout = packetInfo.Timestamp + TCPRstTimeout
+		f.Timeout = packetInfo.Timestamp + rst
 	case packetInfo.TCPFIN && f.FirstFINIndex == -1:
 		f.FirstFINIndex = int32(len(f.Packets) - 1)
-		f.Timeout = packetInfo.Timestamp + TCPFinTimeout
+		f.Timeout = packetInfo.Timestamp + fin
+	default:
+		f.Timeout = packetInfo.Timestamp + idle
+	}
+}
+
+// TimeoutReason returns the termination reason of the flow if it times out
+func (f *TCPFlow) TimeoutReason() TerminationReason {
+	switch {
+	case f.RSTIndex != -1:
+		return TerminationRST
+	case f.FirstFINIndex != -1:
+		return TerminationFIN
 	default:
-		f.Timeout = packetInfo.Timestamp + TCPTimeout
+		return TerminationIdle
 	}
 }
 
@@ -298,10 +497,10 @@ func (f *TCPFlow) setClientServer(packetInfo PacketInformation) {
 	}
 }
 
-// AddPacket to UDP Flow
-func (f *UDPFlow) AddPacket(packetInfo PacketInformation) {
+// AddPacket to UDP Flow. The timeout of the flow is updated according to timeouts (and the timeout profile of the flow).
+func (f *UDPFlow) AddPacket(packetInfo PacketInformation, timeouts *Timeouts) {
 	f.Flow.addPacket(packetInfo) // super method
-	f.Timeout = packetInfo.Timestamp + UDPTimeout
+	f.Timeout = packetInfo.Timestamp + timeouts.IdleTimeout(&f.Flow)
 }
 
 func (f *UDPFlow) setClientServer(packetInfo PacketInformation) {
@@ -0,0 +1,160 @@
+package flows
+
+// This file contains the timeout profiles, which override the timeouts for some protocols, server ports and server networks.
+// A profile is written as <protocol>[/<port>][@<network>]=<idle>[:<fin>[:<rst>]], e.g.
+//
+//	udp/53=30s
+//	tcp/22@10.0.0.0/8=2h:5s:1s
+//
+// The part before = is the name of the profile, which is recorded for the flows using it.
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeoutProfile is the name of the profile of flows without a matching TimeoutProfile
+const DefaultTimeoutProfile = "default"
+
+// TimeoutProfile overrides the timeouts of the flows of a protocol, server port and server network.
+// If several profiles match a flow, the most specific one is used: profiles with a network take precedence over profiles without,
+// profiles with a port over profiles for all ports. Among equally specific profiles, the first one is used.
+type TimeoutProfile struct {
+	Name     string     // Recorded for the flows using the profile, e.g. udp/53
+	Protocol uint8      // TCP or UDP
+	Port     uint16     // Server port, 0 for all ports
+	Network  *net.IPNet // Network of the server address, nil for all addresses
+	Idle     int64      // Timeout after idle time period, replaces Timeouts.TCP or Timeouts.UDP
+	TCPFin   int64      // Timeout after a FIN is received, 0 to use Timeouts.TCPFin
+	TCPRst   int64      // Timeout after a RST is received, 0 to use Timeouts.TCPRst
+}
+
+// ParseTimeoutProfile parses a profile of the form <protocol>[/<port>][@<network>]=<idle>[:<fin>[:<rst>]]
+func ParseTimeoutProfile(s string) (TimeoutProfile, error) {
+	var profile TimeoutProfile
+	name, timeouts, ok := strings.Cut(strings.TrimSpace(s), "=")
+	if !ok {
+		return profile, fmt.Errorf("timeout profile %s: expected <protocol>[/<port>][@<network>]=<idle>[:<fin>[:<rst>]]", s)
+	}
+	profile.Name = strings.ToLower(name)
+
+	key, network, hasNetwork := strings.Cut(profile.Name, "@")
+	protocol, port, hasPort := strings.Cut(key, "/")
+	switch protocol {
+	case "tcp":
+		profile.Protocol = TCP
+	case "udp":
+		profile.Protocol = UDP
+	default:
+		return profile, fmt.Errorf("timeout profile %s: unknown protocol %s (available: tcp,udp)", s, protocol)
+	}
+	if hasPort {
+		value, err := strconv.ParseUint(port, 10, 16)
+		if err != nil || value == 0 {
+			return profile, fmt.Errorf("timeout profile %s: invalid port %s", s, port)
+		}
+		profile.Port = uint16(value)
+	}
+	if hasNetwork {
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			return profile, fmt.Errorf("timeout profile %s: invalid network %s", s, network)
+		}
+		profile.Network = ipNet
+	}
+
+	values := strings.Split(timeouts, ":")
+	if len(values) > 3 || (len(values) > 1 && profile.Protocol != TCP) {
+		return profile, fmt.Errorf("timeout profile %s: expected <idle> for UDP and <idle>[:<fin>[:<rst>]] for TCP", s)
+	}
+	for i, destination := range []*int64{&profile.Idle, &profile.TCPFin, &profile.TCPRst}[:len(values)] {
+		duration, err := time.ParseDuration(values[i])
+		if err != nil || duration <= 0 {
+			return profile, fmt.Errorf("timeout profile %s: invalid timeout %s, must be a positive duration", s, values[i])
+		}
+		*destination = duration.Nanoseconds()
+	}
+	return profile, nil
+}
+
+// ParseTimeoutProfiles parses each profile, see ParseTimeoutProfile
+func ParseTimeoutProfiles(profiles []string) ([]TimeoutProfile, error) {
+	parsed := make([]TimeoutProfile, 0, len(profiles))
+	for _, s := range profiles {
+		profile, err := ParseTimeoutProfile(s)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, profile)
+	}
+	return parsed, nil
+}
+
+// matches returns whether the profile applies to the flow
+func (p *TimeoutProfile) matches(f *Flow) bool {
+	if p.Protocol != f.Protocol || (p.Port != 0 && p.Port != f.ServerPort) {
+		return false
+	}
+	return p.Network == nil || (len(f.FullServerAddr) > 0 && p.Network.Contains(f.FullServerAddr))
+}
+
+// specificity ranks the profiles matching a flow, the profile with the highest specificity is used
+func (p *TimeoutProfile) specificity() int {
+	specificity := 0
+	if p.Network != nil {
+		specificity += 2
+	}
+	if p.Port != 0 {
+		specificity++
+	}
+	return specificity
+}
+
+// profile returns the most specific profile matching the flow, or nil if the global timeouts apply
+func (t *Timeouts) profile(f *Flow) *TimeoutProfile {
+	var best *TimeoutProfile
+	for i := range t.Profiles {
+		profile := &t.Profiles[i]
+		if profile.matches(f) && (best == nil || profile.specificity() > best.specificity()) {
+			best = profile
+		}
+	}
+	return best
+}
+
+// forFlow returns the idle timeout, the timeout after a FIN and the timeout after a RST of the flow.
+// The profile of the flow is resolved once and stored in Flow.TimeoutProfile.
+func (t *Timeouts) forFlow(f *Flow) (idle, fin, rst int64) {
+	if !f.timeoutProfileResolved {
+		f.timeoutProfile = t.profile(f)
+		f.timeoutProfileResolved = true
+		f.TimeoutProfile = DefaultTimeoutProfile
+		if f.timeoutProfile != nil {
+			f.TimeoutProfile = f.timeoutProfile.Name
+		}
+	}
+
+	idle, fin, rst = t.UDP, t.TCPFin, t.TCPRst
+	if f.Protocol == TCP {
+		idle = t.TCP
+	}
+	if profile := f.timeoutProfile; profile != nil {
+		idle = profile.Idle
+		if profile.TCPFin > 0 {
+			fin = profile.TCPFin
+		}
+		if profile.TCPRst > 0 {
+			rst = profile.TCPRst
+		}
+	}
+	return idle, fin, rst
+}
+
+// IdleTimeout returns the timeout of the flow after idle time period, see TimeoutProfile
+func (t *Timeouts) IdleTimeout(f *Flow) int64 {
+	idle, _, _ := t.forFlow(f)
+	return idle
+}
@@ -0,0 +1,84 @@
+package flows
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseTimeoutProfile(t *testing.T) {
+	tests := []struct {
+		profile  string
+		expected TimeoutProfile // Without the network
+		network  string
+		valid    bool
+	}{
+		{"udp/53=30s", TimeoutProfile{Name: "udp/53", Protocol: UDP, Port: 53, Idle: int64(30 * time.Second)}, "", true},
+		{"TCP=1h", TimeoutProfile{Name: "tcp", Protocol: TCP, Idle: int64(time.Hour)}, "", true},
+		{"tcp/22=2h:5s:1s", TimeoutProfile{Name: "tcp/22", Protocol: TCP, Port: 22, Idle: int64(2 * time.Hour), TCPFin: int64(5 * time.Second), TCPRst: int64(time.Second)}, "", true},
+		{"tcp@10.1.0.0/16=2m:5s", TimeoutProfile{Name: "tcp@10.1.0.0/16", Protocol: TCP, Idle: int64(2 * time.Minute), TCPFin: int64(5 * time.Second)}, "10.1.0.0/16", true},
+		{"udp/53", TimeoutProfile{}, "", false},
+		{"icmp=30s", TimeoutProfile{}, "", false},
+		{"udp/0=30s", TimeoutProfile{}, "", false},
+		{"udp/65536=30s", TimeoutProfile{}, "", false},
+		{"udp@10.0.0.0=30s", TimeoutProfile{}, "", false},
+		{"udp/53=30s:5s", TimeoutProfile{}, "", false},
+		{"tcp=1h:1s:1s:1s", TimeoutProfile{}, "", false},
+		{"tcp=-1s", TimeoutProfile{}, "", false},
+		{"tcp=1h:five", TimeoutProfile{}, "", false},
+	}
+	for _, test := range tests {
+		profile, err := ParseTimeoutProfile(test.profile)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: error is %v, expected valid %v", test.profile, err, test.valid)
+			continue
+		}
+		if !test.valid {
+			continue
+		}
+		network := ""
+		if profile.Network != nil {
+			network = profile.Network.String()
+		}
+		profile.Network = nil
+		if profile != test.expected || network != test.network {
+			t.Errorf("%s: parsed %+v with network %q, expected %+v with network %q", test.profile, profile, network, test.expected, test.network)
+		}
+	}
+}
+
+func TestTimeoutProfileMatching(t *testing.T) {
+	profiles, err := ParseTimeoutProfiles([]string{"tcp=1h", "tcp/22=2h:5s", "tcp@10.0.0.0/8=3h", "tcp/22@10.0.0.0/8=4h:6s:1s", "tcp/22=5h", "udp/53=30s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeouts := Timeouts{TCP: int64(time.Minute), TCPFin: int64(2 * time.Second), TCPRst: int64(3 * time.Second), UDP: int64(10 * time.Second), Profiles: profiles}
+	tests := []struct {
+		name           string
+		protocol       uint8
+		server         string
+		port           uint16
+		profile        string
+		idle, fin, rst time.Duration
+	}{
+		{"protocol", TCP, "192.168.0.1", 80, "tcp", time.Hour, 2 * time.Second, 3 * time.Second},
+		{"port before protocol, first of equal profiles", TCP, "192.168.0.1", 22, "tcp/22", 2 * time.Hour, 5 * time.Second, 3 * time.Second},
+		{"network before port", TCP, "10.1.2.3", 80, "tcp@10.0.0.0/8", 3 * time.Hour, 2 * time.Second, 3 * time.Second},
+		{"network and port", TCP, "10.1.2.3", 22, "tcp/22@10.0.0.0/8", 4 * time.Hour, 6 * time.Second, time.Second},
+		{"unknown server address", TCP, "", 80, "tcp", time.Hour, 2 * time.Second, 3 * time.Second},
+		{"udp port", UDP, "10.1.2.3", 53, "udp/53", 30 * time.Second, 2 * time.Second, 3 * time.Second},
+		{"default", UDP, "10.1.2.3", 123, DefaultTimeoutProfile, 10 * time.Second, 2 * time.Second, 3 * time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := &Flow{Protocol: test.protocol, ServerPort: test.port, FullServerAddr: net.ParseIP(test.server)}
+			idle, fin, rst := timeouts.forFlow(f)
+			if f.TimeoutProfile != test.profile {
+				t.Fatalf("profile is %s, expected %s", f.TimeoutProfile, test.profile)
+			}
+			if idle != int64(test.idle) || fin != int64(test.fin) || rst != int64(test.rst) {
+				t.Fatalf("timeouts are %v:%v:%v, expected %v:%v:%v", time.Duration(idle), time.Duration(fin), time.Duration(rst), test.idle, test.fin, test.rst)
+			}
+		})
+	}
+}
@@ -1,149 +1,317 @@
 package main
 
+// This file contains the command line interface of the analyzer.
+// The analysis itself is implemented by the analyzer package.
+
 import (
-	"github.com/dustin/go-humanize"
-	"github.com/google/gopacket/pcap"
+	"test.com/scale/src/analysis/analyzer"
 	"test.com/scale/src/analysis/flows"
 	flowMetrics "test.com/scale/src/analysis/metrics/flows"
 	standardMetrics "test.com/scale/src/analysis/metrics/standard"
-	"test.com/scale/src/analysis/parser"
-	"test.com/scale/src/analysis/pool"
-	"test.com/scale/src/analysis/reader"
 	"test.com/scale/src/analysis/utils"
 
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"os/signal"
 	"path"
 	"runtime"
 	"runtime/pprof"
-	"time"
+	"strings"
 )
 
-const million = 1000000
-
-const sortingRingBufferSize = 4 * million
-const numParser = 3
-
-// Number of parser channels
-// Must be maximal numParser, but better if lower to balance load between parsers (e.g. half of numParser)
-// If it is too low, the synchronization overhead maybe increases
-const numParserChannel = 1
-
-// Flush every x seconds (relative to packet timestamps, not processing time)
-const flushRate = int64(20 * time.Second)
-const packetStop = 100000 * million
-
-// The two different kinds of metrics one can choose by using the 'flow' flag
-var standardMetric *standardMetrics.Metric
-var flowMetric *flowMetrics.Metric
-
-var defaultTCPTimeout, _ = time.ParseDuration("5m0s")
-var defaultTCPFinTimeout, _ = time.ParseDuration("2s")
-var defaultTCPRstTimeout, _ = time.ParseDuration("1s")
-var defaultUDPTimeout, _ = time.ParseDuration("5m0s")
-var defaultSessionTimeout, _ = time.ParseDuration("10m")
+// defaults contains the default options of the analyzer, which are used as defaults for the flags
+var defaults = analyzer.DefaultOptions()
 
 //var defaultInputString = "./testdata/test.pcapng"
 
 //var defaultInputString = "C:\\Users\\Valentin\\Desktop\\pcaptest\\maiw_full_trace.pcap"
 
-var defaultInputString = "C:\\Users\\Valentin\\Desktop\\pcaptest\\mawi_10mill.pcapng"
+//var defaultInputString = "C:\\Users\\Valentin\\Desktop\\pcaptest\\mawi_10mill.pcapng"
+
+var defaultInputString = ""
 
 var input = flag.String("i", defaultInputString, "Path to .pcapng or .pcapng.gz files or to directory with these files (not in combination with --interface)")
 var interfaceName = flag.String("interface", "", "Interface name to capture packets from (not in combination with -i)")
 var exportDirectory = flag.String("export", "", "Export directory to store the metrics files (Default: metrics)")
-var computeFlowMetrics = flag.Bool("flow", true, "Compute flow metrics instead of default metrics (Default: true)")
+var computeFlowMetrics = flag.Bool("flow", defaults.ComputeFlowMetrics, "Compute flow metrics instead of default metrics (Default: true)")
+var computeStandardMetrics = flag.Bool("standard", defaults.ComputeStandardMetrics, "Compute the standard metrics in the same pass as the flow metrics. Implied by -flow=false (Default: false)")
 var tcpFilter = flag.String("tcpFilter", "0-65535", "Filter TCP ports e.g. 0-1023,8080,8443")
 var tcpDropIncomplete = flag.Bool("tcpDropIncomplete", false, "If set, the analyzer drops all tcp flows without a SYN packet.")
 var dropUnidirectional = flag.Bool("dropUnidirectional", false, "If set, the analyzer will drop all unidirectional traffic. Note, that the reconstruction of TCP flows happens first (if tcpReconstructResponse argument is set).")
 var tcpReconstructResponse = flag.Bool("tcpReconstructResponse", false, "If set, the analyzer will try to reconstruct all unidirectional TCP flows, for which only the the packets from the client to the server were captured.")
 var udpFilter = flag.String("udpFilter", "0-65535", "Filter UDP ports e.g. 0-1023,8080,8443")
-var tcpTimeout = flag.Duration("tcpTimeout", defaultTCPTimeout, "TCP timeout after idle time period")
-var tcpFinTimeout = flag.Duration("tcpFinTimeout", defaultTCPFinTimeout, "TCP timeout after a FIN is received")
-var tcpRstTimeout = flag.Duration("tcpRstTimeout", defaultTCPRstTimeout, "TCP timeout after a RST is received")
-var udpTimeout = flag.Duration("udpTimeout", defaultUDPTimeout, "UDP timeout after idle time period")
-var sessionTimeout = flag.Duration("sessionTimeout", defaultSessionTimeout, "Session timeout after idle time period")
+var tcpTimeout = flag.Duration("tcpTimeout", defaults.TCPTimeout, "TCP timeout after idle time period")
+var tcpFinTimeout = flag.Duration("tcpFinTimeout", defaults.TCPFinTimeout, "TCP timeout after a FIN is received")
+var tcpRstTimeout = flag.Duration("tcpRstTimeout", defaults.TCPRstTimeout, "TCP timeout after a RST is received")
+var udpTimeout = flag.Duration("udpTimeout", defaults.UDPTimeout, "UDP timeout after idle time period")
+var timeoutProfiles = flag.String("timeoutProfiles", "", "Comma separated list of timeout profiles, which override the timeouts for a protocol, server port and server network: <protocol>[/<port>][@<network>]=<idle>[:<fin>[:<rst>]], e.g. udp/53=30s,udp/123=5s,tcp/22@10.0.0.0/8=2h:5s:1s. The most specific profile is used, its name (before =) is recorded as timeoutProfile by the flow metric termination (added automatically) and in the flow information")
+var activeTimeout = flag.Duration("activeTimeout", defaults.ActiveTimeout, "Active timeout of the flow metrics: flows open for longer are exported as several records (fragments), each covering the packets since the previous record. Adds the flow metric fragment (Default: 0 (disabled))")
+var sessionTimeout = flag.Duration("sessionTimeout", defaults.SessionTimeout, "Session timeout after idle time period")
 var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to `file`")
 var memprofile = flag.String("memprofile", "", "write memory profile to `file`")
 var blockprofile = flag.String("blockprofile", "", "write block profile to `file`")
-var samplingrate = flag.Float64("sampling", 100, "Sampling rate in percent")
-var samplingrateFlows = flag.Int64("samplingFlows", 0, "Sampling rate for flow rate metric in ms. (Default: 0 (average over entire flow))")
+var samplingrate = flag.Float64("sampling", defaults.SamplingRate, "Sampling rate in percent")
+var samplingrateFlows = flag.Int64("samplingFlows", defaults.SamplingRateFlows, "Sampling rate for flow rate metric in ms. (Default: 0 (average over entire flow))")
+var communityIDSeed = flag.Uint("communityIDSeed", uint(defaults.CommunityIDSeed), "Seed of the Community ID of the flows (0-65535). Must match the seed of the tools whose records are correlated with the flows (Default: 0)")
 var infoDirectory = flag.String("infoDirectory", "", "If a path is specified, the analyzer will output two files for each protocol containing basic rrp, flow, session and user information")
 var clusterModelDirectory = flag.String("clusterModelDirectory", "", "If a path is specified, the analyzer will load the clustering models from this path. The models will be used for clustering.")
+var standardMetricNames = flag.String("standardMetrics", strings.Join(standardMetrics.MetricNames(), ","), "Comma separated list of the standard metrics which are computed and exported. Metrics required by other metrics or the clustering are enabled automatically (Default: all)")
+var disabledStandardMetricNames = flag.String("disableStandardMetrics", "", "Comma separated list of standard metrics which are not computed, e.g. to save memory and runtime")
+var truncatedFlows = flag.String("truncatedFlows", defaults.TruncatedFlows, "How the standard metrics handle flows truncated by the start or end of the trace (first TCP packet no SYN, first UDP packet within the UDP timeout after the start, or still open at the end): include, exclude or separate (exported to the subdirectory truncated) (Default: include)")
 var statisticTCPReconstruction = flag.Bool("statisticTCPReconstruction", false, "If set, the analyzer will include statistics about the reconstruction in the metric file. This includes sizes of the reconstructed packets as well as speed.")
+var flowMetricNames = flag.String("flowMetrics", strings.Join(defaults.FlowMetrics, ","), "Comma separated list of the flow metrics which are computed and exported (available: "+strings.Join(flowMetrics.RegisteredMetrics(), ",")+")")
 var computeFlowRRPs = flag.Bool("flowRRPs", false, "If set, the analyzer will compute the size of rrps during the flow based analysis.")
-var exportBufferSize = flag.Uint("exportBufferSize", 20000, "Specified how many serialized flow metrics can be buffered before being written to the flow metrics json file.")
+var exportBufferSize = flag.Uint("exportBufferSize", defaults.ExportBufferSize, "Specified how many serialized flow metrics can be buffered before being written to the flow metrics json file.")
+var flowFormats = flag.String("flowFormat", strings.Join(defaults.FlowFormats, ","), "Comma separated list of the output formats of the flow metrics: json (flow_metrics.json), parquet (flow_metrics.parquet), csv (flow_metrics.csv), tsv (flow_metrics.tsv), protobuf (flow_metrics.pb), elasticsearch (bulk API, see -esURL) stream (served to subscribers, see -streamListen and -streamGRPC), zeek (conn.log of Zeek), zeekjson (conn.json, the conn.log of Zeek as JSON) and eve (eve.json, flow events of Suricata) (Default: json)")
+var flowCompression = flag.String("flowCompression", defaults.JSON.Compression, "Compression of the json output of the flow metrics: none, gzip or zstd. If set, the flows are written to flow_metrics-<start>-<seq>.json.gz or .json.zst")
+var flowRotateSize = flag.Int64("flowRotateSize", defaults.JSON.RotateSize/mebibyte, "Start a new json file of the flow metrics once the current file has this size in MiB (Default: 0 (no rotation by size))")
+var flowRotateInterval = flag.Duration("flowRotateInterval", defaults.JSON.RotateInterval, "Start a new json file of the flow metrics after this time (Default: 0 (no rotation by time))")
+var flowRotateFlows = flag.Int64("flowRotateFlows", defaults.JSON.RotateFlows, "Start a new json file of the flow metrics after this number of flows (Default: 0 (no rotation by flows))")
+var parquetRowGroupSize = flag.Int64("parquetRowGroupSize", defaults.Parquet.RowGroupSize/mebibyte, "Size of the row groups of the parquet output in MiB")
+var parquetCompression = flag.String("parquetCompression", defaults.Parquet.Compression, "Compression of the parquet output (available: "+strings.Join(flowMetrics.ParquetCompressions(), ",")+")")
+var csvArrays = flag.String("csvArrays", defaults.CSV.Arrays, "How the arrays (flowRates, rrps) are written to the csv and tsv output: summary (count, mean and max columns) or cell (json array in one cell)")
+var esURL = flag.String("esURL", defaults.Elasticsearch.URL, "Base URL of the elasticsearch cluster the flow metrics are sent to")
+var esIndex = flag.String("esIndex", defaults.Elasticsearch.Index, "Elasticsearch index of the flow metrics. {date} is replaced by the day the flow started (UTC, YYYY.MM.DD)")
+var esBatchSize = flag.Int("esBatchSize", defaults.Elasticsearch.BatchSize, "Maximal number of flow metrics per elasticsearch bulk request")
+var esFlushInterval = flag.Duration("esFlushInterval", defaults.Elasticsearch.FlushInterval, "Send a bulk request to elasticsearch after this time, even if the batch is not full (0: only full batches are sent)")
+var esQueueSize = flag.Int("esQueueSize", defaults.Elasticsearch.QueueSize, "Number of batches which can wait to be sent to elasticsearch. Afterwards, the analysis waits for elasticsearch instead of dropping flows")
+var esMaxRetries = flag.Int("esMaxRetries", defaults.Elasticsearch.MaxRetries, "Maximal number of retries of a failed elasticsearch bulk request")
+var esRetryBackoff = flag.Duration("esRetryBackoff", defaults.Elasticsearch.RetryBackoff, "Wait before the first retry of an elasticsearch bulk request, doubled for each further retry")
+var esTimeout = flag.Duration("esTimeout", defaults.Elasticsearch.Timeout, "Timeout of an elasticsearch bulk request (0: no timeout)")
+var streamListen = flag.String("streamListen", defaults.Stream.Listen, "Serve the flow metrics as newline-delimited json to the clients connecting to tcp://host:port or unix:///path")
+var streamGRPC = flag.String("streamGRPC", defaults.Stream.GRPCListen, "Serve the flow metrics with the gRPC service FlowStream (src/clustering/dataformat/FlowStream.proto) on host:port")
+var streamBufferSize = flag.Int("streamBufferSize", defaults.Stream.BufferSize, "Number of flow metrics buffered per stream subscriber. If the buffer is full, further flows are dropped for this subscriber")
+var readerThreads = flag.Int("readerThreads", defaults.ReaderThreads, "Number of goroutines which copy packets of uncompressed pcap files in parallel. If 0, a single goroutine reads the packets (Default: 0)")
+var carryOverLoad = flag.String("carryOverLoad", "", "If a path is specified, the analyzer preloads the open flows and sessions stored by a previous run with -carryOverSave.")
+var carryOverSave = flag.String("carryOverSave", "", "If a path is specified, the analyzer does not flush flows and sessions which are still open at the end of the run, but stores them to this file.")
+var numParser = flag.Int("numParser", defaults.NumParser, "Number of parser goroutines (Default: derived from the number of CPUs)")
+var numParserChannel = flag.Int("numParserChannel", defaults.NumParserChannel, "Number of parser channels. Must be maximal numParser, but better if lower to balance load between parsers (e.g. half of numParser). If it is too low, the synchronization overhead maybe increases (Default: half of numParser)")
+var parserBatchSize = flag.Int("parserBatchSize", defaults.ParserBatchSize, "Number of packets which are sent to the parsers at once")
+var sortingRingBufferSize = flag.Int64("sortingRingBufferSize", defaults.SortingRingBufferSize, "Maximal number of parsed packets which can wait to be sorted. Must be larger than parserBatchSize (Default: derived from the available memory)")
+var numFlowThreads = flag.Int("numFlowThreads", defaults.NumFlowThreads, "Number of pools. Each pool uses two goroutines (TCP & UDP) to add packets to flows (Default: derived from the number of CPUs)")
+var addPacketChannelSize = flag.Int("addPacketChannelSize", defaults.AddPacketChannelSize, "Number of batches which can wait in the channels to each pool")
+var packetInformationCacheSize = flag.Int("packetInformationCacheSize", defaults.PacketInformationCacheSize, "Number of packets which are sent to a pool at once")
+var configFile = flag.String("config", "", "Path to a YAML configuration file. Flags override the values of the configuration file.")
+var maxProcs = flag.Int("maxProcs", 0, "Maximal number of CPUs executing simultaneously (GOMAXPROCS). If 0, the Go default (number of CPUs) is used (Default: 0)")
+
+// mebibyte is the unit of the size flags
+const mebibyte = 1024 * 1024
+
+// Exit codes. Invalid flags exit with 2, like flag.Parse does.
+const (
+	exitOK         = 0
+	exitConfig     = 2
+	exitInput      = 3
+	exitProcessing = 4
+	exitExport     = 5
+)
 
-func createMemoryProfile(suffix string) {
-	utils.PrintMemUsage()
-	if *memprofile != "" {
-		f, err := os.Create(suffix + *memprofile)
-		if err != nil {
-			log.Println("could not create memory profile: ", err)
-		}
-		defer f.Close()
-		runtime.GC() // get up-to-date statistics
-		if err := pprof.WriteHeapProfile(f); err != nil {
-			log.Println("could not write memory profile: ", err)
-		}
+// standardOnlyOptions can only be used if the standard metrics are computed
+var standardOnlyOptions = []string{"standardMetrics", "disableStandardMetrics", "sessionTimeout", "infoDirectory", "clusterModelDirectory", "statisticTCPReconstruction", "truncatedFlows"}
+
+// flowOnlyOptions can only be used if the flow metrics are computed
+var flowOnlyOptions = []string{"activeTimeout", "flowMetrics", "flowRRPs", "samplingFlows", "exportBufferSize", "flowFormat", "flowCompression", "flowRotateSize", "flowRotateInterval", "flowRotateFlows", "parquetRowGroupSize", "parquetCompression", "csvArrays", "esURL", "esIndex", "esBatchSize", "esFlushInterval", "esQueueSize", "esMaxRetries", "esRetryBackoff", "esTimeout", "streamListen", "streamGRPC", "streamBufferSize"}
+
+// CheckFlags will check if the specified flags are valid and resolves the default export directory.
+// Returns all invalid values and combinations, which are not checked by the analyzer itself.
+func checkFlags() (problems []string) {
+	invalid := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
 	}
-}
 
-// CheckFlags will check if the specified flags are valid
-func checkFlags() {
 	if *input == "" && *interfaceName == "" {
-		log.Fatalln("Abort program. Please specify input directoy via -i or an interface.")
+		invalid("Please specify input directoy via -i or an interface.")
 	}
-
 	if *input != "" && *interfaceName != "" {
-		log.Fatalln("Abort program. Please specify either input directoy via -i or an interface, not both!")
+		invalid("Please specify either input directoy via -i or an interface, not both!")
+	}
+	if *input != "" && !utils.FileExists(*input) && !utils.DirectoryExists(*input) {
+		invalid("Input does not exist: %s", *input)
 	}
-
 	if *interfaceName != "" && *exportDirectory == "" {
-		log.Fatalln("Abort program. Please specify a export Directory if you specify an interface to capture traffic from.")
-	} else if *exportDirectory == "" {
+		invalid("Please specify a export Directory if you specify an interface to capture traffic from.")
+	}
+
+	if _, err := utils.ExpandIntegerList(*tcpFilter); err != nil {
+		invalid("tcpFilter is invalid: %v", err)
+	}
+	if _, err := utils.ExpandIntegerList(*udpFilter); err != nil {
+		invalid("udpFilter is invalid: %v", err)
+	}
+	if _, err := flows.ParseTimeoutProfiles(splitList(*timeoutProfiles)); err != nil {
+		invalid("timeoutProfiles is invalid: %v", err)
+	}
+
+	if !standardMetricsEnabled() {
+		for _, option := range standardOnlyOptions {
+			if isSet(option) {
+				invalid("%s can only be used in combination with standard metrics (-flow=false or -standard).", option)
+			}
+		}
+	}
+	if !*computeFlowMetrics {
+		for _, option := range flowOnlyOptions {
+			if isSet(option) {
+				invalid("%s can only be used in combination with flow metrics (-flow).", option)
+			}
+		}
+	}
+	if *communityIDSeed > math.MaxUint16 {
+		invalid("communityIDSeed must not be larger than %d.", math.MaxUint16)
+	}
+	if *maxProcs < 0 {
+		invalid("maxProcs must not be negative.")
+	}
+
+	if *exportDirectory == "" && *input != "" {
 		if utils.FileExists(*input) {
 			*exportDirectory = path.Join(path.Dir(*input), "metrics")
 		} else {
 			*exportDirectory = path.Join(*input, "metrics")
 		}
 	}
+	return problems
+}
 
-	// Create export Directory if it does not exist
-	if !utils.DirectoryExists(*exportDirectory) {
-		utils.CreateDir(*exportDirectory)
-	}
+// standardMetricsEnabled returns whether the standard metrics are computed, either instead of (-flow=false) or in addition to the flow metrics (-standard)
+func standardMetricsEnabled() bool {
+	return *computeStandardMetrics || !*computeFlowMetrics
+}
 
-	if *infoDirectory != "" {
-		if !utils.DirectoryExists(*infoDirectory) {
-			utils.CreateDir(*infoDirectory)
-		}
-	}
+// options returns the options of the analyzer as specified by the flags
+func options() analyzer.Options {
+	opts := defaults
+	opts.TCPFilter, _ = utils.ExpandIntegerList(*tcpFilter)
+	opts.UDPFilter, _ = utils.ExpandIntegerList(*udpFilter)
+	opts.TCPDropIncomplete = *tcpDropIncomplete
+	opts.SamplingRate = *samplingrate
+	opts.TCPTimeout = *tcpTimeout
+	opts.TCPFinTimeout = *tcpFinTimeout
+	opts.TCPRstTimeout = *tcpRstTimeout
+	opts.UDPTimeout = *udpTimeout
+	opts.ActiveTimeout = *activeTimeout
+	opts.TimeoutProfiles, _ = flows.ParseTimeoutProfiles(splitList(*timeoutProfiles))
+
+	opts.ComputeFlowMetrics = *computeFlowMetrics
+	opts.ComputeStandardMetrics = standardMetricsEnabled()
+	opts.ComputeFlowRRPs = *computeFlowRRPs
+	opts.FlowMetrics = splitList(*flowMetricNames)
+	opts.SamplingRateFlows = *samplingrateFlows
+	opts.ExportBufferSize = *exportBufferSize
+	opts.CommunityIDSeed = uint16(*communityIDSeed)
+	opts.SessionTimeout = *sessionTimeout
+	opts.DropUnidirectional = *dropUnidirectional
+	opts.TCPReconstructResponse = *tcpReconstructResponse
+	opts.StatisticTCPReconstruction = *statisticTCPReconstruction
+	opts.TruncatedFlows = *truncatedFlows
+	opts.ClusterModelDirectory = *clusterModelDirectory
+	opts.StandardMetrics = splitList(*standardMetricNames)
+	opts.DisabledStandardMetrics = splitList(*disabledStandardMetricNames)
+
+	opts.ExportDirectory = *exportDirectory
+	opts.InfoDirectory = *infoDirectory
+	opts.FlowFormats = splitList(*flowFormats)
+	opts.JSON.Compression = *flowCompression
+	opts.JSON.RotateSize = *flowRotateSize * mebibyte
+	opts.JSON.RotateInterval = *flowRotateInterval
+	opts.JSON.RotateFlows = *flowRotateFlows
+	opts.Parquet.RowGroupSize = *parquetRowGroupSize * mebibyte
+	opts.Parquet.Compression = *parquetCompression
+	opts.CSV.Arrays = *csvArrays
+	opts.Elasticsearch.URL = *esURL
+	opts.Elasticsearch.Index = *esIndex
+	opts.Elasticsearch.BatchSize = *esBatchSize
+	opts.Elasticsearch.FlushInterval = *esFlushInterval
+	opts.Elasticsearch.QueueSize = *esQueueSize
+	opts.Elasticsearch.MaxRetries = *esMaxRetries
+	opts.Elasticsearch.RetryBackoff = *esRetryBackoff
+	opts.Elasticsearch.Timeout = *esTimeout
+	opts.Stream.Listen = *streamListen
+	opts.Stream.GRPCListen = *streamGRPC
+	opts.Stream.BufferSize = *streamBufferSize
+
+	opts.ReaderThreads = *readerThreads
+	opts.CarryOverLoad = *carryOverLoad
+	opts.CarryOverSave = *carryOverSave
+	opts.MemProfile = *memprofile
+
+	opts.NumParser = *numParser
+	opts.NumParserChannel = *numParserChannel
+	opts.ParserBatchSize = *parserBatchSize
+	opts.SortingRingBufferSize = *sortingRingBufferSize
+	opts.NumFlowThreads = *numFlowThreads
+	opts.AddPacketChannelSize = *addPacketChannelSize
+	opts.PacketInformationCacheSize = *packetInformationCacheSize
+	return opts
+}
 
-	if *statisticTCPReconstruction && !*tcpReconstructResponse {
-		log.Println("statisticTCPReconstruction can only be set in combination with the tcpReconstructResponse flag")
+// splitList returns the elements of a comma separated list, empty elements are skipped
+func splitList(list string) []string {
+	var elements []string
+	for _, element := range strings.Split(list, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			elements = append(elements, element)
+		}
 	}
+	return elements
 }
 
-//print all consts
-func printConsts() {
-	fmt.Println("sortingRingBufferSize", sortingRingBufferSize)
-	fmt.Println("numParser", numParser)
-	fmt.Println("numParserHannel", numParserChannel)
-	fmt.Println("numflowThreads", pool.NumFlowThreads)
-	fmt.Println("AddPacketChannelSize", pool.AddPacketChannelSize)
-	fmt.Println("PacketInformationCacheSize", pool.PacketInformationCacheSize)
-
+// printPipelineSizes prints the sizes of the pipeline
+func printPipelineSizes(opts *analyzer.Options) {
+	fmt.Println("sortingRingBufferSize", opts.SortingRingBufferSize)
+	fmt.Println("numParser", opts.NumParser)
+	fmt.Println("numParserChannel", opts.NumParserChannel)
+	fmt.Println("parserBatchSize", opts.ParserBatchSize)
+	fmt.Println("numFlowThreads", opts.NumFlowThreads)
+	fmt.Println("addPacketChannelSize", opts.AddPacketChannelSize)
+	fmt.Println("packetInformationCacheSize", opts.PacketInformationCacheSize)
+	fmt.Println("GOMAXPROCS", runtime.GOMAXPROCS(0))
 }
 
 func main() {
-	printConsts()
+	os.Exit(run())
+}
+
+// run runs the analyzer and returns the exit code
+func run() int {
 	flag.Parse()
+	recordSetFlags()
+	if err := applyConfigFile(*configFile); err != nil {
+		log.Println("Abort program. Could not load configuration file:", err)
+		return exitConfig
+	}
 
-	checkFlags()
-	runtime.GOMAXPROCS(35)
+	problems := checkFlags()
+	a, err := analyzer.New(options())
+	if err != nil {
+		problems = append(problems, errors.Unwrap(err).Error())
+	}
+	if len(problems) > 0 {
+		log.Println("Abort program. Invalid configuration:\n\t" + strings.Join(problems, "\n\t"))
+		return exitConfig
+	}
+
+	// Create export Directory if it does not exist
+	if !utils.DirectoryExists(*exportDirectory) {
+		if err := utils.CreateDir(*exportDirectory); err != nil {
+			log.Println("Abort program.", err)
+			return exitExport
+		}
+	}
+	if err := writeResolvedConfig(path.Join(*exportDirectory, resolvedConfigFilename)); err != nil {
+		log.Println("Abort program. Could not write configuration:", err)
+		return exitExport
+	}
+	if *maxProcs > 0 {
+		runtime.GOMAXPROCS(*maxProcs)
+	}
+	opts := a.Options()
+	printPipelineSizes(&opts)
 
 	if *cpuprofile != "" {
 		log.Println("Create CPU Profile")
@@ -174,94 +342,42 @@ func main() {
 		}()
 	}
 
-	startTime := time.Now()
-
-	// Initialize Pool
-	flows.TCPTimeout = tcpTimeout.Nanoseconds()
-	flows.TCPRstTimeout = tcpRstTimeout.Nanoseconds()
-	flows.TCPFinTimeout = tcpFinTimeout.Nanoseconds()
-	flows.UDPTimeout = udpTimeout.Nanoseconds()
-	pools := pool.NewPools(utils.ExpandIntegerList(*tcpFilter), utils.ExpandIntegerList(*udpFilter), *tcpDropIncomplete)
-
-	// Initialize Parser
-	packetParser := parser.NewParser(pools, sortingRingBufferSize, numParser, *samplingrate, numParserChannel)
-
-	// Initialize Metrics
-	if *computeFlowMetrics {
-		flowMetric = flowMetrics.NewMetric(*samplingrateFlows, *computeFlowRRPs, *exportBufferSize)
-		pools.RegisterMetric(flowMetric)
-		go flowMetric.ExportRoutine(*exportDirectory)
-	} else {
-		standardMetric = standardMetrics.NewMetric(
-			sessionTimeout.Nanoseconds(), *infoDirectory,
-			*clusterModelDirectory, *dropUnidirectional,
-			*tcpReconstructResponse, *statisticTCPReconstruction,
-		)
-		pools.RegisterMetric(standardMetric)
-	}
-
-	// Initialize Reader
-	var packetReader = reader.NewPacketReader(pools, packetParser)
-
+	var source analyzer.Source
 	if *input != "" {
-		for _, pcapFile := range utils.GetPcapFiles(*input) {
-			fmt.Println("Read file: ", pcapFile)
-			fmt.Println("Already read", humanize.Comma(packetReader.PacketIdx), "packets")
-
-			packetDataSource, ioHandle, deleteFile, fileName := reader.ReadPcapFile(pcapFile)
-			packetStopReached := packetReader.Read(packetStop, flushRate, packetDataSource)
-
-			// Delete uncompressed filed
-			if deleteFile {
-				_ = os.Remove(fileName)
-			}
-			_ = ioHandle.Close()
-			if packetStopReached {
-				break
-			}
-		}
+		source = analyzer.FileSource(*input)
 	} else {
-		handle, err := pcap.OpenLive(*interfaceName, 152200, true, pcap.BlockForever)
-		if err != nil {
-			panic(err)
-		}
-		packetReader.Read(packetStop, flushRate, handle)
-		handle.Close()
+		source = analyzer.InterfaceSource(*interfaceName)
 	}
-
-	createMemoryProfile("PacketStop")
-	secondsAnalyzed := float64(packetReader.LastPacketTimestamp-packetReader.FirstPacketTimestamp) / float64(time.Second)
-	fmt.Println("Analyzed\t\t\t", humanize.CommafWithDigits(secondsAnalyzed, 2), "seconds of traffic")
-
-	packetParser.Close()
-	fmt.Println("Decoded\t\t\t\t", humanize.Comma(packetReader.PacketIdx), "packets")
-	fmt.Println("Time until Parsing Completed:\t", time.Since(startTime))
-	pools.PrintStatistics()
-
-	pools.Close()
-	fmt.Println("Time until Pool Closed:\t\t", time.Since(startTime))
-
-	if !*computeFlowMetrics {
-		standardMetric.ForceFlush()
-		createMemoryProfile("MetricFlush")
-		fmt.Println("Time until Metric flushed:\t", time.Since(startTime))
-
-		standardMetric.MetricSize.PrintStatistic(false)
-		standardMetric.MetricNumRRPairs.PrintStatistic(false)
-		standardMetric.MetricInterRequest.PrintStatistic(false)
-		standardMetric.MetricNumSessions.PrintStatistic(false)
-		standardMetric.MetricInterSessions.PrintStatistic(false)
-		standardMetric.MetricNumFlows.PrintStatistic(false)
-		standardMetric.MetricInterFlowTimes.PrintStatistic(false)
-		standardMetric.ReqResIdentifier.PrintStatistic(false)
+	// Stop reading on interrupt, the packets read so far are still analyzed and exported
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	_, err = a.Run(ctx, source)
+	var analyzerErr *analyzer.Error
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &analyzerErr):
+		log.Println("Analysis failed:", err)
+		return exitCode(analyzerErr.Kind)
+	case errors.Is(err, context.Canceled):
+		log.Println("Analysis interrupted, the packets read so far have been exported.")
+		return exitOK
+	default:
+		log.Println("Analysis failed:", err)
+		return exitProcessing
 	}
+}
 
-	if *computeFlowMetrics {
-		flowMetric.Flush()
-		flowMetric.Wait()
-	} else {
-		fmt.Println("Time until export start:", time.Since(startTime))
-		standardMetric.Export(*exportDirectory)
-		fmt.Println("Time until export finished:", time.Since(startTime))
+// exitCode returns the exit code of an error kind
+func exitCode(kind analyzer.ErrorKind) int {
+	switch kind {
+	case analyzer.ConfigError:
+		return exitConfig
+	case analyzer.InputError:
+		return exitInput
+	case analyzer.ExportError:
+		return exitExport
+	default:
+		return exitProcessing
 	}
 }
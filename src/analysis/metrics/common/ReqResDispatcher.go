@@ -0,0 +1,48 @@
+package common
+
+// Allows several metrics to share the identification of request/response pairs.
+
+import (
+	"test.com/scale/src/analysis/flows"
+)
+
+// ReqResMetric is a metric which processes flows together with their request/response pairs.
+type ReqResMetric interface {
+	OnTCPReqRes(protocol Protocol, flow *flows.TCPFlow, reqRes []*RequestResponse)
+	OnUDPReqRes(protocol Protocol, flow *flows.UDPFlow, reqRes []*RequestResponse)
+}
+
+// ReqResDispatcher identifies the request/response pairs of each flushed flow once and hands them to all its metrics.
+// It must be registered by the pools instead of the metrics.
+// Flows which are dropped by the ReqResIdentifier are not handed to the metrics.
+type ReqResDispatcher struct {
+	identifier *ReqResIdentifier
+	metrics    []ReqResMetric
+}
+
+// NewReqResDispatcher creates a new ReqResDispatcher. The metrics are called in the given order.
+func NewReqResDispatcher(identifier *ReqResIdentifier, metrics ...ReqResMetric) *ReqResDispatcher {
+	return &ReqResDispatcher{identifier: identifier, metrics: metrics}
+}
+
+func (d *ReqResDispatcher) OnTCPFlush(flow *flows.TCPFlow) {
+	var protocol = GetProtocol(&flow.Flow)
+	reqRes, dropFlow := d.identifier.OnTCPFlush(protocol, flow)
+	if dropFlow {
+		return
+	}
+	for _, metric := range d.metrics {
+		metric.OnTCPReqRes(protocol, flow, reqRes)
+	}
+}
+
+func (d *ReqResDispatcher) OnUDPFlush(flow *flows.UDPFlow) {
+	var protocol = GetProtocol(&flow.Flow)
+	reqRes, dropFlow := d.identifier.OnUDPFlush(protocol, flow)
+	if dropFlow {
+		return
+	}
+	for _, metric := range d.metrics {
+		metric.OnUDPReqRes(protocol, flow, reqRes)
+	}
+}
@@ -2,7 +2,7 @@ package common
 
 import (
 	"encoding/binary"
-	"log"
+	"fmt"
 	"strconv"
 	"strings"
 	"test.com/scale/src/analysis/flows"
@@ -13,8 +13,13 @@ import (
 // ProtocolKeyType is the hashed interpretation of an application protocol (TCP/UDP + Port)
 type ProtocolKeyType uint64
 
-func GetProtocolKey(protocolString string) ProtocolKeyType {
+// GetProtocolKey returns the key of a protocol string (e.g. tcp_80).
+// Returns an error if the protocol string is not well formatted.
+func GetProtocolKey(protocolString string) (ProtocolKeyType, error) {
 	splits := strings.SplitN(protocolString, "_", 2)
+	if len(splits) != 2 {
+		return 0, fmt.Errorf("protocolString is not well formatted: %s", protocolString)
+	}
 
 	var protocol uint8
 	switch strings.ToLower(splits[0]) {
@@ -22,18 +27,20 @@ func GetProtocolKey(protocolString string) ProtocolKeyType {
 		protocol = flows.TCP
 	case "udp":
 		protocol = flows.UDP
+	default:
+		return 0, fmt.Errorf("protocolString has an unknown protocol: %s", protocolString)
 	}
 
 	port, err := strconv.ParseUint(splits[1], 10, 16)
 	if err != nil {
-		log.Fatalln("protocolString is not well formatted", protocolString)
+		return 0, fmt.Errorf("protocolString is not well formatted: %s", protocolString)
 	}
 	var serverPort = uint16(port)
 
 	var bytesBuffer = make([]byte, 3)
 	binary.LittleEndian.PutUint16(bytesBuffer[0:2], serverPort)
 	bytesBuffer[2] = protocol
-	return ProtocolKeyType(xxhash.Sum64(bytesBuffer))
+	return ProtocolKeyType(xxhash.Sum64(bytesBuffer)), nil
 }
 
 func GetProtocol(flow *flows.Flow) Protocol {
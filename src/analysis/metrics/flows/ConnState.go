@@ -0,0 +1,182 @@
+package flows
+
+import (
+	"test.com/scale/src/analysis/flows"
+)
+
+func init() {
+	RegisterMetric("connState", func(config MetricConfig) FlowMetric {
+		return newMetricConnState()
+	})
+}
+
+// MetricConnState derives the state and the history of a connection like the conn.log of Zeek.
+// The client is the originator, the server the responder of the connection.
+type MetricConnState struct{}
+
+func newMetricConnState() *MetricConnState {
+	return &MetricConnState{}
+}
+
+// Letters of the history, upper case for the originator and lower case for the responder.
+// Each letter is recorded once per direction, in the order the packets were seen.
+const (
+	historySYN     = 's' // SYN without ACK
+	historySYNACK  = 'h' // SYN with ACK
+	historyACK     = 'a' // Pure ACK
+	historyPayload = 'd' // Packet with payload
+	historyFIN     = 'f' // FIN
+	historyRST     = 'r' // RST
+)
+
+// connHistory records the letters of the history
+type connHistory struct {
+	history []byte
+	seen    [2][128]bool // Letters seen per direction (0: responder, 1: originator)
+}
+
+// add records the letter, if it was not seen in this direction before
+func (h *connHistory) add(letter byte, fromClient bool) {
+	direction := 0
+	if fromClient {
+		direction = 1
+		letter -= 'a' - 'A'
+	}
+	if h.seen[direction][letter] {
+		return
+	}
+	h.seen[direction][letter] = true
+	h.history = append(h.history, letter)
+}
+
+func (h *connHistory) has(letter byte) bool {
+	return h.seen[0][letter] || h.seen[1][letter-('a'-'A')]
+}
+
+func (h *connHistory) hasFromClient(letter byte) bool {
+	return h.seen[1][letter-('a'-'A')]
+}
+
+func (h *connHistory) hasFromServer(letter byte) bool {
+	return h.seen[0][letter]
+}
+
+func (mc *MetricConnState) calcTCP(flow *flows.TCPFlow) ValueConnState {
+	var history connHistory
+	firstRSTFromClient := false
+	for i, p := range flow.TCPPacket {
+		fromClient := flow.Packets[i].FromClient
+		switch {
+		case p.SYN && p.ACK:
+			history.add(historySYNACK, fromClient)
+		case p.SYN:
+			history.add(historySYN, fromClient)
+		case p.ACK && !p.FIN && !p.RST && flow.Packets[i].LengthPayload == 0:
+			history.add(historyACK, fromClient)
+		}
+		if flow.Packets[i].LengthPayload > 0 {
+			history.add(historyPayload, fromClient)
+		}
+		if p.FIN {
+			history.add(historyFIN, fromClient)
+		}
+		if p.RST {
+			if !history.has(historyRST) {
+				firstRSTFromClient = fromClient
+			}
+			history.add(historyRST, fromClient)
+		}
+	}
+
+	clientSYN := history.hasFromClient(historySYN)
+	serverSYNACK := history.hasFromServer(historySYNACK)
+	var state string
+	switch {
+	case !clientSYN && !serverSYNACK:
+		// Midstream traffic
+		state = "OTH"
+	case !serverSYNACK:
+		// Connection attempt without answer of the responder
+		switch {
+		case history.hasFromServer(historyRST):
+			state = "REJ"
+		case history.hasFromClient(historyRST):
+			state = "RSTOS0"
+		case history.hasFromClient(historyFIN):
+			state = "SH"
+		default:
+			state = "S0"
+		}
+	case !clientSYN:
+		// SYN ACK of the responder without SYN of the originator
+		switch {
+		case history.hasFromServer(historyRST):
+			state = "RSTRH"
+		case history.hasFromServer(historyFIN):
+			state = "SHR"
+		default:
+			state = "OTH"
+		}
+	case history.has(historyRST):
+		if firstRSTFromClient {
+			state = "RSTO"
+		} else {
+			state = "RSTR"
+		}
+	case history.hasFromClient(historyFIN) && history.hasFromServer(historyFIN):
+		state = "SF"
+	case history.hasFromClient(historyFIN):
+		state = "S2"
+	case history.hasFromServer(historyFIN):
+		state = "S3"
+	default:
+		state = "S1"
+	}
+	return ValueConnState{connState: state, history: string(history.history)}
+}
+
+func (mc *MetricConnState) calcUDP(flow *flows.Flow) ValueConnState {
+	var history connHistory
+	for _, p := range flow.Packets {
+		if p.LengthPayload > 0 {
+			history.add(historyPayload, p.FromClient)
+		}
+	}
+
+	var state string
+	switch {
+	case history.hasFromClient(historyPayload) && history.hasFromServer(historyPayload):
+		state = "SF"
+	case history.hasFromClient(historyPayload):
+		state = "S0"
+	case history.hasFromServer(historyPayload):
+		state = "SHR"
+	default:
+		state = "OTH"
+	}
+	return ValueConnState{connState: state, history: string(history.history)}
+}
+
+// OnFlush is called for UDP flows
+func (mc *MetricConnState) OnFlush(flow *flows.Flow, record *FlowRecord) {
+	value := mc.calcUDP(flow)
+	value.setFields(record)
+}
+
+func (mc *MetricConnState) OnTCPFlush(flow *flows.TCPFlow, record *FlowRecord) {
+	value := mc.calcTCP(flow)
+	value.setFields(record)
+}
+
+type ValueConnState struct {
+	// State of the connection as conn_state of Zeek, e.g. SF for a normal establishment and termination.
+	connState string
+	// Letters of the packets as history of Zeek, e.g. ShADadFf.
+	history string
+}
+
+func (vc ValueConnState) setFields(record *FlowRecord) {
+	record.HasConnState = true
+	record.ConnState = vc.connState
+	record.History = vc.history
+}
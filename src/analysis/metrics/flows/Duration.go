@@ -4,6 +4,12 @@ import (
 	"test.com/scale/src/analysis/flows"
 )
 
+func init() {
+	RegisterMetric("duration", func(config MetricConfig) FlowMetric {
+		return newMetricFlowDuration()
+	})
+}
+
 type MetricFlowDuration struct{}
 
 func newMetricFlowDuration() *MetricFlowDuration {
@@ -23,9 +29,9 @@ func (mfd *MetricFlowDuration) calc(flow *flows.Flow) ValueFlowDuration {
 	}
 }
 
-func (mfd *MetricFlowDuration) onFlush(flow *flows.Flow) ExportableValue {
+func (mfd *MetricFlowDuration) OnFlush(flow *flows.Flow, record *FlowRecord) {
 	value := mfd.calc(flow)
-	return value
+	value.setFields(record)
 }
 
 type ValueFlowDuration struct {
@@ -37,10 +43,9 @@ type ValueFlowDuration struct {
 	duration int64
 }
 
-func (vfd ValueFlowDuration) export() map[string]interface{} {
-	return map[string]interface{}{
-		"start":    vfd.start,
-		"end":      vfd.end,
-		"duration": vfd.duration,
-	}
+func (vfd ValueFlowDuration) setFields(record *FlowRecord) {
+	record.HasDuration = true
+	record.Start = vfd.start
+	record.End = vfd.end
+	record.Duration = vfd.duration
 }
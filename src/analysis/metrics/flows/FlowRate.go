@@ -5,6 +5,14 @@ import (
 	"time"
 )
 
+func init() {
+	RegisterMetric("rate", func(config MetricConfig) FlowMetric {
+		metricFlowRate := newMetricFlowRate()
+		metricFlowRate.samplingRate = config.SamplingRate
+		return metricFlowRate
+	})
+}
+
 type MetricFlowRate struct {
 	// Sampling rate in milliseconds. If equal to zero the
 	// average over the entirety of the flow will be calculated.
@@ -114,7 +122,7 @@ func (mfr *MetricFlowRate) calcAverage(flow *flows.Flow) ValueFlowRate {
 	}
 }
 
-func (mfr *MetricFlowRate) onFlush(flow *flows.Flow) ExportableValue {
+func (mfr *MetricFlowRate) OnFlush(flow *flows.Flow, record *FlowRecord) {
 	var value ValueFlowRate
 	if mfr.samplingRate == 0 {
 		value = mfr.calcAverage(flow)
@@ -122,7 +130,7 @@ func (mfr *MetricFlowRate) onFlush(flow *flows.Flow) ExportableValue {
 		value = mfr.calc(flow)
 	}
 
-	return value
+	value.setFields(record)
 }
 
 type ValueFlowRate struct {
@@ -134,10 +142,9 @@ type ValueFlowRate struct {
 	flowRatesServer []uint
 }
 
-func (vfr ValueFlowRate) export() map[string]interface{} {
-	return map[string]interface{}{
-		"flowRates":       vfr.flowRates,
-		"flowRatesClient": vfr.flowRatesClient,
-		"flowRatesServer": vfr.flowRatesServer,
-	}
+func (vfr ValueFlowRate) setFields(record *FlowRecord) {
+	record.HasRates = true
+	record.FlowRates = vfr.flowRates
+	record.FlowRatesClient = vfr.flowRatesClient
+	record.FlowRatesServer = vfr.flowRatesServer
 }
@@ -4,6 +4,12 @@ import (
 	"test.com/scale/src/analysis/flows"
 )
 
+func init() {
+	RegisterMetric("size", func(config MetricConfig) FlowMetric {
+		return newMetricFlowSize()
+	})
+}
+
 type MetricFlowSize struct{}
 
 func newMetricFlowSize() *MetricFlowSize {
@@ -33,9 +39,9 @@ func (mfs *MetricFlowSize) calc(flow *flows.Flow) (value ValueFlowSize) {
 	}
 }
 
-func (mfs *MetricFlowSize) onFlush(flow *flows.Flow) ExportableValue {
+func (mfs *MetricFlowSize) OnFlush(flow *flows.Flow, record *FlowRecord) {
 	value := mfs.calc(flow)
-	return value
+	value.setFields(record)
 }
 
 type ValueFlowSize struct {
@@ -47,10 +53,9 @@ type ValueFlowSize struct {
 	sizeServer uint
 }
 
-func (vfs ValueFlowSize) export() map[string]interface{} {
-	return map[string]interface{}{
-		"size":       vfs.size,
-		"sizeClient": vfs.sizeClient,
-		"sizeServer": vfs.sizeServer,
-	}
+func (vfs ValueFlowSize) setFields(record *FlowRecord) {
+	record.HasSize = true
+	record.Size = vfs.size
+	record.SizeClient = vfs.sizeClient
+	record.SizeServer = vfs.sizeServer
 }
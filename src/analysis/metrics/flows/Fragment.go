@@ -0,0 +1,37 @@
+package flows
+
+import (
+	"test.com/scale/src/analysis/flows"
+)
+
+func init() {
+	RegisterMetric("fragment", func(config MetricConfig) FlowMetric {
+		return newMetricFragment()
+	})
+}
+
+// MetricFragment exports which record of the flow this is. Flows open for longer than the active timeout
+// are flushed as several records (fragments), each covering the packets since the previous record.
+type MetricFragment struct{}
+
+func newMetricFragment() *MetricFragment {
+	return &MetricFragment{}
+}
+
+func (mf *MetricFragment) OnFlush(flow *flows.Flow, record *FlowRecord) {
+	value := ValueFragment{fragment: flow.Fragment, lastFragment: flow.IsLastFragment()}
+	value.setFields(record)
+}
+
+type ValueFragment struct {
+	// Sequence number of the record of the flow, starting at 0.
+	fragment uint32
+	// Whether this is the last record of the flow. False for an interim record, even if no packets follow.
+	lastFragment bool
+}
+
+func (vf ValueFragment) setFields(record *FlowRecord) {
+	record.HasFragment = true
+	record.Fragment = vf.fragment
+	record.LastFragment = vf.lastFragment
+}
@@ -1,75 +1,179 @@
 package flows
 
 import (
-	"encoding/json"
 	"fmt"
-	"github.com/dustin/go-humanize"
-	"os"
-	"path"
+	"strings"
 	"sync"
 	"test.com/scale/src/analysis/flows"
 	"test.com/scale/src/analysis/metrics/common"
-	"time"
 )
 
-type Metric struct {
-	computeRRPs  bool
-	rrIdentifier *common.ReqResIdentifier
+// Output formats of the flow metrics
+const (
+	FormatJSON          = "json"          // flow_metrics.json, one JSON object per line
+	FormatParquet       = "parquet"       // flow_metrics.parquet, see ParquetConfig
+	FormatCSV           = "csv"           // flow_metrics.csv, see CSVConfig
+	FormatTSV           = "tsv"           // flow_metrics.tsv, like CSV but separated by tabs
+	FormatProtobuf      = "protobuf"      // flow_metrics.pb, length-delimited dataformat.FlowRecord messages
+	FormatElasticsearch = "elasticsearch" // Bulk API of Elasticsearch, see ElasticsearchConfig
+	FormatStream        = "stream"        // Served to subscribers as soon as the flows are flushed, see StreamConfig
+	FormatZeek          = "zeek"          // conn.log, tab separated like the conn.log of Zeek
+	FormatZeekJSON      = "zeekjson"      // conn.json, the conn.log of Zeek with one JSON object per line
+	FormatEVE           = "eve"           // eve.json, flow events like the EVE JSON output of Suricata
+)
 
-	exportChannel chan *string
-	doneChannel   chan bool
+// Formats contains all output formats
+var Formats = []string{FormatJSON, FormatParquet, FormatCSV, FormatTSV, FormatProtobuf, FormatElasticsearch, FormatStream,
+	FormatZeek, FormatZeekJSON, FormatEVE}
 
-	metrics   []registrableMetric
-	rrMetrics []registrableRRMetric
+// formatMetrics are the metrics required by the fields of a format, they are added to the selected metrics
+var formatMetrics = map[string][]string{
+	FormatZeek:     zeekMetrics,
+	FormatZeekJSON: zeekMetrics,
+	FormatEVE:      eveMetrics,
 }
 
-type ExportableValue interface {
-	export() map[string]interface{}
+// ExportConfig configures the output of the flow metrics
+type ExportConfig struct {
+	BufferSize    uint     // Number of flows which can be buffered per format before being written
+	Formats       []string // Output formats, see Formats
+	JSON          JSONConfig
+	Parquet       ParquetConfig
+	CSV           CSVConfig // Used by the CSV and TSV output
+	Elasticsearch ElasticsearchConfig
+	Stream        StreamConfig
 }
 
-type registrableMetric interface {
-	onFlush(flow *flows.Flow) ExportableValue
+// DefaultExportConfig returns the default output (a single uncompressed JSON file)
+func DefaultExportConfig() ExportConfig {
+	return ExportConfig{
+		BufferSize:    20000,
+		Formats:       []string{FormatJSON},
+		JSON:          DefaultJSONConfig(),
+		Parquet:       DefaultParquetConfig(),
+		CSV:           DefaultCSVConfig(),
+		Elasticsearch: DefaultElasticsearchConfig(),
+		Stream:        DefaultStreamConfig(),
+	}
+}
+
+// Check returns an error if the configuration is invalid
+func (c ExportConfig) Check() error {
+	if len(c.Formats) == 0 {
+		return fmt.Errorf("no output format selected")
+	}
+	for _, format := range c.Formats {
+		var err error
+		switch format {
+		case FormatJSON:
+			err = c.JSON.Check()
+		case FormatParquet:
+			err = c.Parquet.Check()
+		case FormatCSV, FormatTSV:
+			err = c.CSV.Check()
+		case FormatProtobuf, FormatZeek, FormatZeekJSON, FormatEVE: // Not configurable
+		case FormatElasticsearch:
+			err = c.Elasticsearch.Check()
+		case FormatStream:
+			err = c.Stream.Check()
+		default:
+			err = fmt.Errorf("unknown output format %s (available: %s)", format, strings.Join(Formats, ","))
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", format, err)
+		}
+	}
+	return nil
 }
 
-type registrableRRMetric interface {
-	onFlush(flow *flows.Flow, reqRes []*common.RequestResponse) ExportableValue
+type Metric struct {
+	computeRRPs  bool
+	rrIdentifier *common.ReqResIdentifier
+
+	sinks       []sinkRoutine // One sink per output format
+	doneChannel chan bool
+
+	errMutex sync.Mutex
+	err      error // First error during serialization or export
+
+	metrics   []FlowMetric
+	rrMetrics []RRMetric
 }
 
-func NewMetric(samplingRate int64, computeRRPs bool, exportBufferSize uint) *Metric {
+// NewMetric creates a new Metric computing the metrics with the given names (see RegisteredMetrics).
+// The requests and responses of the flows are only identified if a RRMetric is selected,
+// or if unidirectional flows are dropped or reconstructed.
+// The flows are written in each of the configured formats, each format is written by its own goroutine.
+// The metrics required by the selected formats (e.g. Zeek) are added.
+// Returns an error if a metric is not registered, the export configuration is invalid or a sink cannot be opened (see sinkOpener).
+// Afterwards, ExportRoutine must be started, which releases the resources of the sinks once Flush is called.
+func NewMetric(config MetricConfig, metricNames []string, dropUnidirectionalFlows, reconstructTCPResponse bool,
+	exportConfig ExportConfig) (*Metric, error) {
+	if err := exportConfig.Check(); err != nil {
+		return nil, err
+	}
 	metric := &Metric{
-		computeRRPs:   computeRRPs,
-		exportChannel: make(chan *string, exportBufferSize),
-		doneChannel:   make(chan bool),
+		doneChannel: make(chan bool),
+	}
+	addedFormats := make(map[string]bool)
+	for _, format := range exportConfig.Formats {
+		if addedFormats[format] {
+			continue
+		}
+		addedFormats[format] = true
+		if required := formatMetrics[format]; len(required) > 0 {
+			metricNames = append(append([]string(nil), metricNames...), required...)
+		}
+		metric.sinks = append(metric.sinks, sinkRoutine{
+			sink:    newSink(format, exportConfig),
+			channel: make(chan interface{}, exportConfig.BufferSize),
+		})
 	}
 
-	metricFlowRate := newMetricFlowRate()
-	metricFlowRate.samplingRate = samplingRate
+	added := make(map[string]bool)
+	for _, name := range metricNames {
+		if added[name] {
+			continue
+		}
+		added[name] = true
+		registered, ok := lookupMetric(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown flow metric %s", name)
+		}
+		if registered.newMetric != nil {
+			metric.addMetric(registered.newMetric(config))
+		} else {
+			metric.addRRMetric(registered.newRRMetric(config))
+		}
+	}
 
-	metric.addMetric(metricFlowRate)
-	metric.addMetric(newMetricProtocol())
-	metric.addMetric(newMetricFlowSize())
-	metric.addMetric(newMetricPackets())
-	metric.addMetric(newMetricFlowDuration())
+	// Resources of the sinks are acquired last, so that they are not leaked if a metric is unknown
+	for _, s := range metric.sinks {
+		if opener, ok := s.sink.(sinkOpener); ok {
+			if err := opener.open(); err != nil {
+				return nil, err
+			}
+		}
+	}
 
-	if !computeRRPs {
-		return metric
+	metric.computeRRPs = len(metric.rrMetrics) > 0
+	if !metric.computeRRPs && !dropUnidirectionalFlows && !reconstructTCPResponse {
+		return metric, nil
 	}
 
 	metric.rrIdentifier = common.NewReqResIdentifier(
-		false, false,
+		dropUnidirectionalFlows, reconstructTCPResponse,
 		nil, nil,
 	)
 
-	metric.addRRMetric(newMetricRRPs())
-
-	return metric
+	return metric, nil
 }
 
-func (m *Metric) addMetric(metric registrableMetric) {
+func (m *Metric) addMetric(metric FlowMetric) {
 	m.metrics = append(m.metrics, metric)
 }
 
-func (m *Metric) addRRMetric(rrMetric registrableRRMetric) {
+func (m *Metric) addRRMetric(rrMetric RRMetric) {
 	m.rrMetrics = append(m.rrMetrics, rrMetric)
 }
 
@@ -80,14 +184,14 @@ func (m *Metric) OnTCPFlush(flow *flows.TCPFlow) {
 	var rr = make([]*common.RequestResponse, 0)
 	var dropFlow bool
 
-	if m.computeRRPs {
+	if m.rrIdentifier != nil {
 		rr, dropFlow = m.rrIdentifier.OnTCPFlush(protocol, flow)
 		if dropFlow {
 			return
 		}
 	}
 
-	m.onFlush(&flow.Flow, rr) // here i only give on the father flow object
+	m.OnTCPReqRes(protocol, flow, rr)
 }
 
 // Callback that is called by the pools, once reconstruction for a flow is done.
@@ -97,218 +201,100 @@ func (m *Metric) OnUDPFlush(flow *flows.UDPFlow) {
 	var rr = make([]*common.RequestResponse, 0)
 	var dropFlow bool
 
-	if m.computeRRPs {
+	if m.rrIdentifier != nil {
 		rr, dropFlow = m.rrIdentifier.OnUDPFlush(protocol, flow)
 		if dropFlow {
 			return
 		}
 	}
 
-	m.onFlush(&flow.Flow, rr)
-}
-
-// This method is called by the callback. Simplifies metric implementation, as
-// they are not required to implement different methods for TCP/UDP.
-func (m *Metric) onFlush(flow *flows.Flow, rr []*common.RequestResponse) {
-	values := make([]ExportableValue, len(m.metrics)+len(m.rrMetrics))
-
-	for i, metric := range m.metrics {
-		values[i] = metric.onFlush(flow)
-	}
-
-	if m.computeRRPs {
-		for i, rrMetric := range m.rrMetrics {
-			values[len(m.metrics)+i] = rrMetric.onFlush(flow, rr)
-		}
-	}
-
-	combinedMetric := combineMetrics(values)
-	m.exportChannel <- serializeMetric(combinedMetric)
+	m.OnUDPReqRes(protocol, flow, rr)
 }
 
-// Combines metrics that have been computed independently into one.
-func combineMetrics(values []ExportableValue) *map[string]interface{} {
-	combinedMetric := make(map[string]interface{})
-
-	for _, value := range values {
-		for key, value := range value.export() {
-			combinedMetric[key] = value
-		}
-	}
-
-	return &combinedMetric
+// OnTCPReqRes processes a flow whose request/response pairs are already identified (see common.ReqResDispatcher).
+func (m *Metric) OnTCPReqRes(protocol common.Protocol, flow *flows.TCPFlow, reqRes []*common.RequestResponse) {
+	m.onFlush(&flow.Flow, flow, reqRes) // here i only give on the father flow object
 }
 
-type LockedMetric struct {
-	mu     sync.Mutex
-	metric *map[string]interface{}
+// OnUDPReqRes processes a flow whose request/response pairs are already identified (see common.ReqResDispatcher).
+func (m *Metric) OnUDPReqRes(protocol common.Protocol, flow *flows.UDPFlow, reqRes []*common.RequestResponse) {
+	m.onFlush(&flow.Flow, nil, reqRes)
 }
 
-// Serializes a combined metric into a JSON string.
-func serializeMetric(metric *map[string]interface{}) *string {
-	/*
-		test := *metric
-		if data, ok := test["tcpOptionsClient"]; ok {
-			//fmt.Println("no tcpOptionsClient")
-			data_real := data.([]layers.TCPOption)
-			if len(data_real) > 0 && cap(data_real) > 0 {
-				//fmt.Println("maybe the error?")
-				for i := 0; i < len(data_real); i++ {
-					if data_real[i].OptionType == layers.TCPOptionKindTimestamps && data_real[i].OptionLength == 10 {
-						fmt.Println("testcrash clienbt?")
-					}
-
-				}
-			}
-			//fmt.Println(data)
-		} else {
-			fmt.Println("no tcpOptionsClient")
-		}
-
-		if data, ok := test["tcpOptionsServer"]; ok {
-			//fmt.Println("no tcpOptionsClient")
-			data_real := data.([]layers.TCPOption)
-			if len(data_real) > 0 && cap(data_real) > 0 {
-				//fmt.Println("maybe the error?")
-				for i := 0; i < len(data_real); i++ {
-					if data_real[i].OptionType == layers.TCPOptionKindTimestamps && data_real[i].OptionLength == 10 {
-						fmt.Println("testcrash server?")
-					}
-
-				}
-			}
-			//fmt.Println(data)
-		} else {
-			fmt.Println("no tcpOptionsServer")
-		}
+// This method is called by the callback. Simplifies metric implementation, as
+// they are not required to implement different methods for TCP/UDP. tcpFlow is nil for UDP flows.
+func (m *Metric) onFlush(flow *flows.Flow, tcpFlow *flows.TCPFlow, rr []*common.RequestResponse) {
+	record := &FlowRecord{}
 
-		if data, ok := test["TCPOptionsinFlow"]; ok {
-			//fmt.Println("no tcpOptionsClient")
-			data_real_inter := data.([][]layers.TCPOption)
-			for i_j := 0; i_j < len(data_real_inter); i_j++ {
-				if len(data_real_inter[i_j]) > 0 && cap(data_real_inter[i_j]) > 0 {
-					//fmt.Println("maybe the error?")
-					for i := 0; i < len(data_real_inter[i_j]); i++ {
-						if data_real_inter[i_j][i].OptionType == layers.TCPOptionKindTimestamps && data_real_inter[i_j][i].OptionLength == 10 {
-							fmt.Println("testcrash? flow")
-						}
-					}
-				}
-			}
-			//fmt.Println(data)
+	for _, metric := range m.metrics {
+		if tcpMetric, ok := metric.(TCPFlowMetric); ok && tcpFlow != nil {
+			tcpMetric.OnTCPFlush(tcpFlow, record)
 		} else {
-			fmt.Println("no TCPOptionsinFlow")
+			metric.OnFlush(flow, record)
 		}
+	}
 
-		if data, ok := test["size"]; ok {
-			if data := data.(uint); data == 0 {
-				fmt.Println("size is 0")
-			}
+	if m.computeRRPs {
+		for _, rrMetric := range m.rrMetrics {
+			rrMetric.OnFlush(flow, rr, record)
 		}
-		/*test, ok := metric["tcpOptionsClient"]
-		if test != 0 {
-			delete(metric*, "tcpOptionsClient")
-		}*/
-	//fmt.Println("go next marshal")
-
-	/*mopre test code
-	test := *metric
-	if data, ok := test["tcpOptionsServer"]; ok {
-		//fmt.Println("no tcpOptionsClient")
-		data_real := data.([]layers.TCPOption)
-		if len(data_real) > cap(data_real) {
-			fmt.Println(test)
+	}
 
+	// If the conversion fails, the flow is skipped in this format. The other flows are still exported.
+	for _, s := range m.sinks {
+		encoded, err := s.sink.encode(record)
+		if err != nil {
+			m.setError(err)
+			continue
 		}
-	}*/
-
-	b, err := json.Marshal(metric)
-	//fmt.Println("marshal done")
-	//fmt.Println("")
-	if err != nil {
-		fmt.Println(err.Error())
-		panic("Error during json marshalling!")
+		s.channel <- encoded
 	}
+}
 
-	serialized := string(b)
-	return &serialized
+// setError records err, if no error has been recorded before.
+func (m *Metric) setError(err error) {
+	m.errMutex.Lock()
+	defer m.errMutex.Unlock()
+	if m.err == nil {
+		m.err = err
+	}
 }
 
-// Closes the exportChannel, which causes all buffered metrics to be flushed.
+// Closes the export channels, which causes all buffered metrics to be flushed.
 func (m *Metric) Flush() {
-	close(m.exportChannel)
+	for _, s := range m.sinks {
+		close(s.channel)
+	}
 }
 
 // Waits until all metrics have been written to file.
-func (m *Metric) Wait() {
+// Returns the first error which occurred during serialization or export.
+func (m *Metric) Wait() error {
 	<-m.doneChannel
+	m.errMutex.Lock()
+	defer m.errMutex.Unlock()
+	return m.err
 }
 
-// Should always be called as a goroutine. Writes serialized metrics directly to disk.
+// Should always be called as a goroutine. Starts a goroutine per output format, which writes the metrics directly to disk.
+// If an error occurs, the remaining metrics of this format are discarded (so that the pools are not blocked) and Wait returns the error.
 func (m *Metric) ExportRoutine(directory string) {
-	filename := path.Join(directory, "flow_metrics.json")
-	if _, err := os.Stat(filename); err == nil {
-		// File exists
-		err := os.Remove(filename)
-		if err != nil {
-			fmt.Println(err.Error())
-			panic("Could not remove '" + filename + "'!")
-		}
-	}
-
-	f, err := os.Create(filename)
-	if err != nil {
-		fmt.Println(err.Error())
-		panic("Could not create '" + filename + "'!")
-	}
-
-	err = os.Chmod(filename, 0644)
-	if err != nil {
-		fmt.Println(err.Error())
-		fmt.Println("Could not change permissions for '" + filename + "'!")
-	}
-
-	fmt.Println("Export routine successfully setup.")
-	start := time.Now()
-
-	/*_, err = f.WriteString("{")
-	if err != nil {
-		fmt.Println(err.Error())
-		panic("Error writing to file!")
-	}*/
-
-	id := 0
-	serializedMetric := ""
-	for serializedMetricPointer := range m.exportChannel {
-		if len(serializedMetric) != 0 {
-			//_, err = f.WriteString(fmt.Sprintf("\"%d\":%s,", id, serializedMetric)) if i want to rennable alos look upP!
-			_, err = f.WriteString(fmt.Sprintf("%s\n", serializedMetric))
-			if err != nil {
-				fmt.Println(err.Error())
-				panic("Error writing to file!")
+	defer func() {
+		m.doneChannel <- true
+		close(m.doneChannel)
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(len(m.sinks))
+	for _, s := range m.sinks {
+		go func(s sinkRoutine) {
+			defer wg.Done()
+			if err := s.sink.write(directory, s.channel); err != nil {
+				m.setError(err)
+				for range s.channel {
+				}
 			}
-		}
-
-		serializedMetric = *serializedMetricPointer
-		id++
-	}
-
-	//_, err = f.WriteString(fmt.Sprintf("\"%d\":%s}", id, serializedMetric))
-	_, err = f.WriteString(fmt.Sprintf("%s", serializedMetric))
-	if err != nil {
-		fmt.Println(err.Error())
-		panic("Error writing to file!")
-	}
-
-	err = f.Close()
-	if err != nil {
-		fmt.Println(err.Error())
-		panic("Error closing file!")
+		}(s)
 	}
-
-	fmt.Println("Finished writing json. Took:\t", time.Since(start))
-	fmt.Printf("Export successful. Exported:\t %s flow metrics", humanize.Comma(int64(id)))
-
-	m.doneChannel <- true
-	close(m.doneChannel)
+	wg.Wait()
 }
@@ -4,6 +4,12 @@ import (
 	"test.com/scale/src/analysis/flows"
 )
 
+func init() {
+	RegisterMetric("packets", func(config MetricConfig) FlowMetric {
+		return newMetricPackets()
+	})
+}
+
 type MetricPackets struct{}
 
 func newMetricPackets() *MetricPackets {
@@ -32,9 +38,9 @@ func (mp *MetricPackets) calc(flow *flows.Flow) ValuePackets {
 	}
 }
 
-func (mp *MetricPackets) onFlush(flow *flows.Flow) ExportableValue {
+func (mp *MetricPackets) OnFlush(flow *flows.Flow, record *FlowRecord) {
 	value := mp.calc(flow)
-	return value
+	value.setFields(record)
 }
 
 type ValuePackets struct {
@@ -46,10 +52,9 @@ type ValuePackets struct {
 	packetsServer uint32
 }
 
-func (vp ValuePackets) export() map[string]interface{} {
-	return map[string]interface{}{
-		"packets":       vp.packets,
-		"packetsClient": vp.packetsClient,
-		"packetsServer": vp.packetsServer,
-	}
+func (vp ValuePackets) setFields(record *FlowRecord) {
+	record.HasPackets = true
+	record.Packets = vp.packets
+	record.PacketsClient = vp.packetsClient
+	record.PacketsServer = vp.packetsServer
 }
@@ -5,13 +5,21 @@ import (
 	"test.com/scale/src/analysis/flows"
 )
 
-type MetricProtocol struct{}
+func init() {
+	RegisterMetric("protocol", func(config MetricConfig) FlowMetric {
+		return newMetricProtocol(config.CommunityIDSeed)
+	})
+}
+
+type MetricProtocol struct {
+	communityIDSeed uint16
+}
 
-func newMetricProtocol() *MetricProtocol {
-	return &MetricProtocol{}
+func newMetricProtocol(communityIDSeed uint16) *MetricProtocol {
+	return &MetricProtocol{communityIDSeed: communityIDSeed}
 }
 
-func (mp *MetricProtocol) onFlush(flow *flows.Flow) ExportableValue {
+func (mp *MetricProtocol) OnFlush(flow *flows.Flow, record *FlowRecord) {
 	/*
 		TCPOptionsinFlow := false
 		if flow.TCPOptionsinFlow != nil {
@@ -51,9 +59,10 @@ func (mp *MetricProtocol) onFlush(flow *flows.Flow) ExportableValue {
 		FullServerAddr:      flow.FullServerAddr,
 		FirstPacketWasZMap:  flow.FirstPacketWasZMap,
 		AllPacketsZMap:      flow.AllPacketsZMap,
+		communityID:         flow.CommunityID(mp.communityIDSeed),
 	}
 
-	return value
+	value.setFields(record)
 }
 
 type ValueProtocol struct {
@@ -88,27 +97,24 @@ type ValueProtocol struct {
 	//TCPOptionsClient string
 	FirstPacketWasZMap bool
 	AllPacketsZMap     bool
+
+	// Community ID (version 1) of the flow, to match it with the records of other tools.
+	communityID string
 }
 
-func (vp ValueProtocol) export() map[string]interface{} {
-	return map[string]interface{}{
-		"protocol":      vp.protocol,
-		"portClient":    vp.portClient,
-		"portServer":    vp.portServer,
-		"addressClient": vp.addressClient,
-		"addressServer": vp.addressServer,
-		//"tcpOptionsServer":    vp.TCPOptionsSever,
-		//"tcpOptionsClient":    vp.TCPOptionsClient,
-		//"TCPOptionsinFlow":    vp.TCPOptionsinFlow,
-		"ClientInterface":     vp.ClientInterface,
-		"ServerInterface":     vp.ServerInterface,
-		"ServerClientUnclear": vp.ServerClientUnclear,
-		//"NewTCPOptionsClient": vp.NewTCPOptionsClient,
-		//"NewTCPOptionsServer": vp.NewTCPOptionsServer,
-		//"NewTCPOptionsinFlow": vp.NewTCPOptionsinFlow,
-		"FullClientAddr":     vp.FullClientAddr,
-		"FullServerAddr":     vp.FullServerAddr,
-		"FirstPacketWasZMap": vp.FirstPacketWasZMap,
-		"AllPacketsZMap":     vp.AllPacketsZMap,
-	}
+func (vp ValueProtocol) setFields(record *FlowRecord) {
+	record.HasProtocol = true
+	record.Protocol = vp.protocol
+	record.PortClient = vp.portClient
+	record.PortServer = vp.portServer
+	record.AddressClient = vp.addressClient
+	record.AddressServer = vp.addressServer
+	record.ClientInterface = vp.ClientInterface
+	record.ServerInterface = vp.ServerInterface
+	record.ServerClientUnclear = vp.ServerClientUnclear
+	record.FullClientAddr = vp.FullClientAddr
+	record.FullServerAddr = vp.FullServerAddr
+	record.FirstPacketWasZMap = vp.FirstPacketWasZMap
+	record.AllPacketsZMap = vp.AllPacketsZMap
+	record.CommunityID = vp.communityID
 }
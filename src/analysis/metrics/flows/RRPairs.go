@@ -5,6 +5,12 @@ import (
 	"test.com/scale/src/analysis/metrics/common"
 )
 
+func init() {
+	RegisterRRMetric("rrps", func(config MetricConfig) RRMetric {
+		return newMetricRRPs()
+	})
+}
+
 type MetricRRPs struct{}
 
 func newMetricRRPs() *MetricRRPs {
@@ -36,9 +42,9 @@ func (mr *MetricRRPs) calc(flow *flows.Flow, reqRes []*common.RequestResponse) V
 	}
 }
 
-func (mr *MetricRRPs) onFlush(flow *flows.Flow, reqRes []*common.RequestResponse) ExportableValue {
+func (mr *MetricRRPs) OnFlush(flow *flows.Flow, reqRes []*common.RequestResponse, record *FlowRecord) {
 	value := mr.calc(flow, reqRes)
-	return value
+	value.setFields(record)
 }
 
 type ValueRRPairs struct {
@@ -46,8 +52,7 @@ type ValueRRPairs struct {
 	rrps [][2]uint16
 }
 
-func (vr ValueRRPairs) export() map[string]interface{} {
-	return map[string]interface{}{
-		"rrps": vr.rrps,
-	}
+func (vr ValueRRPairs) setFields(record *FlowRecord) {
+	record.HasRRPs = true
+	record.RRPs = vr.rrps
 }
@@ -0,0 +1,59 @@
+package flows
+
+import (
+	"test.com/scale/src/analysis/flows"
+)
+
+func init() {
+	RegisterMetric("tcpFlags", func(config MetricConfig) FlowMetric {
+		return newMetricTCPFlags()
+	})
+}
+
+// MetricTCPFlags exports the summary of the TCP flags of a flow, which is maintained by the pools (see flows.TCPFlags).
+// The fields are only set for TCP flows.
+type MetricTCPFlags struct{}
+
+func newMetricTCPFlags() *MetricTCPFlags {
+	return &MetricTCPFlags{}
+}
+
+func (mt *MetricTCPFlags) OnFlush(flow *flows.Flow, record *FlowRecord) {
+	if flow.Protocol != flows.TCP {
+		return
+	}
+	value := ValueTCPFlags{
+		tcpFlags:           flow.TCPFlags.All,
+		tcpFlagsClient:     flow.TCPFlags.Client,
+		tcpFlagsServer:     flow.TCPFlags.Server,
+		tcpFlagsFirst:      flow.TCPFlags.First,
+		tcpFlagsLast:       flow.TCPFlags.Last,
+		handshakeCompleted: flow.TCPFlags.HandshakeCompleted(),
+	}
+	value.setFields(record)
+}
+
+type ValueTCPFlags struct {
+	// Flags of all packets (see flows.TCPFlagFIN etc.)
+	tcpFlags uint8
+	// Flags of the packets of the client.
+	tcpFlagsClient uint8
+	// Flags of the packets of the server.
+	tcpFlagsServer uint8
+	// Flags of the first packet.
+	tcpFlagsFirst uint8
+	// Flags of the last packet.
+	tcpFlagsLast uint8
+	// Whether SYN, SYN ACK and ACK were seen in this order.
+	handshakeCompleted bool
+}
+
+func (vt ValueTCPFlags) setFields(record *FlowRecord) {
+	record.HasTCPFlags = true
+	record.TCPFlags = vt.tcpFlags
+	record.TCPFlagsClient = vt.tcpFlagsClient
+	record.TCPFlagsServer = vt.tcpFlagsServer
+	record.TCPFlagsFirst = vt.tcpFlagsFirst
+	record.TCPFlagsLast = vt.tcpFlagsLast
+	record.HandshakeCompleted = vt.handshakeCompleted
+}
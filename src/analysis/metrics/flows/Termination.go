@@ -0,0 +1,36 @@
+package flows
+
+import (
+	"test.com/scale/src/analysis/flows"
+)
+
+func init() {
+	RegisterMetric("termination", func(config MetricConfig) FlowMetric {
+		return newMetricTermination()
+	})
+}
+
+// MetricTermination exports why the pools flushed the flow
+type MetricTermination struct{}
+
+func newMetricTermination() *MetricTermination {
+	return &MetricTermination{}
+}
+
+func (mt *MetricTermination) OnFlush(flow *flows.Flow, record *FlowRecord) {
+	value := ValueTermination{terminationReason: flow.TerminationReason.String(), timeoutProfile: flow.TimeoutProfile}
+	value.setFields(record)
+}
+
+type ValueTermination struct {
+	// Reason why the flow was flushed: idle, fin, rst, forced, shutdown or active (see flows.TerminationReason).
+	terminationReason string
+	// Name of the timeout profile of the flow, or default if the global timeouts apply (see flows.TimeoutProfile).
+	timeoutProfile string
+}
+
+func (vt ValueTermination) setFields(record *FlowRecord) {
+	record.HasTermination = true
+	record.TerminationReason = vt.terminationReason
+	record.TimeoutProfile = vt.timeoutProfile
+}
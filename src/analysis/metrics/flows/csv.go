@@ -0,0 +1,300 @@
+package flows
+
+// This file contains the CSV and TSV output of the flow metrics.
+// The files start with a header row, the columns are always written in the following order:
+//
+//	protocol, portClient, portServer, addressClient, addressServer, FullClientAddr, FullServerAddr,
+//	ClientInterface, ServerInterface, ServerClientUnclear, FirstPacketWasZMap, AllPacketsZMap, communityID,
+//	start, end, duration, size, sizeClient, sizeServer, packets, packetsClient, packetsServer, connState, history,
+//	tcpFlags, tcpFlagsClient, tcpFlagsServer, tcpFlagsFirst, tcpFlagsLast, handshakeCompleted, terminationReason,
+//	timeoutProfile, fragment, lastFragment,
+//	<flowRates>, <flowRatesClient>, <flowRatesServer>, <rrps>, extra
+//
+// The cells of metrics which are not selected are empty. The interfaces are written as MAC addresses.
+// The arrays (in angle brackets) are written depending on CSVConfig.Arrays:
+//   - summary: <name>Count, <name>Mean, <name>Max for the rates and
+//     rrpsCount, rrpsRequestMean, rrpsRequestMax, rrpsResponseMean, rrpsResponseMax for the rrps.
+//     Mean and max are empty for empty arrays.
+//   - cell: one column per array containing the JSON array, e.g. [1,2] or [[100,200],[50,1000]]
+//
+// The extra values of the records (set by metrics of other packages) are written as JSON object in the column extra.
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/dustin/go-humanize"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ways to write arrays in the CSV and TSV output
+const (
+	CSVArraysSummary = "summary" // Summary columns (count, mean, max)
+	CSVArraysCell    = "cell"    // JSON array in one cell
+)
+
+// CSVArrays contains the ways to write arrays in the CSV and TSV output
+var CSVArrays = []string{CSVArraysSummary, CSVArraysCell}
+
+// CSVConfig configures the CSV and TSV output
+type CSVConfig struct {
+	Arrays string // How arrays are written, see CSVArrays
+}
+
+// DefaultCSVConfig returns the default configuration of the CSV and TSV output
+func DefaultCSVConfig() CSVConfig {
+	return CSVConfig{Arrays: CSVArraysSummary}
+}
+
+// Check returns an error if the configuration is invalid
+func (c CSVConfig) Check() error {
+	if c.Arrays != CSVArraysSummary && c.Arrays != CSVArraysCell {
+		return fmt.Errorf("unknown way to write arrays %s (available: %s)", c.Arrays, strings.Join(CSVArrays, ","))
+	}
+	return nil
+}
+
+// csvScalarColumns are the columns before the arrays
+var csvScalarColumns = []string{
+	"protocol", "portClient", "portServer", "addressClient", "addressServer", "FullClientAddr", "FullServerAddr",
+	"ClientInterface", "ServerInterface", "ServerClientUnclear", "FirstPacketWasZMap", "AllPacketsZMap", "communityID",
+	"start", "end", "duration", "size", "sizeClient", "sizeServer", "packets", "packetsClient", "packetsServer",
+	"connState", "history", "tcpFlags", "tcpFlagsClient", "tcpFlagsServer", "tcpFlagsFirst", "tcpFlagsLast", "handshakeCompleted",
+	"terminationReason", "timeoutProfile", "fragment", "lastFragment",
+}
+
+// csvRateColumns are the arrays of rates
+var csvRateColumns = []string{"flowRates", "flowRatesClient", "flowRatesServer"}
+
+// header returns the header row
+func (c CSVConfig) header() []string {
+	header := append([]string(nil), csvScalarColumns...)
+	if c.Arrays == CSVArraysCell {
+		header = append(header, csvRateColumns...)
+		header = append(header, "rrps")
+	} else {
+		for _, column := range csvRateColumns {
+			header = append(header, column+"Count", column+"Mean", column+"Max")
+		}
+		header = append(header, "rrpsCount", "rrpsRequestMean", "rrpsRequestMax", "rrpsResponseMean", "rrpsResponseMax")
+	}
+	return append(header, "extra")
+}
+
+// csvSink writes the flows to flow_metrics.csv or flow_metrics.tsv
+type csvSink struct {
+	config CSVConfig
+	comma  rune
+}
+
+func (s *csvSink) encode(r *FlowRecord) (interface{}, error) {
+	row := make([]string, 0, len(csvScalarColumns)+18)
+
+	if r.HasProtocol {
+		row = append(row,
+			r.Protocol,
+			strconv.FormatUint(uint64(r.PortClient), 10),
+			strconv.FormatUint(uint64(r.PortServer), 10),
+			strconv.FormatInt(r.AddressClient, 10),
+			strconv.FormatInt(r.AddressServer, 10),
+			csvIP(r.FullClientAddr),
+			csvIP(r.FullServerAddr),
+			r.ClientInterface.String(),
+			r.ServerInterface.String(),
+			strconv.FormatBool(r.ServerClientUnclear),
+			strconv.FormatBool(r.FirstPacketWasZMap),
+			strconv.FormatBool(r.AllPacketsZMap),
+			r.CommunityID,
+		)
+	} else {
+		row = appendEmpty(row, 13)
+	}
+	if r.HasDuration {
+		row = append(row, strconv.FormatInt(r.Start, 10), strconv.FormatInt(r.End, 10), strconv.FormatInt(r.Duration, 10))
+	} else {
+		row = appendEmpty(row, 3)
+	}
+	if r.HasSize {
+		row = append(row,
+			strconv.FormatUint(uint64(r.Size), 10),
+			strconv.FormatUint(uint64(r.SizeClient), 10),
+			strconv.FormatUint(uint64(r.SizeServer), 10),
+		)
+	} else {
+		row = appendEmpty(row, 3)
+	}
+	if r.HasPackets {
+		row = append(row,
+			strconv.FormatUint(uint64(r.Packets), 10),
+			strconv.FormatUint(uint64(r.PacketsClient), 10),
+			strconv.FormatUint(uint64(r.PacketsServer), 10),
+		)
+	} else {
+		row = appendEmpty(row, 3)
+	}
+	if r.HasConnState {
+		row = append(row, r.ConnState, r.History)
+	} else {
+		row = appendEmpty(row, 2)
+	}
+	if r.HasTCPFlags {
+		row = append(row,
+			strconv.FormatUint(uint64(r.TCPFlags), 10),
+			strconv.FormatUint(uint64(r.TCPFlagsClient), 10),
+			strconv.FormatUint(uint64(r.TCPFlagsServer), 10),
+			strconv.FormatUint(uint64(r.TCPFlagsFirst), 10),
+			strconv.FormatUint(uint64(r.TCPFlagsLast), 10),
+			strconv.FormatBool(r.HandshakeCompleted),
+		)
+	} else {
+		row = appendEmpty(row, 6)
+	}
+	if r.HasTermination {
+		row = append(row, r.TerminationReason, r.TimeoutProfile)
+	} else {
+		row = appendEmpty(row, 2)
+	}
+	if r.HasFragment {
+		row = append(row, strconv.FormatUint(uint64(r.Fragment), 10), strconv.FormatBool(r.LastFragment))
+	} else {
+		row = appendEmpty(row, 2)
+	}
+
+	if s.config.Arrays == CSVArraysCell {
+		if r.HasRates {
+			row = append(row,
+				string(appendJSONUints(nil, r.FlowRates)),
+				string(appendJSONUints(nil, r.FlowRatesClient)),
+				string(appendJSONUints(nil, r.FlowRatesServer)),
+			)
+		} else {
+			row = appendEmpty(row, 3)
+		}
+		if r.HasRRPs {
+			row = append(row, string(appendJSONRRPs(nil, r.RRPs)))
+		} else {
+			row = appendEmpty(row, 1)
+		}
+	} else {
+		if r.HasRates {
+			row = appendUintSummary(row, r.FlowRates)
+			row = appendUintSummary(row, r.FlowRatesClient)
+			row = appendUintSummary(row, r.FlowRatesServer)
+		} else {
+			row = appendEmpty(row, 9)
+		}
+		if r.HasRRPs {
+			requests := make([]uint, len(r.RRPs))
+			responses := make([]uint, len(r.RRPs))
+			for i, rrp := range r.RRPs {
+				requests[i] = uint(rrp[0])
+				responses[i] = uint(rrp[1])
+			}
+			row = append(row, strconv.Itoa(len(r.RRPs)))
+			row = appendUintMeanMax(row, requests)
+			row = appendUintMeanMax(row, responses)
+		} else {
+			row = appendEmpty(row, 5)
+		}
+	}
+
+	if r.Extra != nil {
+		b, err := json.Marshal(r.Extra)
+		if err != nil {
+			return nil, fmt.Errorf("error during json marshalling of extra values: %v", err)
+		}
+		row = append(row, string(b))
+	} else {
+		row = append(row, "")
+	}
+	return row, nil
+}
+
+func (s *csvSink) write(directory string, records <-chan interface{}) error {
+	filename := path.Join(directory, "flow_metrics.csv")
+	if s.comma == '\t' {
+		filename = path.Join(directory, "flow_metrics.tsv")
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("could not create '%s': %v", filename, err)
+	}
+	buffer := bufio.NewWriter(f)
+	w := csv.NewWriter(buffer)
+	w.Comma = s.comma
+
+	fmt.Println("CSV export routine successfully setup.")
+	start := time.Now()
+
+	var numFlows int64
+	err = w.Write(s.config.header())
+	for record := range records {
+		if err != nil {
+			break
+		}
+		err = w.Write(record.([]string))
+		numFlows++
+	}
+	if err == nil {
+		w.Flush()
+		err = w.Error()
+	}
+	if err == nil {
+		err = buffer.Flush()
+	}
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error writing to '%s': %v", filename, err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("error closing '%s': %v", filename, err)
+	}
+
+	fmt.Println("Finished writing csv. Took:\t", time.Since(start))
+	fmt.Printf("CSV export successful. Exported:\t %s flow metrics\n", humanize.Comma(numFlows))
+	return nil
+}
+
+// csvIP returns the textual representation of ip, or an empty string if it is not set
+func csvIP(ip net.IP) string {
+	if len(ip) == 0 {
+		return ""
+	}
+	return ip.String()
+}
+
+// appendEmpty appends n empty cells
+func appendEmpty(row []string, n int) []string {
+	for i := 0; i < n; i++ {
+		row = append(row, "")
+	}
+	return row
+}
+
+// appendUintSummary appends the count, mean and max of values. Mean and max are empty if there are no values.
+func appendUintSummary(row []string, values []uint) []string {
+	row = append(row, strconv.Itoa(len(values)))
+	return appendUintMeanMax(row, values)
+}
+
+// appendUintMeanMax appends the mean and max of values, or two empty cells if there are no values
+func appendUintMeanMax(row []string, values []uint) []string {
+	if len(values) == 0 {
+		return append(row, "", "")
+	}
+	var sum float64
+	var max uint
+	for _, value := range values {
+		sum += float64(value)
+		if value > max {
+			max = value
+		}
+	}
+	return append(row, strconv.FormatFloat(sum/float64(len(values)), 'f', -1, 64), strconv.FormatUint(uint64(max), 10))
+}
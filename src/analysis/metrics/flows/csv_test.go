@@ -0,0 +1,111 @@
+package flows
+
+import (
+	"encoding/csv"
+	"net"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// outputTestRecord returns a TCP flow with all metrics except connState
+func outputTestRecord() *FlowRecord {
+	return &FlowRecord{
+		HasProtocol: true, Protocol: "TCP", PortClient: 40000, PortServer: 80, AddressClient: 1, AddressServer: 2,
+		ClientInterface: net.HardwareAddr{0, 0, 0, 0, 0, 1}, ServerInterface: net.HardwareAddr{0, 0, 0, 0, 0, 2},
+		FullClientAddr: net.ParseIP("10.0.0.1").To4(), FullServerAddr: net.ParseIP("10.0.0.2").To4(), CommunityID: "1:abc",
+		HasDuration: true, Start: 1000, End: 3000, Duration: 2000,
+		HasRates: true, FlowRates: []uint{10, 30}, FlowRatesClient: []uint{5}, FlowRatesServer: []uint{},
+		HasSize: true, Size: 300, SizeClient: 100, SizeServer: 200,
+		HasPackets: true, Packets: 5, PacketsClient: 3, PacketsServer: 2,
+		HasTCPFlags: true, TCPFlags: 0x13, TCPFlagsClient: 0x13, TCPFlagsServer: 0x12, TCPFlagsFirst: 0x02, TCPFlagsLast: 0x11, HandshakeCompleted: true,
+		HasTermination: true, TerminationReason: "fin", TimeoutProfile: "default",
+		HasFragment: true, Fragment: 1, LastFragment: true,
+		HasRRPs: true, RRPs: [][2]uint16{{100, 200}, {50, 1000}},
+		Extra: map[string]interface{}{"label": "web"},
+	}
+}
+
+// writeSink writes the records with the sink to a temporary directory and returns the directory
+func writeSink(t *testing.T, sink flowSink, records ...*FlowRecord) string {
+	t.Helper()
+	channel := make(chan interface{}, len(records))
+	for _, record := range records {
+		encoded, err := sink.encode(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		channel <- encoded
+	}
+	close(channel)
+	directory := t.TempDir()
+	if err := sink.write(directory, channel); err != nil {
+		t.Fatal(err)
+	}
+	return directory
+}
+
+func TestCSVOutput(t *testing.T) {
+	scalarColumns := "protocol,portClient,portServer,addressClient,addressServer,FullClientAddr,FullServerAddr," +
+		"ClientInterface,ServerInterface,ServerClientUnclear,FirstPacketWasZMap,AllPacketsZMap,communityID," +
+		"start,end,duration,size,sizeClient,sizeServer,packets,packetsClient,packetsServer,connState,history," +
+		"tcpFlags,tcpFlagsClient,tcpFlagsServer,tcpFlagsFirst,tcpFlagsLast,handshakeCompleted,terminationReason," +
+		"timeoutProfile,fragment,lastFragment,"
+	scalarValues := "TCP,40000,80,1,2,10.0.0.1,10.0.0.2,00:00:00:00:00:01,00:00:00:00:00:02,false,false,false,1:abc," +
+		"1000,3000,2000,300,100,200,5,3,2,,,19,19,18,2,17,true,fin,default,1,true,"
+	tests := []struct {
+		name     string
+		config   CSVConfig
+		comma    rune
+		filename string
+		header   string
+		row      string
+	}{
+		{"summary", CSVConfig{Arrays: CSVArraysSummary}, ',', "flow_metrics.csv",
+			scalarColumns + "flowRatesCount,flowRatesMean,flowRatesMax,flowRatesClientCount,flowRatesClientMean,flowRatesClientMax," +
+				"flowRatesServerCount,flowRatesServerMean,flowRatesServerMax,rrpsCount,rrpsRequestMean,rrpsRequestMax,rrpsResponseMean,rrpsResponseMax,extra",
+			scalarValues + `2,20,30,1,5,5,0,,,2,75,100,600,1000,"{""label"":""web""}"`},
+		{"cell", CSVConfig{Arrays: CSVArraysCell}, ',', "flow_metrics.csv",
+			scalarColumns + "flowRates,flowRatesClient,flowRatesServer,rrps,extra",
+			scalarValues + `"[10,30]",[5],[],"[[100,200],[50,1000]]","{""label"":""web""}"`},
+		{"tsv", CSVConfig{Arrays: CSVArraysCell}, '\t', "flow_metrics.tsv",
+			scalarColumns + "flowRates,flowRatesClient,flowRatesServer,rrps,extra",
+			scalarValues + `"[10,30]",[5],[],"[[100,200],[50,1000]]","{""label"":""web""}"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			directory := writeSink(t, &csvSink{config: test.config, comma: test.comma}, outputTestRecord(), &FlowRecord{})
+			f, err := os.Open(path.Join(directory, test.filename))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			r := csv.NewReader(f)
+			r.Comma = test.comma
+			rows, err := r.ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The expected rows are given as CSV
+			expected, err := csv.NewReader(strings.NewReader(test.header + "\n" + test.row + "\n")).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 3 {
+				t.Fatalf("read %d rows, expected the header and two flows", len(rows))
+			}
+			if !reflect.DeepEqual(rows[0], expected[0]) {
+				t.Fatalf("header is\n%v\nexpected\n%v", rows[0], expected[0])
+			}
+			if !reflect.DeepEqual(rows[1], expected[1]) {
+				t.Fatalf("row is\n%q\nexpected\n%q", rows[1], expected[1])
+			}
+			// All cells of a record without metrics are empty
+			if len(rows[2]) != len(rows[0]) || strings.Join(rows[2], "") != "" {
+				t.Fatalf("row without metrics is %q", rows[2])
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package flows
+
+// This file contains the Elasticsearch output of the flow metrics.
+// The flows are sent as NDJSON to the bulk API (<URL>/_bulk), the documents are the objects of the JSON output.
+// The index of a flow is ElasticsearchConfig.Index, in which {date} is replaced by the day the flow started (UTC, YYYY.MM.DD).
+// Hence, the default index flow-metrics-{date} results in one index per day. Flows without the metric duration use the day of the export.
+//
+// The flows are collected into batches by the sink and sent by a separate goroutine.
+// Failed requests and documents which are rejected temporarily (status 429 and 5xx) are retried with exponential backoff.
+// While a batch is sent, at most QueueSize further batches are collected. Afterwards, the sink stops reading the flows,
+// so that the export channel fills up and the pools block until the batches are sent. Flows are only discarded
+// once the retries of a batch are exhausted, which stops the Elasticsearch output.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// elasticsearchDatePlaceholder is replaced by the day the flow started in the index name
+const elasticsearchDatePlaceholder = "{date}"
+
+// elasticsearchMaxBatchBytes is the size of a bulk request after which a batch is sent, even if it is not full
+const elasticsearchMaxBatchBytes = 10 * 1024 * 1024
+
+// elasticsearchMaxRetryBackoff is the maximal wait between two retries
+const elasticsearchMaxRetryBackoff = 30 * time.Second
+
+// ElasticsearchConfig configures the Elasticsearch output
+type ElasticsearchConfig struct {
+	URL           string        // Base URL of the cluster, e.g. http://localhost:9200
+	Index         string        // Name of the index, {date} is replaced by the day the flow started
+	BatchSize     int           // Maximal number of flows per bulk request
+	FlushInterval time.Duration // Maximal time a flow waits for its batch to be filled (0: batches are only sent if they are full)
+	QueueSize     int           // Number of batches which can wait to be sent
+	MaxRetries    int           // Maximal number of retries of a batch
+	RetryBackoff  time.Duration // Wait before the first retry, doubled for each further retry
+	Timeout       time.Duration // Timeout of a bulk request (0: no timeout)
+}
+
+// DefaultElasticsearchConfig returns the default configuration of the Elasticsearch output (one index per day on localhost)
+func DefaultElasticsearchConfig() ElasticsearchConfig {
+	return ElasticsearchConfig{
+		URL:           "http://localhost:9200",
+		Index:         "flow-metrics-" + elasticsearchDatePlaceholder,
+		BatchSize:     5000,
+		FlushInterval: 5 * time.Second,
+		QueueSize:     4,
+		MaxRetries:    5,
+		RetryBackoff:  time.Second,
+		Timeout:       time.Minute,
+	}
+}
+
+// Check returns an error if the configuration is invalid
+func (c ElasticsearchConfig) Check() error {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid URL %s: %v", c.URL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid URL %s: expected http(s)://host[:port]", c.URL)
+	}
+	if c.Index == "" || strings.ToLower(c.Index) != c.Index {
+		return fmt.Errorf("the index must be a non-empty lowercase name")
+	}
+	if c.BatchSize <= 0 {
+		return fmt.Errorf("the batch size must be positive")
+	}
+	if c.FlushInterval < 0 || c.QueueSize < 0 || c.MaxRetries < 0 || c.RetryBackoff < 0 || c.Timeout < 0 {
+		return fmt.Errorf("flush interval, queue size, retries, backoff and timeout must not be negative")
+	}
+	return nil
+}
+
+// index returns the name of the index of r
+func (c ElasticsearchConfig) index(r *FlowRecord) string {
+	if !strings.Contains(c.Index, elasticsearchDatePlaceholder) {
+		return c.Index
+	}
+	day := time.Now()
+	if r.HasDuration {
+		day = time.Unix(0, r.Start)
+	}
+	return strings.ReplaceAll(c.Index, elasticsearchDatePlaceholder, day.UTC().Format("2006.01.02"))
+}
+
+// elasticsearchDocument is an encoded flow and its index
+type elasticsearchDocument struct {
+	index  string
+	source *[]byte // From jsonBufferPool
+}
+
+// elasticsearchBatch is the body of a bulk request. Each document consists of an action line and the source line.
+type elasticsearchBatch struct {
+	body    []byte
+	offsets []int // Start of each document in body
+}
+
+// add appends the document to the batch
+func (b *elasticsearchBatch) add(document *elasticsearchDocument) {
+	b.offsets = append(b.offsets, len(b.body))
+	b.body = append(b.body, `{"index":{"_index":`...)
+	b.body = appendJSONString(b.body, document.index)
+	b.body = append(b.body, "}}\n"...)
+	b.body = append(b.body, *document.source...)
+	b.body = append(b.body, '\n')
+}
+
+// document returns the lines of the i-th document
+func (b *elasticsearchBatch) document(i int) []byte {
+	if i+1 < len(b.offsets) {
+		return b.body[b.offsets[i]:b.offsets[i+1]]
+	}
+	return b.body[b.offsets[i]:]
+}
+
+// elasticsearchBulkResponse is the part of the response of the bulk API which is needed to find failed documents
+type elasticsearchBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// elasticsearchSink sends the flows to the bulk API of Elasticsearch
+type elasticsearchSink struct {
+	config ElasticsearchConfig
+	client *http.Client
+
+	rejected    int64  // Number of documents which were rejected permanently
+	firstReject string // Reason of the first rejection
+}
+
+func newElasticsearchSink(config ElasticsearchConfig) *elasticsearchSink {
+	return &elasticsearchSink{config: config, client: &http.Client{Timeout: config.Timeout}}
+}
+
+func (s *elasticsearchSink) encode(record *FlowRecord) (interface{}, error) {
+	buffer := jsonBufferPool.Get().(*[]byte)
+	serialized, err := record.AppendJSON((*buffer)[:0])
+	if err != nil {
+		jsonBufferPool.Put(buffer)
+		return nil, err
+	}
+	*buffer = serialized
+	return &elasticsearchDocument{index: s.config.index(record), source: buffer}, nil
+}
+
+func (s *elasticsearchSink) write(directory string, records <-chan interface{}) error {
+	batches := make(chan *elasticsearchBatch, s.config.QueueSize)
+	senderDone := make(chan error, 1)
+	go func() {
+		for batch := range batches {
+			if err := s.send(batch); err != nil {
+				senderDone <- err
+				return
+			}
+		}
+		senderDone <- nil
+	}()
+
+	// enqueue blocks until the batch can be queued. Returns the error of the sender, if it stopped.
+	enqueue := func(batch *elasticsearchBatch) error {
+		select {
+		case batches <- batch:
+			return nil
+		case err := <-senderDone:
+			return err
+		}
+	}
+
+	// Without a flush interval, tick stays nil and never fires
+	var tick <-chan time.Time
+	if s.config.FlushInterval > 0 {
+		ticker := time.NewTicker(s.config.FlushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	fmt.Println("Elasticsearch export routine successfully setup.")
+	start := time.Now()
+
+	var numFlows int64
+	batch := &elasticsearchBatch{}
+	for {
+		select {
+		case record, ok := <-records:
+			if !ok {
+				if len(batch.offsets) > 0 {
+					if err := enqueue(batch); err != nil {
+						return err
+					}
+				}
+				close(batches)
+				if err := <-senderDone; err != nil {
+					return err
+				}
+				fmt.Println("Finished sending to elasticsearch. Took:\t", time.Since(start))
+				fmt.Printf("Elasticsearch export successful. Exported:\t %s flow metrics\n", humanize.Comma(numFlows-s.rejected))
+				if s.rejected > 0 {
+					return fmt.Errorf("elasticsearch rejected %d flows, first error: %s", s.rejected, s.firstReject)
+				}
+				return nil
+			}
+			document := record.(*elasticsearchDocument)
+			batch.add(document)
+			jsonBufferPool.Put(document.source)
+			numFlows++
+			if len(batch.offsets) >= s.config.BatchSize || len(batch.body) >= elasticsearchMaxBatchBytes {
+				if err := enqueue(batch); err != nil {
+					return err
+				}
+				batch = &elasticsearchBatch{}
+			}
+		case <-tick:
+			if len(batch.offsets) > 0 {
+				if err := enqueue(batch); err != nil {
+					return err
+				}
+				batch = &elasticsearchBatch{}
+			}
+		}
+	}
+}
+
+// send sends the batch to the bulk API. Failed requests and documents which are rejected temporarily are retried.
+// Documents which are rejected permanently are counted. Returns an error if the retries are exhausted
+// or the request is rejected permanently (e.g. due to a wrong URL or missing authorization).
+func (s *elasticsearchSink) send(batch *elasticsearchBatch) error {
+	backoff := s.config.RetryBackoff
+	for retry := 0; ; retry++ {
+		retryBatch, err := s.post(batch)
+		if err == nil && retryBatch == nil {
+			return nil
+		}
+		if err == nil {
+			err = fmt.Errorf("%d flows were rejected temporarily", len(retryBatch.offsets))
+			batch = retryBatch
+		}
+		if _, ok := err.(permanentError); ok {
+			return fmt.Errorf("bulk request to elasticsearch failed: %v", err)
+		}
+		if retry >= s.config.MaxRetries {
+			return fmt.Errorf("bulk request to elasticsearch failed after %d retries: %v", retry, err)
+		}
+		fmt.Printf("Bulk request to elasticsearch failed, retrying in %s: %v\n", backoff, err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > elasticsearchMaxRetryBackoff {
+			backoff = elasticsearchMaxRetryBackoff
+		}
+	}
+}
+
+// permanentError is an error of a bulk request which is not retried
+type permanentError struct {
+	error
+}
+
+// post sends one bulk request. Returns the batch of the documents which should be retried, or nil if there are none.
+func (s *elasticsearchSink) post(batch *elasticsearchBatch) (*elasticsearchBatch, error) {
+	request, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(s.config.URL, "/")+"/_bulk", bytes.NewReader(batch.body))
+	if err != nil {
+		return nil, permanentError{err}
+	}
+	request.Header.Set("Content-Type", "application/x-ndjson")
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		err = fmt.Errorf("status %s: %s", response.Status, truncate(string(body), 200))
+		if !retryableStatus(response.StatusCode) {
+			return nil, permanentError{err}
+		}
+		return nil, err
+	}
+
+	var result elasticsearchBulkResponse
+	if err = json.Unmarshal(body, &result); err != nil {
+		return nil, permanentError{fmt.Errorf("invalid response of the bulk API: %v", err)}
+	}
+	if !result.Errors {
+		return nil, nil
+	}
+	if len(result.Items) != len(batch.offsets) {
+		return nil, permanentError{fmt.Errorf("bulk API returned %d items for %d flows", len(result.Items), len(batch.offsets))}
+	}
+
+	var retryBatch *elasticsearchBatch
+	for i, item := range result.Items {
+		for _, action := range item {
+			switch {
+			case action.Status >= 200 && action.Status < 300:
+			case retryableStatus(action.Status):
+				if retryBatch == nil {
+					retryBatch = &elasticsearchBatch{}
+				}
+				retryBatch.offsets = append(retryBatch.offsets, len(retryBatch.body))
+				retryBatch.body = append(retryBatch.body, batch.document(i)...)
+			default:
+				if s.rejected == 0 {
+					s.firstReject = truncate(string(action.Error), 200)
+				}
+				s.rejected++
+			}
+		}
+	}
+	return retryBatch, nil
+}
+
+// retryableStatus returns whether a request or document with this HTTP status should be retried
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// truncate returns the first n bytes of s
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
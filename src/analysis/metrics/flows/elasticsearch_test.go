@@ -0,0 +1,195 @@
+package flows
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bulkResponse is a scripted response of the bulk API
+type bulkResponse struct {
+	status int
+	body   string
+}
+
+// bulkServer responds with the scripted responses in order (the last one is repeated) and records the request bodies
+type bulkServer struct {
+	*httptest.Server
+	mutex     sync.Mutex
+	responses []bulkResponse
+	bodies    []string
+}
+
+func newBulkServer(t *testing.T, responses ...bulkResponse) *bulkServer {
+	s := &bulkServer{responses: responses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("request to %s with content type %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		response := s.responses[len(s.responses)-1]
+		if len(s.bodies) < len(s.responses) {
+			response = s.responses[len(s.bodies)]
+		}
+		s.bodies = append(s.bodies, string(body))
+		w.WriteHeader(response.status)
+		_, _ = w.Write([]byte(response.body))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *bulkServer) requests() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.bodies...)
+}
+
+// bulkItems returns a response of the bulk API with one item per status
+func bulkItems(statuses ...int) string {
+	items := make([]string, len(statuses))
+	errors := false
+	for i, status := range statuses {
+		items[i] = fmt.Sprintf(`{"index":{"status":%d}}`, status)
+		if status >= 300 {
+			items[i] = fmt.Sprintf(`{"index":{"status":%d,"error":{"type":"error_%d"}}}`, status, status)
+			errors = true
+		}
+	}
+	return fmt.Sprintf(`{"took":1,"errors":%v,"items":[%s]}`, errors, strings.Join(items, ","))
+}
+
+// elasticsearchTestRecords returns flows starting at the given days of September 2020
+func elasticsearchTestRecords(days ...int) []*FlowRecord {
+	records := make([]*FlowRecord, len(days))
+	for i, day := range days {
+		start := time.Date(2020, time.September, day, 12, 0, 0, 0, time.UTC).UnixNano()
+		records[i] = &FlowRecord{HasProtocol: true, Protocol: "UDP", PortClient: uint16(50000 + i), PortServer: 53,
+			HasDuration: true, Start: start, End: start + int64(time.Second), Duration: int64(time.Second)}
+	}
+	return records
+}
+
+// bulkLines returns the lines of the bulk request of the records in index
+func bulkLines(t *testing.T, index string, records ...*FlowRecord) string {
+	var b strings.Builder
+	for _, record := range records {
+		source, err := record.AppendJSON(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&b, "{\"index\":{\"_index\":\"%s\"}}\n%s\n", index, source)
+	}
+	return b.String()
+}
+
+// writeToElasticsearch writes the records with the sink of config and returns the error of write
+func writeToElasticsearch(t *testing.T, config ElasticsearchConfig, records []*FlowRecord) error {
+	s := newElasticsearchSink(config)
+	channel := make(chan interface{}, len(records))
+	for _, record := range records {
+		encoded, err := s.encode(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		channel <- encoded
+	}
+	close(channel)
+	return s.write("", channel)
+}
+
+func elasticsearchTestConfig(url string) ElasticsearchConfig {
+	config := DefaultElasticsearchConfig()
+	config.URL = url
+	config.BatchSize = 2
+	config.FlushInterval = 0
+	config.MaxRetries = 2
+	config.RetryBackoff = time.Millisecond
+	return config
+}
+
+func TestElasticsearchIndex(t *testing.T) {
+	record := elasticsearchTestRecords(13)[0]
+	tests := []struct {
+		index    string
+		record   *FlowRecord
+		expected string
+	}{
+		{"flow-metrics-{date}", record, "flow-metrics-2020.09.13"},
+		{"flows", record, "flows"},
+		{"{date}-flows-{date}", record, "2020.09.13-flows-2020.09.13"},
+		{"flow-metrics-{date}", &FlowRecord{}, "flow-metrics-" + time.Now().UTC().Format("2006.01.02")},
+	}
+	for _, test := range tests {
+		if index := (ElasticsearchConfig{Index: test.index}).index(test.record); index != test.expected {
+			t.Errorf("%s: index is %s, expected %s", test.index, index, test.expected)
+		}
+	}
+}
+
+func TestElasticsearchBulkRequests(t *testing.T) {
+	records := elasticsearchTestRecords(13, 13, 14)
+	server := newBulkServer(t, bulkResponse{http.StatusOK, bulkItems(201, 201)}, bulkResponse{http.StatusOK, bulkItems(201)})
+	if err := writeToElasticsearch(t, elasticsearchTestConfig(server.URL), records); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		bulkLines(t, "flow-metrics-2020.09.13", records[0], records[1]),
+		bulkLines(t, "flow-metrics-2020.09.14", records[2]),
+	}
+	if requests := server.requests(); strings.Join(requests, "") != strings.Join(expected, "") || len(requests) != len(expected) {
+		t.Fatalf("requests are\n%s\nexpected\n%s", strings.Join(requests, "---\n"), strings.Join(expected, "---\n"))
+	}
+}
+
+func TestElasticsearchRetries(t *testing.T) {
+	records := elasticsearchTestRecords(13, 14)
+	both := bulkLines(t, "flow-metrics-2020.09.13", records[0]) + bulkLines(t, "flow-metrics-2020.09.14", records[1])
+	second := bulkLines(t, "flow-metrics-2020.09.14", records[1])
+	tests := []struct {
+		name      string
+		responses []bulkResponse
+		requests  []string
+		err       string
+	}{
+		{"too many requests", []bulkResponse{{http.StatusTooManyRequests, ""}, {http.StatusOK, bulkItems(201, 201)}}, []string{both, both}, ""},
+		{"server error", []bulkResponse{{http.StatusServiceUnavailable, ""}, {http.StatusOK, bulkItems(201, 201)}}, []string{both, both}, ""},
+		{"client error is not retried", []bulkResponse{{http.StatusBadRequest, "bad request"}}, []string{both}, "400 Bad Request: bad request"},
+		{"retries are exhausted", []bulkResponse{{http.StatusInternalServerError, ""}}, []string{both, both, both}, "after 2 retries"},
+		{"rejected documents are retried", []bulkResponse{{http.StatusOK, bulkItems(201, 429)}, {http.StatusOK, bulkItems(201)}}, []string{both, second}, ""},
+		{"invalid documents are not retried", []bulkResponse{{http.StatusOK, bulkItems(400, 201)}}, []string{both}, "rejected 1 flows, first error: {\"type\":\"error_400\"}"},
+		{"invalid response", []bulkResponse{{http.StatusOK, "{"}}, []string{both}, "invalid response"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newBulkServer(t, test.responses...)
+			err := writeToElasticsearch(t, elasticsearchTestConfig(server.URL), records)
+			if (err == nil) != (test.err == "") || (err != nil && !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("error is %v, expected %q", err, test.err)
+			}
+			if requests := server.requests(); strings.Join(requests, "---\n") != strings.Join(test.requests, "---\n") {
+				t.Fatalf("requests are\n%s\nexpected\n%s", strings.Join(requests, "---\n"), strings.Join(test.requests, "---\n"))
+			}
+		})
+	}
+}
+
+func TestElasticsearchUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + listener.Addr().String()
+	_ = listener.Close()
+	if err = writeToElasticsearch(t, elasticsearchTestConfig(url), elasticsearchTestRecords(13)); err == nil || !strings.Contains(err.Error(), "after 2 retries") {
+		t.Fatalf("error is %v, expected that the retries are exhausted", err)
+	}
+}
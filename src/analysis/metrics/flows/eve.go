@@ -0,0 +1,193 @@
+package flows
+
+// This file contains the EVE output of the flow metrics, which writes the flows like the flow events of Suricata.
+// FormatEVE writes eve.json with one event per line, e.g.
+//
+//	{"timestamp":"2020-09-13T12:26:40.515058+0000","flow_id":1234,"event_type":"flow","src_ip":"10.0.7.119","src_port":21911,
+//	 "dest_ip":"192.168.0.12","dest_port":80,"proto":"TCP","community_id":"1:...","flow":{"pkts_toserver":6,"pkts_toclient":4,
+//	 "bytes_toserver":742,"bytes_toclient":2799,"start":"...","end":"...","age":2,"state":"closed","reason":"timeout","alerted":false},
+//	 "tcp":{"tcp_flags":"17","tcp_flags_ts":"17","tcp_flags_tc":"16","syn":true,"fin":true,"rst":true,"ack":true}}
+//
+// The client of a flow is the source, the server the destination. The timestamps are in UTC, the timestamp of the event is the start of the flow.
+// In contrast to Suricata, the bytes are the payload bytes. The tcp object is only written for TCP flows,
+// its flags are the flags recorded by the pools (FIN, SYN, RST and ACK). The reasons idle, fin, rst and active are written as timeout.
+// flow_id is derived from the addresses, ports and start of the flow. The metrics required by the fields (eveMetrics) are enabled automatically.
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"test.com/scale/src/analysis/flows"
+	"time"
+
+	"github.com/cespare/xxhash"
+	"github.com/dustin/go-humanize"
+)
+
+// eveMetrics are the metrics required by the EVE output
+var eveMetrics = []string{"protocol", "duration", "size", "packets", "tcpFlags", "termination"}
+
+// eveTimeFormat is the format of the timestamps of Suricata
+const eveTimeFormat = "2006-01-02T15:04:05.000000-0700"
+
+// eveFlowIDMask limits the flow ids to 51 bits, so they are exact in JSON parsers using doubles
+const eveFlowIDMask = 1<<51 - 1
+
+// appendEVETime appends the timestamp in ns in the format of Suricata
+func appendEVETime(b []byte, ns int64) []byte {
+	b = append(b, '"')
+	b = time.Unix(0, ns).UTC().AppendFormat(b, eveTimeFormat)
+	return append(b, '"')
+}
+
+// appendEVETCPFlags appends the flags as hex string, like Suricata
+func appendEVETCPFlags(b []byte, flags uint8) []byte {
+	const digits = "0123456789abcdef"
+	return append(b, '"', digits[flags>>4], digits[flags&0x0f], '"')
+}
+
+// eveFlowState returns the state of the flow as in the flow events of Suricata
+func eveFlowState(r *FlowRecord) string {
+	if r.HasTCPFlags && (r.TCPFlags&flows.TCPFlagRST != 0 || r.TCPFlagsClient&r.TCPFlagsServer&flows.TCPFlagFIN != 0) {
+		return "closed"
+	}
+	if r.HasPackets && r.PacketsClient > 0 && r.PacketsServer > 0 {
+		return "established"
+	}
+	return "new"
+}
+
+// eveReason returns the reason of the flow event: timeout, forced or shutdown. Interim records of the active timeout are written as timeout.
+func eveReason(terminationReason string) string {
+	switch terminationReason {
+	case flows.TerminationIdle.String(), flows.TerminationFIN.String(), flows.TerminationRST.String(), flows.TerminationActive.String():
+		return "timeout"
+	default:
+		return terminationReason
+	}
+}
+
+// eveSink writes the flows to eve.json
+type eveSink struct{}
+
+func (s *eveSink) encode(r *FlowRecord) (interface{}, error) {
+	b := make([]byte, 0, 768)
+	b = append(b, '{')
+	if r.HasDuration {
+		b = append(b, `"timestamp":`...)
+		b = appendEVETime(b, r.Start)
+		b = append(b, ',')
+	}
+	b = append(b, `"flow_id":`...)
+	b = strconv.AppendUint(b, xxhash.Sum64(r.appendIdentity(nil))&eveFlowIDMask, 10)
+	b = append(b, `,"event_type":"flow"`...)
+	if r.HasProtocol {
+		var err error
+		b = append(b, `,"src_ip":`...)
+		if b, err = appendJSONIP(b, r.FullClientAddr); err != nil {
+			return nil, err
+		}
+		b = append(b, `,"src_port":`...)
+		b = strconv.AppendUint(b, uint64(r.PortClient), 10)
+		b = append(b, `,"dest_ip":`...)
+		if b, err = appendJSONIP(b, r.FullServerAddr); err != nil {
+			return nil, err
+		}
+		b = append(b, `,"dest_port":`...)
+		b = strconv.AppendUint(b, uint64(r.PortServer), 10)
+		b = append(b, `,"proto":`...)
+		b = appendJSONString(b, r.Protocol)
+		if r.CommunityID != "" {
+			b = append(b, `,"community_id":`...)
+			b = appendJSONString(b, r.CommunityID)
+		}
+	}
+
+	b = append(b, `,"flow":{`...)
+	if r.HasPackets {
+		b = append(b, `"pkts_toserver":`...)
+		b = strconv.AppendUint(b, uint64(r.PacketsClient), 10)
+		b = append(b, `,"pkts_toclient":`...)
+		b = strconv.AppendUint(b, uint64(r.PacketsServer), 10)
+		b = append(b, ',')
+	}
+	if r.HasSize {
+		b = append(b, `"bytes_toserver":`...)
+		b = strconv.AppendUint(b, uint64(r.SizeClient), 10)
+		b = append(b, `,"bytes_toclient":`...)
+		b = strconv.AppendUint(b, uint64(r.SizeServer), 10)
+		b = append(b, ',')
+	}
+	if r.HasDuration {
+		b = append(b, `"start":`...)
+		b = appendEVETime(b, r.Start)
+		b = append(b, `,"end":`...)
+		b = appendEVETime(b, r.End)
+		b = append(b, `,"age":`...)
+		b = strconv.AppendInt(b, r.End/int64(time.Second)-r.Start/int64(time.Second), 10)
+		b = append(b, ',')
+	}
+	b = append(b, `"state":`...)
+	b = appendJSONString(b, eveFlowState(r))
+	if r.HasTermination {
+		b = append(b, `,"reason":`...)
+		b = appendJSONString(b, eveReason(r.TerminationReason))
+	}
+	b = append(b, `,"alerted":false}`...)
+
+	if r.HasTCPFlags {
+		b = append(b, `,"tcp":{"tcp_flags":`...)
+		b = appendEVETCPFlags(b, r.TCPFlags)
+		b = append(b, `,"tcp_flags_ts":`...)
+		b = appendEVETCPFlags(b, r.TCPFlagsClient)
+		b = append(b, `,"tcp_flags_tc":`...)
+		b = appendEVETCPFlags(b, r.TCPFlagsServer)
+		for _, flag := range []struct {
+			name string
+			bit  uint8
+		}{{"syn", flows.TCPFlagSYN}, {"fin", flows.TCPFlagFIN}, {"rst", flows.TCPFlagRST}, {"ack", flows.TCPFlagACK}} {
+			if r.TCPFlags&flag.bit != 0 {
+				b = append(b, `,"`...)
+				b = append(b, flag.name...)
+				b = append(b, `":true`...)
+			}
+		}
+		b = append(b, '}')
+	}
+	return append(b, '}', '\n'), nil
+}
+
+func (s *eveSink) write(directory string, records <-chan interface{}) error {
+	filename := path.Join(directory, "eve.json")
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("could not create '%s': %v", filename, err)
+	}
+	buffer := bufio.NewWriter(f)
+
+	fmt.Println("EVE export routine successfully setup.")
+	start := time.Now()
+
+	var numFlows int64
+	for record := range records {
+		if _, err = buffer.Write(record.([]byte)); err != nil {
+			_ = f.Close()
+			return fmt.Errorf("error writing to '%s': %v", filename, err)
+		}
+		numFlows++
+	}
+
+	if err = buffer.Flush(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error writing to '%s': %v", filename, err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("error closing '%s': %v", filename, err)
+	}
+
+	fmt.Println("Finished writing eve.json. Took:\t", time.Since(start))
+	fmt.Printf("EVE export successful. Exported:\t %s flow metrics\n", humanize.Comma(numFlows))
+	return nil
+}
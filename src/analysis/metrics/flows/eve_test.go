@@ -0,0 +1,71 @@
+package flows
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/cespare/xxhash"
+)
+
+func TestEVEEncode(t *testing.T) {
+	tcp := &FlowRecord{
+		HasProtocol: true, Protocol: "TCP", PortClient: 21911, PortServer: 80,
+		FullClientAddr: net.ParseIP("10.0.7.119").To4(), FullServerAddr: net.ParseIP("192.168.0.12").To4(), CommunityID: "1:abc",
+		HasDuration: true, Start: 1600000000515058000, End: 1600000003015058000, Duration: 2500000000,
+		HasSize: true, Size: 3541, SizeClient: 742, SizeServer: 2799,
+		HasPackets: true, Packets: 10, PacketsClient: 6, PacketsServer: 4,
+		HasTCPFlags: true, TCPFlags: 0x13, TCPFlagsClient: 0x13, TCPFlagsServer: 0x11,
+		HasTermination: true, TerminationReason: "fin",
+	}
+	udp := &FlowRecord{
+		HasProtocol: true, Protocol: "UDP", PortClient: 54585, PortServer: 53,
+		FullClientAddr: net.ParseIP("2001:db8::1"), FullServerAddr: net.ParseIP("2001:db8::53"),
+		HasPackets: true, Packets: 1, PacketsClient: 1,
+		HasTermination: true, TerminationReason: "shutdown",
+	}
+	tests := []struct {
+		name     string
+		record   *FlowRecord
+		expected string
+	}{
+		{"closed tcp flow", tcp, `{"timestamp":"2020-09-13T12:26:40.515058+0000","flow_id":%d,"event_type":"flow","src_ip":"10.0.7.119","src_port":21911,` +
+			`"dest_ip":"192.168.0.12","dest_port":80,"proto":"TCP","community_id":"1:abc","flow":{"pkts_toserver":6,"pkts_toclient":4,` +
+			`"bytes_toserver":742,"bytes_toclient":2799,"start":"2020-09-13T12:26:40.515058+0000","end":"2020-09-13T12:26:43.015058+0000","age":3,` +
+			`"state":"closed","reason":"timeout","alerted":false},"tcp":{"tcp_flags":"13","tcp_flags_ts":"13","tcp_flags_tc":"11","syn":true,"fin":true,"ack":true}}` + "\n"},
+		{"new udp flow without duration", udp, `{"flow_id":%d,"event_type":"flow","src_ip":"2001:db8::1","src_port":54585,"dest_ip":"2001:db8::53","dest_port":53,"proto":"UDP",` +
+			`"flow":{"pkts_toserver":1,"pkts_toclient":0,"state":"new","reason":"shutdown","alerted":false}}` + "\n"},
+	}
+	sink := &eveSink{}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, err := sink.encode(test.record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := fmt.Sprintf(test.expected, xxhash.Sum64(test.record.appendIdentity(nil))&eveFlowIDMask)
+			if line := string(encoded.([]byte)); line != expected {
+				t.Fatalf("encoded\n%s\nexpected\n%s", line, expected)
+			}
+		})
+	}
+}
+
+func TestEVEFlowState(t *testing.T) {
+	tests := []struct {
+		name     string
+		record   FlowRecord
+		expected string
+	}{
+		{"one direction", FlowRecord{HasPackets: true, PacketsClient: 3}, "new"},
+		{"both directions", FlowRecord{HasPackets: true, PacketsClient: 3, PacketsServer: 2}, "established"},
+		{"fin of one side", FlowRecord{HasPackets: true, PacketsClient: 3, PacketsServer: 2, HasTCPFlags: true, TCPFlags: 0x01, TCPFlagsClient: 0x01}, "established"},
+		{"fin of both sides", FlowRecord{HasTCPFlags: true, TCPFlags: 0x01, TCPFlagsClient: 0x01, TCPFlagsServer: 0x01}, "closed"},
+		{"rst", FlowRecord{HasTCPFlags: true, TCPFlags: 0x04, TCPFlagsServer: 0x04}, "closed"},
+	}
+	for _, test := range tests {
+		if state := eveFlowState(&test.record); state != test.expected {
+			t.Errorf("%s: state is %s, expected %s", test.name, state, test.expected)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package flows
+
+// This file contains the JSON encoder of FlowRecord.
+// The output is the same as encoding/json produces for a map of the set fields: the keys are sorted
+// and the values are encoded like encoding/json does, but without reflection.
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// recordField is a field of FlowRecord in the JSON output
+type recordField struct {
+	name        string
+	isSet       func(r *FlowRecord) bool
+	appendValue func(b []byte, r *FlowRecord) ([]byte, error)
+}
+
+// recordFields contains the fields of FlowRecord sorted by name, like encoding/json sorts the keys of maps
+var recordFields = []recordField{
+	{"AllPacketsZMap", hasProtocol, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendBool(b, r.AllPacketsZMap), nil
+	}},
+	{"ClientInterface", hasProtocol, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return appendJSONBytes(b, r.ClientInterface), nil
+	}},
+	{"FirstPacketWasZMap", hasProtocol, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendBool(b, r.FirstPacketWasZMap), nil
+	}},
+	{"FullClientAddr", hasProtocol, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return appendJSONIP(b, r.FullClientAddr)
+	}},
+	{"FullServerAddr", hasProtocol, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return appendJSONIP(b, r.FullServerAddr)
+	}},
+	{"ServerClientUnclear", hasProtocol, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendBool(b, r.ServerClientUnclear), nil
+	}},
+	{"ServerInterface", hasProtocol, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return appendJSONBytes(b, r.ServerInterface), nil
+	}},
+	{"addressClient", hasProtocol, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendInt(b, r.AddressClient, 10), nil
+	}},
+	{"addressServer", hasProtocol, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendInt(b, r.AddressServer, 10), nil
+	}},
+	{"communityID", hasProtocol, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return appendJSONString(b, r.CommunityID), nil
+	}},
+	{"connState", hasConnState, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return appendJSONString(b, r.ConnState), nil
+	}},
+	{"duration", hasDuration, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendInt(b, r.Duration, 10), nil
+	}},
+	{"end", hasDuration, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendInt(b, r.End, 10), nil
+	}},
+	{"flowRates", hasRates, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return appendJSONUints(b, r.FlowRates), nil
+	}},
+	{"flowRatesClient", hasRates, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return appendJSONUints(b, r.FlowRatesClient), nil
+	}},
+	{"flowRatesServer", hasRates, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return appendJSONUints(b, r.FlowRatesServer), nil
+	}},
+	{"fragment", hasFragment, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendUint(b, uint64(r.Fragment), 10), nil
+	}},
+	{"handshakeCompleted", hasTCPFlags, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendBool(b, r.HandshakeCompleted), nil
+	}},
+	{"history", hasConnState, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return appendJSONString(b, r.History), nil
+	}},
+	{"lastFragment", hasFragment, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendBool(b, r.LastFragment), nil
+	}},
+	{"packets", hasPackets, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendUint(b, uint64(r.Packets), 10), nil
+	}},
+	{"packetsClient", hasPackets, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendUint(b, uint64(r.PacketsClient), 10), nil
+	}},
+	{"packetsServer", hasPackets, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendUint(b, uint64(r.PacketsServer), 10), nil
+	}},
+	{"portClient", hasProtocol, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendUint(b, uint64(r.PortClient), 10), nil
+	}},
+	{"portServer", hasProtocol, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendUint(b, uint64(r.PortServer), 10), nil
+	}},
+	{"protocol", hasProtocol, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return appendJSONString(b, r.Protocol), nil
+	}},
+	{"rrps", hasRRPs, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return appendJSONRRPs(b, r.RRPs), nil
+	}},
+	{"size", hasSize, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendUint(b, uint64(r.Size), 10), nil
+	}},
+	{"sizeClient", hasSize, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendUint(b, uint64(r.SizeClient), 10), nil
+	}},
+	{"sizeServer", hasSize, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendUint(b, uint64(r.SizeServer), 10), nil
+	}},
+	{"start", hasDuration, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendInt(b, r.Start, 10), nil
+	}},
+	{"tcpFlags", hasTCPFlags, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendUint(b, uint64(r.TCPFlags), 10), nil
+	}},
+	{"tcpFlagsClient", hasTCPFlags, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendUint(b, uint64(r.TCPFlagsClient), 10), nil
+	}},
+	{"tcpFlagsFirst", hasTCPFlags, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendUint(b, uint64(r.TCPFlagsFirst), 10), nil
+	}},
+	{"tcpFlagsLast", hasTCPFlags, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendUint(b, uint64(r.TCPFlagsLast), 10), nil
+	}},
+	{"tcpFlagsServer", hasTCPFlags, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return strconv.AppendUint(b, uint64(r.TCPFlagsServer), 10), nil
+	}},
+	{"terminationReason", hasTermination, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return appendJSONString(b, r.TerminationReason), nil
+	}},
+	{"timeoutProfile", hasTermination, func(b []byte, r *FlowRecord) ([]byte, error) {
+		return appendJSONString(b, r.TimeoutProfile), nil
+	}},
+}
+
+func init() {
+	if !sort.SliceIsSorted(recordFields, func(i, j int) bool { return recordFields[i].name < recordFields[j].name }) {
+		panic("recordFields must be sorted by name")
+	}
+}
+
+func hasProtocol(r *FlowRecord) bool    { return r.HasProtocol }
+func hasDuration(r *FlowRecord) bool    { return r.HasDuration }
+func hasRates(r *FlowRecord) bool       { return r.HasRates }
+func hasSize(r *FlowRecord) bool        { return r.HasSize }
+func hasPackets(r *FlowRecord) bool     { return r.HasPackets }
+func hasRRPs(r *FlowRecord) bool        { return r.HasRRPs }
+func hasConnState(r *FlowRecord) bool   { return r.HasConnState }
+func hasTCPFlags(r *FlowRecord) bool    { return r.HasTCPFlags }
+func hasTermination(r *FlowRecord) bool { return r.HasTermination }
+func hasFragment(r *FlowRecord) bool    { return r.HasFragment }
+
+// AppendJSON appends the JSON object of the record to b.
+// The set fields and the extra values are written in the order of their names.
+func (r *FlowRecord) AppendJSON(b []byte) ([]byte, error) {
+	var extraKeys []string
+	if len(r.Extra) > 0 {
+		extraKeys = make([]string, 0, len(r.Extra))
+		for key := range r.Extra {
+			extraKeys = append(extraKeys, key)
+		}
+		sort.Strings(extraKeys)
+	}
+
+	var err error
+	first := true
+	appendKey := func(name string) {
+		if !first {
+			b = append(b, ',')
+		}
+		first = false
+		b = appendJSONString(b, name)
+		b = append(b, ':')
+	}
+	appendExtra := func(key string) error {
+		value, err := json.Marshal(r.Extra[key])
+		if err != nil {
+			return fmt.Errorf("error during json marshalling of %s: %v", key, err)
+		}
+		appendKey(key)
+		b = append(b, value...)
+		return nil
+	}
+
+	b = append(b, '{')
+	for _, field := range recordFields {
+		for len(extraKeys) > 0 && extraKeys[0] < field.name {
+			if err = appendExtra(extraKeys[0]); err != nil {
+				return nil, err
+			}
+			extraKeys = extraKeys[1:]
+		}
+		if !field.isSet(r) {
+			continue
+		}
+		appendKey(field.name)
+		if b, err = field.appendValue(b, r); err != nil {
+			return nil, fmt.Errorf("error during json marshalling of %s: %v", field.name, err)
+		}
+	}
+	for _, key := range extraKeys {
+		if err = appendExtra(key); err != nil {
+			return nil, err
+		}
+	}
+	return append(b, '}'), nil
+}
+
+// appendJSONString appends s as JSON string. Strings which encoding/json would escape are encoded by encoding/json.
+func appendJSONString(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c >= utf8.RuneSelf || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+			encoded, _ := json.Marshal(s)
+			return append(b, encoded...)
+		}
+	}
+	b = append(b, '"')
+	b = append(b, s...)
+	return append(b, '"')
+}
+
+// appendJSONBytes appends value as base64 string, or null if it is nil
+func appendJSONBytes(b []byte, value []byte) []byte {
+	if value == nil {
+		return append(b, "null"...)
+	}
+	b = append(b, '"')
+	start := len(b)
+	b = append(b, make([]byte, base64.StdEncoding.EncodedLen(len(value)))...)
+	base64.StdEncoding.Encode(b[start:], value)
+	return append(b, '"')
+}
+
+// appendJSONIP appends the textual representation of ip, like net.IP.MarshalText
+func appendJSONIP(b []byte, ip net.IP) ([]byte, error) {
+	if len(ip) == 0 {
+		return append(b, `""`...), nil
+	}
+	if len(ip) != net.IPv4len && len(ip) != net.IPv6len {
+		return nil, fmt.Errorf("invalid IP address of length %d", len(ip))
+	}
+	return appendJSONString(b, ip.String()), nil
+}
+
+// appendJSONUints appends values as JSON array, or null if it is nil
+func appendJSONUints(b []byte, values []uint) []byte {
+	if values == nil {
+		return append(b, "null"...)
+	}
+	b = append(b, '[')
+	for i, value := range values {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = strconv.AppendUint(b, uint64(value), 10)
+	}
+	return append(b, ']')
+}
+
+// appendJSONRRPs appends the rrps as JSON array of arrays, or null if it is nil
+func appendJSONRRPs(b []byte, rrps [][2]uint16) []byte {
+	if rrps == nil {
+		return append(b, "null"...)
+	}
+	b = append(b, '[')
+	for i, rrp := range rrps {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, '[')
+		b = strconv.AppendUint(b, uint64(rrp[0]), 10)
+		b = append(b, ',')
+		b = strconv.AppendUint(b, uint64(rrp[1]), 10)
+		b = append(b, ']')
+	}
+	return append(b, ']')
+}
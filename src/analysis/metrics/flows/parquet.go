@@ -0,0 +1,303 @@
+package flows
+
+// This file contains the Parquet output of the flow metrics.
+// Each flow is converted to a parquetFlowRecord by the pools and written by the parquetSink.
+// The columns are named like the keys of the JSON output. Columns of metrics which are not selected are null.
+// The extra values of the records (set by metrics of other packages) are stored as JSON in the column extra.
+// The version of FlowRecord is stored in the metadata of the file (key flowRecordVersion).
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// DefaultParquetRowGroupSize is the default size of a row group in bytes
+const DefaultParquetRowGroupSize = 128 * 1024 * 1024
+
+// parquetWriterParallelism is the number of goroutines the Parquet writer uses to encode a row group
+const parquetWriterParallelism = 4
+
+// parquetCompressions maps the names of the supported compression codecs to the codecs
+var parquetCompressions = map[string]parquet.CompressionCodec{
+	"none":   parquet.CompressionCodec_UNCOMPRESSED,
+	"snappy": parquet.CompressionCodec_SNAPPY,
+	"gzip":   parquet.CompressionCodec_GZIP,
+	"zstd":   parquet.CompressionCodec_ZSTD,
+	"lz4":    parquet.CompressionCodec_LZ4,
+}
+
+// ParquetConfig configures the Parquet output
+type ParquetConfig struct {
+	RowGroupSize int64  // Size of a row group in bytes
+	Compression  string // Compression codec, see ParquetCompressions
+}
+
+// DefaultParquetConfig returns the default configuration of the Parquet output
+func DefaultParquetConfig() ParquetConfig {
+	return ParquetConfig{RowGroupSize: DefaultParquetRowGroupSize, Compression: "snappy"}
+}
+
+// ParquetCompressions returns the names of the supported compression codecs in alphabetical order
+func ParquetCompressions() []string {
+	names := make([]string, 0, len(parquetCompressions))
+	for name := range parquetCompressions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check returns an error if the configuration is invalid
+func (c ParquetConfig) Check() error {
+	if c.RowGroupSize <= 0 {
+		return fmt.Errorf("row group size must be positive")
+	}
+	if _, ok := parquetCompressions[c.Compression]; !ok {
+		return fmt.Errorf("unknown compression %s (available: %s)", c.Compression, strings.Join(ParquetCompressions(), ","))
+	}
+	return nil
+}
+
+// parquetFlowRecord is a row of the Parquet output.
+// Unsigned values are stored in signed fields of the same size with an unsigned annotation, as required by the writer.
+type parquetFlowRecord struct {
+	Protocol            *string `parquet:"name=protocol, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	PortClient          *int32  `parquet:"name=portClient, type=INT32, convertedtype=UINT_16"`
+	PortServer          *int32  `parquet:"name=portServer, type=INT32, convertedtype=UINT_16"`
+	AddressClient       *int64  `parquet:"name=addressClient, type=INT64"`
+	AddressServer       *int64  `parquet:"name=addressServer, type=INT64"`
+	ClientInterface     *string `parquet:"name=ClientInterface, type=BYTE_ARRAY"`
+	ServerInterface     *string `parquet:"name=ServerInterface, type=BYTE_ARRAY"`
+	ServerClientUnclear *bool   `parquet:"name=ServerClientUnclear, type=BOOLEAN"`
+	FullClientAddr      *string `parquet:"name=FullClientAddr, type=BYTE_ARRAY, convertedtype=UTF8"`
+	FullServerAddr      *string `parquet:"name=FullServerAddr, type=BYTE_ARRAY, convertedtype=UTF8"`
+	FirstPacketWasZMap  *bool   `parquet:"name=FirstPacketWasZMap, type=BOOLEAN"`
+	AllPacketsZMap      *bool   `parquet:"name=AllPacketsZMap, type=BOOLEAN"`
+	CommunityID         *string `parquet:"name=communityID, type=BYTE_ARRAY, convertedtype=UTF8"`
+
+	Start    *int64 `parquet:"name=start, type=INT64"`
+	End      *int64 `parquet:"name=end, type=INT64"`
+	Duration *int64 `parquet:"name=duration, type=INT64"`
+
+	FlowRates       *[]int64 `parquet:"name=flowRates, type=LIST, valuetype=INT64, valueconvertedtype=UINT_64"`
+	FlowRatesClient *[]int64 `parquet:"name=flowRatesClient, type=LIST, valuetype=INT64, valueconvertedtype=UINT_64"`
+	FlowRatesServer *[]int64 `parquet:"name=flowRatesServer, type=LIST, valuetype=INT64, valueconvertedtype=UINT_64"`
+
+	Size       *int64 `parquet:"name=size, type=INT64, convertedtype=UINT_64"`
+	SizeClient *int64 `parquet:"name=sizeClient, type=INT64, convertedtype=UINT_64"`
+	SizeServer *int64 `parquet:"name=sizeServer, type=INT64, convertedtype=UINT_64"`
+
+	Packets       *int32 `parquet:"name=packets, type=INT32, convertedtype=UINT_32"`
+	PacketsClient *int32 `parquet:"name=packetsClient, type=INT32, convertedtype=UINT_32"`
+	PacketsServer *int32 `parquet:"name=packetsServer, type=INT32, convertedtype=UINT_32"`
+
+	ConnState *string `parquet:"name=connState, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	History   *string `parquet:"name=history, type=BYTE_ARRAY, convertedtype=UTF8"`
+
+	TCPFlags           *int32 `parquet:"name=tcpFlags, type=INT32, convertedtype=UINT_8"`
+	TCPFlagsClient     *int32 `parquet:"name=tcpFlagsClient, type=INT32, convertedtype=UINT_8"`
+	TCPFlagsServer     *int32 `parquet:"name=tcpFlagsServer, type=INT32, convertedtype=UINT_8"`
+	TCPFlagsFirst      *int32 `parquet:"name=tcpFlagsFirst, type=INT32, convertedtype=UINT_8"`
+	TCPFlagsLast       *int32 `parquet:"name=tcpFlagsLast, type=INT32, convertedtype=UINT_8"`
+	HandshakeCompleted *bool  `parquet:"name=handshakeCompleted, type=BOOLEAN"`
+
+	TerminationReason *string `parquet:"name=terminationReason, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	TimeoutProfile    *string `parquet:"name=timeoutProfile, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+
+	Fragment     *int32 `parquet:"name=fragment, type=INT32, convertedtype=UINT_32"`
+	LastFragment *bool  `parquet:"name=lastFragment, type=BOOLEAN"`
+
+	RRPs *[]parquetRRP `parquet:"name=rrps, type=LIST"`
+
+	Extra *string `parquet:"name=extra, type=BYTE_ARRAY, convertedtype=JSON"`
+}
+
+// parquetRRP is the size of a request and its response
+type parquetRRP struct {
+	Request  int32 `parquet:"name=request, type=INT32, convertedtype=UINT_16"`
+	Response int32 `parquet:"name=response, type=INT32, convertedtype=UINT_16"`
+}
+
+// newParquetFlowRecord converts a record to a row of the Parquet output
+func newParquetFlowRecord(r *FlowRecord) (*parquetFlowRecord, error) {
+	record := &parquetFlowRecord{}
+	if r.HasProtocol {
+		record.Protocol = stringPointer(r.Protocol)
+		record.PortClient = int32Pointer(int32(r.PortClient))
+		record.PortServer = int32Pointer(int32(r.PortServer))
+		record.AddressClient = int64Pointer(r.AddressClient)
+		record.AddressServer = int64Pointer(r.AddressServer)
+		record.ClientInterface = bytesPointer(r.ClientInterface)
+		record.ServerInterface = bytesPointer(r.ServerInterface)
+		record.ServerClientUnclear = boolPointer(r.ServerClientUnclear)
+		record.FullClientAddr = ipPointer(r.FullClientAddr)
+		record.FullServerAddr = ipPointer(r.FullServerAddr)
+		record.FirstPacketWasZMap = boolPointer(r.FirstPacketWasZMap)
+		record.AllPacketsZMap = boolPointer(r.AllPacketsZMap)
+		record.CommunityID = stringPointer(r.CommunityID)
+	}
+	if r.HasDuration {
+		record.Start = int64Pointer(r.Start)
+		record.End = int64Pointer(r.End)
+		record.Duration = int64Pointer(r.Duration)
+	}
+	if r.HasRates {
+		record.FlowRates = int64Slice(r.FlowRates)
+		record.FlowRatesClient = int64Slice(r.FlowRatesClient)
+		record.FlowRatesServer = int64Slice(r.FlowRatesServer)
+	}
+	if r.HasSize {
+		record.Size = int64Pointer(int64(r.Size))
+		record.SizeClient = int64Pointer(int64(r.SizeClient))
+		record.SizeServer = int64Pointer(int64(r.SizeServer))
+	}
+	if r.HasPackets {
+		record.Packets = int32Pointer(int32(r.Packets))
+		record.PacketsClient = int32Pointer(int32(r.PacketsClient))
+		record.PacketsServer = int32Pointer(int32(r.PacketsServer))
+	}
+	if r.HasConnState {
+		record.ConnState = stringPointer(r.ConnState)
+		record.History = stringPointer(r.History)
+	}
+	if r.HasTCPFlags {
+		record.TCPFlags = int32Pointer(int32(r.TCPFlags))
+		record.TCPFlagsClient = int32Pointer(int32(r.TCPFlagsClient))
+		record.TCPFlagsServer = int32Pointer(int32(r.TCPFlagsServer))
+		record.TCPFlagsFirst = int32Pointer(int32(r.TCPFlagsFirst))
+		record.TCPFlagsLast = int32Pointer(int32(r.TCPFlagsLast))
+		record.HandshakeCompleted = boolPointer(r.HandshakeCompleted)
+	}
+	if r.HasTermination {
+		record.TerminationReason = stringPointer(r.TerminationReason)
+		record.TimeoutProfile = stringPointer(r.TimeoutProfile)
+	}
+	if r.HasFragment {
+		record.Fragment = int32Pointer(int32(r.Fragment))
+		record.LastFragment = boolPointer(r.LastFragment)
+	}
+	if r.HasRRPs {
+		rrps := make([]parquetRRP, len(r.RRPs))
+		for i, rrp := range r.RRPs {
+			rrps[i] = parquetRRP{Request: int32(rrp[0]), Response: int32(rrp[1])}
+		}
+		record.RRPs = &rrps
+	}
+
+	if r.Extra != nil {
+		b, err := json.Marshal(r.Extra)
+		if err != nil {
+			return nil, fmt.Errorf("error during json marshalling of extra values: %v", err)
+		}
+		record.Extra = stringPointer(string(b))
+	}
+	return record, nil
+}
+
+func int32Pointer(value int32) *int32 {
+	return &value
+}
+
+func int64Pointer(value int64) *int64 {
+	return &value
+}
+
+func boolPointer(value bool) *bool {
+	return &value
+}
+
+func stringPointer(value string) *string {
+	return &value
+}
+
+// bytesPointer returns nil for nil slices, like the JSON output
+func bytesPointer(value []byte) *string {
+	if value == nil {
+		return nil
+	}
+	return stringPointer(string(value))
+}
+
+// ipPointer returns nil for unset addresses
+func ipPointer(ip net.IP) *string {
+	if len(ip) == 0 {
+		return nil
+	}
+	return stringPointer(ip.String())
+}
+
+func int64Slice(values []uint) *[]int64 {
+	converted := make([]int64, len(values))
+	for i, value := range values {
+		converted[i] = int64(value)
+	}
+	return &converted
+}
+
+// parquetSink writes the flows to flow_metrics.parquet
+type parquetSink struct {
+	config ParquetConfig
+}
+
+func (s *parquetSink) encode(record *FlowRecord) (interface{}, error) {
+	return newParquetFlowRecord(record)
+}
+
+func (s *parquetSink) write(directory string, records <-chan interface{}) error {
+	filename := path.Join(directory, "flow_metrics.parquet")
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("could not create '%s': %v", filename, err)
+	}
+
+	buffer := bufio.NewWriter(f)
+	pw, err := writer.NewParquetWriterFromWriter(buffer, new(parquetFlowRecord), parquetWriterParallelism)
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("could not create parquet writer for '%s': %v", filename, err)
+	}
+	pw.RowGroupSize = s.config.RowGroupSize
+	pw.CompressionType = parquetCompressions[s.config.Compression]
+	version := strconv.Itoa(FlowRecordVersion)
+	pw.Footer.KeyValueMetadata = append(pw.Footer.KeyValueMetadata, &parquet.KeyValue{Key: "flowRecordVersion", Value: &version})
+
+	fmt.Println("Parquet export routine successfully setup.")
+	start := time.Now()
+
+	var numFlows int64
+	for record := range records {
+		if err = pw.Write(record); err != nil {
+			_ = f.Close()
+			return fmt.Errorf("error writing to '%s': %v", filename, err)
+		}
+		numFlows++
+	}
+
+	if err = pw.WriteStop(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error writing to '%s': %v", filename, err)
+	}
+	if err = buffer.Flush(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error writing to '%s': %v", filename, err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("error closing '%s': %v", filename, err)
+	}
+
+	fmt.Println("Finished writing parquet. Took:\t", time.Since(start))
+	fmt.Printf("Parquet export successful. Exported:\t %s flow metrics\n", humanize.Comma(numFlows))
+	return nil
+}
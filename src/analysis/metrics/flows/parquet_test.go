@@ -0,0 +1,118 @@
+package flows
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// parquetBuffer is a read-only source.ParquetFile in memory
+type parquetBuffer struct {
+	*bytes.Reader
+	data []byte
+}
+
+func newParquetBuffer(data []byte) *parquetBuffer {
+	return &parquetBuffer{Reader: bytes.NewReader(data), data: data}
+}
+
+func (b *parquetBuffer) Open(string) (source.ParquetFile, error) {
+	return newParquetBuffer(b.data), nil
+}
+
+func (b *parquetBuffer) Create(string) (source.ParquetFile, error) {
+	return nil, errors.New("read only")
+}
+
+func (b *parquetBuffer) Write([]byte) (int, error) {
+	return 0, errors.New("read only")
+}
+
+func (b *parquetBuffer) Close() error {
+	return nil
+}
+
+// parquetColumns returns the names of the top-level columns of the schema
+func parquetColumns(schema []*parquet.SchemaElement) []string {
+	var columns []string
+	// skip returns the index after the subtree of the element at i
+	var skip func(i int) int
+	skip = func(i int) int {
+		next := i + 1
+		for c := int32(0); c < schema[i].GetNumChildren(); c++ {
+			next = skip(next)
+		}
+		return next
+	}
+	for i := 1; i < len(schema); i = skip(i) {
+		columns = append(columns, schema[i].GetName())
+	}
+	return columns
+}
+
+func TestParquetOutput(t *testing.T) {
+	record := outputTestRecord()
+	directory := writeSink(t, &parquetSink{config: DefaultParquetConfig()}, record, &FlowRecord{})
+	data, err := os.ReadFile(path.Join(directory, "flow_metrics.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The reader renames the columns to the names of the fields, hence the names in the file are read from the footer separately
+	footer := &reader.ParquetReader{PFile: newParquetBuffer(data)}
+	if err = footer.ReadFooter(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedColumns := []string{"protocol", "portClient", "portServer", "addressClient", "addressServer", "ClientInterface", "ServerInterface",
+		"ServerClientUnclear", "FullClientAddr", "FullServerAddr", "FirstPacketWasZMap", "AllPacketsZMap", "communityID",
+		"start", "end", "duration", "flowRates", "flowRatesClient", "flowRatesServer", "size", "sizeClient", "sizeServer",
+		"packets", "packetsClient", "packetsServer", "connState", "history",
+		"tcpFlags", "tcpFlagsClient", "tcpFlagsServer", "tcpFlagsFirst", "tcpFlagsLast", "handshakeCompleted",
+		"terminationReason", "timeoutProfile", "fragment", "lastFragment", "rrps", "extra"}
+	if columns := parquetColumns(footer.Footer.Schema); !reflect.DeepEqual(columns, expectedColumns) {
+		t.Fatalf("columns are\n%v\nexpected\n%v", columns, expectedColumns)
+	}
+	version := ""
+	for _, keyValue := range footer.Footer.KeyValueMetadata {
+		if keyValue.Key == "flowRecordVersion" {
+			version = keyValue.GetValue()
+		}
+	}
+	if version != strconv.Itoa(FlowRecordVersion) {
+		t.Fatalf("flowRecordVersion is %q, expected %d", version, FlowRecordVersion)
+	}
+
+	pr, err := reader.NewParquetReader(newParquetBuffer(data), new(parquetFlowRecord), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.ReadStop()
+	if pr.GetNumRows() != 2 {
+		t.Fatalf("file has %d rows, expected 2", pr.GetNumRows())
+	}
+	rows := make([]parquetFlowRecord, 2)
+	if err = pr.Read(&rows); err != nil {
+		t.Fatal(err)
+	}
+	row := rows[0]
+	if *row.Protocol != "TCP" || *row.PortServer != 80 || *row.FullClientAddr != "10.0.0.1" || *row.ClientInterface != string(record.ClientInterface) ||
+		*row.Duration != 2000 || *row.SizeServer != 200 || *row.PacketsClient != 3 || *row.TCPFlagsLast != 0x11 || !*row.HandshakeCompleted ||
+		*row.TerminationReason != "fin" || *row.Fragment != 1 || *row.Extra != `{"label":"web"}` {
+		t.Fatalf("scalar values of the row differ from the record: %+v", row)
+	}
+	if !reflect.DeepEqual(*row.FlowRates, []int64{10, 30}) || !reflect.DeepEqual(*row.RRPs, []parquetRRP{{100, 200}, {50, 1000}}) {
+		t.Fatalf("flowRates are %v and rrps %v", *row.FlowRates, *row.RRPs)
+	}
+	// Columns of unselected metrics are null
+	if row.ConnState != nil || row.History != nil || rows[1].Protocol != nil || rows[1].Start != nil || rows[1].RRPs != nil || rows[1].Extra != nil {
+		t.Fatalf("columns of unselected metrics are set: %+v, %+v", row, rows[1])
+	}
+}
@@ -0,0 +1,150 @@
+package flows
+
+// This file contains the protobuf output of the flow metrics.
+// Each flow is converted to a dataformat.FlowRecord (see src/clustering/dataformat/FlowRecord.proto) and marshaled by the pools.
+// The protobufSink writes the messages length-delimited to flow_metrics.pb, they can be read with dataformat.NewFlowRecordReader.
+// The groups of fields of metrics which are not selected are unset.
+// The extra values of the records (set by metrics of other packages) are stored as JSON in the field extra.
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"test.com/scale/src/clustering/dataformat"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/golang/protobuf/proto"
+)
+
+// newProtobufFlowRecord converts r to its protobuf message
+func newProtobufFlowRecord(r *FlowRecord) (*dataformat.FlowRecord, error) {
+	p := &dataformat.FlowRecord{Version: FlowRecordVersion}
+	if r.HasProtocol {
+		p.Protocol = &dataformat.FlowProtocol{
+			Protocol:            r.Protocol,
+			PortClient:          uint32(r.PortClient),
+			PortServer:          uint32(r.PortServer),
+			AddressClient:       r.AddressClient,
+			AddressServer:       r.AddressServer,
+			ClientInterface:     r.ClientInterface,
+			ServerInterface:     r.ServerInterface,
+			ServerClientUnclear: r.ServerClientUnclear,
+			FullClientAddr:      r.FullClientAddr,
+			FullServerAddr:      r.FullServerAddr,
+			FirstPacketWasZmap:  r.FirstPacketWasZMap,
+			AllPacketsZmap:      r.AllPacketsZMap,
+			CommunityId:         r.CommunityID,
+		}
+	}
+	if r.HasDuration {
+		p.Duration = &dataformat.FlowDuration{Start: r.Start, End: r.End, Duration: r.Duration}
+	}
+	if r.HasRates {
+		p.Rates = &dataformat.FlowRates{
+			Total:  uint64Slice(r.FlowRates),
+			Client: uint64Slice(r.FlowRatesClient),
+			Server: uint64Slice(r.FlowRatesServer),
+		}
+	}
+	if r.HasSize {
+		p.Size = &dataformat.FlowSize{Total: uint64(r.Size), Client: uint64(r.SizeClient), Server: uint64(r.SizeServer)}
+	}
+	if r.HasPackets {
+		p.Packets = &dataformat.FlowPackets{Total: r.Packets, Client: r.PacketsClient, Server: r.PacketsServer}
+	}
+	if r.HasConnState {
+		p.ConnState = &dataformat.FlowConnState{State: r.ConnState, History: r.History}
+	}
+	if r.HasTCPFlags {
+		p.TcpFlags = &dataformat.FlowTCPFlags{
+			Total:              uint32(r.TCPFlags),
+			Client:             uint32(r.TCPFlagsClient),
+			Server:             uint32(r.TCPFlagsServer),
+			First:              uint32(r.TCPFlagsFirst),
+			Last:               uint32(r.TCPFlagsLast),
+			HandshakeCompleted: r.HandshakeCompleted,
+		}
+	}
+	if r.HasTermination {
+		p.Termination = &dataformat.FlowTermination{Reason: r.TerminationReason, TimeoutProfile: r.TimeoutProfile}
+	}
+	if r.HasFragment {
+		p.Fragment = &dataformat.FlowFragment{Sequence: r.Fragment, Last: r.LastFragment}
+	}
+	if r.HasRRPs {
+		rrps := make([]*dataformat.RRP, len(r.RRPs))
+		for i, rrp := range r.RRPs {
+			rrps[i] = &dataformat.RRP{RequestSize: int64(rrp[0]), ResponseSize: int64(rrp[1])}
+		}
+		p.Rrps = &dataformat.RRPs{Rrps: rrps}
+	}
+	if r.Extra != nil {
+		b, err := json.Marshal(r.Extra)
+		if err != nil {
+			return nil, fmt.Errorf("error during json marshalling of extra values: %v", err)
+		}
+		p.Extra = string(b)
+	}
+	return p, nil
+}
+
+// uint64Slice converts values to uint64
+func uint64Slice(values []uint) []uint64 {
+	converted := make([]uint64, len(values))
+	for i, value := range values {
+		converted[i] = uint64(value)
+	}
+	return converted
+}
+
+// protobufSink writes the flows to flow_metrics.pb
+type protobufSink struct{}
+
+func (s *protobufSink) encode(record *FlowRecord) (interface{}, error) {
+	p, err := newProtobufFlowRecord(record)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := proto.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("error during protobuf marshalling: %v", err)
+	}
+	return buf, nil
+}
+
+func (s *protobufSink) write(directory string, records <-chan interface{}) error {
+	filename := path.Join(directory, "flow_metrics.pb")
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("could not create '%s': %v", filename, err)
+	}
+	buffer := bufio.NewWriter(f)
+	w := dataformat.NewFlowRecordWriter(buffer)
+
+	fmt.Println("Protobuf export routine successfully setup.")
+	start := time.Now()
+
+	var numFlows int64
+	for record := range records {
+		if err = w.WriteMarshaled(record.([]byte)); err != nil {
+			_ = f.Close()
+			return fmt.Errorf("error writing to '%s': %v", filename, err)
+		}
+		numFlows++
+	}
+
+	if err = buffer.Flush(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error writing to '%s': %v", filename, err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("error closing '%s': %v", filename, err)
+	}
+
+	fmt.Println("Finished writing protobuf. Took:\t", time.Since(start))
+	fmt.Printf("Protobuf export successful. Exported:\t %s flow metrics\n", humanize.Comma(numFlows))
+	return nil
+}
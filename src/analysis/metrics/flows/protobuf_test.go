@@ -0,0 +1,48 @@
+package flows
+
+import (
+	"net"
+	"path"
+	"test.com/scale/src/clustering/dataformat"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func TestProtobufOutput(t *testing.T) {
+	directory := writeSink(t, &protobufSink{}, outputTestRecord(), &FlowRecord{})
+	records, err := dataformat.LoadFlowRecords(path.Join(directory, "flow_metrics.pb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*dataformat.FlowRecord{
+		{
+			Version: FlowRecordVersion,
+			Protocol: &dataformat.FlowProtocol{Protocol: "TCP", PortClient: 40000, PortServer: 80, AddressClient: 1, AddressServer: 2,
+				ClientInterface: []byte{0, 0, 0, 0, 0, 1}, ServerInterface: []byte{0, 0, 0, 0, 0, 2},
+				FullClientAddr: net.IP{10, 0, 0, 1}, FullServerAddr: net.IP{10, 0, 0, 2}, CommunityId: "1:abc"},
+			Duration:    &dataformat.FlowDuration{Start: 1000, End: 3000, Duration: 2000},
+			Rates:       &dataformat.FlowRates{Total: []uint64{10, 30}, Client: []uint64{5}},
+			Size:        &dataformat.FlowSize{Total: 300, Client: 100, Server: 200},
+			Packets:     &dataformat.FlowPackets{Total: 5, Client: 3, Server: 2},
+			TcpFlags:    &dataformat.FlowTCPFlags{Total: 0x13, Client: 0x13, Server: 0x12, First: 0x02, Last: 0x11, HandshakeCompleted: true},
+			Termination: &dataformat.FlowTermination{Reason: "fin", TimeoutProfile: "default"},
+			Fragment:    &dataformat.FlowFragment{Sequence: 1, Last: true},
+			Rrps:        &dataformat.RRPs{Rrps: []*dataformat.RRP{{RequestSize: 100, ResponseSize: 200}, {RequestSize: 50, ResponseSize: 1000}}},
+			Extra:       `{"label":"web"}`,
+		},
+		{Version: FlowRecordVersion},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("read %d records, expected %d", len(records), len(expected))
+	}
+	for i := range records {
+		if !proto.Equal(records[i], expected[i]) {
+			t.Fatalf("record %d is\n%v\nexpected\n%v", i, records[i], expected[i])
+		}
+	}
+	// Unselected metrics stay unset
+	if records[0].ConnState != nil {
+		t.Fatalf("the connState group is set: %v", records[0].ConnState)
+	}
+}
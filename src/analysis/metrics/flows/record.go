@@ -0,0 +1,108 @@
+package flows
+
+// This file contains the typed record of a flow, which is populated by the metrics and serialized by the outputs.
+
+import (
+	"net"
+	"strconv"
+)
+
+// FlowRecordVersion is the version of the layout of FlowRecord.
+// It must be increased whenever fields are added, removed or change their meaning.
+const FlowRecordVersion = 7
+
+// FlowRecord contains the values of the metrics of a flow.
+// Each metric sets its fields and the corresponding Has flag, fields of metrics which are not selected stay unset.
+// Metrics without fields (e.g. metrics of other packages) store their values with SetExtra.
+// The field names of the outputs are given by the comments.
+type FlowRecord struct {
+	// Metric protocol
+	HasProtocol         bool
+	Protocol            string           // protocol
+	PortClient          uint16           // portClient
+	PortServer          uint16           // portServer
+	AddressClient       int64            // addressClient
+	AddressServer       int64            // addressServer
+	ClientInterface     net.HardwareAddr // ClientInterface
+	ServerInterface     net.HardwareAddr // ServerInterface
+	ServerClientUnclear bool             // ServerClientUnclear
+	FullClientAddr      net.IP           // FullClientAddr
+	FullServerAddr      net.IP           // FullServerAddr
+	FirstPacketWasZMap  bool             // FirstPacketWasZMap
+	AllPacketsZMap      bool             // AllPacketsZMap
+	CommunityID         string           // communityID, empty if the full addresses are unknown
+
+	// Metric duration, timestamps in ns
+	HasDuration bool
+	Start       int64 // start
+	End         int64 // end
+	Duration    int64 // duration
+
+	// Metric rate, in bytes per second
+	HasRates        bool
+	FlowRates       []uint // flowRates
+	FlowRatesClient []uint // flowRatesClient
+	FlowRatesServer []uint // flowRatesServer
+
+	// Metric size, payload in bytes
+	HasSize    bool
+	Size       uint // size
+	SizeClient uint // sizeClient
+	SizeServer uint // sizeServer
+
+	// Metric packets
+	HasPackets    bool
+	Packets       uint32 // packets
+	PacketsClient uint32 // packetsClient
+	PacketsServer uint32 // packetsServer
+
+	// Metric connState, state and history of the connection as in the conn.log of Zeek
+	HasConnState bool
+	ConnState    string // connState
+	History      string // history
+
+	// Metric tcpFlags, bitmaps of the TCP flags (see flows.TCPFlagFIN etc.), only set for TCP flows
+	HasTCPFlags        bool
+	TCPFlags           uint8 // tcpFlags
+	TCPFlagsClient     uint8 // tcpFlagsClient
+	TCPFlagsServer     uint8 // tcpFlagsServer
+	TCPFlagsFirst      uint8 // tcpFlagsFirst
+	TCPFlagsLast       uint8 // tcpFlagsLast
+	HandshakeCompleted bool  // handshakeCompleted
+
+	// Metric termination, see flows.TerminationReason
+	HasTermination    bool
+	TerminationReason string // terminationReason
+	TimeoutProfile    string // timeoutProfile
+
+	// Metric fragment, records of flows exceeding the active timeout (see flows.Timeouts.Active)
+	HasFragment  bool
+	Fragment     uint32 // fragment
+	LastFragment bool   // lastFragment
+
+	// Metric rrps, payload sizes of request and response
+	HasRRPs bool
+	RRPs    [][2]uint16 // rrps
+
+	// Extra contains the values set by SetExtra, nil if there are none
+	Extra map[string]interface{}
+}
+
+// appendIdentity appends the addresses, ports, protocol and start of the flow, which identify it within a run
+func (r *FlowRecord) appendIdentity(b []byte) []byte {
+	b = append(b, r.FullClientAddr...)
+	b = append(b, r.FullServerAddr...)
+	b = append(b, byte(r.PortClient>>8), byte(r.PortClient), byte(r.PortServer>>8), byte(r.PortServer))
+	b = append(b, r.Protocol...)
+	return strconv.AppendInt(b, r.Start, 10)
+}
+
+// SetExtra stores a value, which is not represented by a field of the record.
+// The key is the field name in the outputs, hence it must be unique and must not be the name of a field of the record.
+// The value must be serializable by encoding/json.
+func (r *FlowRecord) SetExtra(key string, value interface{}) {
+	if r.Extra == nil {
+		r.Extra = make(map[string]interface{})
+	}
+	r.Extra[key] = value
+}
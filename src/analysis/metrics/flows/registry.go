@@ -0,0 +1,113 @@
+package flows
+
+// This file contains the registry of the flow metrics.
+// Each metric registers itself with a name, the metrics to compute are selected by their names.
+// External packages can register further metrics in their init function:
+//
+//	func init() {
+//		flows.RegisterMetric("myMetric", func(config flows.MetricConfig) flows.FlowMetric {
+//			return &myMetric{}
+//		})
+//	}
+//
+//	func (m *myMetric) OnFlush(flow *flows.Flow, record *flows.FlowRecord) {
+//		record.SetExtra("myValue", len(flow.Packets))
+//	}
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"test.com/scale/src/analysis/flows"
+	"test.com/scale/src/analysis/metrics/common"
+)
+
+// DefaultMetrics are the metrics which are computed if no metrics are selected
+var DefaultMetrics = []string{"rate", "protocol", "size", "packets", "duration"}
+
+// FlowMetric is a metric which is computed on the packets of a flow.
+// OnFlush stores the result in the record of the flow, metrics of other packages use FlowRecord.SetExtra.
+// OnFlush is called concurrently for different flows.
+type FlowMetric interface {
+	OnFlush(flow *flows.Flow, record *FlowRecord)
+}
+
+// TCPFlowMetric is a FlowMetric which additionally requires the TCP flags of TCP flows.
+// For TCP flows, OnTCPFlush is called instead of OnFlush. OnTCPFlush is called concurrently for different flows.
+type TCPFlowMetric interface {
+	FlowMetric
+	OnTCPFlush(flow *flows.TCPFlow, record *FlowRecord)
+}
+
+// RRMetric is a metric which additionally requires the requests and responses of a flow.
+// OnFlush is called concurrently for different flows.
+type RRMetric interface {
+	OnFlush(flow *flows.Flow, reqRes []*common.RequestResponse, record *FlowRecord)
+}
+
+// MetricConfig is passed to the constructors of the metrics
+type MetricConfig struct {
+	SamplingRate    int64  // Sampling rate for rate metrics in ms (0: average over entire flow)
+	CommunityIDSeed uint16 // Seed of the Community ID of the flows
+}
+
+// registeredMetric contains the constructor of a metric, only one of both is set
+type registeredMetric struct {
+	newMetric   func(config MetricConfig) FlowMetric
+	newRRMetric func(config MetricConfig) RRMetric
+}
+
+var registryMutex sync.RWMutex
+var registry = make(map[string]registeredMetric)
+
+// RegisterMetric registers a FlowMetric under name. Panics if a metric with this name is already registered.
+func RegisterMetric(name string, newMetric func(config MetricConfig) FlowMetric) {
+	register(name, registeredMetric{newMetric: newMetric})
+}
+
+// RegisterRRMetric registers a RRMetric under name. Panics if a metric with this name is already registered.
+// The requests and responses are only identified if at least one RRMetric is selected.
+func RegisterRRMetric(name string, newRRMetric func(config MetricConfig) RRMetric) {
+	register(name, registeredMetric{newRRMetric: newRRMetric})
+}
+
+func register(name string, metric registeredMetric) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, ok := registry[name]; ok {
+		panic("flow metric registered twice: " + name)
+	}
+	registry[name] = metric
+}
+
+// RegisteredMetrics returns the names of all registered metrics in alphabetical order
+func RegisteredMetrics() []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckMetrics returns an error if one of the names is not registered
+func CheckMetrics(names []string) error {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	for _, name := range names {
+		if _, ok := registry[name]; !ok {
+			return fmt.Errorf("unknown flow metric %s", name)
+		}
+	}
+	return nil
+}
+
+// lookupMetric returns the registered metric with this name
+func lookupMetric(name string) (registeredMetric, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	metric, ok := registry[name]
+	return metric, ok
+}
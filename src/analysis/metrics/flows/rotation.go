@@ -0,0 +1,205 @@
+package flows
+
+// This file contains the files of the JSON output.
+// Without compression and rotation, the flows are written to flow_metrics.json.
+// Otherwise, they are written to flow_metrics-<start>-<seq>.json[.gz|.zst], where start is the time the export started (UTC)
+// and seq is the number of the file, starting at 0.
+// A file is written with the suffix .part, which is removed once the file is complete.
+// Hence, downstream jobs can process the completed files while the analysis continues.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	gzip "github.com/klauspost/pgzip"
+)
+
+// partSuffix is appended to the name of files which are still written
+const partSuffix = ".part"
+
+// jsonCompressions maps the names of the supported compressions to the suffix of the files
+var jsonCompressions = map[string]string{
+	"none": "",
+	"gzip": ".gz",
+	"zstd": ".zst",
+}
+
+// JSONCompressions contains the names of the supported compressions of the JSON output
+var JSONCompressions = []string{"none", "gzip", "zstd"}
+
+// JSONConfig configures the files of the JSON output.
+// A new file is started as soon as one of the rotation limits is reached.
+type JSONConfig struct {
+	Compression    string        // Compression of the files, see JSONCompressions
+	RotateSize     int64         // Maximal size of a file in bytes (0: unlimited). Files can be slightly larger, as the compression buffers data.
+	RotateInterval time.Duration // Maximal time a file is written (0: unlimited)
+	RotateFlows    int64         // Maximal number of flows in a file (0: unlimited)
+}
+
+// DefaultJSONConfig returns the default configuration of the JSON output (a single uncompressed file)
+func DefaultJSONConfig() JSONConfig {
+	return JSONConfig{Compression: "none"}
+}
+
+// Check returns an error if the configuration is invalid
+func (c JSONConfig) Check() error {
+	if _, ok := jsonCompressions[c.Compression]; !ok {
+		return fmt.Errorf("unknown compression %s (available: %s)", c.Compression, strings.Join(JSONCompressions, ","))
+	}
+	if c.RotateSize < 0 || c.RotateInterval < 0 || c.RotateFlows < 0 {
+		return fmt.Errorf("rotation limits must not be negative")
+	}
+	return nil
+}
+
+// rotates returns whether the flows are written to several files
+func (c JSONConfig) rotates() bool {
+	return c.RotateSize > 0 || c.RotateInterval > 0 || c.RotateFlows > 0
+}
+
+// countingWriter counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// rotatingFile writes lines to the files of the JSON output.
+// The lines are separated by newlines, the last line of a file is not terminated.
+type rotatingFile struct {
+	directory string
+	config    JSONConfig
+	start     string // Start of the export, part of the file names
+	seq       int    // Number of the next file
+
+	filename   string // Final name of the current file, empty if no file is open
+	file       *os.File
+	counter    *countingWriter
+	compressor io.WriteCloser // nil without compression
+	buffer     *bufio.Writer
+	lines      int64 // Number of lines in the current file
+}
+
+func newRotatingFile(directory string, config JSONConfig) *rotatingFile {
+	return &rotatingFile{
+		directory: directory,
+		config:    config,
+		start:     time.Now().UTC().Format("20060102T150405Z"),
+	}
+}
+
+// nextFilename returns the name of the next file
+func (rf *rotatingFile) nextFilename() string {
+	if !rf.config.rotates() && rf.config.Compression == "none" {
+		return path.Join(rf.directory, "flow_metrics.json")
+	}
+	return path.Join(rf.directory, fmt.Sprintf("flow_metrics-%s-%06d.json%s", rf.start, rf.seq, jsonCompressions[rf.config.Compression]))
+}
+
+// open starts the next file
+func (rf *rotatingFile) open() error {
+	filename := rf.nextFilename()
+	file, err := os.Create(filename + partSuffix)
+	if err != nil {
+		return fmt.Errorf("could not create '%s': %v", filename+partSuffix, err)
+	}
+	if err = os.Chmod(filename+partSuffix, 0644); err != nil {
+		fmt.Println(err.Error())
+		fmt.Println("Could not change permissions for '" + filename + partSuffix + "'!")
+	}
+
+	rf.counter = &countingWriter{w: file}
+	var w io.Writer = rf.counter
+	switch rf.config.Compression {
+	case "gzip":
+		rf.compressor = gzip.NewWriter(rf.counter)
+		w = rf.compressor
+	case "zstd":
+		rf.compressor, err = zstd.NewWriter(rf.counter)
+		if err != nil {
+			_ = file.Close()
+			return fmt.Errorf("could not create zstd writer for '%s': %v", filename, err)
+		}
+		w = rf.compressor
+	default:
+		rf.compressor = nil
+	}
+
+	rf.filename = filename
+	rf.file = file
+	rf.buffer = bufio.NewWriter(w)
+	rf.lines = 0
+	rf.seq++
+	return nil
+}
+
+// writeLine writes line to the current file. If there is no open file, the next file is started.
+// Afterwards, the file is finalized if the size or flow limit is reached.
+func (rf *rotatingFile) writeLine(line []byte) error {
+	if rf.filename == "" {
+		if err := rf.open(); err != nil {
+			return err
+		}
+	}
+	if rf.lines > 0 {
+		if err := rf.buffer.WriteByte('\n'); err != nil {
+			return rf.writeFailed(err)
+		}
+	}
+	if _, err := rf.buffer.Write(line); err != nil {
+		return rf.writeFailed(err)
+	}
+	rf.lines++
+
+	if (rf.config.RotateFlows > 0 && rf.lines >= rf.config.RotateFlows) ||
+		(rf.config.RotateSize > 0 && rf.counter.n >= rf.config.RotateSize) {
+		return rf.finalize()
+	}
+	return nil
+}
+
+// finalize completes the current file and renames it to its final name. Does nothing if no file is open.
+func (rf *rotatingFile) finalize() error {
+	if rf.filename == "" {
+		return nil
+	}
+	if err := rf.buffer.Flush(); err != nil {
+		return rf.writeFailed(err)
+	}
+	if rf.compressor != nil {
+		if err := rf.compressor.Close(); err != nil {
+			return rf.writeFailed(err)
+		}
+	}
+	if err := rf.file.Sync(); err != nil {
+		return rf.writeFailed(err)
+	}
+	filename := rf.filename
+	rf.filename = ""
+	if err := rf.file.Close(); err != nil {
+		return fmt.Errorf("error closing '%s': %v", filename+partSuffix, err)
+	}
+	if err := os.Rename(filename+partSuffix, filename); err != nil {
+		return fmt.Errorf("could not rename '%s': %v", filename+partSuffix, err)
+	}
+	return nil
+}
+
+// writeFailed closes the current file and returns the error
+func (rf *rotatingFile) writeFailed(err error) error {
+	filename := rf.filename
+	rf.filename = ""
+	_ = rf.file.Close()
+	return fmt.Errorf("error writing to '%s': %v", filename+partSuffix, err)
+}
@@ -0,0 +1,129 @@
+package flows
+
+// This file contains the sinks, which write the flows in the output formats.
+// The records are encoded by the pools (concurrently) and written by one goroutine per sink.
+
+import (
+	"fmt"
+	"github.com/dustin/go-humanize"
+	"sync"
+	"time"
+)
+
+// flowSink writes the flows in one output format
+type flowSink interface {
+	// encode converts a record to the value which is passed to write. It is called concurrently by the pools.
+	encode(record *FlowRecord) (interface{}, error)
+	// write writes the encoded records to directory until records is closed. It runs in its own goroutine.
+	// If an error is returned, the remaining records are discarded.
+	write(directory string, records <-chan interface{}) error
+}
+
+// sinkOpener is implemented by sinks which acquire resources before the analysis, e.g. the listeners of the stream.
+// open is called once by NewMetric, so that errors are reported before packets are read. write releases the resources.
+type sinkOpener interface {
+	open() error
+}
+
+// sinkRoutine is a sink and the channel of its encoded records
+type sinkRoutine struct {
+	sink    flowSink
+	channel chan interface{}
+}
+
+// newSink returns the sink of the format, the configuration must be valid
+func newSink(format string, config ExportConfig) flowSink {
+	switch format {
+	case FormatParquet:
+		return &parquetSink{config: config.Parquet}
+	case FormatCSV:
+		return &csvSink{config: config.CSV, comma: ','}
+	case FormatTSV:
+		return &csvSink{config: config.CSV, comma: '\t'}
+	case FormatProtobuf:
+		return &protobufSink{}
+	case FormatElasticsearch:
+		return newElasticsearchSink(config.Elasticsearch)
+	case FormatStream:
+		return newStreamSink(config.Stream)
+	case FormatZeek:
+		return &zeekSink{}
+	case FormatZeekJSON:
+		return &zeekSink{json: true}
+	case FormatEVE:
+		return &eveSink{}
+	default:
+		return &jsonSink{config: config.JSON}
+	}
+}
+
+// jsonBufferPool contains the buffers of serialized flows, they are returned once they are written
+var jsonBufferPool = sync.Pool{
+	New: func() interface{} {
+		buffer := make([]byte, 0, 1024)
+		return &buffer
+	},
+}
+
+// jsonSink writes the flows to flow_metrics.json, or to several compressed or rotated files (see JSONConfig)
+type jsonSink struct {
+	config JSONConfig
+}
+
+func (s *jsonSink) encode(record *FlowRecord) (interface{}, error) {
+	buffer := jsonBufferPool.Get().(*[]byte)
+	serialized, err := record.AppendJSON((*buffer)[:0])
+	if err != nil {
+		jsonBufferPool.Put(buffer)
+		return nil, err
+	}
+	*buffer = serialized
+	return buffer, nil
+}
+
+func (s *jsonSink) write(directory string, records <-chan interface{}) error {
+	output := newRotatingFile(directory, s.config)
+	if !s.config.rotates() {
+		// Without rotation, the file is also written if there are no flows
+		if err := output.open(); err != nil {
+			return err
+		}
+	}
+
+	// Without a time limit, tick stays nil and never fires
+	var tick <-chan time.Time
+	if s.config.RotateInterval > 0 {
+		ticker := time.NewTicker(s.config.RotateInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	fmt.Println("Export routine successfully setup.")
+	start := time.Now()
+
+	id := 0
+	for {
+		select {
+		case record, ok := <-records:
+			if !ok {
+				if err := output.finalize(); err != nil {
+					return err
+				}
+				fmt.Println("Finished writing json. Took:\t", time.Since(start))
+				fmt.Printf("Export successful. Exported:\t %s flow metrics in %d files", humanize.Comma(int64(id)), output.seq)
+				return nil
+			}
+			serializedMetric := record.(*[]byte)
+			err := output.writeLine(*serializedMetric)
+			jsonBufferPool.Put(serializedMetric)
+			if err != nil {
+				return err
+			}
+			id++
+		case <-tick:
+			if err := output.finalize(); err != nil {
+				return err
+			}
+		}
+	}
+}
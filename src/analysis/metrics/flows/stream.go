@@ -0,0 +1,439 @@
+package flows
+
+// This file contains the streaming output of the flow metrics, which serves the flows to subscribers as soon as they are flushed.
+// The listeners are started when the metric is created (see sinkOpener).
+// Subscribers either connect to StreamConfig.Listen (TCP or Unix socket) and receive all flows as newline-delimited JSON,
+// or use the gRPC service dataformat.FlowStream at StreamConfig.GRPCListen, which filters the flows (see FlowStream.proto).
+// Only flows flushed while a subscriber is connected are sent to it.
+//
+// Each subscriber has a buffer of StreamConfig.BufferSize flows. If the buffer is full, further flows are dropped
+// for this subscriber, so that a slow subscriber does not stall the pools. At the end of the analysis,
+// the subscribers receive their buffered flows (for at most streamDrainTimeout) and are disconnected.
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"test.com/scale/src/clustering/dataformat"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// streamDrainTimeout is the maximal time the subscribers get to receive their buffered flows at the end of the analysis
+const streamDrainTimeout = 10 * time.Second
+
+// StreamConfig configures the streaming output. At least one of the listeners must be set.
+type StreamConfig struct {
+	Listen     string // Listener of the newline-delimited JSON stream, tcp://host:port or unix:///path (empty: disabled)
+	GRPCListen string // Address of the gRPC server, host:port (empty: disabled)
+	BufferSize int    // Number of flows buffered per subscriber, further flows are dropped for this subscriber
+}
+
+// DefaultStreamConfig returns the default configuration of the streaming output (no listeners)
+func DefaultStreamConfig() StreamConfig {
+	return StreamConfig{BufferSize: 10000}
+}
+
+// Check returns an error if the configuration is invalid
+func (c StreamConfig) Check() error {
+	if c.Listen == "" && c.GRPCListen == "" {
+		return fmt.Errorf("neither a listener of the json stream nor of the gRPC server is set")
+	}
+	if c.Listen != "" {
+		network, address, err := c.listenAddress()
+		if err != nil {
+			return err
+		}
+		if network == "tcp" {
+			if _, err = net.ResolveTCPAddr(network, address); err != nil {
+				return fmt.Errorf("invalid listener %s: %v", c.Listen, err)
+			}
+		}
+	}
+	if c.GRPCListen != "" {
+		if _, err := net.ResolveTCPAddr("tcp", c.GRPCListen); err != nil {
+			return fmt.Errorf("invalid address of the gRPC server %s: %v", c.GRPCListen, err)
+		}
+	}
+	if c.BufferSize <= 0 {
+		return fmt.Errorf("the buffer size must be positive")
+	}
+	return nil
+}
+
+// listenAddress returns the network and address of the listener of the json stream
+func (c StreamConfig) listenAddress() (network, address string, err error) {
+	for _, network := range []string{"tcp", "unix"} {
+		if address := strings.TrimPrefix(c.Listen, network+"://"); address != c.Listen && address != "" {
+			return network, address, nil
+		}
+	}
+	return "", "", fmt.Errorf("invalid listener %s: expected tcp://host:port or unix:///path", c.Listen)
+}
+
+// streamRecord is an encoded flow. Only the encodings required by the listeners are set.
+type streamRecord struct {
+	json    []byte
+	message *dataformat.FlowRecord // Also used to filter the flows. Read only, as it is shared by the subscribers.
+}
+
+// streamFilter is the parsed dataformat.FlowFilter of a subscriber
+type streamFilter struct {
+	protocols []string
+	ports     map[uint32]bool
+	prefixes  []*net.IPNet
+}
+
+// newStreamFilter parses filter. Returns an error if an address prefix is invalid.
+func newStreamFilter(filter *dataformat.FlowFilter) (*streamFilter, error) {
+	f := &streamFilter{protocols: filter.Protocols}
+	if len(filter.Ports) > 0 {
+		f.ports = make(map[uint32]bool, len(filter.Ports))
+		for _, port := range filter.Ports {
+			f.ports[port] = true
+		}
+	}
+	for _, prefix := range filter.AddressPrefixes {
+		_, network, err := net.ParseCIDR(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address prefix %s: %v", prefix, err)
+		}
+		f.prefixes = append(f.prefixes, network)
+	}
+	return f, nil
+}
+
+// matches returns whether the flow matches all set filters
+func (f *streamFilter) matches(message *dataformat.FlowRecord) bool {
+	if len(f.protocols) == 0 && len(f.ports) == 0 && len(f.prefixes) == 0 {
+		return true
+	}
+	p := message.Protocol
+	if p == nil {
+		return false
+	}
+	if len(f.protocols) > 0 {
+		matched := false
+		for _, protocol := range f.protocols {
+			matched = matched || strings.EqualFold(protocol, p.Protocol)
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(f.ports) > 0 && !f.ports[p.PortClient] && !f.ports[p.PortServer] {
+		return false
+	}
+	if len(f.prefixes) > 0 {
+		matched := false
+		for _, prefix := range f.prefixes {
+			matched = matched || prefix.Contains(p.FullClientAddr) || prefix.Contains(p.FullServerAddr)
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// streamSubscriber is a connected subscriber. The channel is closed at the end of the analysis.
+type streamSubscriber struct {
+	name    string
+	filter  *streamFilter // nil for the json stream
+	channel chan *streamRecord
+	dropped int64 // Guarded by the mutex of the sink
+}
+
+// streamSink serves the flows to the subscribers
+type streamSink struct {
+	config StreamConfig
+
+	mutex        sync.Mutex
+	subscribers  map[*streamSubscriber]bool
+	closed       bool              // Set at the end of the analysis, no further subscribers are accepted
+	handlers     sync.WaitGroup    // Running subscriber handlers
+	numServed    int64             // Number of subscribers, only used for the summary
+	grpcServer   *grpc.Server      // nil if disabled
+	grpcListener net.Listener      // nil if disabled
+	listener     net.Listener      // nil if disabled
+	connections  map[net.Conn]bool // Connections of the json stream
+}
+
+func newStreamSink(config StreamConfig) *streamSink {
+	return &streamSink{
+		config:      config,
+		subscribers: make(map[*streamSubscriber]bool),
+		connections: make(map[net.Conn]bool),
+	}
+}
+
+func (s *streamSink) encode(record *FlowRecord) (interface{}, error) {
+	encoded := &streamRecord{}
+	var err error
+	if s.config.Listen != "" {
+		if encoded.json, err = record.AppendJSON(nil); err != nil {
+			return nil, err
+		}
+	}
+	if s.config.GRPCListen != "" {
+		if encoded.message, err = newProtobufFlowRecord(record); err != nil {
+			return nil, err
+		}
+	}
+	return encoded, nil
+}
+
+func (s *streamSink) write(directory string, records <-chan interface{}) error {
+	fmt.Println("Stream export routine successfully setup.")
+	start := time.Now()
+
+	var numFlows int64
+	for record := range records {
+		s.dispatch(record.(*streamRecord))
+		numFlows++
+	}
+
+	s.shutdown()
+	fmt.Println("Finished streaming. Took:\t", time.Since(start))
+	fmt.Printf("Stream export successful. Streamed:\t %s flow metrics to %d subscribers\n", humanize.Comma(numFlows), s.numServed)
+	return nil
+}
+
+// open starts the listeners, so that invalid addresses or ports in use are reported before packets are read.
+// Subscribers can connect from now on, they receive the flows written afterwards.
+func (s *streamSink) open() error {
+	if s.config.Listen != "" {
+		network, address, _ := s.config.listenAddress()
+		listener, err := net.Listen(network, address)
+		if err != nil {
+			return fmt.Errorf("could not listen on %s: %v", s.config.Listen, err)
+		}
+		if network == "unix" {
+			if err = os.Chmod(address, 0660); err != nil {
+				fmt.Println("Could not change permissions for '" + address + "': " + err.Error())
+			}
+		}
+		s.listener = listener
+		fmt.Println("Streaming flows as json on", listener.Addr())
+		go s.acceptJSON()
+	}
+	if s.config.GRPCListen != "" {
+		listener, err := net.Listen("tcp", s.config.GRPCListen)
+		if err != nil {
+			if s.listener != nil {
+				_ = s.listener.Close()
+			}
+			return fmt.Errorf("could not listen on %s: %v", s.config.GRPCListen, err)
+		}
+		s.grpcListener = listener
+		s.grpcServer = grpc.NewServer()
+		dataformat.RegisterFlowStreamServer(s.grpcServer, &flowStreamServer{sink: s})
+		fmt.Println("Streaming flows via gRPC on", listener.Addr())
+		go func() {
+			_ = s.grpcServer.Serve(listener)
+		}()
+	}
+	return nil
+}
+
+// subscribe adds a subscriber. Returns nil if the analysis already ended.
+func (s *streamSink) subscribe(name string, filter *streamFilter) *streamSubscriber {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return nil
+	}
+	subscriber := &streamSubscriber{name: name, filter: filter, channel: make(chan *streamRecord, s.config.BufferSize)}
+	s.subscribers[subscriber] = true
+	s.numServed++
+	s.handlers.Add(1)
+	fmt.Printf("Stream subscriber %s connected\n", name)
+	return subscriber
+}
+
+// unsubscribe removes a subscriber, once its handler returns
+func (s *streamSink) unsubscribe(subscriber *streamSubscriber) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.subscribers, subscriber)
+	s.handlers.Done()
+	fmt.Printf("Stream subscriber %s disconnected, dropped %s flows\n", subscriber.name, humanize.Comma(subscriber.dropped))
+}
+
+// dispatch passes the record to all subscribers it matches, without blocking
+func (s *streamSink) dispatch(record *streamRecord) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for subscriber := range s.subscribers {
+		if subscriber.filter != nil && !subscriber.filter.matches(record.message) {
+			continue
+		}
+		select {
+		case subscriber.channel <- record:
+		default:
+			subscriber.dropped++
+		}
+	}
+}
+
+// shutdown stops accepting subscribers, closes their channels and waits until they received their buffered flows
+// (at most streamDrainTimeout). Afterwards, the remaining subscribers are disconnected.
+func (s *streamSink) shutdown() {
+	s.mutex.Lock()
+	s.closed = true
+	for subscriber := range s.subscribers {
+		close(subscriber.channel)
+	}
+	s.mutex.Unlock()
+	if s.listener != nil {
+		_ = s.listener.Close()
+	}
+
+	deadline := time.After(streamDrainTimeout)
+	drained := make(chan bool)
+	go func() {
+		s.handlers.Wait()
+		if s.grpcServer != nil {
+			// Waits until the flows sent by the handlers are transmitted
+			s.grpcServer.GracefulStop()
+		}
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-deadline:
+		fmt.Println("Stream subscribers did not receive their flows in time, disconnecting them")
+		s.mutex.Lock()
+		for connection := range s.connections {
+			_ = connection.Close()
+		}
+		s.mutex.Unlock()
+		if s.grpcServer != nil {
+			s.grpcServer.Stop()
+		}
+		<-drained
+	}
+}
+
+// acceptJSON accepts the connections of the json stream until the listener is closed
+func (s *streamSink) acceptJSON() {
+	for {
+		connection, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveJSON(connection)
+	}
+}
+
+// serveJSON sends all flows as newline-delimited JSON to the connection
+func (s *streamSink) serveJSON(connection net.Conn) {
+	defer connection.Close()
+	name := connection.RemoteAddr().String()
+	if name == "" || name == "@" {
+		name = "unix socket"
+	}
+	subscriber := s.subscribe(name, nil)
+	if subscriber == nil {
+		return
+	}
+	defer s.unsubscribe(subscriber)
+	s.mutex.Lock()
+	s.connections[connection] = true
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.connections, connection)
+		s.mutex.Unlock()
+	}()
+
+	// Detect closed connections, as the subscribers do not send anything
+	closed := make(chan bool)
+	go func() {
+		_, _ = connection.Read(make([]byte, 1))
+		close(closed)
+	}()
+
+	buffer := bufio.NewWriter(connection)
+	for {
+		var record *streamRecord
+		var ok bool
+		select {
+		case record, ok = <-subscriber.channel:
+		case <-closed:
+			s.discard(subscriber)
+			return
+		}
+		if !ok {
+			_ = buffer.Flush()
+			return
+		}
+		if _, err := buffer.Write(record.json); err != nil {
+			s.discard(subscriber)
+			return
+		}
+		if err := buffer.WriteByte('\n'); err != nil {
+			s.discard(subscriber)
+			return
+		}
+		// Flush once the buffered flows are written
+		if len(subscriber.channel) == 0 {
+			if err := buffer.Flush(); err != nil {
+				s.discard(subscriber)
+				return
+			}
+		}
+	}
+}
+
+// discard removes the subscriber from the dispatcher, before its handler returns
+func (s *streamSink) discard(subscriber *streamSubscriber) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.subscribers, subscriber)
+}
+
+// flowStreamServer implements the gRPC service dataformat.FlowStream
+type flowStreamServer struct {
+	sink *streamSink
+}
+
+func (f *flowStreamServer) Subscribe(request *dataformat.FlowFilter, stream dataformat.FlowStream_SubscribeServer) error {
+	filter, err := newStreamFilter(request)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	name := "gRPC client"
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		name = p.Addr.String()
+	}
+	subscriber := f.sink.subscribe(name, filter)
+	if subscriber == nil {
+		return status.Error(codes.Unavailable, "the analysis has ended")
+	}
+	defer f.sink.unsubscribe(subscriber)
+
+	for {
+		select {
+		case record, ok := <-subscriber.channel:
+			if !ok {
+				return nil
+			}
+			if err = stream.Send(record.message); err != nil {
+				f.sink.discard(subscriber)
+				return err
+			}
+		case <-stream.Context().Done():
+			f.sink.discard(subscriber)
+			return stream.Context().Err()
+		}
+	}
+}
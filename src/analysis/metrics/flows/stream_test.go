@@ -0,0 +1,239 @@
+package flows
+
+import (
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"test.com/scale/src/clustering/dataformat"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// streamTestRecords are a TCP flow to port 80 and a DNS flow within 10.0.0.0/8
+var streamTestRecords = []*FlowRecord{
+	{HasProtocol: true, Protocol: "TCP", PortClient: 40000, PortServer: 80,
+		FullClientAddr: net.ParseIP("192.168.0.1").To4(), FullServerAddr: net.ParseIP("192.168.0.2").To4(),
+		HasPackets: true, Packets: 3, PacketsClient: 2, PacketsServer: 1},
+	{HasProtocol: true, Protocol: "UDP", PortClient: 50000, PortServer: 53,
+		FullClientAddr: net.ParseIP("10.0.0.1").To4(), FullServerAddr: net.ParseIP("10.0.0.53").To4(),
+		HasPackets: true, Packets: 2, PacketsClient: 1, PacketsServer: 1},
+}
+
+// waitForSubscribers waits until the sink has served the number of subscribers
+func waitForSubscribers(t *testing.T, s *streamSink, subscribers int64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mutex.Lock()
+		served := s.numServed
+		s.mutex.Unlock()
+		if served >= subscribers {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d subscribers connected", served, subscribers)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStreamSink(t *testing.T) {
+	s := newStreamSink(StreamConfig{Listen: "tcp://127.0.0.1:0", GRPCListen: "127.0.0.1:0", BufferSize: 10})
+	if err := s.open(); err != nil {
+		t.Fatal(err)
+	}
+
+	jsonConnection, err := net.Dial("tcp", s.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jsonConnection.Close()
+	grpcConnection, err := grpc.Dial(s.grpcListener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer grpcConnection.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client := dataformat.NewFlowStreamClient(grpcConnection)
+	stream, err := client.Subscribe(ctx, &dataformat.FlowFilter{Protocols: []string{"udp"}, AddressPrefixes: []string{"10.0.0.0/8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForSubscribers(t, s, 2)
+
+	records := make(chan interface{}, len(streamTestRecords))
+	for _, record := range streamTestRecords {
+		encoded, err := s.encode(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records <- encoded
+	}
+	close(records)
+	written := make(chan error)
+	go func() {
+		written <- s.write("", records)
+	}()
+
+	// The json stream receives all flows
+	lines, err := io.ReadAll(jsonConnection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected []string
+	for _, record := range streamTestRecords {
+		line, err := record.AppendJSON(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, string(line))
+	}
+	if received := strings.Split(strings.TrimSuffix(string(lines), "\n"), "\n"); !reflect.DeepEqual(received, expected) {
+		t.Fatalf("json stream received\n%s\nexpected\n%s", strings.Join(received, "\n"), strings.Join(expected, "\n"))
+	}
+
+	// The gRPC subscriber only receives the DNS flow
+	var ports []uint32
+	for {
+		message, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ports = append(ports, message.Protocol.PortServer)
+	}
+	if !reflect.DeepEqual(ports, []uint32{53}) {
+		t.Fatalf("gRPC subscriber received flows to ports %v, expected [53]", ports)
+	}
+	if err = <-written; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamSinkRejectsInvalidFilter(t *testing.T) {
+	s := newStreamSink(StreamConfig{GRPCListen: "127.0.0.1:0", BufferSize: 10})
+	if err := s.open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.shutdown()
+	connection, err := grpc.Dial(s.grpcListener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connection.Close()
+	stream, err := dataformat.NewFlowStreamClient(connection).Subscribe(context.Background(), &dataformat.FlowFilter{AddressPrefixes: []string{"10.0.0.0"}})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("error is %v, expected an invalid argument", err)
+	}
+}
+
+func TestStreamSinkDropsFlowsOfSlowSubscribers(t *testing.T) {
+	s := newStreamSink(StreamConfig{Listen: "tcp://127.0.0.1:0", BufferSize: 2})
+	slow := s.subscribe("slow", nil)
+	record, err := s.encode(streamTestRecords[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dispatched := make(chan bool)
+	go func() {
+		for i := 0; i < 5; i++ {
+			s.dispatch(record.(*streamRecord))
+		}
+		close(dispatched)
+	}()
+	select {
+	case <-dispatched:
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatch is blocked by the slow subscriber")
+	}
+	s.mutex.Lock()
+	dropped := slow.dropped
+	s.mutex.Unlock()
+	if len(slow.channel) != 2 || dropped != 3 {
+		t.Fatalf("%d flows are buffered and %d dropped, expected 2 and 3", len(slow.channel), dropped)
+	}
+	s.unsubscribe(slow)
+}
+
+func TestStreamFilter(t *testing.T) {
+	tcp, err := newProtobufFlowRecord(streamTestRecords[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	udp, err := newProtobufFlowRecord(streamTestRecords[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		filter   *dataformat.FlowFilter
+		tcp, udp bool
+	}{
+		{"empty filter", &dataformat.FlowFilter{}, true, true},
+		{"protocol ignores the case", &dataformat.FlowFilter{Protocols: []string{"Tcp"}}, true, false},
+		{"client or server port", &dataformat.FlowFilter{Ports: []uint32{40000, 53}}, true, true},
+		{"port", &dataformat.FlowFilter{Ports: []uint32{53}}, false, true},
+		{"client or server address", &dataformat.FlowFilter{AddressPrefixes: []string{"192.168.0.1/32"}}, true, false},
+		{"all filters must match", &dataformat.FlowFilter{Protocols: []string{"udp"}, Ports: []uint32{80}}, false, false},
+	}
+	for _, test := range tests {
+		filter, err := newStreamFilter(test.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filter.matches(tcp) != test.tcp || filter.matches(udp) != test.udp {
+			t.Errorf("%s: matches the tcp flow %v and the udp flow %v, expected %v and %v", test.name, filter.matches(tcp), filter.matches(udp), test.tcp, test.udp)
+		}
+	}
+	if filter, _ := newStreamFilter(&dataformat.FlowFilter{Protocols: []string{"tcp"}}); filter.matches(&dataformat.FlowRecord{}) {
+		t.Error("flows without protocol metric match the filter")
+	}
+}
+
+func TestStreamConfigCheck(t *testing.T) {
+	tests := []struct {
+		config StreamConfig
+		valid  bool
+	}{
+		{StreamConfig{Listen: "tcp://127.0.0.1:9000", BufferSize: 1}, true},
+		{StreamConfig{Listen: "unix:///tmp/flows.sock", GRPCListen: ":9001", BufferSize: 1}, true},
+		{StreamConfig{BufferSize: 1}, false},
+		{StreamConfig{Listen: "127.0.0.1:9000", BufferSize: 1}, false},
+		{StreamConfig{Listen: "tcp://127.0.0.1", BufferSize: 1}, false},
+		{StreamConfig{GRPCListen: "127.0.0.1:port", BufferSize: 1}, false},
+		{StreamConfig{GRPCListen: ":9001", BufferSize: 0}, false},
+	}
+	for _, test := range tests {
+		if err := test.config.Check(); (err == nil) != test.valid {
+			t.Errorf("%+v: error is %v, expected valid %v", test.config, err, test.valid)
+		}
+	}
+}
+
+func TestNewMetricFailsIfStreamCannotListen(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	config := DefaultExportConfig()
+	config.Formats = []string{FormatStream}
+	config.Stream.GRPCListen = listener.Addr().String()
+	if _, err = NewMetric(MetricConfig{}, nil, false, false, config); err == nil || !strings.Contains(err.Error(), "could not listen") {
+		t.Fatalf("error is %v, expected that the port is in use", err)
+	}
+}
@@ -0,0 +1,246 @@
+package flows
+
+// This file contains the Zeek output of the flow metrics, which writes the flows like the conn.log of Zeek.
+// FormatZeek writes conn.log in the tab separated format of Zeek (including the header),
+// FormatZeekJSON writes conn.json with one JSON object per line, like Zeek with LogAscii::use_json.
+// The fields are those of the conn.log:
+//
+//	ts, uid, id.orig_h, id.orig_p, id.resp_h, id.resp_p, proto, service, duration, orig_bytes, resp_bytes,
+//	conn_state, local_orig, local_resp, missed_bytes, history, orig_pkts, orig_ip_bytes, resp_pkts, resp_ip_bytes, tunnel_parents,
+//	community_id
+//
+// The client of a flow is the originator, the server the responder. The bytes are the payload bytes.
+// The analysis does not determine service, local_orig, local_resp, missed_bytes, the IP bytes and tunnel_parents,
+// hence they are unset ("-" in conn.log, omitted in conn.json).
+// community_id is appended like the community-id package of Zeek does.
+// The uid of a flow is derived from its addresses, ports and start and a random seed, so it is unique within a run
+// and the same in both formats. The metrics required by the fields (zeekMetrics) are enabled automatically.
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cespare/xxhash"
+	"github.com/dustin/go-humanize"
+)
+
+// zeekMetrics are the metrics required by the Zeek output
+var zeekMetrics = []string{"protocol", "duration", "size", "packets", "connState"}
+
+// zeekTimeFormat is the format of the timestamps in the header of conn.log
+const zeekTimeFormat = "2006-01-02-15-04-05"
+
+// zeekFields are the fields of conn.log and their types
+var zeekFields = []struct{ name, typ string }{
+	{"ts", "time"}, {"uid", "string"},
+	{"id.orig_h", "addr"}, {"id.orig_p", "port"}, {"id.resp_h", "addr"}, {"id.resp_p", "port"},
+	{"proto", "enum"}, {"service", "string"}, {"duration", "interval"},
+	{"orig_bytes", "count"}, {"resp_bytes", "count"}, {"conn_state", "string"},
+	{"local_orig", "bool"}, {"local_resp", "bool"}, {"missed_bytes", "count"}, {"history", "string"},
+	{"orig_pkts", "count"}, {"orig_ip_bytes", "count"}, {"resp_pkts", "count"}, {"resp_ip_bytes", "count"},
+	{"tunnel_parents", "set[string]"}, {"community_id", "string"},
+}
+
+// zeekUIDSeed makes the uids of different runs differ
+var zeekUIDSeed [16]byte
+
+func init() {
+	if _, err := rand.Read(zeekUIDSeed[:]); err != nil {
+		binary.BigEndian.PutUint64(zeekUIDSeed[:], uint64(time.Now().UnixNano()))
+	}
+}
+
+// base62Digits are the digits of the uids
+const base62Digits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// zeekUID returns the uid of the flow: C followed by 96 bits in base 62, like the uids of Zeek
+func zeekUID(r *FlowRecord) string {
+	data := make([]byte, 0, 64)
+	data = append(data, zeekUIDSeed[:]...)
+	data = r.appendIdentity(data)
+	high := xxhash.Sum64(data)
+	data[0] ^= 0xff
+	low := xxhash.Sum64(data)
+
+	uid := make([]byte, 0, 18)
+	uid = append(uid, 'C')
+	uid = appendBase62(uid, high, 11)
+	return string(appendBase62(uid, low&0xffffffff, 6))
+}
+
+// appendBase62 appends the digits of value in base 62, padded with zeros to width
+func appendBase62(b []byte, value uint64, width int) []byte {
+	start := len(b)
+	for i := 0; i < width; i++ {
+		b = append(b, base62Digits[value%62])
+		value /= 62
+	}
+	for i, j := start, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return b
+}
+
+// appendZeekTime appends the nanoseconds as seconds with six decimals, like the times and intervals of Zeek
+func appendZeekTime(b []byte, ns int64) []byte {
+	if ns < 0 {
+		b = append(b, '-')
+		ns = -ns
+	}
+	b = strconv.AppendInt(b, ns/int64(time.Second), 10)
+	b = append(b, '.')
+	micros := strconv.FormatInt((ns%int64(time.Second))/int64(time.Microsecond), 10)
+	b = append(b, "000000"[len(micros):]...)
+	return append(b, micros...)
+}
+
+// zeekField is a field of a conn.log entry. Unset fields have no value.
+type zeekField struct {
+	value    []byte
+	isString bool // Quoted in conn.json
+}
+
+// zeekSink writes the flows to conn.log or conn.json
+type zeekSink struct {
+	json bool
+}
+
+// fields returns the values of the fields of the flow in the order of zeekFields
+func (s *zeekSink) fields(r *FlowRecord) []zeekField {
+	fields := make([]zeekField, len(zeekFields))
+	set := func(i int, value []byte, isString bool) {
+		fields[i] = zeekField{value: value, isString: isString}
+	}
+	if r.HasDuration {
+		set(0, appendZeekTime(nil, r.Start), false)
+		set(8, appendZeekTime(nil, r.Duration), false)
+	}
+	set(1, []byte(zeekUID(r)), true)
+	if r.HasProtocol {
+		if len(r.FullClientAddr) > 0 {
+			set(2, []byte(r.FullClientAddr.String()), true)
+		}
+		set(3, strconv.AppendUint(nil, uint64(r.PortClient), 10), false)
+		if len(r.FullServerAddr) > 0 {
+			set(4, []byte(r.FullServerAddr.String()), true)
+		}
+		set(5, strconv.AppendUint(nil, uint64(r.PortServer), 10), false)
+		set(6, []byte(strings.ToLower(r.Protocol)), true)
+		if r.CommunityID != "" {
+			set(21, []byte(r.CommunityID), true)
+		}
+	}
+	if r.HasSize {
+		set(9, strconv.AppendUint(nil, uint64(r.SizeClient), 10), false)
+		set(10, strconv.AppendUint(nil, uint64(r.SizeServer), 10), false)
+	}
+	if r.HasConnState {
+		set(11, []byte(r.ConnState), true)
+		set(15, []byte(r.History), true)
+	}
+	if r.HasPackets {
+		set(16, strconv.AppendUint(nil, uint64(r.PacketsClient), 10), false)
+		set(18, strconv.AppendUint(nil, uint64(r.PacketsServer), 10), false)
+	}
+	return fields
+}
+
+func (s *zeekSink) encode(record *FlowRecord) (interface{}, error) {
+	fields := s.fields(record)
+	var line []byte
+	if s.json {
+		line = append(line, '{')
+		first := true
+		for i, field := range fields {
+			if field.value == nil {
+				continue
+			}
+			if !first {
+				line = append(line, ',')
+			}
+			first = false
+			line = appendJSONString(line, zeekFields[i].name)
+			line = append(line, ':')
+			if field.isString {
+				line = appendJSONString(line, string(field.value))
+			} else {
+				line = append(line, field.value...)
+			}
+		}
+		line = append(line, '}')
+	} else {
+		for i, field := range fields {
+			if i > 0 {
+				line = append(line, '\t')
+			}
+			switch {
+			case field.value == nil:
+				line = append(line, '-')
+			case len(field.value) == 0:
+				line = append(line, "(empty)"...)
+			default:
+				line = append(line, field.value...)
+			}
+		}
+	}
+	return append(line, '\n'), nil
+}
+
+func (s *zeekSink) write(directory string, records <-chan interface{}) error {
+	filename := path.Join(directory, "conn.log")
+	if s.json {
+		filename = path.Join(directory, "conn.json")
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("could not create '%s': %v", filename, err)
+	}
+	buffer := bufio.NewWriter(f)
+
+	fmt.Println("Zeek export routine successfully setup.")
+	start := time.Now()
+
+	if !s.json {
+		names := make([]string, len(zeekFields))
+		types := make([]string, len(zeekFields))
+		for i, field := range zeekFields {
+			names[i] = field.name
+			types[i] = field.typ
+		}
+		_, err = fmt.Fprintf(buffer, "#separator \\x09\n#set_separator\t,\n#empty_field\t(empty)\n#unset_field\t-\n#path\tconn\n#open\t%s\n#fields\t%s\n#types\t%s\n",
+			start.Format(zeekTimeFormat), strings.Join(names, "\t"), strings.Join(types, "\t"))
+	}
+
+	var numFlows int64
+	for record := range records {
+		if err != nil {
+			break
+		}
+		_, err = buffer.Write(record.([]byte))
+		numFlows++
+	}
+	if err == nil && !s.json {
+		_, err = fmt.Fprintf(buffer, "#close\t%s\n", time.Now().Format(zeekTimeFormat))
+	}
+	if err == nil {
+		err = buffer.Flush()
+	}
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error writing to '%s': %v", filename, err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("error closing '%s': %v", filename, err)
+	}
+
+	fmt.Println("Finished writing zeek log. Took:\t", time.Since(start))
+	fmt.Printf("Zeek export successful. Exported:\t %s flow metrics\n", humanize.Comma(numFlows))
+	return nil
+}
@@ -0,0 +1,78 @@
+package flows
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"testing"
+)
+
+func TestZeekEncode(t *testing.T) {
+	record := &FlowRecord{
+		HasProtocol: true, Protocol: "TCP", PortClient: 21911, PortServer: 80,
+		FullClientAddr: net.ParseIP("10.0.7.119").To4(), FullServerAddr: net.ParseIP("192.168.0.12").To4(), CommunityID: "1:abc",
+		HasDuration: true, Start: 1600000000515058000, End: 1600000003015058000, Duration: 2500000000,
+		HasSize: true, Size: 3541, SizeClient: 742, SizeServer: 0,
+		HasPackets: true, Packets: 10, PacketsClient: 6, PacketsServer: 4,
+		HasConnState: true, ConnState: "SF", History: "ShADadFf",
+	}
+	noHistory := &FlowRecord{
+		HasProtocol: true, Protocol: "UDP", PortClient: 54585, PortServer: 53,
+		HasConnState: true, ConnState: "S0", History: "",
+	}
+	tests := []struct {
+		name     string
+		record   *FlowRecord
+		json     bool
+		expected string
+	}{
+		{"tsv", record, false, "1600000000.515058\t%s\t10.0.7.119\t21911\t192.168.0.12\t80\ttcp\t-\t2.500000\t742\t0\tSF\t-\t-\t-\tShADadFf\t6\t-\t4\t-\t-\t1:abc\n"},
+		{"json", record, true, `{"ts":1600000000.515058,"uid":"%s","id.orig_h":"10.0.7.119","id.orig_p":21911,"id.resp_h":"192.168.0.12","id.resp_p":80,"proto":"tcp",` +
+			`"duration":2.500000,"orig_bytes":742,"resp_bytes":0,"conn_state":"SF","history":"ShADadFf","orig_pkts":6,"resp_pkts":4,"community_id":"1:abc"}` + "\n"},
+		{"tsv with unset and empty fields", noHistory, false, "-\t%s\t-\t54585\t-\t53\tudp\t-\t-\t-\t-\tS0\t-\t-\t-\t(empty)\t-\t-\t-\t-\t-\t-\n"},
+		{"json with unset and empty fields", noHistory, true, `{"uid":"%s","id.orig_p":54585,"id.resp_p":53,"proto":"udp","conn_state":"S0","history":""}` + "\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sink := &zeekSink{json: test.json}
+			encoded, err := sink.encode(test.record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := fmt.Sprintf(test.expected, zeekUID(test.record))
+			if line := string(encoded.([]byte)); line != expected {
+				t.Fatalf("encoded\n%s\nexpected\n%s", line, expected)
+			}
+		})
+	}
+}
+
+func TestZeekUID(t *testing.T) {
+	a := &FlowRecord{Protocol: "TCP", FullClientAddr: net.ParseIP("10.0.0.1"), FullServerAddr: net.ParseIP("10.0.0.2"), PortClient: 1, PortServer: 2, Start: 5}
+	b := *a
+	b.Start++
+	uid := zeekUID(a)
+	if !regexp.MustCompile(`^C[0-9A-Za-z]{17}$`).MatchString(uid) {
+		t.Fatalf("uid %s does not look like a uid of Zeek", uid)
+	}
+	if zeekUID(a) != uid || zeekUID(&b) == uid {
+		t.Fatalf("uids are not derived from the identity of the flow")
+	}
+}
+
+func TestAppendZeekTime(t *testing.T) {
+	tests := []struct {
+		ns       int64
+		expected string
+	}{
+		{0, "0.000000"},
+		{1500, "0.000001"},
+		{1600000000515058000, "1600000000.515058"},
+		{-2500000000, "-2.500000"},
+	}
+	for _, test := range tests {
+		if formatted := string(appendZeekTime(nil, test.ns)); formatted != test.expected {
+			t.Errorf("%d: formatted %s, expected %s", test.ns, formatted, test.expected)
+		}
+	}
+}
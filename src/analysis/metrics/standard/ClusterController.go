@@ -1,7 +1,7 @@
 package standard
 
 import (
-	"log"
+	"fmt"
 	"path"
 	"sync"
 	"test.com/scale/src/analysis/flows"
@@ -38,6 +38,9 @@ type ClusterController struct {
 	useClusters        bool
 	collectClusterInfo bool
 	infoFilesPath      string
+	communityIDSeed    uint16
+	errMutex           sync.Mutex
+	err                error
 }
 
 type Model struct {
@@ -68,17 +71,21 @@ type UsersInfos struct {
 // DefaultClusterIndex is used whenever a metric does not support clustering, or no clustering is used
 const DefaultClusterIndex = 0
 
-func NewClusterController(metric *Metric, infoPath, modelPath string) *ClusterController {
+// NewClusterController creates a new ClusterController.
+// The flow information contains the Community ID of the flows with the given seed.
+// Returns an error if the info directories can not be created or the models can not be loaded.
+func NewClusterController(metric *Metric, infoPath, modelPath string, communityIDSeed uint16) (*ClusterController, error) {
 	cc := &ClusterController{
-		metric:       metric,
-		rrpModel:     make(map[common.ProtocolKeyType]Model),
-		rrpsInfo:     make(map[common.ProtocolKeyType]*RRPsInfos),
-		flowModel:    make(map[common.ProtocolKeyType]Model),
-		flowsInfo:    make(map[common.ProtocolKeyType]*FlowsInfos),
-		sessionModel: make(map[common.ProtocolKeyType]Model),
-		sessionsInfo: make(map[common.ProtocolKeyType]*SessionsInfos),
-		userModel:    make(map[common.ProtocolKeyType]Model),
-		usersInfo:    make(map[common.ProtocolKeyType]*UsersInfos),
+		metric:          metric,
+		communityIDSeed: communityIDSeed,
+		rrpModel:        make(map[common.ProtocolKeyType]Model),
+		rrpsInfo:        make(map[common.ProtocolKeyType]*RRPsInfos),
+		flowModel:       make(map[common.ProtocolKeyType]Model),
+		flowsInfo:       make(map[common.ProtocolKeyType]*FlowsInfos),
+		sessionModel:    make(map[common.ProtocolKeyType]Model),
+		sessionsInfo:    make(map[common.ProtocolKeyType]*SessionsInfos),
+		userModel:       make(map[common.ProtocolKeyType]Model),
+		usersInfo:       make(map[common.ProtocolKeyType]*UsersInfos),
 	}
 	switch infoPath {
 	case "":
@@ -86,17 +93,12 @@ func NewClusterController(metric *Metric, infoPath, modelPath string) *ClusterCo
 	default:
 		cc.collectClusterInfo = true
 		cc.infoFilesPath = infoPath
-		if !utils.DirectoryExists(path.Join(infoPath, rrpDirectory)) {
-			utils.CreateDir(path.Join(infoPath, rrpDirectory))
-		}
-		if !utils.DirectoryExists(path.Join(infoPath, flowDirectory)) {
-			utils.CreateDir(path.Join(infoPath, flowDirectory))
-		}
-		if !utils.DirectoryExists(path.Join(infoPath, sessionDirectory)) {
-			utils.CreateDir(path.Join(infoPath, sessionDirectory))
-		}
-		if !utils.DirectoryExists(path.Join(infoPath, userDirectory)) {
-			utils.CreateDir(path.Join(infoPath, userDirectory))
+		for _, directory := range []string{rrpDirectory, flowDirectory, sessionDirectory, userDirectory} {
+			if !utils.DirectoryExists(path.Join(infoPath, directory)) {
+				if err := utils.CreateDir(path.Join(infoPath, directory)); err != nil {
+					return nil, err
+				}
+			}
 		}
 	}
 
@@ -105,72 +107,65 @@ func NewClusterController(metric *Metric, infoPath, modelPath string) *ClusterCo
 		cc.useClusters = false
 	default:
 		cc.useClusters = true
-
-		// Load User models
-		userModelDirectory := path.Join(modelPath, userDirectory)
-		if !utils.DirectoryExists(userModelDirectory) {
-			log.Fatalln("Directory for user cluster model does not exist:", userModelDirectory)
+		var err error
+		if cc.userModel, err = loadModels(path.Join(modelPath, userDirectory), "user"); err != nil {
+			return nil, err
 		}
-		for _, filepath := range utils.GetFilesInPath(userModelDirectory, "json") {
-			model, options, err := clustering.LoadModel(filepath)
-			if err != nil {
-				log.Fatalln("Error while loading user Cluster Model from", filepath, err)
-			}
-			cc.userModel[common.GetProtocolKey(utils.GetFilename(filepath, false))] = Model{
-				model:   model,
-				options: options,
-			}
+		if cc.sessionModel, err = loadModels(path.Join(modelPath, sessionDirectory), "session"); err != nil {
+			return nil, err
 		}
-
-		// Load Session models
-		sessionModelDirectory := path.Join(modelPath, sessionDirectory)
-		if !utils.DirectoryExists(sessionModelDirectory) {
-			log.Fatalln("Directory for session cluster model does not exist:", sessionModelDirectory)
+		if cc.flowModel, err = loadModels(path.Join(modelPath, flowDirectory), "flow"); err != nil {
+			return nil, err
 		}
-		for _, filepath := range utils.GetFilesInPath(sessionModelDirectory, "json") {
-			model, options, err := clustering.LoadModel(filepath)
-			if err != nil {
-				log.Fatalln("Error while loading session Cluster Model from", filepath, err)
-			}
-			cc.sessionModel[common.GetProtocolKey(utils.GetFilename(filepath, false))] = Model{
-				model:   model,
-				options: options,
-			}
+		if cc.rrpModel, err = loadModels(path.Join(modelPath, rrpDirectory), "rrp"); err != nil {
+			return nil, err
 		}
+	}
+	return cc, nil
+}
 
-		// Load Flow models
-		flowModelDirectory := path.Join(modelPath, flowDirectory)
-		if !utils.DirectoryExists(flowModelDirectory) {
-			log.Fatalln("Directory for flow cluster models does not exist:", flowModelDirectory)
-		}
-		for _, filepath := range utils.GetFilesInPath(flowModelDirectory, "json") {
-			model, options, err := clustering.LoadModel(filepath)
-			if err != nil {
-				log.Fatalln("Error while loading flow Cluster Model from", filepath, err)
-			}
-			cc.flowModel[common.GetProtocolKey(utils.GetFilename(filepath, false))] = Model{
-				model:   model,
-				options: options,
-			}
+// loadModels loads the cluster models of all protocols stored in modelDirectory
+func loadModels(modelDirectory, modelName string) (map[common.ProtocolKeyType]Model, error) {
+	if !utils.DirectoryExists(modelDirectory) {
+		return nil, fmt.Errorf("directory for %s cluster models does not exist: %s", modelName, modelDirectory)
+	}
+	files, err := utils.GetFilesInPath(modelDirectory, "json")
+	if err != nil {
+		return nil, fmt.Errorf("error while listing %s cluster models in %s: %v", modelName, modelDirectory, err)
+	}
+	models := make(map[common.ProtocolKeyType]Model)
+	for _, filepath := range files {
+		model, options, err := clustering.LoadModel(filepath)
+		if err != nil {
+			return nil, fmt.Errorf("error while loading %s cluster model from %s: %v", modelName, filepath, err)
 		}
-
-		// Load RRP models
-		rrpModelDirectory := path.Join(modelPath, rrpDirectory)
-		if !utils.DirectoryExists(rrpModelDirectory) {
-			log.Fatalln("Directory for rrp cluster models does not exist:", rrpModelDirectory)
+		protocolKey, err := common.GetProtocolKey(utils.GetFilename(filepath, false))
+		if err != nil {
+			return nil, fmt.Errorf("invalid name of %s cluster model %s: %v", modelName, filepath, err)
 		}
-		for _, filepath := range utils.GetFilesInPath(rrpModelDirectory, "json") {
-			model, options, err := clustering.LoadModel(filepath)
-			if err != nil {
-				log.Fatalln("Error while loading flow Cluster Model from", filepath, err)
-			}
-			cc.rrpModel[common.GetProtocolKey(utils.GetFilename(filepath, false))] = Model{
-				model:   model,
-				options: options,
-			}
+		models[protocolKey] = Model{
+			model:   model,
+			options: options,
 		}
 	}
-	return cc
+	return models, nil
+}
+
+// setError records err, if no error has been recorded before.
+// Errors during prediction do not stop the analysis, the affected element gets the DefaultClusterIndex.
+func (cc *ClusterController) setError(err error) {
+	cc.errMutex.Lock()
+	defer cc.errMutex.Unlock()
+	if cc.err == nil {
+		cc.err = err
+	}
+}
+
+// Err returns the first error which occurred during prediction
+func (cc *ClusterController) Err() error {
+	cc.errMutex.Lock()
+	defer cc.errMutex.Unlock()
+	return cc.err
 }
 
 func (cc *ClusterController) GetNumberOfRRPClusters(protocolKey common.ProtocolKeyType) int {
@@ -219,15 +214,21 @@ func (cc *ClusterController) CollectAndSetRRPClusterIndex(flow *flows.Flow, reqR
 			reqRes[i].ClusterIndex = DefaultClusterIndex
 		}
 	} else {
-		if _, ok := cc.rrpModel[protocolKey]; !ok {
-			log.Fatalln("No RRP Model for prediction")
+		_, ok := cc.rrpModel[protocolKey]
+		if !ok {
+			cc.setError(fmt.Errorf("no rrp model for prediction of protocol %s", common.GetProtocol(flow).GetProtocolString()))
 		}
 		for i := 0; i < len(reqRes); i++ {
+			reqRes[i].ClusterIndex = DefaultClusterIndex
+			if !ok {
+				continue
+			}
 			rrpData := clustering.GetDataOfRRP(rrpInfos[i])
 			clustering.ScaleData(rrpData, cc.rrpModel[protocolKey].options)
 			clusterIdx, err := cc.rrpModel[protocolKey].model.Predict(rrpData)
 			if err != nil {
-				log.Fatalln("Error while predicting values", err)
+				cc.setError(fmt.Errorf("error while predicting rrp cluster: %v", err))
+				continue
 			}
 			// Predict always returns a vector. First element is the cluster index
 			reqRes[i].ClusterIndex = int(clusterIdx[0])
@@ -253,6 +254,7 @@ func (cc *ClusterController) CollectAndSetRRPClusterIndex(flow *flows.Flow, reqR
 func (cc *ClusterController) CollectAndSetFlowClusterIndex(flow *flows.Flow, reqRes []*common.RequestResponse) {
 	if !cc.useClusters && !cc.collectClusterInfo {
 		flow.ClusterIndex = DefaultClusterIndex
+		return
 	}
 	protocolKey := common.GetProtocol(flow).ProtocolKey
 	flowInfos := cc.getFlowInfo(flow, reqRes)
@@ -261,17 +263,24 @@ func (cc *ClusterController) CollectAndSetFlowClusterIndex(flow *flows.Flow, req
 	if !cc.useClusters {
 		flow.ClusterIndex = DefaultClusterIndex
 	} else {
+		flow.ClusterIndex = DefaultClusterIndex
 		if _, ok := cc.flowModel[protocolKey]; !ok {
-			log.Fatalln("No Flow Model for prediction")
-		}
-		flowData := clustering.GetDataOfFlow(flowInfos)
-		clustering.ScaleData(flowData, cc.flowModel[protocolKey].options)
-		clusterIdx, err := cc.flowModel[protocolKey].model.Predict(flowData)
-		if err != nil {
-			log.Fatalln("Error while predicting values", err)
+			cc.setError(fmt.Errorf("no flow model for prediction of protocol %s", common.GetProtocol(flow).GetProtocolString()))
+		} else {
+			flowData := clustering.GetDataOfFlow(flowInfos)
+			clustering.ScaleData(flowData, cc.flowModel[protocolKey].options)
+			clusterIdx, err := cc.flowModel[protocolKey].model.Predict(flowData)
+			if err != nil {
+				cc.setError(fmt.Errorf("error while predicting flow cluster: %v", err))
+			} else {
+				// Predict always returns a vector. First element is the cluster index
+				flow.ClusterIndex = int(clusterIdx[0])
+			}
 		}
-		// Predict always returns a vector. First element is the cluster index
-		flow.ClusterIndex = int(clusterIdx[0])
+	}
+
+	if !cc.collectClusterInfo {
+		return
 	}
 
 	cc.flowsInfoMutex.Lock()
@@ -298,17 +307,20 @@ func (cc *ClusterController) CollectAndSetSessionClusterIndex(session *session,
 	if !cc.useClusters {
 		session.sessionClusterIndex = DefaultClusterIndex
 	} else {
+		session.sessionClusterIndex = DefaultClusterIndex
 		if _, ok := cc.sessionModel[protocolKey]; !ok {
-			log.Fatalln("No Session Model for prediction")
-		}
-		sessionData := clustering.GetDataOfSession(sessionInfos)
-		clustering.ScaleData(sessionData, cc.sessionModel[protocolKey].options)
-		clusterIdx, err := cc.sessionModel[protocolKey].model.Predict(sessionData)
-		if err != nil {
-			log.Fatalln("Error while predicting values", err)
+			cc.setError(fmt.Errorf("no session model for prediction of protocol %s", protocol.GetProtocolString()))
+		} else {
+			sessionData := clustering.GetDataOfSession(sessionInfos)
+			clustering.ScaleData(sessionData, cc.sessionModel[protocolKey].options)
+			clusterIdx, err := cc.sessionModel[protocolKey].model.Predict(sessionData)
+			if err != nil {
+				cc.setError(fmt.Errorf("error while predicting session cluster: %v", err))
+			} else {
+				// Predict always returns a vector. First element is the cluster index
+				session.sessionClusterIndex = int(clusterIdx[0])
+			}
 		}
-		// Predict always returns a vector. First element is the cluster index
-		session.sessionClusterIndex = int(clusterIdx[0])
 	}
 
 	if !cc.collectClusterInfo {
@@ -340,17 +352,20 @@ func (cc *ClusterController) CollectAndSetUserClusterIndex(sessions *userSession
 		sessions.userClusterIndex = DefaultClusterIndex
 	} else {
 		protocolKey := protocol.ProtocolKey
+		sessions.userClusterIndex = DefaultClusterIndex
 		if _, ok := cc.userModel[protocolKey]; !ok {
-			log.Fatalln("No user Model for prediction")
-		}
-		userData := clustering.GetDataOfUser(userInfos)
-		clustering.ScaleData(userData, cc.userModel[protocolKey].options)
-		clusterIdx, err := cc.userModel[protocolKey].model.Predict(userData)
-		if err != nil {
-			log.Fatalln("Error while predicting values", err)
+			cc.setError(fmt.Errorf("no user model for prediction of protocol %s", protocol.GetProtocolString()))
+		} else {
+			userData := clustering.GetDataOfUser(userInfos)
+			clustering.ScaleData(userData, cc.userModel[protocolKey].options)
+			clusterIdx, err := cc.userModel[protocolKey].model.Predict(userData)
+			if err != nil {
+				cc.setError(fmt.Errorf("error while predicting user cluster: %v", err))
+			} else {
+				// Predict always returns a vector. First element is the cluster index
+				sessions.userClusterIndex = int(clusterIdx[0])
+			}
 		}
-		// Predict always returns a vector. First element is the cluster index
-		sessions.userClusterIndex = int(clusterIdx[0])
 	}
 
 	if !cc.collectClusterInfo {
@@ -368,15 +383,16 @@ func (cc *ClusterController) CollectAndSetUserClusterIndex(sessions *userSession
 	cc.usersInfoMutex.Unlock()
 }
 
-func (cc *ClusterController) PersistRRPInfos(clearMemory bool) {
+func (cc *ClusterController) PersistRRPInfos(clearMemory bool) error {
 	if !cc.collectClusterInfo {
-		return
+		return nil
 	}
 
 	// For each protocol save flows
+	var errs []error
 	for _, rrps := range cc.rrpsInfo {
 		fname := path.Join(cc.infoFilesPath, rrpDirectory, rrps.Protocol.GetProtocolString()+".data")
-		clustering.SaveRRPData(fname, rrps.RRPs, 5000)
+		errs = append(errs, clustering.SaveRRPData(fname, rrps.RRPs, 5000))
 	}
 
 	if clearMemory {
@@ -384,17 +400,19 @@ func (cc *ClusterController) PersistRRPInfos(clearMemory bool) {
 		cc.rrpsInfo = make(map[common.ProtocolKeyType]*RRPsInfos)
 		cc.rrpsInfoMutex.Unlock()
 	}
+	return utils.JoinErrors(errs...)
 }
 
-func (cc *ClusterController) PersistFlowInfos(clearMemory bool) {
+func (cc *ClusterController) PersistFlowInfos(clearMemory bool) error {
 	if !cc.collectClusterInfo {
-		return
+		return nil
 	}
 
 	// For each protocol save flows
+	var errs []error
 	for _, flowInfo := range cc.flowsInfo {
 		fileName := path.Join(cc.infoFilesPath, flowDirectory, flowInfo.Protocol.GetProtocolString()+".data")
-		clustering.SaveFlowData(fileName, flowInfo.Flows, 5000)
+		errs = append(errs, clustering.SaveFlowData(fileName, flowInfo.Flows, 5000))
 	}
 
 	if clearMemory {
@@ -402,17 +420,19 @@ func (cc *ClusterController) PersistFlowInfos(clearMemory bool) {
 		cc.flowsInfo = make(map[common.ProtocolKeyType]*FlowsInfos)
 		cc.flowsInfoMutex.Unlock()
 	}
+	return utils.JoinErrors(errs...)
 }
 
-func (cc *ClusterController) PersistSessionInfos(clearMemory bool) {
+func (cc *ClusterController) PersistSessionInfos(clearMemory bool) error {
 	if !cc.collectClusterInfo {
-		return
+		return nil
 	}
 
 	// For each protocol save flows
+	var errs []error
 	for _, sessions := range cc.sessionsInfo {
 		fname := path.Join(cc.infoFilesPath, sessionDirectory, sessions.Protocol.GetProtocolString()+".data")
-		clustering.SaveSessionData(fname, sessions.Sessions, 5000)
+		errs = append(errs, clustering.SaveSessionData(fname, sessions.Sessions, 5000))
 	}
 
 	if clearMemory {
@@ -420,17 +440,19 @@ func (cc *ClusterController) PersistSessionInfos(clearMemory bool) {
 		cc.sessionsInfo = make(map[common.ProtocolKeyType]*SessionsInfos)
 		cc.sessionsInfoMutex.Unlock()
 	}
+	return utils.JoinErrors(errs...)
 }
 
-func (cc *ClusterController) PersistUserInfos(clearMemory bool) {
+func (cc *ClusterController) PersistUserInfos(clearMemory bool) error {
 	if !cc.collectClusterInfo {
-		return
+		return nil
 	}
 
 	// For each protocol save flows
+	var errs []error
 	for _, users := range cc.usersInfo {
 		fname := path.Join(cc.infoFilesPath, userDirectory, users.Protocol.GetProtocolString()+".data")
-		clustering.SaveUserData(fname, users.Users, 5000)
+		errs = append(errs, clustering.SaveUserData(fname, users.Users, 5000))
 	}
 
 	if clearMemory {
@@ -438,6 +460,7 @@ func (cc *ClusterController) PersistUserInfos(clearMemory bool) {
 		cc.usersInfo = make(map[common.ProtocolKeyType]*UsersInfos)
 		cc.usersInfoMutex.Unlock()
 	}
+	return utils.JoinErrors(errs...)
 }
 
 func getUnivariateOfBivariate(values [][]int) []int {
@@ -473,6 +496,15 @@ func (cc *ClusterController) getFlowInfo(flow *flows.Flow, reqRes []*common.Requ
 			Max:    int64(interReqMax),
 			StdDev: interReqStdDev,
 		},
+		CommunityId:        flow.CommunityID(cc.communityIDSeed),
+		TerminationReason:  flow.TerminationReason.String(),
+		TcpFlags:           uint32(flow.TCPFlags.All),
+		TcpFlagsClient:     uint32(flow.TCPFlags.Client),
+		TcpFlagsServer:     uint32(flow.TCPFlags.Server),
+		TcpFlagsFirst:      uint32(flow.TCPFlags.First),
+		TcpFlagsLast:       uint32(flow.TCPFlags.Last),
+		HandshakeCompleted: flow.TCPFlags.HandshakeCompleted(),
+		TimeoutProfile:     flow.TimeoutProfile,
 	}
 	return flowInfo
 }
@@ -5,13 +5,18 @@ package standard
 // The Pool will only flush Flows (connections). Based on these, sessions and request/responses are extracted by this package.
 
 import (
+	"fmt"
+	"path"
+	"strings"
 	"sync"
 	"test.com/scale/src/analysis/flows"
 	"test.com/scale/src/analysis/metrics/common"
+	"test.com/scale/src/analysis/utils"
 )
 
 // Metric handles all sub-metrics.
 // It must be created with the NewMetric function, to ensure all sessionMetrics and RRMetrics are registered correctly.
+// Only the enabled metrics are created, the fields of disabled metrics are nil.
 // The caller must register the metric by the pool.
 // At the end of the processing, you must call ForceFlush to flush all remaining sessions.
 type Metric struct {
@@ -26,6 +31,8 @@ type Metric struct {
 	MetricFlowRate                   *MetricFlowRate
 	MetricInterFlowTimes             *MetricInterFlow
 	MetricNumPackets                 *MetricNumPackets
+	MetricTerminationReasons         *MetricTerminationReasons
+	MetricTCPFlags                   *MetricTCPFlags
 	MetricNumServers                 *MetricNumServers
 	MetricRRPClusterDistribution     *MetricRRPClusterDistribution
 	MetricFlowClusterDistribution    *MetricFlowClusterDistribution
@@ -41,6 +48,33 @@ type Metric struct {
 	allExportedMetricsBivariateCluster  []MetricBivariateClusterExport
 
 	clusterController *ClusterController
+	sessionTimeout    int64
+	truncatedFlows    string
+	truncated         *Metric // Computes the metrics of the truncated flows, if truncatedFlows is TruncatedFlowsSeparate
+}
+
+// Ways to handle truncated flows (see flows.Truncation)
+const (
+	TruncatedFlowsInclude  = "include"  // Truncated flows are handled like all other flows
+	TruncatedFlowsExclude  = "exclude"  // Truncated flows are dropped
+	TruncatedFlowsSeparate = "separate" // Truncated flows are handled by separate metrics, which are exported to TruncatedDirectory
+)
+
+// TruncatedFlows contains the ways to handle truncated flows
+var TruncatedFlows = []string{TruncatedFlowsInclude, TruncatedFlowsExclude, TruncatedFlowsSeparate}
+
+// TruncatedDirectory is the subdirectory of the export and info directory which contains the metrics and information
+// of the truncated flows, if they are handled separately
+const TruncatedDirectory = "truncated"
+
+// CheckTruncatedFlows returns an error if truncatedFlows is no way to handle truncated flows
+func CheckTruncatedFlows(truncatedFlows string) error {
+	for _, mode := range TruncatedFlows {
+		if truncatedFlows == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown way to handle truncated flows %s (available: %s)", truncatedFlows, strings.Join(TruncatedFlows, ","))
 }
 
 // FlowMetric are metrics which are evaluated on flow level.
@@ -63,17 +97,40 @@ type SessionMetric interface {
 	PrintStatistic(verbose bool)
 }
 
-// NewMetric creates a new Metric and registers all session and request/response metrics
+// NewMetric creates a new Metric and registers the enabled session and request/response metrics
 // If infoPath is not empty, flow and session information will be stored to this directory
 // if clusterModelDirectory is not empty, a clustering will be used.
-func NewMetric(sessionTimeout int64, infoPath, clusterModelDirectory string,
-	dropUnidirectionalFlows, reconstructTCPResponse, statisticTCPReconstruction bool) *Metric {
-	var metric = &Metric{}
-	metric.clusterController = NewClusterController(metric, infoPath, clusterModelDirectory)
+// The flow information contains the Community ID of the flows with the given seed.
+// truncatedFlows defines how truncated flows are handled (see TruncatedFlows).
+// The metrics are enabled and disabled by their names (see MetricNames), if enabledMetrics is nil all metrics are enabled.
+func NewMetric(sessionTimeout int64, infoPath, clusterModelDirectory string, communityIDSeed uint16,
+	dropUnidirectionalFlows, reconstructTCPResponse, statisticTCPReconstruction bool, truncatedFlows string,
+	enabledMetrics, disabledMetrics []string) (*Metric, error) {
+	if err := CheckTruncatedFlows(truncatedFlows); err != nil {
+		return nil, err
+	}
+	metricNames, err := ResolveMetrics(enabledMetrics, disabledMetrics, infoPath != "" || clusterModelDirectory != "")
+	if err != nil {
+		return nil, err
+	}
 
-	// Session and Request/Response Identifier
-	metric.SessionIdentifier = newSessionIdentifier(sessionTimeout, metric.clusterController)
-	metric.registerFlowMetric(metric.SessionIdentifier)
+	var metric = &Metric{sessionTimeout: sessionTimeout, truncatedFlows: truncatedFlows}
+	if truncatedFlows == TruncatedFlowsSeparate {
+		// The truncated flows are passed with identified request/response pairs, hence the reconstruction is not used
+		truncatedInfoPath := infoPath
+		if infoPath != "" {
+			truncatedInfoPath = path.Join(infoPath, TruncatedDirectory)
+		}
+		metric.truncated, err = NewMetric(sessionTimeout, truncatedInfoPath, clusterModelDirectory, communityIDSeed,
+			dropUnidirectionalFlows, reconstructTCPResponse, false, TruncatedFlowsInclude, enabledMetrics, disabledMetrics)
+		if err != nil {
+			return nil, err
+		}
+	}
+	metric.clusterController, err = NewClusterController(metric, infoPath, clusterModelDirectory, communityIDSeed)
+	if err != nil {
+		return nil, err
+	}
 
 	var reconstructionMetricSpeed *common.MetricReconstructedPacketsSpeed
 	var reconstructionMetricSize *common.MetricReconstructedPacketsSize
@@ -90,66 +147,17 @@ func NewMetric(sessionTimeout int64, infoPath, clusterModelDirectory string,
 	metric.ReqResIdentifier = common.NewReqResIdentifier(dropUnidirectionalFlows, reconstructTCPResponse,
 		reconstructionMetricSpeed, reconstructionMetricSize)
 
-	// Flow Metrics
-	metric.MetricNumPackets = newMetricNumPackets()
-	metric.registerFlowMetric(metric.MetricNumPackets)
-	metric.allExportedMetrics = append(metric.allExportedMetrics, metric.MetricNumPackets)
-
-	metric.MetricFlowRate = newMetricFlowRate()
-	metric.registerFlowMetric(metric.MetricFlowRate)
-	metric.allExportedMetricsUnivariate = append(metric.allExportedMetricsUnivariate, metric.MetricFlowRate)
-
-	// RequestResponse Metrics
-	metric.MetricRRPClusterDistribution = newMetricRRPClusterDistribution()
-	metric.registerRRMetric(metric.MetricRRPClusterDistribution)
-	metric.allExportedMetricsBivariateCluster = append(metric.allExportedMetricsBivariateCluster, metric.MetricRRPClusterDistribution)
-
-	metric.MetricSize = newMetricSize()
-	metric.registerRRMetric(metric.MetricSize)
-	metric.allExportedMetricsBivariateCluster = append(metric.allExportedMetricsBivariateCluster,
-		metric.MetricSize.GetRequest(), metric.MetricSize.GetResponse())
-
-	metric.MetricInterRequest = newMetricInterRequests()
-	metric.registerRRMetric(metric.MetricInterRequest)
-	metric.allExportedMetricsBivariateCluster = append(metric.allExportedMetricsBivariateCluster, metric.MetricInterRequest)
-
-	metric.MetricNumRRPairs = newMetricNumRRPairs()
-	metric.registerRRMetric(metric.MetricNumRRPairs)
-	metric.allExportedMetricsUnivariateCluster = append(metric.allExportedMetricsUnivariateCluster, metric.MetricNumRRPairs)
-
-	// Session metrics
-	metric.MetricNumSessions = newMetricNumSessions()
-	metric.registerSessionMetric(metric.MetricNumSessions)
-	metric.allExportedMetricsUnivariateCluster = append(metric.allExportedMetricsUnivariateCluster, metric.MetricNumSessions)
-
-	metric.MetricInterSessions = newMetricInterSessions()
-	metric.registerSessionMetric(metric.MetricInterSessions)
-	metric.allExportedMetricsUnivariateCluster = append(metric.allExportedMetricsUnivariateCluster, metric.MetricInterSessions)
-
-	metric.MetricNumFlows = newMetricNumFlows()
-	metric.registerSessionMetric(metric.MetricNumFlows)
-	metric.allExportedMetricsUnivariateCluster = append(metric.allExportedMetricsUnivariateCluster, metric.MetricNumFlows)
-
-	metric.MetricInterFlowTimes = newMetricInterFlows()
-	metric.registerSessionMetric(metric.MetricInterFlowTimes)
-	metric.allExportedMetricsUnivariateCluster = append(metric.allExportedMetricsUnivariateCluster, metric.MetricInterFlowTimes)
-
-	metric.MetricNumServers = newMetricNumServers()
-	metric.registerSessionMetric(metric.MetricNumServers)
-	metric.allExportedMetricsBivariateCluster = append(metric.allExportedMetricsBivariateCluster, metric.MetricNumServers)
-
-	metric.MetricFlowClusterDistribution = newMetricFlowClusterDistribution()
-	metric.registerSessionMetric(metric.MetricFlowClusterDistribution)
-	metric.allExportedMetricsUnivariateCluster = append(metric.allExportedMetricsUnivariateCluster, metric.MetricFlowClusterDistribution)
-
-	metric.MetricSessionClusterDistribution = newMetricSessionClusterDistribution()
-	metric.registerSessionMetric(metric.MetricSessionClusterDistribution)
-	metric.allExportedMetricsUnivariateCluster = append(metric.allExportedMetricsUnivariateCluster, metric.MetricSessionClusterDistribution)
-
-	metric.MetricUserClusterDistribution = newMetricUserClusterDistribution()
-	metric.registerSessionMetric(metric.MetricUserClusterDistribution)
-	metric.allExportedMetricsUnivariate = append(metric.allExportedMetricsUnivariate, metric.MetricUserClusterDistribution)
-	return metric
+	// Create and register the enabled metrics in the order of the registry
+	enabled := make(map[string]bool)
+	for _, name := range metricNames {
+		enabled[name] = true
+	}
+	for _, descriptor := range metricRegistry {
+		if enabled[descriptor.name] {
+			descriptor.enable(metric)
+		}
+	}
+	return metric, nil
 }
 
 func (metric *Metric) registerRRMetric(rrMetric RRMetric) {
@@ -174,7 +182,30 @@ func (metric *Metric) OnTCPFlush(flow *flows.TCPFlow) {
 	if dropFlow {
 		return
 	}
+	metric.OnTCPReqRes(protocol, flow, reqRes)
+}
 
+// OnUDPFlush we first identify the request/response pairs. Based on these,
+// the basic metrics to identify the corresponding cluster can be calculated.
+// Afterwards, all metrics are computed.
+// Session Metrics are called by sessionIdentifier on ForceFlush
+func (metric *Metric) OnUDPFlush(flow *flows.UDPFlow) {
+	var protocol = common.GetProtocol(&flow.Flow)
+	reqRes, dropFlow := metric.ReqResIdentifier.OnUDPFlush(protocol, flow)
+	if dropFlow {
+		return
+	}
+	metric.OnUDPReqRes(protocol, flow, reqRes)
+}
+
+// OnTCPReqRes computes all metrics of a flow whose request/response pairs are already identified (see common.ReqResDispatcher).
+func (metric *Metric) OnTCPReqRes(protocol common.Protocol, flow *flows.TCPFlow, reqRes []*common.RequestResponse) {
+	if flow.Truncated != 0 && metric.truncatedFlows != TruncatedFlowsInclude {
+		if metric.truncated != nil {
+			metric.truncated.OnTCPReqRes(protocol, flow, reqRes)
+		}
+		return
+	}
 	metric.clusterController.CollectAndSetFlowClusterIndex(&flow.Flow, reqRes)
 	metric.clusterController.CollectAndSetRRPClusterIndex(&flow.Flow, reqRes)
 
@@ -187,17 +218,14 @@ func (metric *Metric) OnTCPFlush(flow *flows.TCPFlow) {
 	}
 }
 
-// OnUDPFlush we first identify the request/response pairs. Based on these,
-// the basic metrics to identify the corresponding cluster can be calculated.
-// Afterwards, all metrics are computed.
-// Session Metrics are called by sessionIdentifier on ForceFlush
-func (metric *Metric) OnUDPFlush(flow *flows.UDPFlow) {
-	var protocol = common.GetProtocol(&flow.Flow)
-	reqRes, dropFlow := metric.ReqResIdentifier.OnUDPFlush(protocol, flow)
-	if dropFlow {
+// OnUDPReqRes computes all metrics of a flow whose request/response pairs are already identified (see common.ReqResDispatcher).
+func (metric *Metric) OnUDPReqRes(protocol common.Protocol, flow *flows.UDPFlow, reqRes []*common.RequestResponse) {
+	if flow.Truncated != 0 && metric.truncatedFlows != TruncatedFlowsInclude {
+		if metric.truncated != nil {
+			metric.truncated.OnUDPReqRes(protocol, flow, reqRes)
+		}
 		return
 	}
-
 	metric.clusterController.CollectAndSetRRPClusterIndex(&flow.Flow, reqRes)
 	metric.clusterController.CollectAndSetFlowClusterIndex(&flow.Flow, reqRes)
 
@@ -211,27 +239,111 @@ func (metric *Metric) OnUDPFlush(flow *flows.UDPFlow) {
 }
 
 // ForceFlush flushes all open sessions, so that session metrics also process the remaining sessions
-func (metric *Metric) ForceFlush() {
-	metric.SessionIdentifier.forceFlush()
+// Returns an error if the information files could not be stored.
+func (metric *Metric) ForceFlush() error {
+	if metric.SessionIdentifier != nil {
+		metric.SessionIdentifier.forceFlush()
+	}
 	// Save infos in file, which can then be used to calculate clusters
 	// Do this in parallel
 	var wgPersistInfo sync.WaitGroup
+	errs := make([]error, 4)
 	wgPersistInfo.Add(4)
 	go func() {
-		metric.clusterController.PersistSessionInfos(true)
+		errs[0] = metric.clusterController.PersistSessionInfos(true)
 		wgPersistInfo.Done()
 	}()
 	go func() {
-		metric.clusterController.PersistUserInfos(true)
+		errs[1] = metric.clusterController.PersistUserInfos(true)
 		wgPersistInfo.Done()
 	}()
 	go func() {
-		metric.clusterController.PersistFlowInfos(true)
+		errs[2] = metric.clusterController.PersistFlowInfos(true)
 		wgPersistInfo.Done()
 	}()
 	go func() {
-		metric.clusterController.PersistRRPInfos(true)
+		errs[3] = metric.clusterController.PersistRRPInfos(true)
 		wgPersistInfo.Done()
 	}()
 	wgPersistInfo.Wait()
+	if metric.truncated != nil {
+		errs = append(errs, metric.truncated.ForceFlush())
+	}
+	return utils.JoinErrors(errs...)
+}
+
+// PrintStatistics prints the statistics of the main metrics, if they are enabled
+func (metric *Metric) PrintStatistics() {
+	if metric.MetricSize != nil {
+		metric.MetricSize.PrintStatistic(false)
+	}
+	if metric.MetricNumRRPairs != nil {
+		metric.MetricNumRRPairs.PrintStatistic(false)
+	}
+	if metric.MetricInterRequest != nil {
+		metric.MetricInterRequest.PrintStatistic(false)
+	}
+	if metric.MetricNumSessions != nil {
+		metric.MetricNumSessions.PrintStatistic(false)
+	}
+	if metric.MetricInterSessions != nil {
+		metric.MetricInterSessions.PrintStatistic(false)
+	}
+	if metric.MetricNumFlows != nil {
+		metric.MetricNumFlows.PrintStatistic(false)
+	}
+	if metric.MetricInterFlowTimes != nil {
+		metric.MetricInterFlowTimes.PrintStatistic(false)
+	}
+	metric.ReqResIdentifier.PrintStatistic(false)
+	if metric.truncated != nil {
+		fmt.Println("Truncated flows:")
+		metric.truncated.PrintStatistics()
+	}
+}
+
+// Err returns the first error which occurred while processing flows (e.g. during the prediction of clusters).
+// These errors do not stop the analysis.
+func (metric *Metric) Err() error {
+	if err := metric.clusterController.Err(); err != nil || metric.truncated == nil {
+		return err
+	}
+	return metric.truncated.Err()
+}
+
+// DetachOpenSessions removes all sessions which are still open at lastTimestamp and returns them.
+// Must be called before ForceFlush. The sessions can be passed to PreloadSessions of the next run.
+func (metric *Metric) DetachOpenSessions(lastTimestamp int64) []CarriedSession {
+	if metric.SessionIdentifier == nil {
+		return nil
+	}
+	sessions := metric.SessionIdentifier.detachOpenSessions(lastTimestamp)
+	if metric.truncated != nil {
+		for _, session := range metric.truncated.DetachOpenSessions(lastTimestamp) {
+			session.Truncated = true
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+// PreloadSessions adds the open sessions of a previous run. Must be called before the first flow is flushed.
+// The sessions of truncated flows are only preloaded if the truncated flows are handled separately.
+func (metric *Metric) PreloadSessions(sessions []CarriedSession) {
+	if metric.SessionIdentifier == nil {
+		return
+	}
+	var truncatedSessions []CarriedSession
+	var otherSessions []CarriedSession
+	for _, session := range sessions {
+		if session.Truncated {
+			truncatedSessions = append(truncatedSessions, session)
+		} else {
+			otherSessions = append(otherSessions, session)
+		}
+	}
+	metric.SessionIdentifier.preloadSessions(otherSessions)
+	if metric.truncated != nil {
+		metric.truncated.PreloadSessions(truncatedSessions)
+	}
 }
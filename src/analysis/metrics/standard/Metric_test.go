@@ -0,0 +1,142 @@
+package standard
+
+import (
+	"os"
+	"path"
+	"test.com/scale/src/analysis/flows"
+	"test.com/scale/src/analysis/metrics/common"
+	"testing"
+	"time"
+)
+
+// countingFlowMetric counts the flows it receives per server port
+type countingFlowMetric struct {
+	flows map[uint16]int
+}
+
+func newCountingFlowMetric() *countingFlowMetric {
+	return &countingFlowMetric{flows: make(map[uint16]int)}
+}
+
+func (m *countingFlowMetric) OnTCPFlush(flow *flows.TCPFlow) {
+	m.flows[flow.ServerPort]++
+}
+
+func (m *countingFlowMetric) OnUDPFlush(flow *flows.UDPFlow) {
+	m.flows[flow.ServerPort]++
+}
+
+func (m *countingFlowMetric) PrintStatistic(bool) {}
+
+func TestTruncatedFlows(t *testing.T) {
+	timeouts := &flows.Timeouts{TCP: int64(time.Minute), TCPFin: int64(time.Second), TCPRst: int64(time.Second), UDP: int64(time.Minute)}
+	packet := func(port uint16, hasTCP bool) flows.PacketInformation {
+		return flows.PacketInformation{FlowKey: flows.FlowKeyType(port), SrcIP: 1, DstIP: 2, SrcPort: 40000, DstPort: port,
+			Timestamp: int64(time.Second), PayloadLength: 10, HasTCP: hasTCP, HasUDP: !hasTCP, TCPSYN: hasTCP}
+	}
+	// Port 80 and 53 are complete, 443 and 123 truncated
+	tcpFlows := []*flows.TCPFlow{flows.NewTCPFlow(packet(80, true), timeouts), flows.NewTCPFlow(packet(443, true), timeouts)}
+	tcpFlows[1].Truncated = flows.TruncatedStart
+	udpFlows := []*flows.UDPFlow{flows.NewUDPFlow(packet(53, false), timeouts), flows.NewUDPFlow(packet(123, false), timeouts)}
+	udpFlows[1].Truncated = flows.TruncatedEnd
+	complete := map[uint16]int{80: 1, 53: 1}
+	truncated := map[uint16]int{443: 1, 123: 1}
+	all := map[uint16]int{80: 1, 53: 1, 443: 1, 123: 1}
+
+	tests := []struct {
+		mode      string
+		main      map[uint16]int // Flows of the main metrics
+		separate  map[uint16]int // Flows of the metrics of the truncated flows, nil if there are none
+		exported  []uint16       // Protocols exported to the export directory
+		truncated []uint16       // Protocols exported to TruncatedDirectory
+	}{
+		{TruncatedFlowsInclude, all, nil, []uint16{80, 53, 443, 123}, nil},
+		{TruncatedFlowsExclude, complete, nil, []uint16{80, 53}, nil},
+		{TruncatedFlowsSeparate, complete, truncated, []uint16{80, 53}, []uint16{443, 123}},
+	}
+	for _, test := range tests {
+		t.Run(test.mode, func(t *testing.T) {
+			metric, err := NewMetric(int64(time.Minute), "", "", 0, false, false, false, test.mode, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			main := newCountingFlowMetric()
+			metric.registerFlowMetric(main)
+			var separate *countingFlowMetric
+			if metric.truncated != nil {
+				separate = newCountingFlowMetric()
+				metric.truncated.registerFlowMetric(separate)
+			}
+			if (separate == nil) != (test.separate == nil) {
+				t.Fatalf("metrics of the truncated flows exist: %v", separate != nil)
+			}
+
+			for _, flow := range tcpFlows {
+				metric.OnTCPReqRes(common.GetProtocol(&flow.Flow), flow, nil)
+			}
+			for _, flow := range udpFlows {
+				metric.OnUDPReqRes(common.GetProtocol(&flow.Flow), flow, nil)
+			}
+			if !equalCounts(main.flows, test.main) {
+				t.Fatalf("main metrics received %v, expected %v", main.flows, test.main)
+			}
+			if separate != nil && !equalCounts(separate.flows, test.separate) {
+				t.Fatalf("metrics of the truncated flows received %v, expected %v", separate.flows, test.separate)
+			}
+
+			if err = metric.ForceFlush(); err != nil {
+				t.Fatal(err)
+			}
+			directory := t.TempDir()
+			if err = metric.Export(directory); err != nil {
+				t.Fatal(err)
+			}
+			checkExportedProtocols(t, directory, test.exported)
+			checkExportedProtocols(t, path.Join(directory, TruncatedDirectory), test.truncated)
+		})
+	}
+}
+
+func equalCounts(a, b map[uint16]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for port, count := range a {
+		if b[port] != count {
+			return false
+		}
+	}
+	return true
+}
+
+// checkExportedProtocols checks that the directory contains exactly the files of the protocols of the ports
+// (TCP for 80 and 443, UDP otherwise). A missing directory contains no protocols.
+func checkExportedProtocols(t *testing.T, directory string, ports []uint16) {
+	t.Helper()
+	expected := make(map[string]bool)
+	for _, port := range ports {
+		protocol := flows.UDP
+		if port == 80 || port == 443 {
+			protocol = flows.TCP
+		}
+		expected[common.Protocol{Protocol: protocol, Port: port}.GetProtocolString()+".json"] = true
+	}
+	entries, err := os.ReadDir(directory)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			files = append(files, entry.Name())
+		}
+	}
+	for _, file := range files {
+		if !expected[file] {
+			t.Errorf("%s contains %s, expected the protocols of %v", directory, file, ports)
+		}
+	}
+	if len(files) != len(expected) {
+		t.Errorf("%s contains %v, expected the protocols of %v", directory, files, ports)
+	}
+}
@@ -214,3 +214,101 @@ func (si *sessionIdentifier) OnUDPFlush(flow *flows.UDPFlow) {
 func (si *sessionIdentifier) PrintStatistic(verbose bool) {
 
 }
+
+// CarriedSession is a session which was still open at the end of a run.
+// It is handed over to the next run, so that it can be completed there.
+type CarriedSession struct {
+	Protocol   common.Protocol
+	ClientAddr uint64
+	Start      int64
+	End        int64
+	Flows      []CarriedSessionFlow
+	Truncated  bool // The session consists of truncated flows, which are handled separately (see TruncatedFlowsSeparate)
+}
+
+// CarriedSessionFlow is a flow of a CarriedSession
+type CarriedSessionFlow struct {
+	Start        int64
+	End          int64
+	ServerAddr   uint64
+	ClusterIndex int
+}
+
+// detachOpenSessions removes all sessions, which have not timed out at lastTimestamp, and returns them.
+func (si *sessionIdentifier) detachOpenSessions(lastTimestamp int64) []CarriedSession {
+	var carriedSessions []CarriedSession
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+	for _, protSessions := range si.sessions {
+		protSessions.mutex.Lock()
+		for userAddress, userSessions := range protSessions.usersSessions {
+			var closedSessions []*session
+			for _, s := range userSessions.sessions {
+				if lastTimestamp-s.end > si.sessionTimeout {
+					closedSessions = append(closedSessions, s)
+					continue
+				}
+				carriedSession := CarriedSession{
+					Protocol:   protSessions.protocol,
+					ClientAddr: userAddress,
+					Start:      s.start,
+					End:        s.end,
+					Flows:      make([]CarriedSessionFlow, 0, len(s.flows)),
+				}
+				for _, flow := range s.flows {
+					carriedSession.Flows = append(carriedSession.Flows, CarriedSessionFlow{
+						Start:        flow.start,
+						End:          flow.end,
+						ServerAddr:   flow.serverAddr,
+						ClusterIndex: flow.clusterIndex,
+					})
+				}
+				carriedSessions = append(carriedSessions, carriedSession)
+			}
+			// Users without closed sessions must not be flushed to the session metrics
+			if len(closedSessions) == 0 {
+				delete(protSessions.usersSessions, userAddress)
+			} else {
+				userSessions.sessions = closedSessions
+			}
+		}
+		protSessions.mutex.Unlock()
+	}
+	return carriedSessions
+}
+
+// preloadSessions adds the sessions of a previous run. Must be called before the first flow is flushed.
+func (si *sessionIdentifier) preloadSessions(carriedSessions []CarriedSession) {
+	si.mutex.Lock()
+	defer si.mutex.Unlock()
+	for _, carriedSession := range carriedSessions {
+		protSessions, ok := si.sessions[carriedSession.Protocol.ProtocolKey]
+		if !ok {
+			protSessions = &protocolSessionsStruct{protocol: carriedSession.Protocol, usersSessions: make(map[uint64]*userSessionsStruct)}
+			si.sessions[carriedSession.Protocol.ProtocolKey] = protSessions
+		}
+		userSessions, ok := protSessions.usersSessions[carriedSession.ClientAddr]
+		if !ok {
+			userSessions = &userSessionsStruct{}
+			protSessions.usersSessions[carriedSession.ClientAddr] = userSessions
+		}
+		newSession := &session{start: carriedSession.Start, end: carriedSession.End}
+		for _, flow := range carriedSession.Flows {
+			newSession.flows = append(newSession.flows, &sessionFlow{
+				start:        flow.Start,
+				end:          flow.End,
+				serverAddr:   flow.ServerAddr,
+				clusterIndex: flow.ClusterIndex,
+			})
+		}
+		userSessions.sessions = append(userSessions.sessions, newSession)
+	}
+	// onFlush relies on sessions being ordered by their start
+	for _, protSessions := range si.sessions {
+		for _, userSessions := range protSessions.usersSessions {
+			sort.Slice(userSessions.sessions, func(i, j int) bool {
+				return userSessions.sessions[i].start < userSessions.sessions[j].start
+			})
+		}
+	}
+}
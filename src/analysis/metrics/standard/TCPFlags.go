@@ -0,0 +1,58 @@
+package standard
+
+import (
+	"fmt"
+	"test.com/scale/src/analysis/flows"
+	"test.com/scale/src/analysis/metrics/common"
+)
+
+// MetricTCPFlags counts the TCP flows per combination of flags.
+// The values are the bitmaps of the flags of all packets of a flow (see flows.TCPFlagFIN etc.).
+// If the handshake of the flow was completed, 256 is added to the value.
+type MetricTCPFlags struct {
+	flags common.IntMetricUnivariate
+}
+
+// tcpFlagsHandshakeCompleted is added to the flags of flows with a completed handshake
+const tcpFlagsHandshakeCompleted = 256
+
+func newMetricTCPFlags() *MetricTCPFlags {
+	var metricTCPFlags = MetricTCPFlags{}
+	metricTCPFlags.flags = common.NewIntMetricUnivariate(1, false)
+	return &metricTCPFlags
+}
+
+func (mtf *MetricTCPFlags) calc(flow *flows.TCPFlow) int {
+	value := int(flow.TCPFlags.All)
+	if flow.TCPFlags.HandshakeCompleted() {
+		value += tcpFlagsHandshakeCompleted
+	}
+	return value
+}
+
+func (mtf *MetricTCPFlags) OnTCPFlush(flow *flows.TCPFlow) {
+	protocol := common.GetProtocol(&(flow.Flow))
+	mtf.flags.AddValue(protocol, DefaultClusterIndex, mtf.calc(flow))
+}
+
+// OnUDPFlush does nothing, UDP flows have no flags
+func (mtf *MetricTCPFlags) OnUDPFlush(flow *flows.UDPFlow) {}
+
+// Export returns the metric data per Protocol
+func (mtf *MetricTCPFlags) Export(protocolKey common.ProtocolKeyType) *common.ExportUnivariateFormat {
+	return mtf.flags.Export(protocolKey, DefaultClusterIndex)
+}
+
+// Export the stored protocols
+func (mtf *MetricTCPFlags) GetProtocols() []common.Protocol {
+	return mtf.flags.GetProtocols()
+}
+
+func (mtf *MetricTCPFlags) Name() string {
+	return "TCPFlags"
+}
+
+func (mtf *MetricTCPFlags) PrintStatistic(verbose bool) {
+	fmt.Println("Metric TCP flags:")
+	fmt.Print(mtf.flags.GetStatistics(verbose))
+}
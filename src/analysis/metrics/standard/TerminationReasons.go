@@ -0,0 +1,51 @@
+package standard
+
+import (
+	"fmt"
+	"test.com/scale/src/analysis/flows"
+	"test.com/scale/src/analysis/metrics/common"
+)
+
+// MetricTerminationReasons counts the flows per termination reason.
+// The values are the numbers of flows.TerminationReason (1: idle, 2: fin, 3: rst, 4: forced, 5: shutdown).
+type MetricTerminationReasons struct {
+	reasons common.IntMetricUnivariate
+}
+
+func newMetricTerminationReasons() *MetricTerminationReasons {
+	var metricTerminationReasons = MetricTerminationReasons{}
+	metricTerminationReasons.reasons = common.NewIntMetricUnivariate(1, false)
+	return &metricTerminationReasons
+}
+
+func (mtr *MetricTerminationReasons) OnTCPFlush(flow *flows.TCPFlow) {
+	mtr.onFlush(&(flow.Flow))
+}
+
+func (mtr *MetricTerminationReasons) OnUDPFlush(flow *flows.UDPFlow) {
+	mtr.onFlush(&(flow.Flow))
+}
+
+func (mtr *MetricTerminationReasons) onFlush(flow *flows.Flow) {
+	protocol := common.GetProtocol(flow)
+	mtr.reasons.AddValue(protocol, DefaultClusterIndex, int(flow.TerminationReason))
+}
+
+// Export returns the metric data per Protocol
+func (mtr *MetricTerminationReasons) Export(protocolKey common.ProtocolKeyType) *common.ExportUnivariateFormat {
+	return mtr.reasons.Export(protocolKey, DefaultClusterIndex)
+}
+
+// Export the stored protocols
+func (mtr *MetricTerminationReasons) GetProtocols() []common.Protocol {
+	return mtr.reasons.GetProtocols()
+}
+
+func (mtr *MetricTerminationReasons) Name() string {
+	return "TerminationReasons"
+}
+
+func (mtr *MetricTerminationReasons) PrintStatistic(verbose bool) {
+	fmt.Println("Metric Termination reasons:")
+	fmt.Print(mtr.reasons.GetStatistics(verbose))
+}
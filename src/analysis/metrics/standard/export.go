@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"path"
 	"test.com/scale/src/analysis/metrics/common"
+	"test.com/scale/src/analysis/utils"
 
 	"github.com/dustin/go-humanize"
 )
@@ -88,19 +89,45 @@ func addBivariateClusterMetricDataToExport(export *exportFormat, metric MetricBi
 }
 
 // Export stores the metric in JSON files in the "directory"
-// It will create one file for each protocol.
-func (metric *Metric) Export(directory string) {
+// It will create one file for each protocol. The metrics of separately handled truncated flows are stored in the TruncatedDirectory.
+// If a file can not be exported, the other files are still exported and the errors are returned.
+func (metric *Metric) Export(directory string) error {
+	var errs []error
+	if metric.truncated != nil {
+		truncatedDirectory := path.Join(directory, TruncatedDirectory)
+		if err := utils.CreateDir(truncatedDirectory); err != nil {
+			errs = append(errs, err)
+		} else if err = metric.truncated.Export(truncatedDirectory); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
 	var allProtocols = make(map[common.ProtocolKeyType]common.Protocol)
 
 	// Get protocols from all metrics and only add new protocols to list of all protocols
-	for _, singleMetric := range metric.allExportedMetricsUnivariate {
-		protocols := singleMetric.GetProtocols()
+	// All lists are considered, since only some metrics may be enabled
+	addProtocols := func(protocols []common.Protocol) {
 		for _, protocol := range protocols {
 			if _, ok := allProtocols[protocol.ProtocolKey]; !ok {
 				allProtocols[protocol.ProtocolKey] = protocol
 			}
 		}
 	}
+	for _, singleMetric := range metric.allExportedMetrics {
+		addProtocols(singleMetric.GetProtocols())
+	}
+	for _, singleMetric := range metric.allExportedMetricsUnivariate {
+		addProtocols(singleMetric.GetProtocols())
+	}
+	for _, singleMetric := range metric.allExportedMetricsUnivariateCluster {
+		addProtocols(singleMetric.GetProtocols())
+	}
+	for _, singleMetric := range metric.allExportedMetricsBivariate {
+		addProtocols(singleMetric.GetProtocols())
+	}
+	for _, singleMetric := range metric.allExportedMetricsBivariateCluster {
+		addProtocols(singleMetric.GetProtocols())
+	}
 
 	fmt.Println("Create Metrics for", humanize.Comma(int64(len(allProtocols))), "protocols")
 	for _, protocol := range allProtocols {
@@ -126,18 +153,21 @@ func (metric *Metric) Export(directory string) {
 		for _, singleMetric := range metric.allExportedMetricsBivariateCluster {
 			addBivariateClusterMetricDataToExport(&export, singleMetric, protocol)
 		}
+		filename := path.Join(directory, protocol.GetProtocolString()+".json")
 		b, err := json.Marshal(export)
 		if err != nil {
-			fmt.Println(err.Error())
-			panic("Error during marshalling data")
+			errs = append(errs, fmt.Errorf("error during marshalling data for %s: %v", filename, err))
+			continue
 		}
 
-		filename := path.Join(directory, protocol.GetProtocolString()+".json")
 		err = ioutil.WriteFile(filename, b, 0644)
 		if err != nil {
-			fmt.Println(err.Error())
-			panic("Could not export json file " + filename)
+			errs = append(errs, fmt.Errorf("could not export json file %s: %v", filename, err))
 		}
 	}
+	if len(errs) > 0 {
+		return utils.JoinErrors(errs...)
+	}
 	fmt.Println("Export successfull")
+	return nil
 }
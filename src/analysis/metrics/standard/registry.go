@@ -0,0 +1,200 @@
+package standard
+
+// This file contains the registry of the standard metrics.
+// Metrics are enabled by their name, the metrics they depend on are enabled automatically.
+// Disabled metrics are neither created nor registered, hence they do not cost memory or runtime.
+
+import (
+	"fmt"
+	"sort"
+)
+
+// sessionIdentifierDependency is the internal dependency of all session metrics, it can not be selected
+const sessionIdentifierDependency = "sessionIdentifier"
+
+// clusterDependencies are the metrics which are used by the ClusterController to describe rrps, flows, sessions and users.
+// They are enabled automatically, if cluster information is collected or cluster models are used.
+var clusterDependencies = []string{"size", "interRequests", "numServers", "numFlows", "interFlows", "interSessions", sessionIdentifierDependency}
+
+type metricDescriptor struct {
+	name     string
+	requires []string
+	enable   func(metric *Metric)
+}
+
+// metricRegistry contains all standard metrics in the order in which they are registered
+var metricRegistry = []metricDescriptor{
+	{sessionIdentifierDependency, nil, func(metric *Metric) {
+		metric.SessionIdentifier = newSessionIdentifier(metric.sessionTimeout, metric.clusterController)
+		metric.registerFlowMetric(metric.SessionIdentifier)
+	}},
+
+	// Flow Metrics
+	{"numPackets", nil, func(metric *Metric) {
+		metric.MetricNumPackets = newMetricNumPackets()
+		metric.registerFlowMetric(metric.MetricNumPackets)
+		metric.allExportedMetrics = append(metric.allExportedMetrics, metric.MetricNumPackets)
+	}},
+	{"flowRate", nil, func(metric *Metric) {
+		metric.MetricFlowRate = newMetricFlowRate()
+		metric.registerFlowMetric(metric.MetricFlowRate)
+		metric.allExportedMetricsUnivariate = append(metric.allExportedMetricsUnivariate, metric.MetricFlowRate)
+	}},
+	{"terminationReasons", nil, func(metric *Metric) {
+		metric.MetricTerminationReasons = newMetricTerminationReasons()
+		metric.registerFlowMetric(metric.MetricTerminationReasons)
+		metric.allExportedMetricsUnivariate = append(metric.allExportedMetricsUnivariate, metric.MetricTerminationReasons)
+	}},
+	{"tcpFlags", nil, func(metric *Metric) {
+		metric.MetricTCPFlags = newMetricTCPFlags()
+		metric.registerFlowMetric(metric.MetricTCPFlags)
+		metric.allExportedMetricsUnivariate = append(metric.allExportedMetricsUnivariate, metric.MetricTCPFlags)
+	}},
+
+	// RequestResponse Metrics
+	{"rrpClusterDistribution", nil, func(metric *Metric) {
+		metric.MetricRRPClusterDistribution = newMetricRRPClusterDistribution()
+		metric.registerRRMetric(metric.MetricRRPClusterDistribution)
+		metric.allExportedMetricsBivariateCluster = append(metric.allExportedMetricsBivariateCluster, metric.MetricRRPClusterDistribution)
+	}},
+	{"size", nil, func(metric *Metric) {
+		metric.MetricSize = newMetricSize()
+		metric.registerRRMetric(metric.MetricSize)
+		metric.allExportedMetricsBivariateCluster = append(metric.allExportedMetricsBivariateCluster,
+			metric.MetricSize.GetRequest(), metric.MetricSize.GetResponse())
+	}},
+	{"interRequests", nil, func(metric *Metric) {
+		metric.MetricInterRequest = newMetricInterRequests()
+		metric.registerRRMetric(metric.MetricInterRequest)
+		metric.allExportedMetricsBivariateCluster = append(metric.allExportedMetricsBivariateCluster, metric.MetricInterRequest)
+	}},
+	{"numRRPairs", nil, func(metric *Metric) {
+		metric.MetricNumRRPairs = newMetricNumRRPairs()
+		metric.registerRRMetric(metric.MetricNumRRPairs)
+		metric.allExportedMetricsUnivariateCluster = append(metric.allExportedMetricsUnivariateCluster, metric.MetricNumRRPairs)
+	}},
+
+	// Session metrics
+	{"numSessions", []string{sessionIdentifierDependency}, func(metric *Metric) {
+		metric.MetricNumSessions = newMetricNumSessions()
+		metric.registerSessionMetric(metric.MetricNumSessions)
+		metric.allExportedMetricsUnivariateCluster = append(metric.allExportedMetricsUnivariateCluster, metric.MetricNumSessions)
+	}},
+	{"interSessions", []string{sessionIdentifierDependency}, func(metric *Metric) {
+		metric.MetricInterSessions = newMetricInterSessions()
+		metric.registerSessionMetric(metric.MetricInterSessions)
+		metric.allExportedMetricsUnivariateCluster = append(metric.allExportedMetricsUnivariateCluster, metric.MetricInterSessions)
+	}},
+	{"numFlows", []string{sessionIdentifierDependency}, func(metric *Metric) {
+		metric.MetricNumFlows = newMetricNumFlows()
+		metric.registerSessionMetric(metric.MetricNumFlows)
+		metric.allExportedMetricsUnivariateCluster = append(metric.allExportedMetricsUnivariateCluster, metric.MetricNumFlows)
+	}},
+	{"interFlows", []string{sessionIdentifierDependency}, func(metric *Metric) {
+		metric.MetricInterFlowTimes = newMetricInterFlows()
+		metric.registerSessionMetric(metric.MetricInterFlowTimes)
+		metric.allExportedMetricsUnivariateCluster = append(metric.allExportedMetricsUnivariateCluster, metric.MetricInterFlowTimes)
+	}},
+	{"numServers", []string{sessionIdentifierDependency}, func(metric *Metric) {
+		metric.MetricNumServers = newMetricNumServers()
+		metric.registerSessionMetric(metric.MetricNumServers)
+		metric.allExportedMetricsBivariateCluster = append(metric.allExportedMetricsBivariateCluster, metric.MetricNumServers)
+	}},
+	{"flowClusterDistribution", []string{sessionIdentifierDependency}, func(metric *Metric) {
+		metric.MetricFlowClusterDistribution = newMetricFlowClusterDistribution()
+		metric.registerSessionMetric(metric.MetricFlowClusterDistribution)
+		metric.allExportedMetricsUnivariateCluster = append(metric.allExportedMetricsUnivariateCluster, metric.MetricFlowClusterDistribution)
+	}},
+	{"sessionClusterDistribution", []string{sessionIdentifierDependency}, func(metric *Metric) {
+		metric.MetricSessionClusterDistribution = newMetricSessionClusterDistribution()
+		metric.registerSessionMetric(metric.MetricSessionClusterDistribution)
+		metric.allExportedMetricsUnivariateCluster = append(metric.allExportedMetricsUnivariateCluster, metric.MetricSessionClusterDistribution)
+	}},
+	{"userClusterDistribution", []string{sessionIdentifierDependency}, func(metric *Metric) {
+		metric.MetricUserClusterDistribution = newMetricUserClusterDistribution()
+		metric.registerSessionMetric(metric.MetricUserClusterDistribution)
+		metric.allExportedMetricsUnivariate = append(metric.allExportedMetricsUnivariate, metric.MetricUserClusterDistribution)
+	}},
+}
+
+// MetricNames returns the names of all standard metrics which can be enabled or disabled
+func MetricNames() []string {
+	var names []string
+	for _, descriptor := range metricRegistry {
+		if descriptor.name != sessionIdentifierDependency {
+			names = append(names, descriptor.name)
+		}
+	}
+	return names
+}
+
+// ResolveMetrics returns the names of the metrics to create: the enabled metrics (all if nil) without the disabled metrics,
+// together with their dependencies. If useClusters is set, the metrics required by the ClusterController are added.
+// Returns an error if a name is unknown or a disabled metric is required by another metric.
+func ResolveMetrics(enabled, disabled []string, useClusters bool) ([]string, error) {
+	if enabled == nil {
+		enabled = MetricNames()
+	}
+	selectable := make(map[string]bool)
+	for _, name := range MetricNames() {
+		selectable[name] = true
+	}
+	isDisabled := make(map[string]bool)
+	for _, name := range append(append([]string(nil), enabled...), disabled...) {
+		if !selectable[name] {
+			return nil, fmt.Errorf("unknown standard metric %s", name)
+		}
+	}
+	for _, name := range disabled {
+		isDisabled[name] = true
+	}
+
+	resolved := make(map[string]bool)
+	var resolve func(name, requiredBy string) error
+	resolve = func(name, requiredBy string) error {
+		if isDisabled[name] {
+			if requiredBy == "" {
+				return nil
+			}
+			return fmt.Errorf("standard metric %s is disabled, but required by %s", name, requiredBy)
+		}
+		if resolved[name] {
+			return nil
+		}
+		resolved[name] = true
+		for _, dependency := range findMetricDescriptor(name).requires {
+			if err := resolve(dependency, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, name := range enabled {
+		if err := resolve(name, ""); err != nil {
+			return nil, err
+		}
+	}
+	if useClusters {
+		for _, name := range clusterDependencies {
+			if err := resolve(name, "the clustering"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var names []string
+	for name := range resolved {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func findMetricDescriptor(name string) *metricDescriptor {
+	for i := range metricRegistry {
+		if metricRegistry[i].name == name {
+			return &metricRegistry[i]
+		}
+	}
+	return nil
+}
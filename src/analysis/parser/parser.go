@@ -8,7 +8,6 @@ import (
 	"sync"
 	"test.com/scale/src/analysis/flows"
 	"test.com/scale/src/analysis/pool"
-	"time"
 
 	"github.com/cespare/xxhash"
 
@@ -19,28 +18,23 @@ import (
 // parserChannelSize defines the Size of the channel to the Parser
 const parserChannelSize = 40000
 
-// packetDataCacheSize is the batching size of the packets sent to the Parsers
-const packetDataCacheSize = 1600
-
-const ringBufferFlushChannelSize = 200
+// DefaultBatchSize is the default batching size of the packets sent to the Parsers
+const DefaultBatchSize = 1600
 
 // Parser multithreads parsing of packets
 type Parser struct {
 	numFlowThreads       uint64
-	parsePacketDataCache packetDataCache
+	parsePacketDataCache []PacketData
+	batchSize            int
 	pool                 *pool.Pools
 	samplingrate         float64
 	numParserChannel     int
-	parserChannel        []chan [packetDataCacheSize]PacketData
+	parserChannel        []chan []PacketData
 
-	ringbufferUsedlist     []bool // Same size as ringbuffer. Indicates whether a ringbuffer entry is used or not
-	ringbuffer             []flows.PacketInformation
-	ringbufferStart        int64
-	ringbufferSize         int64
-	ringbufferFlushChannel chan bool
+	reorderBuffer *reorderBuffer
 
-	wgParserThreads   sync.WaitGroup // Waitgroup to wait until parser are finished
-	wgRingbufferFlush sync.WaitGroup // Waitgroup to wait until Ringbuffer is flushed
+	wgParserThreads sync.WaitGroup // Waitgroup to wait until parser are finished
+	wgReorderFlush  sync.WaitGroup // Waitgroup to wait until reorder buffer is flushed
 }
 
 // PacketData contains the basic information from the packet source
@@ -50,68 +44,87 @@ type PacketData struct {
 	PacketIdx int64
 }
 
-type packetDataCache struct {
-	buf [packetDataCacheSize]PacketData
-	pos int
-}
-
 // NewParser returns a new parser
-func NewParser(p *pool.Pools, sortingRingBufferSize int64, numParserThreads int, samplingrate float64, numParserChannel int) *Parser {
+// sortingRingBufferSize is the maximal number of packets which can wait to be sorted.
+// Packets further ahead are only handed to the parsers once the missing packets have been parsed. Hence, it must be larger than batchSize.
+// batchSize is the number of packets which are sent to the parsers at once.
+func NewParser(p *pool.Pools, sortingRingBufferSize int64, numParserThreads int, samplingrate float64, numParserChannel, batchSize int) *Parser {
 	var parser = &Parser{
-		pool:                   p,
-		samplingrate:           samplingrate,
-		numParserChannel:       int(math.Min(float64(numParserChannel), float64(numParserThreads))),
-		parsePacketDataCache:   packetDataCache{},
-		ringbufferUsedlist:     make([]bool, sortingRingBufferSize),
-		ringbuffer:             make([]flows.PacketInformation, sortingRingBufferSize),
-		ringbufferStart:        1,
-		ringbufferSize:         sortingRingBufferSize,
-		ringbufferFlushChannel: make(chan bool, ringBufferFlushChannelSize),
-		numFlowThreads:         uint64(p.GetNumFlowThreads()),
+		pool:                 p,
+		samplingrate:         samplingrate,
+		numParserChannel:     int(math.Min(float64(numParserChannel), float64(numParserThreads))),
+		parsePacketDataCache: make([]PacketData, 0, batchSize),
+		batchSize:            batchSize,
+		reorderBuffer:        newReorderBuffer(sortingRingBufferSize, 1),
+		numFlowThreads:       uint64(p.GetNumFlowThreads()),
 	}
 	parser.wgParserThreads.Add(numParserThreads)
-	parser.parserChannel = make([]chan [packetDataCacheSize]PacketData, parser.numParserChannel)
-	for i := 0; i < numParserChannel; i++ {
-		parser.parserChannel[i] = make(chan [packetDataCacheSize]PacketData, parserChannelSize)
+	parser.parserChannel = make([]chan []PacketData, parser.numParserChannel)
+	for i := 0; i < parser.numParserChannel; i++ {
+		parser.parserChannel[i] = make(chan []PacketData, parserChannelSize)
 	}
 	for i := 0; i < numParserThreads; i++ {
 		go parser.parsePacket(parser.parserChannel[i%parser.numParserChannel], i)
 	}
-	parser.wgRingbufferFlush.Add(1)
-	go parser.flushRingbuffer()
+	parser.wgReorderFlush.Add(1)
+	go parser.flushReorderBuffer()
 	return parser
 }
 
 // Close Parser and flush out all packets to the pool
 func (p *Parser) Close() {
 	// Flush to parser
-	tmpPacketsCache := packetDataCache{}
-	copy(tmpPacketsCache.buf[:p.parsePacketDataCache.pos], p.parsePacketDataCache.buf[:p.parsePacketDataCache.pos])
-	p.parserChannel[0] <- tmpPacketsCache.buf
+	if len(p.parsePacketDataCache) > 0 {
+		p.reorderBuffer.waitForWindow(p.parsePacketDataCache[len(p.parsePacketDataCache)-1].PacketIdx)
+	}
+	p.parserChannel[0] <- p.parsePacketDataCache
 	// Close Parser
 	for i := 0; i < p.numParserChannel; i++ {
 		close(p.parserChannel[i])
 	}
 	p.wgParserThreads.Wait()
 
-	// Ensure to flush out all remaining packets from the sorting ringbuffer
-	p.ringbufferFlushChannel <- true
-	close(p.ringbufferFlushChannel)
-	p.wgRingbufferFlush.Wait()
+	// Ensure to flush out all remaining packets from the reorder buffer
+	p.reorderBuffer.close()
+	p.wgReorderFlush.Wait()
 }
 
 // ParsePacket adds a packet to the parser (buffered)
 func (p *Parser) ParsePacket(data []byte, packetIdx, packetTimestamp int64) {
-	p.parsePacketDataCache.buf[p.parsePacketDataCache.pos] = PacketData{Data: data, PacketIdx: packetIdx, Timestamp: packetTimestamp}
-	p.parsePacketDataCache.pos++
-	if p.parsePacketDataCache.pos == packetDataCacheSize {
-		p.parserChannel[rand.Intn(p.numParserChannel)] <- p.parsePacketDataCache.buf
-		p.parsePacketDataCache.pos = 0
+	p.parsePacketDataCache = append(p.parsePacketDataCache, PacketData{Data: data, PacketIdx: packetIdx, Timestamp: packetTimestamp})
+	if len(p.parsePacketDataCache) == p.batchSize {
+		p.reorderBuffer.waitForWindow(packetIdx)
+		// The batch is handed over to a parser, hence a new one is required
+		p.parserChannel[rand.Intn(p.numParserChannel)] <- p.parsePacketDataCache
+		p.parsePacketDataCache = make([]PacketData, 0, p.batchSize)
+	}
+}
+
+// ParsePacketBatch adds a batch of packets to the parser (unbuffered).
+// In contrast to ParsePacket, it may be called concurrently, as long as each PacketIdx is used only once.
+// The packets of the batch must be sorted by their PacketIdx. The batch is handed to the parsers in parts,
+// each part blocks until it fits into the window of the reorder buffer.
+// The slice is handed over to the parsers and must not be modified afterwards.
+func (p *Parser) ParsePacketBatch(packets []PacketData) {
+	for start := 0; start < len(packets); start += p.batchSize {
+		end := start + p.batchSize
+		if end > len(packets) {
+			end = len(packets)
+		}
+		p.reorderBuffer.waitForWindow(packets[end-1].PacketIdx)
+		p.parserChannel[rand.Intn(p.numParserChannel)] <- packets[start:end]
 	}
 }
 
+// WaitForWindow blocks until the packet with packetIdx can be handed to the parsers, i.e. it is less than
+// sortingRingBufferSize packets ahead of the next packet to sort. Concurrent callers of ParsePacketBatch use it
+// to limit how far they read ahead.
+func (p *Parser) WaitForWindow(packetIdx int64) {
+	p.reorderBuffer.waitForWindow(packetIdx)
+}
+
 // parsePacket is the internal method, called when the internal cache/buffer is full
-func (p *Parser) parsePacket(channel chan [packetDataCacheSize]PacketData, parserIndex int) {
+func (p *Parser) parsePacket(channel chan []PacketData, parserIndex int) {
 	var dot1q layers.Dot1Q
 	var gre layers.GRE
 	var eth layers.Ethernet
@@ -133,12 +146,10 @@ func (p *Parser) parsePacket(channel chan [packetDataCacheSize]PacketData, parse
 	parserIPv4 := gopacket.NewDecodingLayerParser(layers.LayerTypeIPv4, &ipv4, &tcp, &udp)
 	parserIPv6 := gopacket.NewDecodingLayerParser(layers.LayerTypeIPv6, &ipv6, &ipv6e, &tcp, &udp)
 	var decoded []gopacket.LayerType
+	parsedPackets := make([]flows.PacketInformation, 0, p.batchSize)
 	for packets := range channel {
-		for _, packet := range &packets {
-			// Ignore empty packets from last flush
-			if packet.PacketIdx == 0 {
-				continue
-			}
+		parsedPackets = parsedPackets[:0]
+		for _, packet := range packets {
 			_ = parserIPv4.DecodeLayers(packet.Data, &decoded)
 			if len(decoded) < 2 {
 				_ = parser.DecodeLayers(packet.Data, &decoded)
@@ -209,141 +220,35 @@ func (p *Parser) parsePacket(channel chan [packetDataCacheSize]PacketData, parse
 				}
 			}
 
-			for packetInfo.PacketIdx-p.ringbufferStart > p.ringbufferSize {
-				//p.flushRingbuffer()
-				p.ringbufferFlushChannel <- true
-				time.Sleep(1 * time.Second)
-				fmt.Println("Parser", parserIndex, ": Sleep for 1s due to missing space in ringbuffer.")
-				fmt.Println("Parser", parserIndex, ": Please increase sortingRingBufferSize variable or increase number of pool to speed up flushing if this happens more often.")
-			}
 			// Sampling
 			if uint64(packetInfo.FlowKey)%samplingModulo > p.numFlowThreads {
 				packetInfo.HasTCP = false
 				packetInfo.HasUDP = false
 			}
-			ringBufferIndex := packetInfo.PacketIdx % p.ringbufferSize
-			p.ringbuffer[ringBufferIndex] = packetInfo
-			p.ringbufferUsedlist[ringBufferIndex] = true
-		}
-		if rand.Intn(100) <= 5 {
-			p.ringbufferFlushChannel <- true
+			parsedPackets = append(parsedPackets, packetInfo)
 		}
+		p.reorderBuffer.insert(parsedPackets)
 	}
 	p.wgParserThreads.Done()
 }
 
-// flushRingbuffer checks if packets can be flushed out to the processing unit.
-func (p *Parser) flushRingbuffer() {
-	for range p.ringbufferFlushChannel {
-		// Go through ringbuffer and flush out all available packets
-
-		//calculate the ringbuffer usage
-		/*var ringbufferUsage int
-		for _, used := range p.ringbufferUsedlist {
-			if used {
-				ringbufferUsage++
-			}
+// flushReorderBuffer forwards the sorted packets to the pools.
+func (p *Parser) flushReorderBuffer() {
+	packets := make([]flows.PacketInformation, 0, reorderSegmentSize)
+	for {
+		packets = p.reorderBuffer.take(packets[:0])
+		if len(packets) == 0 {
+			break
 		}
-		fmt.Println("Ringbuffer usage before flush:", ringbufferUsage, "/", p.ringbufferSize)*/
-
-		//var already_ran int64
-
-		for i := p.ringbufferStart; true; i++ {
-			ringBufferIndex := i % p.ringbufferSize
-			/*already_ran++
-
-			if already_ran > p.ringbufferSize {
-				continue // todo is disabled, needs to be break to reenable
-			}*/
-
-			if !p.ringbufferUsedlist[ringBufferIndex] {
-				p.ringbufferStart = i
-				break
-				// was break TODO change?
-			}
-			if p.ringbuffer[ringBufferIndex].HasTCP {
-				p.pool.AddTCPPacket(&p.ringbuffer[ringBufferIndex])
-			} else if p.ringbuffer[ringBufferIndex].HasUDP {
-				p.pool.AddUDPPacket(&p.ringbuffer[ringBufferIndex])
+		for i := range packets {
+			if packets[i].HasTCP {
+				p.pool.AddTCPPacket(&packets[i])
+			} else if packets[i].HasUDP {
+				p.pool.AddUDPPacket(&packets[i])
 			}
-			p.ringbufferUsedlist[ringBufferIndex] = false
 		}
-		/*
-			var ringbufferUsage int64
-			ringbufferUsage = 0
-			for _, used := range p.ringbufferUsedlist {
-				if used {
-					ringbufferUsage++
-				}
-			}
-			if float64(ringbufferUsage)/float64(p.ringbufferSize) > 0.5 {
-				fmt.Println("Ringbuffer usage after flush:", ringbufferUsage, "/", p.ringbufferSize)
-				// find continous ares of used ring buffer indexes and print their start and end
-				var start int64
-				var end int64
-				var found bool
-				found = false
-				for i := int64(0); i < p.ringbufferSize; i++ {
-					if p.ringbufferUsedlist[i] {
-						if !found {
-							start = i
-							found = true
-						}
-						end = i
-					} else {
-						if found {
-
-							fmt.Println("Used ringbuffer indexes:", start, "-", end)
-							fmt.Println("ringbuffer start", p.ringbufferStart)
-							found = false
-						}
-					}
-				}
-				// print new line
-				fmt.Println()*/
-		/*
-			if p.ringbufferUsedlist[(p.ringbufferStart+1)%p.ringbufferSize] == true {
-				if p.ringbufferUsedlist[(p.ringbufferStart+int64(0.1*float64(p.ringbufferSize)))%p.ringbufferSize] == true { // cheap binary search
-					if p.ringbufferUsedlist[(p.ringbufferStart+int64(0.5*float64(p.ringbufferSize)))%p.ringbufferSize] == true {
-						p.ringbufferStart = p.ringbufferStart + 1 // if ringbuffer at 50 percent or above move this one packet ahead
-
-						//then do this for debugging:
-						// find continous ares of used ring buffer indexes and print their start and end
-						var start int64
-						var end int64
-						var found bool
-						var hits int8
-						found = false
-						for i := int64(0); i < p.ringbufferSize; i++ {
-							if hits > 3 {
-								fmt.Println("and more slices")
-								break
-							}
-							if p.ringbufferUsedlist[i] {
-								if !found {
-									start = i
-									found = true
-								}
-								end = i
-							} else {
-								if found {
-									hits++
-									fmt.Println("Used ringbuffer indexes:", start, "-", end)
-
-									found = false
-								}
-							}
-						}
-						// print new line
-						fmt.Println("ringbuffer start", p.ringbufferStart%p.ringbufferSize)
-						fmt.Println()
-
-					}
-				}
-			}*/
-
 	}
-	p.wgRingbufferFlush.Done()
+	p.wgReorderFlush.Done()
 }
 
 // GetFlowKey returns the Flow key. Is symmetric so A:46254<-->B:80 returns the same key in both directions
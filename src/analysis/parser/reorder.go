@@ -0,0 +1,157 @@
+package parser
+
+// This file contains the reorder stage between the parsers and the pools.
+// The parsers work concurrently, hence packets are parsed out of order.
+// The pools however require the packets of a flow in the order they were captured.
+
+import (
+	"sync"
+	"test.com/scale/src/analysis/flows"
+)
+
+// reorderSegmentSize is the number of packets per segment
+const reorderSegmentSize = 64 * 1024
+
+// maxFreeReorderSegments is the number of emptied segments which are kept for reuse
+const maxFreeReorderSegments = 4
+
+// reorderBuffer sorts packets by their PacketIdx.
+// Packets are stored in segments, which are allocated on demand and recycled as soon as all of their packets are emitted.
+// Thereby, memory is only used for the packets which are actually waiting.
+// A packet may only be handed to the parsers if it is less than capacity packets ahead of the next packet to emit (see waitForWindow).
+// Hence, the parsers never block on insert: the packets which are missing to advance have always been handed to the parsers before.
+type reorderBuffer struct {
+	mutex        sync.Mutex
+	notFull      *sync.Cond // Signaled when packets have been emitted
+	notEmpty     *sync.Cond // Signaled when the next packet can be emitted or the buffer is closed
+	segments     map[int64]*reorderSegment
+	freeSegments []*reorderSegment
+	capacity     int64
+	next         int64 // PacketIdx of the next packet to emit
+	buffered     int64 // Number of packets waiting
+	closed       bool
+}
+
+type reorderSegment struct {
+	packets []flows.PacketInformation
+	used    []bool
+}
+
+// newReorderBuffer creates a new reorderBuffer, which admits packets up to capacity packets ahead of the next packet to emit.
+// The capacity must be larger than the number of packets of a single parser batch.
+func newReorderBuffer(capacity int64, firstPacketIdx int64) *reorderBuffer {
+	rb := &reorderBuffer{
+		segments: make(map[int64]*reorderSegment),
+		capacity: capacity,
+		next:     firstPacketIdx,
+	}
+	rb.notFull = sync.NewCond(&rb.mutex)
+	rb.notEmpty = sync.NewCond(&rb.mutex)
+	return rb
+}
+
+// waitForWindow blocks until the packet with packetIdx is less than capacity packets ahead of the next packet to emit.
+// Must be called before a batch is handed to the parsers with the last PacketIdx of the batch.
+// It must not be called by the parsers themselves, otherwise they could wait for a packet queued behind them.
+func (rb *reorderBuffer) waitForWindow(packetIdx int64) {
+	rb.mutex.Lock()
+	for packetIdx >= rb.next+rb.capacity {
+		rb.notFull.Wait()
+	}
+	rb.mutex.Unlock()
+}
+
+// segment returns the segment of a PacketIdx. If allocate is set, it will be allocated if necessary.
+// Must be called with the lock held.
+func (rb *reorderBuffer) segment(packetIdx int64, allocate bool) *reorderSegment {
+	segmentIdx := packetIdx / reorderSegmentSize
+	s := rb.segments[segmentIdx]
+	if s == nil && allocate {
+		if len(rb.freeSegments) > 0 {
+			s = rb.freeSegments[len(rb.freeSegments)-1]
+			rb.freeSegments = rb.freeSegments[:len(rb.freeSegments)-1]
+		} else {
+			s = &reorderSegment{
+				packets: make([]flows.PacketInformation, reorderSegmentSize),
+				used:    make([]bool, reorderSegmentSize),
+			}
+		}
+		rb.segments[segmentIdx] = s
+	}
+	return s
+}
+
+// isUsed returns whether the packet with packetIdx is waiting.
+// Must be called with the lock held.
+func (rb *reorderBuffer) isUsed(packetIdx int64) bool {
+	s := rb.segment(packetIdx, false)
+	return s != nil && s.used[packetIdx%reorderSegmentSize]
+}
+
+// insert adds packets to the buffer. It never blocks, the window is enforced before by waitForWindow.
+// Packets before the next packet to emit can not be emitted anymore and are dropped.
+func (rb *reorderBuffer) insert(packets []flows.PacketInformation) {
+	rb.mutex.Lock()
+	for i := range packets {
+		if packets[i].PacketIdx < rb.next {
+			continue
+		}
+		s := rb.segment(packets[i].PacketIdx, true)
+		s.packets[packets[i].PacketIdx%reorderSegmentSize] = packets[i]
+		s.used[packets[i].PacketIdx%reorderSegmentSize] = true
+		rb.buffered++
+		if packets[i].PacketIdx == rb.next {
+			rb.notEmpty.Signal()
+		}
+	}
+	rb.mutex.Unlock()
+}
+
+// take blocks until the next packets can be emitted and appends them in order to out.
+// Returns an empty slice if the buffer is closed and all packets have been emitted.
+func (rb *reorderBuffer) take(out []flows.PacketInformation) []flows.PacketInformation {
+	rb.mutex.Lock()
+	defer rb.mutex.Unlock()
+	for !rb.isUsed(rb.next) {
+		if rb.closed {
+			if rb.buffered == 0 {
+				return out
+			}
+			// Skip missing packets, since they will never arrive
+			rb.advance()
+			continue
+		}
+		rb.notEmpty.Wait()
+	}
+	for len(out) < reorderSegmentSize && rb.isUsed(rb.next) {
+		s := rb.segment(rb.next, false)
+		out = append(out, s.packets[rb.next%reorderSegmentSize])
+		s.used[rb.next%reorderSegmentSize] = false
+		rb.buffered--
+		rb.advance()
+	}
+	rb.notFull.Broadcast()
+	return out
+}
+
+// advance moves to the next packet and recycles the segment if it has been completely emitted.
+// Must be called with the lock held.
+func (rb *reorderBuffer) advance() {
+	rb.next++
+	if rb.next%reorderSegmentSize != 0 {
+		return
+	}
+	segmentIdx := (rb.next - 1) / reorderSegmentSize
+	if s := rb.segments[segmentIdx]; s != nil && len(rb.freeSegments) < maxFreeReorderSegments {
+		rb.freeSegments = append(rb.freeSegments, s)
+	}
+	delete(rb.segments, segmentIdx)
+}
+
+// close signals that no more packets will be inserted.
+func (rb *reorderBuffer) close() {
+	rb.mutex.Lock()
+	rb.closed = true
+	rb.notEmpty.Broadcast()
+	rb.mutex.Unlock()
+}
@@ -0,0 +1,136 @@
+package parser
+
+import (
+	"math/rand"
+	"sync"
+	"test.com/scale/src/analysis/flows"
+	"testing"
+	"time"
+)
+
+// makePackets returns the packets from first to last (inclusive)
+func makePackets(first, last int64) []flows.PacketInformation {
+	packets := make([]flows.PacketInformation, 0, last-first+1)
+	for idx := first; idx <= last; idx++ {
+		packets = append(packets, flows.PacketInformation{PacketIdx: idx})
+	}
+	return packets
+}
+
+// takeAll emits all packets of the buffer until it is closed and empty
+func takeAll(rb *reorderBuffer) []int64 {
+	var emitted []int64
+	for {
+		packets := rb.take(nil)
+		if len(packets) == 0 {
+			return emitted
+		}
+		for _, packet := range packets {
+			emitted = append(emitted, packet.PacketIdx)
+		}
+	}
+}
+
+func checkOrder(t *testing.T, emitted []int64, first, last int64) {
+	t.Helper()
+	if int64(len(emitted)) != last-first+1 {
+		t.Fatalf("emitted %d packets, expected %d", len(emitted), last-first+1)
+	}
+	for i, idx := range emitted {
+		if idx != first+int64(i) {
+			t.Fatalf("packet %d has PacketIdx %d, expected %d", i, idx, first+int64(i))
+		}
+	}
+}
+
+func TestReorderBufferSortsBatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		batches [][2]int64
+	}{
+		{"in order", [][2]int64{{1, 10}, {11, 20}, {21, 30}}},
+		{"reversed", [][2]int64{{21, 30}, {11, 20}, {1, 10}}},
+		{"across segments", [][2]int64{{reorderSegmentSize + 1, reorderSegmentSize + 10}, {1, reorderSegmentSize}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rb := newReorderBuffer(2*reorderSegmentSize, 1)
+			for _, batch := range test.batches {
+				rb.insert(makePackets(batch[0], batch[1]))
+			}
+			rb.close()
+			last := int64(0)
+			for _, batch := range test.batches {
+				if batch[1] > last {
+					last = batch[1]
+				}
+			}
+			checkOrder(t, takeAll(rb), 1, last)
+		})
+	}
+}
+
+func TestReorderBufferSkipsMissingPacketsAfterClose(t *testing.T) {
+	rb := newReorderBuffer(100, 1)
+	rb.insert(makePackets(1, 3))
+	rb.insert(makePackets(6, 8))
+	rb.close()
+	emitted := takeAll(rb)
+	expected := []int64{1, 2, 3, 6, 7, 8}
+	if len(emitted) != len(expected) {
+		t.Fatalf("emitted %v, expected %v", emitted, expected)
+	}
+	for i := range expected {
+		if emitted[i] != expected[i] {
+			t.Fatalf("emitted %v, expected %v", emitted, expected)
+		}
+	}
+}
+
+// TestReorderBufferWindowLargerThanCapacity feeds batches out of order, while far more packets are in flight than fit into
+// the buffer: a sequential reader hands batches to concurrent decoders through a large channel, like the chunked reader.
+// It must not deadlock.
+func TestReorderBufferWindowLargerThanCapacity(t *testing.T) {
+	const capacity = 1000
+	const batchSize = 100
+	const numBatches = 2000
+	const numDecoders = 8
+
+	rb := newReorderBuffer(capacity, 1)
+	batches := make(chan []flows.PacketInformation, 500) // 50000 packets in flight
+	done := make(chan []int64)
+	go func() {
+		done <- takeAll(rb)
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(numDecoders)
+	for i := 0; i < numDecoders; i++ {
+		go func(seed int64) {
+			random := rand.New(rand.NewSource(seed))
+			for batch := range batches {
+				rb.waitForWindow(batch[len(batch)-1].PacketIdx)
+				if random.Intn(4) == 0 {
+					time.Sleep(time.Duration(random.Intn(100)) * time.Microsecond)
+				}
+				rb.insert(batch)
+			}
+			wg.Done()
+		}(int64(i))
+	}
+	for i := int64(0); i < numBatches; i++ {
+		batches <- makePackets(i*batchSize+1, (i+1)*batchSize)
+	}
+	close(batches)
+
+	go func() {
+		wg.Wait()
+		rb.close()
+	}()
+	select {
+	case emitted := <-done:
+		checkOrder(t, emitted, 1, numBatches*batchSize)
+	case <-time.After(30 * time.Second):
+		t.Fatal("deadlock: the reorder buffer did not emit all packets")
+	}
+}
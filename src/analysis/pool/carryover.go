@@ -0,0 +1,62 @@
+package pool
+
+// This file contains everything needed to hand over open flows from one run to the next.
+// Used if traces are split into several files (e.g. one per day) which are analyzed in separate runs.
+
+import (
+	"fmt"
+	"github.com/dustin/go-humanize"
+	"test.com/scale/src/analysis/flows"
+)
+
+// Preload adds flows which are still open from a previous run to the pools.
+// Must be called before the first packet is added. The trace is continued, hence no flows are marked as flows.TruncatedStart
+// because of the initial timeout window.
+func (p *Pools) Preload(tcpFlows []*flows.TCPFlow, udpFlows []*flows.UDPFlow) {
+	p.started = true
+	for _, flow := range tcpFlows {
+		pool := p.pools[uint64(flow.FlowKey)%p.numFlowThreads]
+		pool.tcpFlowsLock.Lock()
+		pool.tcpFlows[flow.FlowKey] = flow
+		pool.tcpExpiry.schedule(flow.FlowKey, pool.deadline(&flow.Flow))
+		pool.tcpFlowsLock.Unlock()
+	}
+	for _, flow := range udpFlows {
+		pool := p.pools[uint64(flow.FlowKey)%p.numFlowThreads]
+		pool.udpFlowsLock.Lock()
+		pool.udpFlows[flow.FlowKey] = flow
+		pool.udpExpiry.schedule(flow.FlowKey, pool.deadline(&flow.Flow))
+		pool.udpFlowsLock.Unlock()
+	}
+	fmt.Println("Preloaded", humanize.Comma(int64(len(tcpFlows))), "TCP Flows and", humanize.Comma(int64(len(udpFlows))), "UDP Flows")
+}
+
+// CloseAndDetach is an alternative to Close. It adds all remaining packets to the pools and flushes all timed out flows.
+// In contrast to Close, the flows which are still open are not flushed, but removed from the pools and returned.
+// They can be passed to Preload of the next run to complete them.
+func (p *Pools) CloseAndDetach() (tcpFlows []*flows.TCPFlow, udpFlows []*flows.UDPFlow) {
+	for _, pool := range p.pools {
+		pool.close()
+	}
+	p.Flush(false)
+
+	for _, pool := range p.pools {
+		pool.tcpFlowsLock.Lock()
+		for key, flow := range pool.tcpFlows {
+			tcpFlows = append(tcpFlows, flow)
+			delete(pool.tcpFlows, key)
+		}
+		pool.tcpExpiry.reset()
+		pool.tcpFlowsLock.Unlock()
+
+		pool.udpFlowsLock.Lock()
+		for key, flow := range pool.udpFlows {
+			udpFlows = append(udpFlows, flow)
+			delete(pool.udpFlows, key)
+		}
+		pool.udpExpiry.reset()
+		pool.udpFlowsLock.Unlock()
+	}
+	fmt.Println("Detached", humanize.Comma(int64(len(tcpFlows))), "TCP Flows and", humanize.Comma(int64(len(udpFlows))), "UDP Flows")
+	return tcpFlows, udpFlows
+}
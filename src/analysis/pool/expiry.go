@@ -0,0 +1,97 @@
+package pool
+
+// This file contains the expiry lists of a pool, which avoid scanning all flows on every flush.
+// The flows are sorted into buckets by their timeout, or by the active timeout if it is earlier (see pool.deadline).
+// A flow is scheduled in one bucket at a time, entries of flows which were rescheduled or removed in the meantime become stale and are skipped.
+// If a packet extends the timeout of a flow, the flow is moved lazily: it is rescheduled when its old bucket expires.
+// If a packet shortens the timeout (FIN or RST), the flow is rescheduled immediately.
+
+import (
+	"math"
+	"test.com/scale/src/analysis/flows"
+	"time"
+)
+
+// expiryBucketDuration is the time covered by a bucket. A flush only visits buckets which ended,
+// hence a timed out flow may stay in the pool for up to one more bucket until the next flush.
+const expiryBucketDuration = int64(time.Second)
+
+type expiryLists struct {
+	buckets   map[int64][]flows.FlowKeyType
+	scheduled map[flows.FlowKeyType]int64 // Bucket in which each flow is scheduled
+	next      int64                       // All buckets before next are empty
+}
+
+func newExpiryLists() *expiryLists {
+	e := &expiryLists{}
+	e.reset()
+	return e
+}
+
+// expiryBucket returns the bucket of a timestamp
+func expiryBucket(timestamp int64) int64 {
+	return timestamp / expiryBucketDuration
+}
+
+// schedule adds the flow to the bucket of its timeout. Must be called for new flows.
+func (e *expiryLists) schedule(key flows.FlowKeyType, timeout int64) {
+	bucket := expiryBucket(timeout)
+	e.scheduled[key] = bucket
+	e.buckets[bucket] = append(e.buckets[bucket], key)
+	if bucket < e.next {
+		e.next = bucket
+	}
+}
+
+// update reschedules the flow if its timeout moved before its bucket. Must be called after a packet was added.
+func (e *expiryLists) update(key flows.FlowKeyType, timeout int64) {
+	if bucket, ok := e.scheduled[key]; !ok || expiryBucket(timeout) < bucket {
+		e.schedule(key, timeout)
+	}
+}
+
+// expire removes all buckets which ended before now and calls expired for the flows scheduled in them.
+// The flows are not necessarily timed out (or still in the pool): expired must check them and schedule
+// the flows which are still open again.
+func (e *expiryLists) expire(now int64, expired func(key flows.FlowKeyType)) {
+	end := expiryBucket(now)
+	if e.next >= end {
+		return
+	}
+	var buckets []int64
+	if end-e.next <= int64(len(e.buckets)) {
+		for bucket := e.next; bucket < end; bucket++ {
+			buckets = append(buckets, bucket)
+		}
+	} else {
+		// Few buckets spread over a long time (e.g. after a gap in the trace)
+		for bucket := range e.buckets {
+			if bucket < end {
+				buckets = append(buckets, bucket)
+			}
+		}
+	}
+	// Flows which are scheduled again have a timeout of at least now, hence they are added to the buckets from end onwards
+	e.next = end
+	for _, bucket := range buckets {
+		keys, ok := e.buckets[bucket]
+		if !ok {
+			continue
+		}
+		delete(e.buckets, bucket)
+		for _, key := range keys {
+			if scheduled, ok := e.scheduled[key]; !ok || scheduled != bucket {
+				continue // Stale entry, the flow was rescheduled
+			}
+			delete(e.scheduled, key)
+			expired(key)
+		}
+	}
+}
+
+// reset removes all entries, used after all flows were removed from the pool
+func (e *expiryLists) reset() {
+	e.buckets = make(map[int64][]flows.FlowKeyType)
+	e.scheduled = make(map[flows.FlowKeyType]int64)
+	e.next = math.MaxInt64
+}
@@ -0,0 +1,112 @@
+package pool
+
+import (
+	"sort"
+	"test.com/scale/src/analysis/flows"
+	"testing"
+)
+
+const second = expiryBucketDuration
+
+// expireKeys returns the sorted keys passed to expired
+func expireKeys(e *expiryLists, now int64) []flows.FlowKeyType {
+	var keys []flows.FlowKeyType
+	e.expire(now, func(key flows.FlowKeyType) {
+		keys = append(keys, key)
+	})
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+func equalKeys(a, b []flows.FlowKeyType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestExpiryLists(t *testing.T) {
+	type step struct {
+		schedule map[flows.FlowKeyType]int64 // Timeouts of new flows
+		update   map[flows.FlowKeyType]int64 // New timeouts of existing flows
+		reset    bool
+		now      int64
+		expired  []flows.FlowKeyType
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"only ended buckets expire", []step{
+			{schedule: map[flows.FlowKeyType]int64{1: 5 * second, 2: 10*second + 1, 3: 20 * second}, now: 10*second + 500, expired: []flows.FlowKeyType{1}},
+			{now: 11 * second, expired: []flows.FlowKeyType{2}},
+			{now: 11 * second, expired: nil},
+			{now: 30 * second, expired: []flows.FlowKeyType{3}},
+		}},
+		{"later timeout is moved lazily", []step{
+			{schedule: map[flows.FlowKeyType]int64{1: 5 * second}, update: map[flows.FlowKeyType]int64{1: 50 * second}, now: 6 * second, expired: []flows.FlowKeyType{1}},
+			{now: 60 * second, expired: nil},
+		}},
+		{"earlier timeout is moved immediately and the stale entry is skipped", []step{
+			{schedule: map[flows.FlowKeyType]int64{1: 50 * second}, update: map[flows.FlowKeyType]int64{1: 5 * second}, now: 6 * second, expired: []flows.FlowKeyType{1}},
+			{now: 60 * second, expired: nil},
+		}},
+		{"rescheduled flow replaces the previous entry", []step{
+			{schedule: map[flows.FlowKeyType]int64{1: 5 * second}, now: 0},
+			{schedule: map[flows.FlowKeyType]int64{1: 8 * second}, now: 7 * second, expired: nil},
+			{now: 9 * second, expired: []flows.FlowKeyType{1}},
+		}},
+		{"sparse buckets after a gap", []step{
+			{schedule: map[flows.FlowKeyType]int64{1: 5 * second, 2: 1000000 * second, 3: 3000000 * second}, now: 2000000 * second, expired: []flows.FlowKeyType{1, 2}},
+			{now: 4000000 * second, expired: []flows.FlowKeyType{3}},
+		}},
+		{"reset removes all flows", []step{
+			{schedule: map[flows.FlowKeyType]int64{1: 5 * second, 2: 6 * second}, reset: true, now: 10 * second, expired: nil},
+			{schedule: map[flows.FlowKeyType]int64{3: 12 * second}, now: 13 * second, expired: []flows.FlowKeyType{3}},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := newExpiryLists()
+			for i, s := range test.steps {
+				for key, timeout := range s.schedule {
+					e.schedule(key, timeout)
+				}
+				for key, timeout := range s.update {
+					e.update(key, timeout)
+				}
+				if s.reset {
+					e.reset()
+				}
+				if expired := expireKeys(e, s.now); !equalKeys(expired, s.expired) {
+					t.Fatalf("step %d: expired %v, expected %v", i, expired, s.expired)
+				}
+			}
+		})
+	}
+}
+
+func TestExpiryListsRescheduleWhileExpiring(t *testing.T) {
+	e := newExpiryLists()
+	e.schedule(1, 5*second)
+	calls := 0
+	e.expire(10*second, func(key flows.FlowKeyType) {
+		calls++
+		// The flow is still open, its timeout lies after now
+		e.schedule(key, 10*second)
+	})
+	if calls != 1 {
+		t.Fatalf("expired was called %d times, expected 1", calls)
+	}
+	if expired := expireKeys(e, 10*second+1); len(expired) != 0 {
+		t.Fatalf("expired %v before the bucket ended", expired)
+	}
+	if expired := expireKeys(e, 11*second); !equalKeys(expired, []flows.FlowKeyType{1}) {
+		t.Fatalf("expired %v, expected [1]", expired)
+	}
+}
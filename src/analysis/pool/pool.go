@@ -11,41 +11,45 @@ import (
 
 // Pool is a collection of Flows previously seen
 type pool struct {
-	addTCPPacketCache   packetInformationCache
-	addTCPPacketChannel chan [PacketInformationCacheSize]flows.PacketInformation
-	addUDPPacketCache   packetInformationCache
-	addUDPPacketChannel chan [PacketInformationCacheSize]flows.PacketInformation
+	addTCPPacketCache   []flows.PacketInformation
+	addTCPPacketChannel chan []flows.PacketInformation
+	addUDPPacketCache   []flows.PacketInformation
+	addUDPPacketChannel chan []flows.PacketInformation
 	tcpFlows            map[flows.FlowKeyType]*flows.TCPFlow // each flowthread has its own map to avoid concurrency
 	udpFlows            map[flows.FlowKeyType]*flows.UDPFlow // each flowthread has its own map to avoid concurrency
 	metrics             []metrics.Metric
 	currentTCPTime      int64
 	currentUDPTime      int64
 	wgAddPacket         sync.WaitGroup
-	tcpFlowsLock        sync.Mutex // Lock synchronizes with flushing
-	udpFlowsLock        sync.Mutex // Lock synchronizes with flushing
+	tcpFlowsLock        sync.Mutex   // Lock synchronizes with flushing
+	udpFlowsLock        sync.Mutex   // Lock synchronizes with flushing
+	tcpExpiry           *expiryLists // Protected by tcpFlowsLock
+	udpExpiry           *expiryLists // Protected by udpFlowsLock
 	tcpFilter           [65536]bool
 	udpFilter           [65536]bool
 	tcpDropIncomplete   bool
-}
-
-type packetInformationCache struct {
-	buf [PacketInformationCacheSize]flows.PacketInformation
-	pos int
+	timeouts            *flows.Timeouts
+	cacheSize           int
+	traceStart          int64 // Timestamp of the first packet of the trace, 0 if the trace is continued (see Pools.Preload)
 }
 
 // NewPool creates an empty pool of flows
-func newPool(tcpFilter, udpFilter *[65536]bool, tcpDropIncomplete bool) *pool {
-	p := pool{tcpFilter: *tcpFilter, udpFilter: *udpFilter, tcpDropIncomplete: tcpDropIncomplete}
+func newPool(tcpFilter, udpFilter *[65536]bool, tcpDropIncomplete bool, timeouts *flows.Timeouts, channelSize, cacheSize int) *pool {
+	p := pool{tcpFilter: *tcpFilter, udpFilter: *udpFilter, tcpDropIncomplete: tcpDropIncomplete, timeouts: timeouts, cacheSize: cacheSize}
+	p.addTCPPacketCache = make([]flows.PacketInformation, 0, cacheSize)
+	p.addUDPPacketCache = make([]flows.PacketInformation, 0, cacheSize)
+	p.tcpExpiry = newExpiryLists()
+	p.udpExpiry = newExpiryLists()
 
 	// Start goroutines to add packets
 	p.wgAddPacket.Add(1)
 	p.tcpFlows = make(map[flows.FlowKeyType]*flows.TCPFlow)
-	p.addTCPPacketChannel = make(chan [PacketInformationCacheSize]flows.PacketInformation, AddPacketChannelSize)
+	p.addTCPPacketChannel = make(chan []flows.PacketInformation, channelSize)
 	go p.addTCPPackets()
 
 	p.wgAddPacket.Add(1)
 	p.udpFlows = make(map[flows.FlowKeyType]*flows.UDPFlow)
-	p.addUDPPacketChannel = make(chan [PacketInformationCacheSize]flows.PacketInformation, AddPacketChannelSize)
+	p.addUDPPacketChannel = make(chan []flows.PacketInformation, channelSize)
 	go p.addUDPPackets()
 
 	return &p
@@ -54,121 +58,145 @@ func newPool(tcpFilter, udpFilter *[65536]bool, tcpDropIncomplete bool) *pool {
 // ClosePool adds all remaining packets to pool and then flushes all packets to the metrics.
 func (p *pool) close() {
 	// Write remaining packets from channels to flows
-	tmp := [PacketInformationCacheSize]flows.PacketInformation{}
-	copy(tmp[:p.addTCPPacketCache.pos], p.addTCPPacketCache.buf[:p.addTCPPacketCache.pos])
-	p.addTCPPacketChannel <- tmp
+	p.addTCPPacketChannel <- p.addTCPPacketCache
 	close(p.addTCPPacketChannel)
-	tmp = [PacketInformationCacheSize]flows.PacketInformation{}
-	copy(tmp[:p.addUDPPacketCache.pos], p.addUDPPacketCache.buf[:p.addUDPPacketCache.pos])
-	p.addUDPPacketChannel <- tmp
+	p.addUDPPacketChannel <- p.addUDPPacketCache
 	close(p.addUDPPacketChannel)
 
 	p.wgAddPacket.Wait()
 }
 
 func (p *pool) addTCPPacket(packet *flows.PacketInformation) {
-	p.addTCPPacketCache.buf[p.addTCPPacketCache.pos] = *packet
-	p.addTCPPacketCache.pos++
-	if p.addTCPPacketCache.pos == PacketInformationCacheSize {
-		p.addTCPPacketChannel <- p.addTCPPacketCache.buf
-		p.addTCPPacketCache.pos = 0
+	p.addTCPPacketCache = append(p.addTCPPacketCache, *packet)
+	if len(p.addTCPPacketCache) == p.cacheSize {
+		// The batch is handed over to the goroutine, hence a new one is required
+		p.addTCPPacketChannel <- p.addTCPPacketCache
+		p.addTCPPacketCache = make([]flows.PacketInformation, 0, p.cacheSize)
 	}
 }
 
 func (p *pool) addTCPPackets() {
-
 	for tcpPackets := range p.addTCPPacketChannel {
-		// to check why we wait: we wait bc channel is empty :(
-		/*if rand.Intn(10000) <= 1 {
-			fmt.Println(len(p.addTCPPacketChannel))
-		}*/
-		p.tcpFlowsLock.Lock()
-		for _, tcpPacket := range &tcpPackets {
-			if tcpPacket.PacketIdx == 0 {
-				continue
-			}
-			if !p.tcpFilter[tcpPacket.SrcPort] && !p.tcpFilter[tcpPacket.DstPort] {
-				continue // todo whats up with these filters?
+		p.addTCPBatch(tcpPackets)
+	}
+	p.wgAddPacket.Done()
+}
+
+// addTCPBatch adds a batch of TCP packets to their flows
+func (p *pool) addTCPBatch(tcpPackets []flows.PacketInformation) {
+	p.tcpFlowsLock.Lock()
+	for _, tcpPacket := range tcpPackets {
+		if !p.tcpFilter[tcpPacket.SrcPort] && !p.tcpFilter[tcpPacket.DstPort] {
+			continue // todo whats up with these filters?
+		}
+		p.currentTCPTime = tcpPacket.Timestamp
+		flow, flowExists := p.tcpFlows[tcpPacket.FlowKey]
+		// Check if connection is timedout or a new connection is establishing
+		if flowExists {
+			// Check if connection timed out. Exception: TCP RST is set, then it belongs to current flow (e.g. tearing down due to timeout)
+			if !tcpPacket.TCPRST && p.flushTCPFlow(flow, false, flows.TerminationUnknown) {
+				flowExists = false
+				delete(p.tcpFlows, flow.FlowKey) //these deletes are used at other usage of p.flushTCPFlow
 			}
-			p.currentTCPTime = tcpPacket.Timestamp
-			flow, flowExists := p.tcpFlows[tcpPacket.FlowKey]
-			// Check if connection is timedout or a new connection is establishing
-			if flowExists {
-				// Check if connection timed out. Exception: TCP RST is set, then it belongs to current flow (e.g. tearing down due to timeout)
-				if !tcpPacket.TCPRST && p.flushTCPFlow(flow, false) {
-					flowExists = false
-					delete(p.tcpFlows, flow.FlowKey) //these deletes are used at other usage of p.flushTCPFlow
-				}
-
-				// If new TCP Connection and Old Flow was terminated: Force flush
-				if flowExists && tcpPacket.TCPSYN && (flow.FirstFINIndex != -1 || flow.RSTIndex != -1) {
-					p.flushTCPFlow(flow, true)
-					flowExists = false
-					delete(p.tcpFlows, flow.FlowKey)
-				}
+
+			// If new TCP Connection and Old Flow was terminated: Force flush
+			if flowExists && tcpPacket.TCPSYN && (flow.FirstFINIndex != -1 || flow.RSTIndex != -1) {
+				p.flushTCPFlow(flow, true, flows.TerminationForced)
+				flowExists = false
+				delete(p.tcpFlows, flow.FlowKey)
 			}
-			// Create new flow
-			if !flowExists {
-				flow = flows.NewTCPFlow(tcpPacket)
-				p.tcpFlows[flow.FlowKey] = flow
-			} else {
-				// Add packet to existing flow
-				flow.AddPacket(tcpPacket)
+		}
+		// Flush an interim record before the packet, if the flow exceeds the active timeout
+		if flowExists {
+			p.flushActiveTCPFlow(flow)
+		}
+		// Create new flow
+		if !flowExists {
+			flow = flows.NewTCPFlow(tcpPacket, p.timeouts)
+			if !tcpPacket.TCPSYN {
+				flow.Truncated |= flows.TruncatedStart
 			}
+			p.tcpFlows[flow.FlowKey] = flow
+			p.tcpExpiry.schedule(flow.FlowKey, p.deadline(&flow.Flow))
+		} else {
+			// Add packet to existing flow
+			flow.AddPacket(tcpPacket, p.timeouts)
+			p.tcpExpiry.update(flow.FlowKey, p.deadline(&flow.Flow))
 		}
-		p.tcpFlowsLock.Unlock()
 	}
-	p.wgAddPacket.Done()
+	p.tcpFlowsLock.Unlock()
 }
 
 func (p *pool) addUDPPacket(packet *flows.PacketInformation) {
-	p.addUDPPacketCache.buf[p.addUDPPacketCache.pos] = *packet
-	p.addUDPPacketCache.pos++
-	if p.addUDPPacketCache.pos == PacketInformationCacheSize {
-		p.addUDPPacketChannel <- p.addUDPPacketCache.buf
-		p.addUDPPacketCache.pos = 0
+	p.addUDPPacketCache = append(p.addUDPPacketCache, *packet)
+	if len(p.addUDPPacketCache) == p.cacheSize {
+		// The batch is handed over to the goroutine, hence a new one is required
+		p.addUDPPacketChannel <- p.addUDPPacketCache
+		p.addUDPPacketCache = make([]flows.PacketInformation, 0, p.cacheSize)
 	}
 }
 
 func (p *pool) addUDPPackets() {
 	for udpPackets := range p.addUDPPacketChannel {
-		p.udpFlowsLock.Lock()
-		for _, udpPacket := range &udpPackets {
-			if udpPacket.PacketIdx == 0 {
-				continue
-			}
-			if !p.udpFilter[udpPacket.SrcPort] && !p.udpFilter[udpPacket.DstPort] {
-				continue
-			}
-			p.currentUDPTime = udpPacket.Timestamp
-			flow, flowExists := p.udpFlows[udpPacket.FlowKey]
-			// Check if connection is timedout
-			if flowExists && p.flushUDPFlow(flow, false) {
-				flowExists = false
-				delete(p.udpFlows, flow.FlowKey) // be gone flow
-			}
+		p.addUDPBatch(udpPackets)
+	}
+	p.wgAddPacket.Done()
+}
+
+// addUDPBatch adds a batch of UDP packets to their flows
+func (p *pool) addUDPBatch(udpPackets []flows.PacketInformation) {
+	p.udpFlowsLock.Lock()
+	for _, udpPacket := range udpPackets {
+		if !p.udpFilter[udpPacket.SrcPort] && !p.udpFilter[udpPacket.DstPort] {
+			continue
+		}
+		p.currentUDPTime = udpPacket.Timestamp
+		flow, flowExists := p.udpFlows[udpPacket.FlowKey]
+		// Check if connection is timedout
+		if flowExists && p.flushUDPFlow(flow, false, flows.TerminationUnknown) {
+			flowExists = false
+			delete(p.udpFlows, flow.FlowKey) // be gone flow
+		}
 
-			// Create new flow
-			if !flowExists {
-				flow = flows.NewUDPFlow(udpPacket)
-				p.udpFlows[flow.FlowKey] = flow
-			} else {
-				// Add packet to existing flow
-				flow.AddPacket(udpPacket)
+		// Flush an interim record before the packet, if the flow exceeds the active timeout
+		if flowExists {
+			p.flushActiveUDPFlow(flow)
+		}
+		// Create new flow
+		if !flowExists {
+			flow = flows.NewUDPFlow(udpPacket, p.timeouts)
+			// UDP flows starting within their idle timeout were probably already open before the trace
+			if p.traceStart != 0 && udpPacket.Timestamp-p.traceStart <= p.timeouts.IdleTimeout(&flow.Flow) {
+				flow.Truncated |= flows.TruncatedStart
 			}
+			p.udpFlows[flow.FlowKey] = flow
+			p.udpExpiry.schedule(flow.FlowKey, p.deadline(&flow.Flow))
+		} else {
+			// Add packet to existing flow
+			flow.AddPacket(udpPacket, p.timeouts)
+			p.udpExpiry.update(flow.FlowKey, p.deadline(&flow.Flow))
 		}
-		p.udpFlowsLock.Unlock()
 	}
-	p.wgAddPacket.Done()
+	p.udpFlowsLock.Unlock()
 }
 
 // flushTCPFlow flushes a TCP connection if has timed out, or force=true. Returns whether connection can be removed.
-func (p *pool) flushTCPFlow(flow *flows.TCPFlow, force bool) bool {
+// forceReason is the termination reason of a forced flush, flows which have timed out are terminated by their TimeoutReason.
+func (p *pool) flushTCPFlow(flow *flows.TCPFlow, force bool, forceReason flows.TerminationReason) bool {
 	// Needs Flush
-	if force || p.currentTCPTime > flow.Flow.Timeout {
+	timedOut := p.currentTCPTime > flow.Flow.Timeout
+	if force || timedOut {
+		flow.TerminationReason = forceReason
+		if timedOut {
+			flow.TerminationReason = flow.TimeoutReason()
+		}
+		if flow.TerminationReason == flows.TerminationShutdown {
+			flow.Truncated |= flows.TruncatedEnd
+		}
 		// Ignore filtered ports
 		// Ignore incomplete flows (only SYN must be set)
-		if !p.tcpFilter[flow.ServerPort] || (p.tcpDropIncomplete && (!flow.TCPPacket[0].SYN || flow.TCPPacket[0].ACK)) {
+		// Ignore flows without packets since their last interim record (see flushActiveTCPFlow)
+		if p.tcpFiltered(flow) || len(flow.Packets) == 0 {
 			return true
 		}
 
@@ -181,12 +209,73 @@ func (p *pool) flushTCPFlow(flow *flows.TCPFlow, force bool) bool {
 	return false
 }
 
+// tcpFiltered returns whether the flow is not passed to the metrics, because the port is filtered
+// or the flow is incomplete (the first packet is no SYN) and incomplete flows are dropped
+func (p *pool) tcpFiltered(flow *flows.TCPFlow) bool {
+	return !p.tcpFilter[flow.ServerPort] || (p.tcpDropIncomplete && flow.TCPFlags.FlowFirst&(flows.TCPFlagSYN|flows.TCPFlagACK) != flows.TCPFlagSYN)
+}
+
+// flushActiveTCPFlow flushes an interim record of a TCP connection whose first packet since the last record
+// is older than the active timeout. The packets of the record are removed from the flow afterwards.
+// It is called before a packet is added and by the flush for flows without new packets (see deadline).
+// Flows without packets since the last record are not flushed.
+func (p *pool) flushActiveTCPFlow(flow *flows.TCPFlow) {
+	if p.timeouts.Active <= 0 || len(flow.Packets) == 0 || p.currentTCPTime-flow.Packets[0].Timestamp < p.timeouts.Active {
+		return
+	}
+	flow.TerminationReason = flows.TerminationActive
+	if !p.tcpFiltered(flow) {
+		for _, metric := range p.metrics {
+			metric.OnTCPFlush(flow)
+		}
+	}
+	flow.NextFragment()
+}
+
+// flushActiveUDPFlow flushes an interim record of a UDP connection whose first packet since the last record
+// is older than the active timeout. The packets of the record are removed from the flow afterwards.
+// It is called before a packet is added and by the flush for flows without new packets (see deadline).
+// Flows without packets since the last record are not flushed.
+func (p *pool) flushActiveUDPFlow(flow *flows.UDPFlow) {
+	if p.timeouts.Active <= 0 || len(flow.Packets) == 0 || p.currentUDPTime-flow.Packets[0].Timestamp < p.timeouts.Active {
+		return
+	}
+	flow.TerminationReason = flows.TerminationActive
+	if p.udpFilter[flow.ServerPort] {
+		for _, metric := range p.metrics {
+			metric.OnUDPFlush(flow)
+		}
+	}
+	flow.NextFragment()
+}
+
+// deadline returns when the flow has to be visited by the flush: when it times out or,
+// if it is earlier, when it exceeds the active timeout (see flushActiveTCPFlow)
+func (p *pool) deadline(flow *flows.Flow) int64 {
+	if p.timeouts.Active > 0 && len(flow.Packets) > 0 {
+		if active := flow.Packets[0].Timestamp + p.timeouts.Active; active < flow.Timeout {
+			return active
+		}
+	}
+	return flow.Timeout
+}
+
 // flushUDPFlow flushes a UDP connection if has timed out, or force=true. Returns whether connection has been flushed.
-func (p *pool) flushUDPFlow(flow *flows.UDPFlow, force bool) bool {
+// forceReason is the termination reason of a forced flush, flows which have timed out are terminated by TerminationIdle.
+func (p *pool) flushUDPFlow(flow *flows.UDPFlow, force bool, forceReason flows.TerminationReason) bool {
 	// Needs Flush
-	if force || p.currentUDPTime > flow.Flow.Timeout {
+	timedOut := p.currentUDPTime > flow.Flow.Timeout
+	if force || timedOut {
+		flow.TerminationReason = forceReason
+		if timedOut {
+			flow.TerminationReason = flows.TerminationIdle
+		}
+		if flow.TerminationReason == flows.TerminationShutdown {
+			flow.Truncated |= flows.TruncatedEnd
+		}
 		// Ignore filtered ports
-		if !p.udpFilter[flow.ServerPort] {
+		// Ignore flows without packets since their last interim record (see flushActiveUDPFlow)
+		if !p.udpFilter[flow.ServerPort] || len(flow.Packets) == 0 {
 			return true
 		}
 
@@ -199,7 +288,7 @@ func (p *pool) flushUDPFlow(flow *flows.UDPFlow, force bool) bool {
 	return false
 }
 
-// Flush will flush all closed connections
+// Flush will flush all closed connections. If force is set, the open connections are flushed as well (TerminationShutdown, flows.TruncatedEnd).
 func (p *pool) flush(force bool, wgFlush *sync.WaitGroup, tcpFlushed, tcpCount, udpFlushed, udpCount *int64, counterLock *sync.Mutex) {
 	// Start concurrent threads which can check if Flows needs flushing concurrently
 	wgFlush.Add(1)
@@ -209,15 +298,16 @@ func (p *pool) flush(force bool, wgFlush *sync.WaitGroup, tcpFlushed, tcpCount,
 		*tcpCount += int64(len(p.tcpFlows))
 		counterLock.Unlock()
 		var flushed int64
-		//len_flows := len(p.tcpFlows)
-		//fmt.Println("trying to flush tcp flows: ", len_flows)
-		for _, flow := range p.tcpFlows {
-			if p.flushTCPFlow(flow, force) {
+		if force {
+			for _, flow := range p.tcpFlows {
+				p.flushTCPFlow(flow, true, flows.TerminationShutdown)
 				delete(p.tcpFlows, flow.FlowKey)
 				flushed++
 			}
+			p.tcpExpiry.reset()
+		} else {
+			flushed = p.flushExpiredTCPFlows()
 		}
-		//fmt.Println("flushed % of tcp flows: ", float64(flushed)/float64(len_flows))
 		p.tcpFlowsLock.Unlock()
 		counterLock.Lock()
 		*tcpFlushed += flushed
@@ -232,11 +322,15 @@ func (p *pool) flush(force bool, wgFlush *sync.WaitGroup, tcpFlushed, tcpCount,
 		*udpCount += int64(len(p.udpFlows))
 		counterLock.Unlock()
 		var flushed int64
-		for _, flow := range p.udpFlows {
-			if p.flushUDPFlow(flow, force) {
+		if force {
+			for _, flow := range p.udpFlows {
+				p.flushUDPFlow(flow, true, flows.TerminationShutdown)
 				delete(p.udpFlows, flow.FlowKey)
 				flushed++
 			}
+			p.udpExpiry.reset()
+		} else {
+			flushed = p.flushExpiredUDPFlows()
 		}
 		p.udpFlowsLock.Unlock()
 		counterLock.Lock()
@@ -246,6 +340,46 @@ func (p *pool) flush(force bool, wgFlush *sync.WaitGroup, tcpFlushed, tcpCount,
 	}(force, wgFlush)
 }
 
+// flushExpiredTCPFlows flushes the TCP flows which timed out and the interim records of the active timeout. Only the flows of the expired buckets of the expiry lists are visited.
+// Must be called with tcpFlowsLock held. Returns the number of flushed flows.
+func (p *pool) flushExpiredTCPFlows() (flushed int64) {
+	p.tcpExpiry.expire(p.currentTCPTime, func(key flows.FlowKeyType) {
+		flow, ok := p.tcpFlows[key]
+		if !ok {
+			return // The flow was already removed
+		}
+		if p.flushTCPFlow(flow, false, flows.TerminationUnknown) {
+			delete(p.tcpFlows, key)
+			flushed++
+		} else {
+			// Flows which are open for longer than the active timeout are flushed, even if no packets arrive
+			p.flushActiveTCPFlow(flow)
+			p.tcpExpiry.schedule(flow.FlowKey, p.deadline(&flow.Flow))
+		}
+	})
+	return flushed
+}
+
+// flushExpiredUDPFlows flushes the UDP flows which timed out and the interim records of the active timeout. Only the flows of the expired buckets of the expiry lists are visited.
+// Must be called with udpFlowsLock held. Returns the number of flushed flows.
+func (p *pool) flushExpiredUDPFlows() (flushed int64) {
+	p.udpExpiry.expire(p.currentUDPTime, func(key flows.FlowKeyType) {
+		flow, ok := p.udpFlows[key]
+		if !ok {
+			return // The flow was already removed
+		}
+		if p.flushUDPFlow(flow, false, flows.TerminationUnknown) {
+			delete(p.udpFlows, key)
+			flushed++
+		} else {
+			// Flows which are open for longer than the active timeout are flushed, even if no packets arrive
+			p.flushActiveUDPFlow(flow)
+			p.udpExpiry.schedule(flow.FlowKey, p.deadline(&flow.Flow))
+		}
+	})
+	return flushed
+}
+
 // registerMetric registers a Metric which shall be called on flush
 func (p *pool) registerMetric(metric metrics.Metric) {
 	p.metrics = append(p.metrics, metric)
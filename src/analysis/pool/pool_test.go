@@ -0,0 +1,221 @@
+package pool
+
+import (
+	"sort"
+	"sync"
+	"test.com/scale/src/analysis/flows"
+	"testing"
+)
+
+// recordingMetric records the keys, termination reasons and truncation of the flushed flows
+type recordingMetric struct {
+	tcp       map[flows.FlowKeyType][]flows.TerminationReason
+	udp       map[flows.FlowKeyType][]flows.TerminationReason
+	truncated map[flows.FlowKeyType]flows.Truncation // Of the last record of the flow
+}
+
+func newRecordingMetric() *recordingMetric {
+	return &recordingMetric{
+		tcp:       make(map[flows.FlowKeyType][]flows.TerminationReason),
+		udp:       make(map[flows.FlowKeyType][]flows.TerminationReason),
+		truncated: make(map[flows.FlowKeyType]flows.Truncation),
+	}
+}
+
+func (m *recordingMetric) OnTCPFlush(flow *flows.TCPFlow) {
+	m.tcp[flow.FlowKey] = append(m.tcp[flow.FlowKey], flow.TerminationReason)
+	m.truncated[flow.FlowKey] = flow.Truncated
+}
+
+func (m *recordingMetric) OnUDPFlush(flow *flows.UDPFlow) {
+	m.udp[flow.FlowKey] = append(m.udp[flow.FlowKey], flow.TerminationReason)
+	m.truncated[flow.FlowKey] = flow.Truncated
+}
+
+func newTestPool(timeouts flows.Timeouts) (*pool, *recordingMetric) {
+	var filter [65536]bool
+	for i := range filter {
+		filter[i] = true
+	}
+	p := newPool(&filter, &filter, false, &timeouts, 10, 1)
+	metric := newRecordingMetric()
+	p.registerMetric(metric)
+	return p, metric
+}
+
+func tcpPacket(key flows.FlowKeyType, timestamp int64, syn, fin bool) flows.PacketInformation {
+	return flows.PacketInformation{FlowKey: key, SrcIP: 1, DstIP: 2, SrcPort: 40000, DstPort: 80, Timestamp: timestamp, HasTCP: true, TCPSYN: syn, TCPFIN: fin}
+}
+
+func udpPacket(key flows.FlowKeyType, timestamp int64) flows.PacketInformation {
+	return flows.PacketInformation{FlowKey: key, SrcIP: 1, DstIP: 2, SrcPort: 50000, DstPort: 53, Timestamp: timestamp, HasUDP: true}
+}
+
+// forceFlush flushes all flows of the pool, like at the end of the analysis
+func forceFlush(p *pool) {
+	var wg sync.WaitGroup
+	var counterLock sync.Mutex
+	var tcpFlushed, tcpCount, udpFlushed, udpCount int64
+	p.flush(true, &wg, &tcpFlushed, &tcpCount, &udpFlushed, &udpCount, &counterLock)
+	wg.Wait()
+}
+
+func flushedKeys(flushed map[flows.FlowKeyType][]flows.TerminationReason) []flows.FlowKeyType {
+	var keys []flows.FlowKeyType
+	for key := range flushed {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+func TestFlushExpiredTCPFlows(t *testing.T) {
+	p, metric := newTestPool(flows.Timeouts{TCP: 10 * second, TCPFin: 2 * second, TCPRst: 1 * second, UDP: 10 * second})
+	p.addTCPBatch([]flows.PacketInformation{
+		tcpPacket(1, 0, true, false),
+		tcpPacket(2, 0, true, false),
+		tcpPacket(3, 0, true, false),
+		tcpPacket(2, 8*second, false, false), // Extends the timeout, the entry in the first bucket becomes stale
+		tcpPacket(3, 1*second, false, true),  // FIN shortens the timeout, the entry in the later bucket becomes stale
+		tcpPacket(4, 12*second, true, false), // Only advances the time
+	})
+
+	p.tcpFlowsLock.Lock()
+	flushed := p.flushExpiredTCPFlows()
+	p.tcpFlowsLock.Unlock()
+	if keys := flushedKeys(metric.tcp); flushed != 2 || !equalKeys(keys, []flows.FlowKeyType{1, 3}) {
+		t.Fatalf("flushed %d flows %v, expected [1 3]", flushed, keys)
+	}
+	if metric.tcp[1][0] != flows.TerminationIdle || metric.tcp[3][0] != flows.TerminationFIN {
+		t.Fatalf("termination reasons are %v and %v, expected idle and fin", metric.tcp[1], metric.tcp[3])
+	}
+	if _, ok := p.tcpFlows[2]; !ok {
+		t.Fatal("flow 2 was removed although its timeout was extended")
+	}
+
+	p.addTCPBatch([]flows.PacketInformation{tcpPacket(4, 20*second, false, false)})
+	p.tcpFlowsLock.Lock()
+	flushed = p.flushExpiredTCPFlows()
+	p.tcpFlowsLock.Unlock()
+	if flushed != 1 || len(metric.tcp[2]) != 1 || metric.tcp[2][0] != flows.TerminationIdle {
+		t.Fatalf("flushed %d flows, expected flow 2 once: %v", flushed, metric.tcp)
+	}
+	if len(p.tcpFlows) != 1 {
+		t.Fatalf("%d flows are left, expected 1", len(p.tcpFlows))
+	}
+}
+
+func TestFlushExpiredFlowsActiveTimeout(t *testing.T) {
+	p, metric := newTestPool(flows.Timeouts{TCP: 100 * second, TCPFin: 2 * second, TCPRst: 1 * second, UDP: 100 * second, Active: 10 * second})
+	p.addTCPBatch([]flows.PacketInformation{
+		tcpPacket(1, 0, true, false),
+		tcpPacket(1, 1*second, false, false),
+		tcpPacket(2, 12*second, true, false), // Only advances the time, flow 1 is quiet
+	})
+
+	// The quiet flow exceeds the active timeout without a new packet
+	p.tcpFlowsLock.Lock()
+	flushed := p.flushExpiredTCPFlows()
+	p.tcpFlowsLock.Unlock()
+	if flushed != 0 || len(metric.tcp[1]) != 1 || metric.tcp[1][0] != flows.TerminationActive {
+		t.Fatalf("flushed %d flows, expected an interim record of flow 1: %v", flushed, metric.tcp)
+	}
+	flow := p.tcpFlows[1]
+	if flow.Fragment != 1 || len(flow.Packets) != 0 || flow.TCPFlags.All != 0 || flow.TCPFlags.FlowFirst != flows.TCPFlagSYN {
+		t.Fatalf("fragment %d with %d packets and flags %+v after the interim record", flow.Fragment, len(flow.Packets), flow.TCPFlags)
+	}
+
+	// The next fragment covers only its own packets
+	p.addTCPBatch([]flows.PacketInformation{tcpPacket(1, 13*second, false, true)})
+	if flow.TCPFlags.First != flows.TCPFlagFIN || flow.TCPFlags.All != flows.TCPFlagFIN {
+		t.Fatalf("flags of the second fragment are %+v, expected FIN only", flow.TCPFlags)
+	}
+	p.addTCPBatch([]flows.PacketInformation{tcpPacket(2, 20*second, false, false)})
+	p.tcpFlowsLock.Lock()
+	p.flushExpiredTCPFlows()
+	p.tcpFlowsLock.Unlock()
+	if reasons := metric.tcp[1]; len(reasons) != 2 || reasons[1] != flows.TerminationFIN {
+		t.Fatalf("termination reasons of flow 1 are %v, expected active and fin", reasons)
+	}
+}
+
+func TestFlushExpiredFlowsWithoutPacketsAfterInterimRecord(t *testing.T) {
+	p, metric := newTestPool(flows.Timeouts{TCP: 15 * second, TCPFin: 2 * second, TCPRst: 1 * second, UDP: 15 * second, Active: 10 * second})
+	p.addTCPBatch([]flows.PacketInformation{
+		tcpPacket(1, 0, true, false),
+		tcpPacket(2, 11*second, true, false),
+	})
+	p.tcpFlowsLock.Lock()
+	p.flushExpiredTCPFlows()
+	p.tcpFlowsLock.Unlock()
+
+	// Flow 1 idles out without packets since its interim record, it is removed without another record
+	p.addTCPBatch([]flows.PacketInformation{tcpPacket(2, 20*second, false, false)})
+	p.tcpFlowsLock.Lock()
+	flushed := p.flushExpiredTCPFlows()
+	p.tcpFlowsLock.Unlock()
+	if _, ok := p.tcpFlows[1]; ok || flushed != 1 {
+		t.Fatalf("flow 1 was not removed (flushed %d)", flushed)
+	}
+	if reasons := metric.tcp[1]; len(reasons) != 1 || reasons[0] != flows.TerminationActive {
+		t.Fatalf("termination reasons of flow 1 are %v, expected only active", reasons)
+	}
+}
+
+func TestTruncation(t *testing.T) {
+	timeouts := flows.Timeouts{TCP: 10 * second, TCPFin: 2 * second, TCPRst: 1 * second, UDP: 10 * second}
+	tests := []struct {
+		name       string
+		traceStart int64
+		tcp        []flows.PacketInformation
+		udp        []flows.PacketInformation
+		expected   map[flows.FlowKeyType]flows.Truncation
+	}{
+		{"tcp starting with and without SYN", 100 * second,
+			[]flows.PacketInformation{tcpPacket(1, 100*second, true, false), tcpPacket(2, 100*second, false, false),
+				tcpPacket(1, 101*second, false, true), tcpPacket(2, 101*second, false, true)}, nil,
+			map[flows.FlowKeyType]flows.Truncation{1: 0, 2: flows.TruncatedStart}},
+		{"udp within and after the idle timeout of the trace start", 100 * second, nil,
+			[]flows.PacketInformation{udpPacket(1, 100*second), udpPacket(2, 110*second), udpPacket(3, 111*second), udpPacket(4, 200*second)},
+			map[flows.FlowKeyType]flows.Truncation{1: flows.TruncatedStart, 2: flows.TruncatedStart, 3: 0, 4: 0}},
+		{"udp of a continued trace", 0, nil,
+			[]flows.PacketInformation{udpPacket(1, 100*second), udpPacket(2, 200*second)},
+			map[flows.FlowKeyType]flows.Truncation{1: 0, 2: 0}},
+		{"open flows at the end", 100 * second,
+			[]flows.PacketInformation{tcpPacket(1, 100*second, false, false), tcpPacket(2, 150*second, true, false), tcpPacket(3, 995*second, false, false)},
+			[]flows.PacketInformation{udpPacket(4, 150*second), udpPacket(5, 995*second)},
+			map[flows.FlowKeyType]flows.Truncation{1: flows.TruncatedStart, 2: 0, 3: flows.TruncatedStart | flows.TruncatedEnd, 4: 0, 5: flows.TruncatedEnd}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, metric := newTestPool(timeouts)
+			p.traceStart = test.traceStart
+			// The last packets advance the time, they belong to flows which are still open at the end
+			p.addTCPBatch(append(test.tcp, tcpPacket(98, 1000*second, true, false)))
+			p.addUDPBatch(append(test.udp, udpPacket(99, 1000*second)))
+			test.expected[98] = flows.TruncatedEnd
+			test.expected[99] = flows.TruncatedEnd
+			// Flows which timed out before the end are flushed by the expiry walk, the others at the end
+			p.tcpFlowsLock.Lock()
+			p.flushExpiredTCPFlows()
+			p.tcpFlowsLock.Unlock()
+			p.udpFlowsLock.Lock()
+			p.flushExpiredUDPFlows()
+			p.udpFlowsLock.Unlock()
+			forceFlush(p)
+
+			for key, expected := range test.expected {
+				truncated, ok := metric.truncated[key]
+				if !ok {
+					t.Fatalf("flow %d was not flushed", key)
+				}
+				if truncated != expected {
+					t.Errorf("flow %d is truncated %v, expected %v", key, truncated, expected)
+				}
+			}
+			if len(metric.truncated) != len(test.expected) {
+				t.Fatalf("flushed %d flows, expected %d", len(metric.truncated), len(test.expected))
+			}
+		})
+	}
+}
@@ -10,22 +10,25 @@ import (
 	"test.com/scale/src/analysis/metrics"
 )
 
-// NumFlowThreads defines the number of Threads (x2 (TCP & UDP)) which are responsible to add packets
-const NumFlowThreads = 14
+// DefaultAddPacketChannelSize is the default number of batches which can wait in the addPacket Channels
+const DefaultAddPacketChannelSize = 300
 
-// AddPacketChannelSize defines the size of the channel
-const AddPacketChannelSize = 300
-
-// PacketInformationCacheSize is the batching size of the packets sent to the addPacket Channels
-const PacketInformationCacheSize = 128
+// DefaultPacketInformationCacheSize is the default batching size of the packets sent to the addPacket Channels
+const DefaultPacketInformationCacheSize = 128
 
 type Pools struct {
-	pools []*pool
+	pools          []*pool
+	numFlowThreads uint64
+	started        bool // Whether the first packet was added or flows were preloaded
 }
 
 // Create new pools
-func NewPools(tcpFilter, udpFilter []uint16, tcpDropIncomplete bool) *Pools {
-	p := &Pools{}
+// timeouts defines when flows are timed out. They are copied, hence each Pools can use different timeouts.
+// numFlowThreads defines the number of pools. Each pool has two goroutines (TCP & UDP) which are responsible to add packets.
+// addPacketChannelSize defines the size of the addPacket Channels, packetInformationCacheSize the batching size of the packets sent to them.
+func NewPools(tcpFilter, udpFilter []uint16, tcpDropIncomplete bool, timeouts flows.Timeouts,
+	numFlowThreads, addPacketChannelSize, packetInformationCacheSize int) *Pools {
+	p := &Pools{numFlowThreads: uint64(numFlowThreads)}
 	var tcpFilterList [65536]bool
 	for _, i := range tcpFilter {
 		tcpFilterList[i] = true
@@ -34,16 +37,16 @@ func NewPools(tcpFilter, udpFilter []uint16, tcpDropIncomplete bool) *Pools {
 	for _, i := range udpFilter {
 		udpFilterList[i] = true
 	}
-	p.pools = make([]*pool, NumFlowThreads)
-	for i := 0; i < NumFlowThreads; i++ {
-		p.pools[i] = newPool(&tcpFilterList, &udpFilterList, tcpDropIncomplete)
+	p.pools = make([]*pool, numFlowThreads)
+	for i := 0; i < numFlowThreads; i++ {
+		p.pools[i] = newPool(&tcpFilterList, &udpFilterList, tcpDropIncomplete, &timeouts, addPacketChannelSize, packetInformationCacheSize)
 	}
 	return p
 }
 
 // Returns the number of flow threads
 func (p Pools) GetNumFlowThreads() int {
-	return NumFlowThreads
+	return int(p.numFlowThreads)
 }
 
 // RegisterMetric registers a Metric which shall be called on flush
@@ -53,15 +56,30 @@ func (p *Pools) RegisterMetric(metric metrics.Metric) {
 	}
 }
 
+// start sets the start of the trace, which starts the initial timeout window of the pools (see flows.TruncatedStart).
+// Must be called before the first packet is handed over to the pools.
+func (p *Pools) start(timestamp int64) {
+	p.started = true
+	for _, pool := range p.pools {
+		pool.traceStart = timestamp
+	}
+}
+
 // Add a TCP Packet to the pools
 func (p *Pools) AddTCPPacket(packet *flows.PacketInformation) {
-	poolIndex := uint64(packet.FlowKey) % NumFlowThreads
+	if !p.started {
+		p.start(packet.Timestamp)
+	}
+	poolIndex := uint64(packet.FlowKey) % p.numFlowThreads
 	p.pools[poolIndex].addTCPPacket(packet)
 }
 
 // Add a UDP Packet to the pools
 func (p *Pools) AddUDPPacket(packet *flows.PacketInformation) {
-	poolIndex := uint64(packet.FlowKey) % NumFlowThreads
+	if !p.started {
+		p.start(packet.Timestamp)
+	}
+	poolIndex := uint64(packet.FlowKey) % p.numFlowThreads
 	p.pools[poolIndex].addUDPPacket(packet)
 }
 
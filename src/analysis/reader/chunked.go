@@ -0,0 +1,211 @@
+package reader
+
+// This file contains a reader for uncompressed pcap files, which distributes the copying of packets over multiple goroutines.
+// The file is read in large blocks. Only the record boundaries are identified sequentially,
+// the records themselves are handed in chunks to multiple decoder goroutines.
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"test.com/scale/src/analysis/parser"
+	"test.com/scale/src/analysis/utils"
+)
+
+// chunkedBlockSize is the number of bytes read from the file at once
+const chunkedBlockSize = 64 * 1024 * 1024
+
+// chunkedRecordsPerChunk is the number of records handed to a decoder at once
+const chunkedRecordsPerChunk = 8192
+
+const pcapGlobalHeaderSize = 24
+const pcapRecordHeaderSize = 16
+
+// pcapBlock is a block of the file. It is reused as soon as all of its chunks are decoded.
+type pcapBlock struct {
+	buf     []byte
+	pending int32 // Number of chunks (plus the scanner itself) which still use the block
+	free    chan *pcapBlock
+}
+
+func (b *pcapBlock) release() {
+	if atomic.AddInt32(&b.pending, -1) == 0 {
+		b.free <- b
+	}
+}
+
+type pcapRecord struct {
+	offset    int
+	length    int
+	timestamp int64
+}
+
+// pcapChunk contains consecutive records of a block. The first record has the PacketIdx firstPacketIdx.
+type pcapChunk struct {
+	block          *pcapBlock
+	records        []pcapRecord
+	firstPacketIdx int64
+}
+
+// CanReadChunked returns whether the file can be read by ReadPcapFileChunked.
+// This is only the case for uncompressed pcap files.
+func CanReadChunked(filename string) bool {
+	return !strings.Contains(filename, ".pcapng") && !utils.IsZipFile(filename)
+}
+
+// ReadPcapFileChunked reads an uncompressed pcap file with numDecoders goroutines.
+// It is an alternative to Read (with ReadPcapFile) and behaves in the same way:
+// The packets get the same, globally consistent PacketIdx and the pools are flushed in the same intervals.
+// Only the order in which packets are handed to the parser differs, which is restored by the reorder buffer of the parser.
+// Reading is also stopped if ctx is cancelled, the caller has to check ctx.Err().
+//
+// Returns whether the specified number of packets have been read.
+// If an error occurs, the packets read before are still handed to the parser.
+func (p *PacketReader) ReadPcapFileChunked(ctx context.Context, filename string, packetStop, flushRate int64, numDecoders int) (bool, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	header := make([]byte, pcapGlobalHeaderSize)
+	if _, err = io.ReadFull(file, header); err != nil {
+		return false, fmt.Errorf("could not read pcap header of %s: %v", filename, err)
+	}
+	byteOrder, timestampScale, err := parsePcapHeader(header)
+	if err != nil {
+		return false, fmt.Errorf("could not read pcap header of %s: %v", filename, err)
+	}
+
+	// The number of blocks limits the memory footprint and slows down reading, if the decoders are too slow
+	freeBlocks := make(chan *pcapBlock, numDecoders+2)
+	for i := 0; i < cap(freeBlocks); i++ {
+		freeBlocks <- &pcapBlock{buf: make([]byte, chunkedBlockSize), free: freeBlocks}
+	}
+
+	var wgDecoder sync.WaitGroup
+	chunks := make(chan pcapChunk, numDecoders*2)
+	wgDecoder.Add(numDecoders)
+	for i := 0; i < numDecoders; i++ {
+		go p.decodeChunks(chunks, &wgDecoder)
+	}
+
+	p.spikeCount = 0
+	packetStopReached := false
+	var readErr error
+	var leftoverData []byte
+	var leftoverBlock *pcapBlock
+	for {
+		block := <-freeBlocks
+		atomic.StoreInt32(&block.pending, 1)
+		leftover := copy(block.buf, leftoverData)
+		if leftoverBlock != nil {
+			leftoverBlock.release()
+		}
+		n, err := io.ReadFull(file, block.buf[leftover:])
+		lastBlock := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !lastBlock {
+			block.release()
+			readErr = fmt.Errorf("error while reading %s: %v", filename, err)
+			break
+		}
+		data := block.buf[:leftover+n]
+
+		// Identify record boundaries
+		chunk := pcapChunk{block: block, firstPacketIdx: p.PacketIdx + 1}
+		offset := 0
+		for offset+pcapRecordHeaderSize <= len(data) {
+			inclLen := int(byteOrder.Uint32(data[offset+8 : offset+12]))
+			if inclLen > chunkedBlockSize-pcapRecordHeaderSize {
+				readErr = fmt.Errorf("record in %s is larger than the block size: %d", filename, inclLen)
+				break
+			}
+			if offset+pcapRecordHeaderSize+inclLen > len(data) {
+				break
+			}
+			seconds := int64(byteOrder.Uint32(data[offset : offset+4]))
+			fraction := int64(byteOrder.Uint32(data[offset+4 : offset+8]))
+			timestamp := seconds*1e9 + fraction*timestampScale
+			recordOffset := offset + pcapRecordHeaderSize
+			offset = recordOffset + inclLen
+
+			if p.PacketIdx == 0 {
+				p.FirstPacketTimestamp = timestamp
+				p.flushTimestamp = p.FirstPacketTimestamp + flushRate
+			}
+			//sometimes packets with len 0 come thorugh although no error is thrown? these have weird timestamps
+			if inclLen == 0 {
+				continue
+			}
+			p.PacketIdx++
+			p.LastPacketTimestamp = timestamp
+			chunk.records = append(chunk.records, pcapRecord{offset: recordOffset, length: inclLen, timestamp: timestamp})
+			if len(chunk.records) == chunkedRecordsPerChunk {
+				atomic.AddInt32(&block.pending, 1)
+				chunks <- chunk
+				chunk = pcapChunk{block: block, firstPacketIdx: p.PacketIdx + 1}
+			}
+
+			p.flushIfNeeded(flushRate)
+			if p.PacketIdx >= packetStop {
+				packetStopReached = true
+				break
+			}
+		}
+		if len(chunk.records) > 0 {
+			atomic.AddInt32(&block.pending, 1)
+			chunks <- chunk
+		}
+
+		if lastBlock || packetStopReached || readErr != nil || ctx.Err() != nil {
+			block.release()
+			break
+		}
+		// The incomplete record at the end of the block is copied to the next block
+		leftoverData = data[offset:]
+		leftoverBlock = block
+	}
+	close(chunks)
+	wgDecoder.Wait()
+	return packetStopReached, readErr
+}
+
+// decodeChunks copies the records of the chunks and hands them to the parser.
+// The records are copied, since the parsed packet information references the packet data.
+// A chunk is only copied once its first packet fits into the window of the parser's reorder buffer,
+// hence the decoders read at most one chunk further ahead than the reorder buffer can sort.
+func (p *PacketReader) decodeChunks(chunks chan pcapChunk, wgDecoder *sync.WaitGroup) {
+	for chunk := range chunks {
+		p.parser.WaitForWindow(chunk.firstPacketIdx)
+		batch := make([]parser.PacketData, len(chunk.records))
+		for i, record := range chunk.records {
+			data := make([]byte, record.length)
+			copy(data, chunk.block.buf[record.offset:record.offset+record.length])
+			batch[i] = parser.PacketData{Data: data, Timestamp: record.timestamp, PacketIdx: chunk.firstPacketIdx + int64(i)}
+		}
+		chunk.block.release()
+		p.parser.ParsePacketBatch(batch)
+	}
+	wgDecoder.Done()
+}
+
+// parsePcapHeader returns the byte order and the factor to convert the fraction of the timestamps to nanoseconds.
+func parsePcapHeader(header []byte) (byteOrder binary.ByteOrder, timestampScale int64, err error) {
+	switch {
+	case binary.LittleEndian.Uint32(header[0:4]) == 0xa1b2c3d4:
+		return binary.LittleEndian, 1000, nil
+	case binary.LittleEndian.Uint32(header[0:4]) == 0xa1b23c4d:
+		return binary.LittleEndian, 1, nil
+	case binary.BigEndian.Uint32(header[0:4]) == 0xa1b2c3d4:
+		return binary.BigEndian, 1000, nil
+	case binary.BigEndian.Uint32(header[0:4]) == 0xa1b23c4d:
+		return binary.BigEndian, 1, nil
+	default:
+		return nil, 0, fmt.Errorf("unknown magic number %x", header[0:4])
+	}
+}
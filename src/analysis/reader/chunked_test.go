@@ -0,0 +1,161 @@
+package reader
+
+import (
+	"context"
+	"math"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"test.com/scale/src/analysis/flows"
+	"test.com/scale/src/analysis/parser"
+	"test.com/scale/src/analysis/pool"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// chunkedTestPackets spans several chunks
+const chunkedTestPackets = 3*chunkedRecordsPerChunk + 100
+
+// readPacket is a packet as it arrives in the flows of the pools
+type readPacket struct {
+	packetIdx int64
+	timestamp int64
+}
+
+// recordingMetric collects the packets of the flushed flows
+type recordingMetric struct {
+	mutex   sync.Mutex
+	packets []readPacket
+	ordered bool // Whether the packets of each flow are sorted by PacketIdx
+}
+
+func (m *recordingMetric) OnTCPFlush(flow *flows.TCPFlow) {
+	m.onFlush(&flow.Flow)
+}
+
+func (m *recordingMetric) OnUDPFlush(flow *flows.UDPFlow) {
+	m.onFlush(&flow.Flow)
+}
+
+func (m *recordingMetric) onFlush(flow *flows.Flow) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for i, packet := range flow.Packets {
+		if i > 0 && packet.PacketIdx <= flow.Packets[i-1].PacketIdx {
+			m.ordered = false
+		}
+		m.packets = append(m.packets, readPacket{packetIdx: packet.PacketIdx, timestamp: packet.Timestamp})
+	}
+}
+
+// writeTestPcap writes UDP packets of 64 flows with 1 ms between them, and a record without data
+func writeTestPcap(t *testing.T) string {
+	filename := path.Join(t.TempDir(), "trace.pcap")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := pcapgo.NewWriterNanos(f)
+	if err = w.WriteFileHeader(65536, layers.LinkTypeEthernet); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2020, time.September, 13, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < chunkedTestPackets; i++ {
+		ethernet := &layers.Ethernet{SrcMAC: net.HardwareAddr{0, 0, 0, 0, 0, 1}, DstMAC: net.HardwareAddr{0, 0, 0, 0, 0, 2}, EthernetType: layers.EthernetTypeIPv4}
+		ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+		udp := &layers.UDP{SrcPort: layers.UDPPort(40000 + i%64), DstPort: 53}
+		if err = udp.SetNetworkLayerForChecksum(ip); err != nil {
+			t.Fatal(err)
+		}
+		buffer := gopacket.NewSerializeBuffer()
+		if err = gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, ethernet, ip, udp, gopacket.Payload(make([]byte, i%100))); err != nil {
+			t.Fatal(err)
+		}
+		data := buffer.Bytes()
+		if i == 100 {
+			data = nil
+		}
+		ci := gopacket.CaptureInfo{Timestamp: start.Add(time.Duration(i) * time.Millisecond), CaptureLength: len(data), Length: len(data)}
+		if err = w.WritePacket(ci, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filename
+}
+
+// readTestPcap reads the file sequentially (numDecoders 0) or chunked and returns the packets in the order of PacketIdx
+func readTestPcap(t *testing.T, filename string, numDecoders int) (*PacketReader, []readPacket) {
+	ports := []uint16{53}
+	pools := pool.NewPools(ports, ports, false, flows.Timeouts{TCP: int64(time.Minute), TCPFin: int64(time.Second), TCPRst: int64(time.Second), UDP: int64(5 * time.Second)},
+		2, pool.DefaultAddPacketChannelSize, pool.DefaultPacketInformationCacheSize)
+	metric := &recordingMetric{ordered: true}
+	pools.RegisterMetric(metric)
+	// The small reorder buffer makes the decoders wait for each other
+	packetParser := parser.NewParser(pools, 1000, 4, 100, 4, 100)
+	packetReader := NewPacketReader(pools, packetParser)
+	flushRate := int64(time.Second)
+	done := make(chan error)
+	go func() {
+		var err error
+		if numDecoders == 0 {
+			source, file, _, _, openErr := ReadPcapFile(filename)
+			if openErr != nil {
+				done <- openErr
+				return
+			}
+			defer file.Close()
+			packetReader.Read(context.Background(), math.MaxInt64, flushRate, source)
+		} else {
+			_, err = packetReader.ReadPcapFileChunked(context.Background(), filename, math.MaxInt64, flushRate, numDecoders)
+		}
+		packetParser.Close()
+		pools.Close()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("deadlock: the packets were not handed to the pools")
+	}
+
+	if !metric.ordered {
+		t.Fatal("the packets of a flow are not sorted")
+	}
+	sort.Slice(metric.packets, func(i, j int) bool { return metric.packets[i].packetIdx < metric.packets[j].packetIdx })
+	return packetReader, metric.packets
+}
+
+func TestReadPcapFileChunked(t *testing.T) {
+	filename := writeTestPcap(t)
+	sequentialReader, expected := readTestPcap(t, filename, 0)
+	if len(expected) != chunkedTestPackets-1 {
+		t.Fatalf("read %d packets sequentially, expected %d", len(expected), chunkedTestPackets-1)
+	}
+	for _, numDecoders := range []int{1, 4} {
+		reader, packets := readTestPcap(t, filename, numDecoders)
+		if len(packets) != len(expected) {
+			t.Fatalf("%d decoders: read %d packets, expected %d", numDecoders, len(packets), len(expected))
+		}
+		for i := range packets {
+			if packets[i] != expected[i] {
+				t.Fatalf("%d decoders: packet %d is %+v, expected %+v", numDecoders, i, packets[i], expected[i])
+			}
+		}
+		if reader.PacketIdx != sequentialReader.PacketIdx || reader.FirstPacketTimestamp != sequentialReader.FirstPacketTimestamp ||
+			reader.LastPacketTimestamp != sequentialReader.LastPacketTimestamp {
+			t.Fatalf("%d decoders: read %d packets from %d to %d, expected %d from %d to %d", numDecoders,
+				reader.PacketIdx, reader.FirstPacketTimestamp, reader.LastPacketTimestamp,
+				sequentialReader.PacketIdx, sequentialReader.FirstPacketTimestamp, sequentialReader.LastPacketTimestamp)
+		}
+	}
+}
@@ -1,12 +1,12 @@
 package reader
 
 import (
+	"context"
 	"fmt"
 	"github.com/dustin/go-humanize"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/pcapgo"
 	"io"
-	"log"
 	"os"
 	"strings"
 	"test.com/scale/src/analysis/parser"
@@ -14,6 +14,10 @@ import (
 	"test.com/scale/src/analysis/utils"
 )
 
+// cancelCheckInterval is the number of packets after which the reader checks whether it is cancelled.
+// The reader also checks it after each read error, e.g. the timeouts of idle interfaces.
+const cancelCheckInterval = 1024
+
 // PacketReader reads from a source.
 // Is responsible for forwarding packets to the parser,
 // as well as keeping track of the number of Packet, as well
@@ -23,6 +27,7 @@ type PacketReader struct {
 	flushTimestamp       int64
 	FirstPacketTimestamp int64
 	LastPacketTimestamp  int64
+	spikeCount           int
 	pools                *pool.Pools
 	parser               *parser.Parser
 }
@@ -43,10 +48,15 @@ func NewPacketReader(pools *pool.Pools, packetParser *parser.Parser) *PacketRead
 // Flushing the pool is necessary to remove timedout flows from the pool
 // and to keep memory footprint low.
 //
+// Reading is also stopped if ctx is cancelled, the caller has to check ctx.Err().
+//
 // Returns whether the specified number of packets have been read
-func (p *PacketReader) Read(packetStop, flushRate int64, packetDataSource gopacket.PacketDataSource) bool {
-	spike_count := 0
-	for p.PacketIdx < packetStop {
+func (p *PacketReader) Read(ctx context.Context, packetStop, flushRate int64, packetDataSource gopacket.PacketDataSource) bool {
+	p.spikeCount = 0
+	for i := 0; p.PacketIdx < packetStop; i++ {
+		if i%cancelCheckInterval == 0 && ctx.Err() != nil {
+			return false
+		}
 		data, ci, err := packetDataSource.ReadPacketData()
 		// Stop reading at end of file
 		if err == io.EOF {
@@ -60,6 +70,10 @@ func (p *PacketReader) Read(packetStop, flushRate int64, packetDataSource gopack
 
 		if err != nil {
 			//fmt.Println("Error reading packet: ", err) todo renable and filter out
+			// Interfaces return a timeout error while idle, hence i does not advance for a long time
+			if ctx.Err() != nil {
+				return false
+			}
 			continue
 		}
 		if len(data) == 0 { //sometimes packets with len 0 come thorugh although no error is thrown? these have weird timestamps
@@ -79,42 +93,48 @@ func (p *PacketReader) Read(packetStop, flushRate int64, packetDataSource gopack
 		// Parse packet
 		p.parser.ParsePacket(data, p.PacketIdx, p.LastPacketTimestamp)
 		// Flush packet when flushing interval is reached
-		if p.LastPacketTimestamp > p.flushTimestamp {
-			// print flush timestamp in human readable format
-
-			if p.LastPacketTimestamp-p.flushTimestamp >= flushRate*3 {
-				if spike_count > 1000 { // if we have over 1000 spikes, this is not a spike but just the data i guess, so give it a try
-					fmt.Println("1000 spikes, trying to continue softly")
-					p.flushTimestamp = p.flushTimestamp + flushRate
-
-				} else {
-					fmt.Println("spike?")
-					spike_count += 1
-					continue
-				}
-			} else {
-				p.flushTimestamp = p.LastPacketTimestamp + flushRate
-			}
-			fmt.Println("Flushing pool at: ", humanize.Comma(p.LastPacketTimestamp))
-
-			spike_count = 0
-			// print new flush timesamp in human readable format
-			//fmt.Println("Next flush at: ", humanize.Comma(p.flushTimestamp))
-			//utils.PrintMemUsage()
-			//utils.CreateMemoryProfile(strconv.FormatInt(p.flushTimestamp, 10))
-			fmt.Println("Flush at packet", humanize.Comma(p.PacketIdx))
-			p.pools.Flush(false)
-		}
+		p.flushIfNeeded(flushRate)
 	}
 	return true
 }
 
+// flushIfNeeded flushes the pools if the flushing interval is reached by LastPacketTimestamp.
+func (p *PacketReader) flushIfNeeded(flushRate int64) {
+	if p.LastPacketTimestamp <= p.flushTimestamp {
+		return
+	}
+	// print flush timestamp in human readable format
+
+	if p.LastPacketTimestamp-p.flushTimestamp >= flushRate*3 {
+		if p.spikeCount > 1000 { // if we have over 1000 spikes, this is not a spike but just the data i guess, so give it a try
+			fmt.Println("1000 spikes, trying to continue softly")
+			p.flushTimestamp = p.flushTimestamp + flushRate
+
+		} else {
+			fmt.Println("spike?")
+			p.spikeCount++
+			return
+		}
+	} else {
+		p.flushTimestamp = p.LastPacketTimestamp + flushRate
+	}
+	fmt.Println("Flushing pool at: ", humanize.Comma(p.LastPacketTimestamp))
+
+	p.spikeCount = 0
+	// print new flush timesamp in human readable format
+	//fmt.Println("Next flush at: ", humanize.Comma(p.flushTimestamp))
+	//utils.PrintMemUsage()
+	//utils.CreateMemoryProfile(strconv.FormatInt(p.flushTimestamp, 10))
+	fmt.Println("Flush at packet", humanize.Comma(p.PacketIdx))
+	p.pools.Flush(false)
+}
+
 // ReadPcapFile reads a pcap/pcapng file from filename. This file can optionally be zipped.
 //
 // Returns an instance of NgReader to read the pcap.
 // Also returns an io.ReadCloser which must be closed after the file has been read.
 // file is not nil for zipped file. If it is not nil, the caller must close it.
-func ReadPcapFile(filename string) (reader gopacket.PacketDataSource, ioReader io.ReadCloser, deleteFile bool, deleteFileName string) {
+func ReadPcapFile(filename string) (reader gopacket.PacketDataSource, ioReader io.ReadCloser, deleteFile bool, deleteFileName string, err error) {
 	if strings.Contains(filename, ".pcapng") {
 		return readPcapNgFile(filename)
 	} else {
@@ -127,29 +147,18 @@ func ReadPcapFile(filename string) (reader gopacket.PacketDataSource, ioReader i
 // Returns an instance of NgReader to read the pcap.
 // Also returns an io.ReadCloser which must be closed after the file has been read.
 // file is not nil for zipped file. If it is not nil, the caller must close it.
-func readPcapFile(filename string) (reader *pcapgo.Reader, ioReader io.ReadCloser, deleteFile bool, deleteFileName string) {
-	var err error
-
-	if utils.IsZipFile(filename) {
-		unzippedFileName := utils.Unzip(filename)
-		ioReader, err = os.Open(unzippedFileName)
-		deleteFile = true
-		deleteFileName = unzippedFileName
-	} else {
-		ioReader, err = os.Open(filename)
-	}
-
+func readPcapFile(filename string) (reader gopacket.PacketDataSource, ioReader io.ReadCloser, deleteFile bool, deleteFileName string, err error) {
+	ioReader, deleteFile, deleteFileName, err = openPcapFile(filename)
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, false, "", err
 	}
 
 	reader, err = pcapgo.NewReader(ioReader)
-
 	if err != nil {
-		panic(err)
+		closePcapFile(ioReader, deleteFile, deleteFileName)
+		return nil, nil, false, "", fmt.Errorf("could not read pcap header of %s: %v", filename, err)
 	}
-
-	return reader, ioReader, deleteFile, deleteFileName
+	return reader, ioReader, deleteFile, deleteFileName, nil
 }
 
 // readPcapNgFile reads a pcapng file from filename. This file can optionally be zipped.
@@ -157,26 +166,42 @@ func readPcapFile(filename string) (reader *pcapgo.Reader, ioReader io.ReadClose
 // Returns an instance of NgReader to read the pcap.
 // Also returns an io.ReadCloser which must be closed after the file has been read.
 // file is not nil for zipped file. If it is not nil, the caller must close it.
-func readPcapNgFile(filename string) (ngReader *pcapgo.NgReader, ioReader io.ReadCloser, deleteFile bool, deleteFileName string) {
-	var err error
-
-	if utils.IsZipFile(filename) {
-		unzippedFileName := utils.Unzip(filename)
-		ioReader, err = os.Open(unzippedFileName)
-		deleteFile = true
-		deleteFileName = unzippedFileName
-	} else {
-		ioReader, err = os.Open(filename)
+func readPcapNgFile(filename string) (ngReader gopacket.PacketDataSource, ioReader io.ReadCloser, deleteFile bool, deleteFileName string, err error) {
+	ioReader, deleteFile, deleteFileName, err = openPcapFile(filename)
+	if err != nil {
+		return nil, nil, false, "", err
 	}
 
+	ngReader, err = pcapgo.NewNgReader(ioReader, pcapgo.DefaultNgReaderOptions)
 	if err != nil {
-		log.Fatal(err)
+		closePcapFile(ioReader, deleteFile, deleteFileName)
+		return nil, nil, false, "", fmt.Errorf("could not read pcapng header of %s: %v", filename, err)
 	}
+	return ngReader, ioReader, deleteFile, deleteFileName, nil
+}
 
-	ngReader, err = pcapgo.NewNgReader(ioReader, pcapgo.DefaultNgReaderOptions)
+// openPcapFile opens filename. Zipped files are unzipped first, the unzipped file must be deleted by the caller.
+func openPcapFile(filename string) (ioReader io.ReadCloser, deleteFile bool, deleteFileName string, err error) {
+	if utils.IsZipFile(filename) {
+		unzippedFileName, err := utils.Unzip(filename)
+		if err != nil {
+			return nil, false, "", err
+		}
+		ioReader, err = os.Open(unzippedFileName)
+		if err != nil {
+			_ = os.Remove(unzippedFileName)
+			return nil, false, "", err
+		}
+		return ioReader, true, unzippedFileName, nil
+	}
+	ioReader, err = os.Open(filename)
+	return ioReader, false, "", err
+}
 
-	if err != nil {
-		panic(err)
+// closePcapFile closes a file opened by openPcapFile and deletes it, if it has been unzipped
+func closePcapFile(ioReader io.ReadCloser, deleteFile bool, deleteFileName string) {
+	_ = ioReader.Close()
+	if deleteFile {
+		_ = os.Remove(deleteFileName)
 	}
-	return ngReader, ioReader, deleteFile, deleteFileName
 }
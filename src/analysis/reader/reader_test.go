@@ -0,0 +1,43 @@
+package reader
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+)
+
+// idleSource behaves like an idle interface: each read times out without packet
+type idleSource struct {
+	timeout time.Duration
+}
+
+func (s idleSource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	time.Sleep(s.timeout)
+	return nil, gopacket.CaptureInfo{}, errors.New("timeout expired")
+}
+
+func TestReadReturnsAfterCancelWithoutPackets(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	reader := NewPacketReader(nil, nil)
+	done := make(chan bool)
+	go func() {
+		done <- reader.Read(ctx, 100, int64(time.Minute), idleSource{timeout: 10 * time.Millisecond})
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case packetStopReached := <-done:
+		if packetStopReached {
+			t.Fatal("Read reported the packet stop without packets")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read did not return within a second after the cancellation")
+	}
+	if reader.PacketIdx != 0 {
+		t.Fatalf("read %d packets, expected none", reader.PacketIdx)
+	}
+}
@@ -0,0 +1,33 @@
+package utils
+
+import "strings"
+
+// joinedErrors combines several errors into one
+type joinedErrors []error
+
+func (e joinedErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// JoinErrors returns an error combining all errors which are not nil.
+// Returns nil if all errors are nil, and the error itself if only one error is not nil.
+func JoinErrors(errs ...error) error {
+	var joined joinedErrors
+	for _, err := range errs {
+		if err != nil {
+			joined = append(joined, err)
+		}
+	}
+	switch len(joined) {
+	case 0:
+		return nil
+	case 1:
+		return joined[0]
+	default:
+		return joined
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"fmt"
 	gzip "github.com/klauspost/pgzip"
-	"log"
 	"os"
 	"os/exec"
 	"path"
@@ -14,11 +13,12 @@ import (
 )
 
 // CreateDir creates a new Directory
-func CreateDir(dirname string) {
+func CreateDir(dirname string) error {
 	err := os.MkdirAll(dirname, 0744)
 	if err != nil {
-		panic("Could not create export Directory: " + dirname + err.Error())
+		return fmt.Errorf("could not create directory %s: %v", dirname, err)
 	}
+	return nil
 }
 
 // FileExists returns whether a File exists
@@ -43,15 +43,18 @@ func DirectoryExists(directoryPath string) bool {
 }
 
 // GetPcapFiles returns all pcap files specified
-func GetPcapFiles(input string) []string {
+func GetPcapFiles(input string) ([]string, error) {
 	switch {
 	case FileExists(input):
 		fmt.Println("Use input File:", input)
-		return []string{input}
+		return []string{input}, nil
 	case DirectoryExists(input):
 		var files []string
 		fmt.Println("Use input Directory:", input)
 		err := filepath.Walk(input, func(filepathFile string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
 			// Skip directories and subdirectories
 			if info.IsDir() || filepath.Clean(filepath.Dir(filepathFile)) != filepath.Clean(input) {
 				return nil
@@ -63,28 +66,30 @@ func GetPcapFiles(input string) []string {
 			return nil
 		})
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 		sort.Slice(files, func(i, j int) bool { return files[i] < files[j] })
 		fmt.Println("Analyze the following files in this order (please recheck!):")
 		for _, file := range files {
 			fmt.Println(file)
 		}
-		return files
+		return files, nil
 	default:
-		log.Fatal("Input does not exist. Please recheck", input)
-		return []string{}
+		return nil, fmt.Errorf("input does not exist: %s", input)
 	}
 }
 
 // GetFilesInPath returns the complete path to all files in the inputDirectory which do have the required extension.
 // Skips subdirectories
-func GetFilesInPath(inputDirectory, extensionWithoutDot string) []string {
+func GetFilesInPath(inputDirectory, extensionWithoutDot string) ([]string, error) {
 	if !DirectoryExists(inputDirectory) {
-		return []string{}
+		return []string{}, nil
 	}
 	var files []string
 	err := filepath.Walk(inputDirectory, func(filepath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
 		// Skip directories and subdirectories
 		if info.IsDir() || path.Clean(path.Dir(filepath)) != path.Clean(inputDirectory) {
 			return nil
@@ -96,9 +101,9 @@ func GetFilesInPath(inputDirectory, extensionWithoutDot string) []string {
 		return nil
 	})
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return files
+	return files, nil
 }
 
 // Returns the filename of a path.
@@ -122,15 +127,14 @@ func IsZipFile(filename string) (isZipFile bool) {
 }
 
 // Unzips a zip file and returns the filename of the unzipped file
-func Unzip(filename string) (unzippedFileName string) {
+func Unzip(filename string) (unzippedFileName string, err error) {
 	if isBz2(filename) {
 		return unzipBz2(filename)
 	}
 	if isGzip(filename) {
 		return unzipGzip(filename)
 	}
-
-	panic("File is neither a .b")
+	return "", fmt.Errorf("file is neither a .bz2 nor a .gz file: %s", filename)
 }
 
 // Checks whether a file is a .bz2 file by looking at the extension
@@ -144,43 +148,44 @@ func isGzip(filename string) bool {
 }
 
 // Unzips a .bz2 file and returns the name of the unzipped file
-func unzipBz2(filename string) (unzippedFileName string) {
-	var err error
-
+func unzipBz2(filename string) (unzippedFileName string, err error) {
 	cmd := exec.Command("lbunzip2", "-k", "-n", "64", filename)
-	err = cmd.Run()
-	if err != nil {
-		log.Fatal(err)
+	if err = cmd.Run(); err != nil {
+		return "", fmt.Errorf("could not unzip %s: %v", filename, err)
 	}
-
-	return filename[:len(filename)-4]
+	return filename[:len(filename)-4], nil
 }
 
 // Unzips a .gz file and returns the name of the unzipped file
-func unzipGzip(filename string) (unzippedFileName string) {
+func unzipGzip(filename string) (unzippedFileName string, err error) {
 	file, err := os.Open(filename)
-	assertNoError(err)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
 
 	r, err := gzip.NewReader(file)
-	assertNoError(err)
+	if err != nil {
+		return "", fmt.Errorf("could not unzip %s: %v", filename, err)
+	}
 
 	unzippedFileName = filename[:len(filename)-3]
 	f, err := os.Create(unzippedFileName)
-	assertNoError(err)
+	if err != nil {
+		return "", err
+	}
 
 	w := bufio.NewWriter(f)
 	_, err = r.WriteTo(w)
-	assertNoError(err)
-
-	err = file.Close()
-	assertNoError(err)
-
-	return unzippedFileName
-}
-
-// Helper function that only returns if err == nil
-func assertNoError(err error) {
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
-		log.Fatal(err)
+		_ = os.Remove(unzippedFileName)
+		return "", fmt.Errorf("could not unzip %s: %v", filename, err)
 	}
+	return unzippedFileName, nil
 }
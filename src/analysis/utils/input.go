@@ -2,27 +2,27 @@ package utils
 
 import (
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
 )
 
 // Ask User for Confirmation
 // From https://gist.github.com/albrow/5882501
-func AskForConfirmation(message string) bool {
+// Returns an error if the response can not be read.
+func AskForConfirmation(message string) (bool, error) {
 	fmt.Println(message)
 	var response string
 	_, err := fmt.Scanln(&response)
 	if err != nil {
-		log.Fatal(err)
+		return false, err
 	}
 	okayResponses := []string{"y", "Y", "yes", "Yes", "YES"}
 	nokayResponses := []string{"n", "N", "no", "No", "NO"}
 	switch {
 	case containsString(okayResponses, response):
-		return true
+		return true, nil
 	case containsString(nokayResponses, response):
-		return false
+		return false, nil
 	default:
 		fmt.Println("Please type yes or no and then press enter:")
 		return AskForConfirmation(message)
@@ -47,7 +47,8 @@ func containsString(slice []string, element string) bool {
 
 // ExpandIntegerList returns from a string all integers in this range
 // e.g. 2-5,12 will return 2,3,4,5,12
-func ExpandIntegerList(str string) []uint16 {
+// Returns an error if the string is invalid.
+func ExpandIntegerList(str string) ([]uint16, error) {
 	ints := make([]uint16, 0)
 	for _, intsSeperated := range strings.Split(str, ",") {
 		if intsSeperated == "" {
@@ -57,11 +58,11 @@ func ExpandIntegerList(str string) []uint16 {
 			startEnd := strings.SplitN(intsSeperated, "-", 2)
 			start, err := strconv.ParseUint(startEnd[0], 10, 16)
 			if err != nil {
-				panic("Wrong argument to getListOfInts: " + intsSeperated)
+				return nil, fmt.Errorf("invalid integer list element: %s", intsSeperated)
 			}
 			end, err := strconv.ParseUint(startEnd[1], 10, 16)
 			if err != nil {
-				panic("Wrong argument to getListOfInts: " + intsSeperated)
+				return nil, fmt.Errorf("invalid integer list element: %s", intsSeperated)
 			}
 			for i := start; i <= end; i++ {
 				ints = append(ints, uint16(i))
@@ -69,10 +70,10 @@ func ExpandIntegerList(str string) []uint16 {
 		} else {
 			integer, err := strconv.ParseUint(intsSeperated, 10, 16)
 			if err != nil {
-				panic("Wrong argument to getListOfInts: " + intsSeperated)
+				return nil, fmt.Errorf("invalid integer list element: %s", intsSeperated)
 			}
 			ints = append(ints, uint16(integer))
 		}
 	}
-	return ints
+	return ints, nil
 }
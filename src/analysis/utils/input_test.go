@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandIntegerList(t *testing.T) {
+	tests := []struct {
+		list     string
+		expected []uint16
+		valid    bool
+	}{
+		{"", []uint16{}, true},
+		{"80", []uint16{80}, true},
+		{"80,443", []uint16{80, 443}, true},
+		{"2-5,12", []uint16{2, 3, 4, 5, 12}, true},
+		{"65535", []uint16{65535}, true},
+		{"65536", nil, false},
+		{"a", nil, false},
+		{"1-b", nil, false},
+	}
+	for _, test := range tests {
+		ints, err := ExpandIntegerList(test.list)
+		if (err == nil) != test.valid {
+			t.Errorf("%q: error is %v, expected valid %v", test.list, err, test.valid)
+			continue
+		}
+		if test.valid && !reflect.DeepEqual(ints, test.expected) {
+			t.Errorf("%q: expanded to %v, expected %v", test.list, ints, test.expected)
+		}
+	}
+}
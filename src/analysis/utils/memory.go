@@ -1,11 +1,14 @@
 package utils
 
 import (
+	"bufio"
 	"fmt"
 	"log"
 	"os"
 	"runtime"
 	"runtime/pprof"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dustin/go-humanize"
@@ -38,3 +41,27 @@ func CreateMemoryProfile(suffix string) {
 		log.Println("could not write memory profile: ", err)
 	}
 }
+
+// AvailableMemory returns the memory in bytes which is available for new applications without swapping.
+// It is read from /proc/meminfo. Returns 0 if it cannot be determined (e.g. on other operating systems).
+func AvailableMemory() uint64 {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Format: "MemAvailable:   12345678 kB"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == "MemAvailable:" && fields[2] == "kB" {
+			kiloBytes, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0
+			}
+			return kiloBytes * 1024
+		}
+	}
+	return 0
+}
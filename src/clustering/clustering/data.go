@@ -1,209 +1,146 @@
 package clustering
 
+// This file contains the loaders and writers of the cluster info files.
+// A file starts with the total number of entries (8 bytes, big endian),
+// followed by batches of entries. Each batch is prefixed by its size in bytes (8 bytes, big endian).
+
 import (
 	"encoding/binary"
+	"fmt"
 	"io"
-	"log"
 	"os"
 	"test.com/scale/src/clustering/dataformat"
 
 	"github.com/golang/protobuf/proto"
 )
 
-func LoadRRPData(filename string) *dataformat.RRPs {
+func LoadRRPData(filename string) (*dataformat.RRPs, error) {
 	allRRPs := &dataformat.RRPs{}
-	// Open file
-	file, err := os.Open(filename)
-	defer file.Close()
-	if err != nil {
-		panic(err)
-	}
-
-	// Get Number of RRPs
-	sizeBytes := make([]byte, 8)
-	_, err = file.Read(sizeBytes)
-	if err != nil {
-		panic(err)
-	}
-	numRRPs := binary.BigEndian.Uint64(sizeBytes)
-	allRRPs.Rrps = make([]*dataformat.RRP, numRRPs)
-
-	var i int
-	for true {
-		// Read size of message
-		n, err := file.Read(sizeBytes)
-		if n == 0 && err == io.EOF {
-			break
-		}
-		if n != 8 {
-			log.Fatalln("Number of read bytes must be 8")
-		}
-		size := binary.BigEndian.Uint64(sizeBytes)
-
-		// Read message of the specified size, unmarshal it and add it to result
-		buf := make([]byte, size)
-		_, err = file.Read(buf)
-		if err != nil {
-			log.Fatalln("Error at reading cluster data File", err)
-		}
+	err := readData(filename, func(numRRPs uint64) {
+		allRRPs.Rrps = make([]*dataformat.RRP, 0, numRRPs)
+	}, func(buf []byte) error {
 		rrps := &dataformat.RRPs{}
-		err = proto.Unmarshal(buf, rrps)
-		if err != nil {
-			log.Fatalln("Errowr while unmarshaling cluster data", err)
-		}
-		for j := 0; j < len(rrps.Rrps); j++ {
-			allRRPs.Rrps[i+j] = rrps.Rrps[j]
+		if err := proto.Unmarshal(buf, rrps); err != nil {
+			return err
 		}
-		i += len(rrps.Rrps)
+		allRRPs.Rrps = append(allRRPs.Rrps, rrps.Rrps...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return allRRPs
+	return allRRPs, nil
 }
 
-func LoadFlowData(filename string) *dataformat.Flows {
+func LoadFlowData(filename string) (*dataformat.Flows, error) {
 	allFlows := &dataformat.Flows{}
-	// Open file
-	file, err := os.Open(filename)
-	defer file.Close()
-	if err != nil {
-		panic(err)
-	}
-
-	// Get Number of Flows
-	sizeBytes := make([]byte, 8)
-	_, err = file.Read(sizeBytes)
-	if err != nil {
-		panic(err)
-	}
-	numFlows := binary.BigEndian.Uint64(sizeBytes)
-	allFlows.Flows = make([]*dataformat.Flow, numFlows)
-
-	var i int
-	for true {
-		// Read size of message
-		n, err := file.Read(sizeBytes)
-		if n == 0 && err == io.EOF {
-			break
-		}
-		if n != 8 {
-			log.Fatalln("Number of read bytes must be 8")
-		}
-		size := binary.BigEndian.Uint64(sizeBytes)
-
-		// Read message of the specified size, unmarshal it and add it to result
-		buf := make([]byte, size)
-		_, err = file.Read(buf)
-		if err != nil {
-			log.Fatalln("Error at reading cluster data File", err)
-		}
+	err := readData(filename, func(numFlows uint64) {
+		allFlows.Flows = make([]*dataformat.Flow, 0, numFlows)
+	}, func(buf []byte) error {
 		flows := &dataformat.Flows{}
-		err = proto.Unmarshal(buf, flows)
-		if err != nil {
-			log.Fatalln("Errowr while unmarshaling cluster data", err)
+		if err := proto.Unmarshal(buf, flows); err != nil {
+			return err
 		}
-		for j := 0; j < len(flows.Flows); j++ {
-			allFlows.Flows[i+j] = flows.Flows[j]
-		}
-		i += len(flows.Flows)
+		allFlows.Flows = append(allFlows.Flows, flows.Flows...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return allFlows
+	return allFlows, nil
 }
 
-func LoadSessionData(filename string) *dataformat.Sessions {
+func LoadSessionData(filename string) (*dataformat.Sessions, error) {
 	allSessions := &dataformat.Sessions{}
-	// Open file
-	file, err := os.Open(filename)
-	defer file.Close()
-	if err != nil {
-		panic(err)
-	}
-
-	// Get Number of Sessions
-	sizeBytes := make([]byte, 8)
-	_, err = file.Read(sizeBytes)
+	err := readData(filename, func(numSessions uint64) {
+		allSessions.Sessions = make([]*dataformat.Session, 0, numSessions)
+	}, func(buf []byte) error {
+		sessions := &dataformat.Sessions{}
+		if err := proto.Unmarshal(buf, sessions); err != nil {
+			return err
+		}
+		allSessions.Sessions = append(allSessions.Sessions, sessions.Sessions...)
+		return nil
+	})
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	numSessions := binary.BigEndian.Uint64(sizeBytes)
-	allSessions.Sessions = make([]*dataformat.Session, numSessions)
-
-	var i int
-	for true {
-		// Read size of message
-		n, err := file.Read(sizeBytes)
-		if n == 0 && err == io.EOF {
-			break
-		}
-		if n != 8 {
-			log.Fatalln("Number of read bytes must be 8")
-		}
-		size := binary.BigEndian.Uint64(sizeBytes)
+	return allSessions, nil
+}
 
-		// Read message of the specified size, unmarshal it and add it to result
-		buf := make([]byte, size)
-		_, err = file.Read(buf)
-		if err != nil {
-			log.Fatalln("Error at reading cluster data File", err)
-		}
-		sessions := &dataformat.Sessions{}
-		err = proto.Unmarshal(buf, sessions)
-		if err != nil {
-			log.Fatalln("Errowr while unmarshaling cluster data", err)
-		}
-		for j := 0; j < len(sessions.Sessions); j++ {
-			allSessions.Sessions[i+j] = sessions.Sessions[j]
+func LoadUserData(filename string) (*dataformat.Users, error) {
+	allUsers := &dataformat.Users{}
+	err := readData(filename, func(numUsers uint64) {
+		allUsers.Users = make([]*dataformat.User, 0, numUsers)
+	}, func(buf []byte) error {
+		users := &dataformat.Users{}
+		if err := proto.Unmarshal(buf, users); err != nil {
+			return err
 		}
-		i += len(sessions.Sessions)
+		allUsers.Users = append(allUsers.Users, users.Users...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return allSessions
+	return allUsers, nil
 }
 
-func LoadUserData(filename string) *dataformat.Users {
-	allUsers := &dataformat.Users{}
-	// Open file
+// minEntrySize is the minimal number of bytes of an entry in a marshaled batch (tag and length of an empty entry)
+const minEntrySize = 2
+
+// readData reads a cluster info file. onCount is called with the total number of entries,
+// onBatch with each marshaled batch. The number of entries and the sizes of the batches are checked against
+// the size of the file, hence corrupt or truncated files are reported as error before anything is allocated.
+func readData(filename string, onCount func(count uint64), onBatch func(buf []byte) error) error {
 	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
 	defer file.Close()
+	info, err := file.Stat()
 	if err != nil {
-		panic(err)
+		return err
 	}
+	remaining := uint64(info.Size())
 
-	// Get Number of Users
+	// Get Number of entries
 	sizeBytes := make([]byte, 8)
-	_, err = file.Read(sizeBytes)
-	if err != nil {
-		panic(err)
+	if _, err = io.ReadFull(file, sizeBytes); err != nil {
+		return fmt.Errorf("error while reading number of entries of %s: %v", filename, err)
+	}
+	remaining -= uint64(len(sizeBytes))
+	count := binary.BigEndian.Uint64(sizeBytes)
+	if count > remaining/minEntrySize {
+		return fmt.Errorf("%s is corrupt: %d entries do not fit into the remaining %d bytes", filename, count, remaining)
 	}
-	numUsers := binary.BigEndian.Uint64(sizeBytes)
-	allUsers.Users = make([]*dataformat.User, numUsers)
+	onCount(count)
 
-	var i int
-	for true {
+	for {
 		// Read size of message
-		n, err := file.Read(sizeBytes)
-		if n == 0 && err == io.EOF {
-			break
+		_, err = io.ReadFull(file, sizeBytes)
+		if err == io.EOF {
+			return nil
 		}
-		if n != 8 {
-			log.Fatalln("Number of read bytes must be 8")
+		if err != nil {
+			return fmt.Errorf("error while reading size of batch of %s: %v", filename, err)
 		}
+		remaining -= uint64(len(sizeBytes))
 		size := binary.BigEndian.Uint64(sizeBytes)
+		if size > remaining {
+			return fmt.Errorf("%s is corrupt: batch of %d bytes does not fit into the remaining %d bytes", filename, size, remaining)
+		}
+		remaining -= size
 
-		// Read message of the specified size, unmarshal it and add it to result
+		// Read message of the specified size and unmarshal it
 		buf := make([]byte, size)
-		_, err = file.Read(buf)
-		if err != nil {
-			log.Fatalln("Error at reading cluster data File", err)
-		}
-		users := &dataformat.Users{}
-		err = proto.Unmarshal(buf, users)
-		if err != nil {
-			log.Fatalln("Errowr while unmarshaling cluster data", err)
+		if _, err = io.ReadFull(file, buf); err != nil {
+			return fmt.Errorf("error while reading batch of %s: %v", filename, err)
 		}
-		for j := 0; j < len(users.Users); j++ {
-			allUsers.Users[i+j] = users.Users[j]
+		if err = onBatch(buf); err != nil {
+			return fmt.Errorf("error while unmarshaling batch of %s: %v", filename, err)
 		}
-		i += len(users.Users)
 	}
-	return allUsers
 }
 
 func min(a, b int) int {
@@ -213,142 +150,61 @@ func min(a, b int) int {
 	return b
 }
 
-func SaveRRPData(filename string, rrps *dataformat.RRPs, chunksize int) {
-	file, err := os.Create(filename)
-	defer file.Close()
-	if err != nil {
-		panic(err)
-	}
-	var buf []byte
-	sizeBytes := make([]byte, 8)
-	binary.BigEndian.PutUint64(sizeBytes, uint64(len(rrps.Rrps)))
-	_, err = file.Write(sizeBytes)
-	if err != nil {
-		log.Fatalln("Error while writing number of rrps", err)
-	}
-
-	for i := 0; i < len(rrps.Rrps); i += chunksize {
-		batch := rrps.Rrps[i:min(i+chunksize, len(rrps.Rrps))]
-		batchRRPs := &dataformat.RRPs{Rrps: batch}
-		buf, err = proto.Marshal(batchRRPs)
-		if err != nil {
-			log.Fatalln("Error while marshaling Batch", err)
-		}
-		// Write Size
-		binary.BigEndian.PutUint64(sizeBytes, uint64(len(buf)))
-		_, err = file.Write(sizeBytes)
-		if err != nil {
-			log.Fatalln("Error while writing size", err)
-		}
-		// Write message
-		_, err = file.Write(buf)
-		if err != nil {
-			log.Fatalln("Error while writing marshaled message", err)
-		}
-	}
+func SaveRRPData(filename string, rrps *dataformat.RRPs, chunksize int) error {
+	return writeData(filename, len(rrps.Rrps), chunksize, func(start, end int) ([]byte, error) {
+		return proto.Marshal(&dataformat.RRPs{Rrps: rrps.Rrps[start:end]})
+	})
 }
 
-func SaveFlowData(filename string, flows *dataformat.Flows, chunksize int) {
-	file, err := os.Create(filename)
-	defer file.Close()
-	if err != nil {
-		panic(err)
-	}
-	var buf []byte
-	sizeBytes := make([]byte, 8)
-	binary.BigEndian.PutUint64(sizeBytes, uint64(len(flows.Flows)))
-	_, err = file.Write(sizeBytes)
-	if err != nil {
-		log.Fatalln("Error while writing number of flows", err)
-	}
-
-	for i := 0; i < len(flows.Flows); i += chunksize {
-		batch := flows.Flows[i:min(i+chunksize, len(flows.Flows))]
-		batchFlows := &dataformat.Flows{Flows: batch}
-		buf, err = proto.Marshal(batchFlows)
-		if err != nil {
-			log.Fatalln("Error while marshaling Batch", err)
-		}
-		// Write Size
-		binary.BigEndian.PutUint64(sizeBytes, uint64(len(buf)))
-		_, err = file.Write(sizeBytes)
-		if err != nil {
-			log.Fatalln("Error while writing size", err)
-		}
-		// Write message
-		_, err = file.Write(buf)
-		if err != nil {
-			log.Fatalln("Error while writing marshaled message", err)
-		}
-	}
+func SaveFlowData(filename string, flows *dataformat.Flows, chunksize int) error {
+	return writeData(filename, len(flows.Flows), chunksize, func(start, end int) ([]byte, error) {
+		return proto.Marshal(&dataformat.Flows{Flows: flows.Flows[start:end]})
+	})
 }
 
-func SaveSessionData(filename string, sessions *dataformat.Sessions, chunksize int) {
-	file, err := os.Create(filename)
-	defer file.Close()
-	if err != nil {
-		panic(err)
-	}
-	var buf []byte
-	sizeBytes := make([]byte, 8)
-	binary.BigEndian.PutUint64(sizeBytes, uint64(len(sessions.Sessions)))
-	_, err = file.Write(sizeBytes)
-	if err != nil {
-		log.Fatalln("Error while writing number of sessions", err)
-	}
+func SaveSessionData(filename string, sessions *dataformat.Sessions, chunksize int) error {
+	return writeData(filename, len(sessions.Sessions), chunksize, func(start, end int) ([]byte, error) {
+		return proto.Marshal(&dataformat.Sessions{Sessions: sessions.Sessions[start:end]})
+	})
+}
 
-	for i := 0; i < len(sessions.Sessions); i += chunksize {
-		batch := sessions.Sessions[i:min(i+chunksize, len(sessions.Sessions))]
-		batchSessions := &dataformat.Sessions{Sessions: batch}
-		buf, err = proto.Marshal(batchSessions)
-		if err != nil {
-			log.Fatalln("Error while marshaling Batch", err)
-		}
-		// Write Size
-		binary.BigEndian.PutUint64(sizeBytes, uint64(len(buf)))
-		_, err = file.Write(sizeBytes)
-		if err != nil {
-			log.Fatalln("Error while writing size", err)
-		}
-		// Write message
-		_, err = file.Write(buf)
-		if err != nil {
-			log.Fatalln("Error while writing marshaled message", err)
-		}
-	}
+func SaveUserData(filename string, users *dataformat.Users, chunksize int) error {
+	return writeData(filename, len(users.Users), chunksize, func(start, end int) ([]byte, error) {
+		return proto.Marshal(&dataformat.Users{Users: users.Users[start:end]})
+	})
 }
 
-func SaveUserData(filename string, users *dataformat.Users, chunksize int) {
+// writeData writes count entries in batches of chunksize entries to a cluster info file.
+// marshalBatch must return the marshaled entries from start to end (exclusive).
+func writeData(filename string, count, chunksize int, marshalBatch func(start, end int) ([]byte, error)) error {
 	file, err := os.Create(filename)
-	defer file.Close()
 	if err != nil {
-		panic(err)
+		return err
 	}
-	var buf []byte
 	sizeBytes := make([]byte, 8)
-	binary.BigEndian.PutUint64(sizeBytes, uint64(len(users.Users)))
-	_, err = file.Write(sizeBytes)
-	if err != nil {
-		log.Fatalln("Error while writing number of users", err)
+	binary.BigEndian.PutUint64(sizeBytes, uint64(count))
+	if _, err = file.Write(sizeBytes); err != nil {
+		file.Close()
+		return fmt.Errorf("error while writing number of entries to %s: %v", filename, err)
 	}
 
-	for i := 0; i < len(users.Users); i += chunksize {
-		batch := users.Users[i:min(i+chunksize, len(users.Users))]
-		batchUsers := &dataformat.Users{Users: batch}
-		buf, err = proto.Marshal(batchUsers)
+	for i := 0; i < count; i += chunksize {
+		buf, err := marshalBatch(i, min(i+chunksize, count))
 		if err != nil {
-			log.Fatalln("Error while marshaling Batch", err)
+			file.Close()
+			return fmt.Errorf("error while marshaling batch for %s: %v", filename, err)
 		}
 		// Write Size
 		binary.BigEndian.PutUint64(sizeBytes, uint64(len(buf)))
-		_, err = file.Write(sizeBytes)
-		if err != nil {
-			log.Fatalln("Error while writing size", err)
+		if _, err = file.Write(sizeBytes); err != nil {
+			file.Close()
+			return fmt.Errorf("error while writing size to %s: %v", filename, err)
 		}
 		// Write message
-		_, err = file.Write(buf)
-		if err != nil {
-			log.Fatalln("Error while writing marshaled message", err)
+		if _, err = file.Write(buf); err != nil {
+			file.Close()
+			return fmt.Errorf("error while writing marshaled message to %s: %v", filename, err)
 		}
 	}
+	return file.Close()
 }
@@ -0,0 +1,71 @@
+package clustering
+
+import (
+	"encoding/binary"
+	"os"
+	"path"
+	"strings"
+	"test.com/scale/src/clustering/dataformat"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func TestFlowDataRoundTrip(t *testing.T) {
+	flows := &dataformat.Flows{}
+	for i := 0; i < 25; i++ {
+		flows.Flows = append(flows.Flows, &dataformat.Flow{ServerAddress: uint64(i), NumRrp: int64(i * 2), TimeoutProfile: "udp/53"})
+	}
+	flows.Flows = append(flows.Flows, &dataformat.Flow{}) // Empty entries must fit as well
+	filename := path.Join(t.TempDir(), "flows")
+	if err := SaveFlowData(filename, flows, 10); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFlowData(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(loaded, flows) {
+		t.Fatalf("loaded %d flows which differ from the %d saved flows", len(loaded.Flows), len(flows.Flows))
+	}
+}
+
+// uint64Bytes returns the big endian representation of the values
+func uint64Bytes(values ...uint64) []byte {
+	buf := make([]byte, 8*len(values))
+	for i, value := range values {
+		binary.BigEndian.PutUint64(buf[8*i:], value)
+	}
+	return buf
+}
+
+func TestLoadCorruptData(t *testing.T) {
+	batch, err := proto.Marshal(&dataformat.Flows{Flows: []*dataformat.Flow{{ServerAddress: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		content []byte
+		err     string
+	}{
+		{"empty file", nil, "number of entries"},
+		{"huge number of entries", uint64Bytes(1 << 62), "entries do not fit"},
+		{"huge batch", append(uint64Bytes(1, 1<<62), batch...), "does not fit"},
+		{"truncated batch", append(uint64Bytes(1, uint64(len(batch))), batch[:len(batch)-1]...), "does not fit"},
+		{"truncated size", append(uint64Bytes(1), 0, 0, 0), "size of batch"},
+		{"invalid batch", append(uint64Bytes(1, 2), 0xff, 0xff), "unmarshaling"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := path.Join(t.TempDir(), "flows")
+			if err := os.WriteFile(filename, test.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadFlowData(filename)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("error is %v, expected %s", err, test.err)
+			}
+		})
+	}
+}
@@ -170,12 +170,26 @@ func (m *RRPs) GetRrps() []*RRP {
 }
 
 type Flow struct {
-	ServerAddress        uint64        `protobuf:"varint,1,opt,name=server_address,json=serverAddress,proto3" json:"server_address,omitempty"`
-	NumRrp               int64         `protobuf:"varint,2,opt,name=num_rrp,json=numRrp,proto3" json:"num_rrp,omitempty"`
-	InterReq             *Distribution `protobuf:"bytes,3,opt,name=inter_req,json=interReq,proto3" json:"inter_req,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
-	XXX_unrecognized     []byte        `json:"-"`
-	XXX_sizecache        int32         `json:"-"`
+	ServerAddress uint64        `protobuf:"varint,1,opt,name=server_address,json=serverAddress,proto3" json:"server_address,omitempty"`
+	NumRrp        int64         `protobuf:"varint,2,opt,name=num_rrp,json=numRrp,proto3" json:"num_rrp,omitempty"`
+	InterReq      *Distribution `protobuf:"bytes,3,opt,name=inter_req,json=interReq,proto3" json:"inter_req,omitempty"`
+	// Community ID (version 1) of the flow, empty if the full addresses are unknown
+	CommunityId string `protobuf:"bytes,4,opt,name=community_id,json=communityId,proto3" json:"community_id,omitempty"`
+	// Reason why the flow was flushed: idle, fin, rst, forced or shutdown
+	TerminationReason string `protobuf:"bytes,5,opt,name=termination_reason,json=terminationReason,proto3" json:"termination_reason,omitempty"`
+	// Bitmaps of the TCP flags as in the TCP header (FIN 0x01, SYN 0x02, RST 0x04, ACK 0x10), zero for UDP flows
+	TcpFlags       uint32 `protobuf:"varint,6,opt,name=tcp_flags,json=tcpFlags,proto3" json:"tcp_flags,omitempty"`
+	TcpFlagsClient uint32 `protobuf:"varint,7,opt,name=tcp_flags_client,json=tcpFlagsClient,proto3" json:"tcp_flags_client,omitempty"`
+	TcpFlagsServer uint32 `protobuf:"varint,8,opt,name=tcp_flags_server,json=tcpFlagsServer,proto3" json:"tcp_flags_server,omitempty"`
+	TcpFlagsFirst  uint32 `protobuf:"varint,9,opt,name=tcp_flags_first,json=tcpFlagsFirst,proto3" json:"tcp_flags_first,omitempty"`
+	TcpFlagsLast   uint32 `protobuf:"varint,10,opt,name=tcp_flags_last,json=tcpFlagsLast,proto3" json:"tcp_flags_last,omitempty"`
+	// SYN, SYN ACK and ACK were seen in this order
+	HandshakeCompleted bool `protobuf:"varint,11,opt,name=handshake_completed,json=handshakeCompleted,proto3" json:"handshake_completed,omitempty"`
+	// Name of the timeout profile of the flow, or default if the global timeouts apply
+	TimeoutProfile       string   `protobuf:"bytes,12,opt,name=timeout_profile,json=timeoutProfile,proto3" json:"timeout_profile,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *Flow) Reset()         { *m = Flow{} }
@@ -224,6 +238,69 @@ func (m *Flow) GetInterReq() *Distribution {
 	return nil
 }
 
+func (m *Flow) GetCommunityId() string {
+	if m != nil {
+		return m.CommunityId
+	}
+	return ""
+}
+
+func (m *Flow) GetTerminationReason() string {
+	if m != nil {
+		return m.TerminationReason
+	}
+	return ""
+}
+
+func (m *Flow) GetTcpFlags() uint32 {
+	if m != nil {
+		return m.TcpFlags
+	}
+	return 0
+}
+
+func (m *Flow) GetTcpFlagsClient() uint32 {
+	if m != nil {
+		return m.TcpFlagsClient
+	}
+	return 0
+}
+
+func (m *Flow) GetTcpFlagsServer() uint32 {
+	if m != nil {
+		return m.TcpFlagsServer
+	}
+	return 0
+}
+
+func (m *Flow) GetTcpFlagsFirst() uint32 {
+	if m != nil {
+		return m.TcpFlagsFirst
+	}
+	return 0
+}
+
+func (m *Flow) GetTcpFlagsLast() uint32 {
+	if m != nil {
+		return m.TcpFlagsLast
+	}
+	return 0
+}
+
+func (m *Flow) GetHandshakeCompleted() bool {
+	if m != nil {
+		return m.HandshakeCompleted
+	}
+	return false
+}
+
+func (m *Flow) GetTimeoutProfile() string {
+	if m != nil {
+		return m.TimeoutProfile
+	}
+	return ""
+}
+
 type Flows struct {
 	Flows                []*Flow  `protobuf:"bytes,1,rep,name=flows,proto3" json:"flows,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -474,33 +551,44 @@ func init() {
 func init() { proto.RegisterFile("DataFormat.proto", fileDescriptor_f338bfeebed1f6b5) }
 
 var fileDescriptor_f338bfeebed1f6b5 = []byte{
-	// 444 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x53, 0xd1, 0x6a, 0xd4, 0x40,
-	0x14, 0x25, 0x26, 0xdd, 0x6e, 0x6f, 0xb2, 0x75, 0x19, 0x1f, 0x0c, 0xf8, 0xe0, 0x36, 0xa5, 0xb2,
-	0x20, 0x6c, 0xa1, 0x22, 0x3e, 0x88, 0x0f, 0xc2, 0xd2, 0x37, 0x61, 0x99, 0xc5, 0xe7, 0x30, 0x35,
-	0xb7, 0x30, 0xd0, 0x4c, 0xb2, 0x73, 0x27, 0x6b, 0x29, 0xf8, 0x0d, 0x7e, 0x86, 0xbf, 0x29, 0x33,
-	0x77, 0x56, 0x83, 0x88, 0xf6, 0xed, 0x72, 0xee, 0xb9, 0x39, 0xe7, 0xcc, 0x21, 0x30, 0x5f, 0x2b,
-	0xa7, 0xae, 0x3b, 0xdb, 0x2a, 0xb7, 0xea, 0x6d, 0xe7, 0x3a, 0x01, 0x8d, 0x72, 0xea, 0x36, 0x20,
-	0x55, 0x0d, 0xc5, 0x5a, 0x93, 0xb3, 0xfa, 0x66, 0x70, 0xba, 0x33, 0x62, 0x0e, 0x69, 0xab, 0x4d,
-	0x99, 0x2c, 0x92, 0x65, 0x2a, 0xfd, 0x18, 0x10, 0x75, 0x5f, 0x3e, 0x89, 0x88, 0xba, 0x17, 0x02,
-	0xb2, 0x16, 0x95, 0x29, 0xd3, 0x45, 0xb2, 0x4c, 0x64, 0x98, 0xc5, 0x73, 0x38, 0x26, 0xd7, 0xd4,
-	0x0d, 0xee, 0xcb, 0x2c, 0xc0, 0x13, 0x72, 0xcd, 0x1a, 0xf7, 0xd5, 0x27, 0x48, 0xa5, 0xdc, 0x88,
-	0x33, 0x28, 0x2c, 0xee, 0x06, 0x24, 0x57, 0x93, 0x7e, 0xc0, 0x28, 0x90, 0x47, 0x6c, 0xab, 0x1f,
-	0x50, 0x9c, 0xc3, 0xcc, 0x22, 0xf5, 0x9d, 0x21, 0x64, 0x0e, 0x4b, 0x16, 0x07, 0xd0, 0x93, 0xaa,
-	0xd7, 0x90, 0x49, 0xb9, 0x21, 0x71, 0x0e, 0x99, 0xb5, 0x3d, 0x95, 0xc9, 0x22, 0x5d, 0xe6, 0x57,
-	0x4f, 0x57, 0xbf, 0x23, 0xad, 0xa4, 0xdc, 0xc8, 0xb0, 0xac, 0xbe, 0x41, 0x76, 0x7d, 0xd7, 0x7d,
-	0x15, 0x17, 0x70, 0x4a, 0x68, 0xf7, 0x68, 0x6b, 0xd5, 0x34, 0x16, 0x89, 0x82, 0x7c, 0x26, 0x67,
-	0x8c, 0x7e, 0x64, 0xd0, 0x67, 0x30, 0x43, 0x5b, 0x5b, 0xdb, 0x47, 0xe9, 0x89, 0x19, 0x5a, 0x69,
-	0x7b, 0xf1, 0x16, 0x4e, 0xb4, 0x71, 0x68, 0x6b, 0x8b, 0xbb, 0x90, 0x3a, 0xbf, 0x2a, 0xc7, 0x8a,
-	0xe3, 0x17, 0x94, 0xd3, 0x40, 0x95, 0xb8, 0xab, 0x2e, 0xe1, 0xc8, 0xcb, 0x93, 0x78, 0x05, 0x47,
-	0xb7, 0x7e, 0x88, 0x6e, 0xe7, 0xe3, 0x5b, 0xcf, 0x90, 0xbc, 0xae, 0x7e, 0x24, 0x70, 0xbc, 0x45,
-	0x22, 0x5f, 0xc4, 0x05, 0x9c, 0x7e, 0xb9, 0xd3, 0x68, 0xdc, 0x9f, 0x9e, 0x19, 0x3d, 0x78, 0x7e,
-	0x09, 0xb9, 0xf7, 0xcc, 0x41, 0x28, 0xfa, 0x06, 0x33, 0xb4, 0x5b, 0x46, 0xc4, 0x0b, 0x38, 0xf1,
-	0x04, 0xd6, 0x4f, 0xc3, 0x7a, 0x6a, 0x86, 0x96, 0x8d, 0xbd, 0x03, 0xe0, 0x60, 0x7e, 0x1d, 0x8a,
-	0xfb, 0x57, 0x32, 0x7e, 0x04, 0x7f, 0x59, 0xbd, 0x87, 0x69, 0x34, 0x4a, 0xe2, 0x12, 0xa6, 0x14,
-	0xe7, 0x18, 0xf0, 0xd9, 0xf8, 0x13, 0x91, 0x27, 0x7f, 0x91, 0xaa, 0xef, 0x09, 0x64, 0x9f, 0x09,
-	0xed, 0x63, 0x33, 0x9e, 0x41, 0xc1, 0x19, 0xa3, 0x08, 0x87, 0xcc, 0x43, 0xc8, 0xe8, 0xe1, 0x03,
-	0xcc, 0x38, 0x48, 0x24, 0xfd, 0xb7, 0xa5, 0x22, 0xd0, 0xe3, 0xbd, 0x6f, 0xca, 0x1b, 0x0a, 0x4d,
-	0x0d, 0x7e, 0xf8, 0x5b, 0x53, 0x9e, 0x21, 0x79, 0x7d, 0x33, 0x09, 0x7f, 0xd2, 0x9b, 0x9f, 0x01,
-	0x00, 0x00, 0xff, 0xff, 0xf2, 0xd7, 0x15, 0x53, 0x5d, 0x03, 0x00, 0x00,
+	// 619 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x94, 0xdf, 0x6a, 0x13, 0x41,
+	0x14, 0xc6, 0x59, 0x77, 0x9b, 0x6e, 0xce, 0x6e, 0xd2, 0x38, 0xbd, 0x70, 0xc0, 0x0b, 0xd3, 0xad,
+	0xad, 0x01, 0xb1, 0x85, 0x8a, 0x78, 0x21, 0x5e, 0x48, 0x4b, 0x40, 0x50, 0x08, 0x53, 0xbc, 0x5e,
+	0xa6, 0xd9, 0x89, 0x1d, 0xcc, 0xce, 0x6e, 0xe7, 0xcc, 0xd6, 0xda, 0x97, 0xf0, 0x31, 0x7c, 0x35,
+	0x1f, 0x43, 0xe6, 0x4f, 0xd2, 0x54, 0x84, 0x7a, 0x37, 0xf9, 0xbe, 0xdf, 0xe4, 0xcc, 0x77, 0xce,
+	0x49, 0x60, 0x74, 0xc6, 0x0d, 0x9f, 0x36, 0xba, 0xe6, 0xe6, 0xa8, 0xd5, 0x8d, 0x69, 0x08, 0x54,
+	0xdc, 0xf0, 0x85, 0x53, 0x8a, 0x12, 0xf2, 0x33, 0x89, 0x46, 0xcb, 0x8b, 0xce, 0xc8, 0x46, 0x91,
+	0x11, 0xc4, 0xb5, 0x54, 0x34, 0x1a, 0x47, 0x93, 0x98, 0xd9, 0xa3, 0x53, 0xf8, 0x0d, 0x7d, 0x14,
+	0x14, 0x7e, 0x43, 0x08, 0x24, 0xb5, 0xe0, 0x8a, 0xc6, 0xe3, 0x68, 0x12, 0x31, 0x77, 0x26, 0x4f,
+	0x60, 0x1b, 0x4d, 0x55, 0x56, 0xe2, 0x9a, 0x26, 0x4e, 0xee, 0xa1, 0xa9, 0xce, 0xc4, 0x75, 0xf1,
+	0x19, 0x62, 0xc6, 0x66, 0x64, 0x0f, 0x72, 0x2d, 0xae, 0x3a, 0x81, 0xa6, 0x44, 0x79, 0x2b, 0x42,
+	0x81, 0x2c, 0x68, 0xe7, 0xf2, 0x56, 0x90, 0x7d, 0x18, 0x68, 0x81, 0x6d, 0xa3, 0x50, 0x78, 0xc6,
+	0x97, 0xcc, 0x57, 0xa2, 0x85, 0x8a, 0x97, 0x90, 0x30, 0x36, 0x43, 0xb2, 0x0f, 0x89, 0xd6, 0x2d,
+	0xd2, 0x68, 0x1c, 0x4f, 0xb2, 0x93, 0x9d, 0xa3, 0xbb, 0x48, 0x47, 0x8c, 0xcd, 0x98, 0x33, 0x8b,
+	0xdf, 0x31, 0x24, 0xd3, 0x65, 0xf3, 0x9d, 0x1c, 0xc0, 0x10, 0x85, 0xbe, 0x16, 0xba, 0xe4, 0x55,
+	0xa5, 0x05, 0xa2, 0xab, 0x9f, 0xb0, 0x81, 0x57, 0x3f, 0x78, 0xd1, 0x86, 0x50, 0x5d, 0x5d, 0x6a,
+	0xdd, 0x86, 0xda, 0x3d, 0xd5, 0xd5, 0x4c, 0xb7, 0xe4, 0x0d, 0xf4, 0xa5, 0x32, 0x42, 0x97, 0x5a,
+	0x5c, 0xb9, 0xd8, 0xd9, 0x09, 0xdd, 0x2c, 0xb9, 0xd9, 0x42, 0x96, 0x3a, 0x94, 0x89, 0x2b, 0x1b,
+	0x7a, 0xde, 0xd4, 0x75, 0xa7, 0xa4, 0xf9, 0x51, 0xca, 0xca, 0x75, 0xa6, 0xcf, 0xb2, 0xb5, 0xf6,
+	0xb1, 0x22, 0xaf, 0x80, 0x18, 0xa1, 0x6b, 0xa9, 0xb8, 0xbd, 0x5b, 0x6a, 0xc1, 0xb1, 0x51, 0x74,
+	0xcb, 0x81, 0x8f, 0x37, 0x1c, 0xe6, 0x0c, 0xf2, 0x14, 0xfa, 0x66, 0xde, 0x96, 0x8b, 0x25, 0xff,
+	0x8a, 0xb4, 0x37, 0x8e, 0x26, 0x03, 0x96, 0x9a, 0x79, 0x3b, 0xb5, 0x9f, 0xc9, 0x04, 0x46, 0x6b,
+	0xb3, 0x9c, 0x2f, 0xa5, 0x50, 0x86, 0x6e, 0x3b, 0x66, 0xb8, 0x62, 0x4e, 0x9d, 0x7a, 0x9f, 0xf4,
+	0x3d, 0xa0, 0xe9, 0x7d, 0xf2, 0xdc, 0xa9, 0xe4, 0x10, 0x76, 0xee, 0xc8, 0x85, 0xd4, 0x68, 0x68,
+	0xdf, 0x81, 0x83, 0x15, 0x38, 0xb5, 0x22, 0x79, 0x0e, 0xc3, 0x3b, 0x6e, 0xc9, 0xd1, 0x50, 0x70,
+	0x58, 0xbe, 0xc2, 0x3e, 0x71, 0x34, 0xe4, 0x18, 0x76, 0x2f, 0xb9, 0xaa, 0xf0, 0x92, 0x7f, 0x13,
+	0xe5, 0xbc, 0xa9, 0xdb, 0xa5, 0x30, 0xa2, 0xa2, 0xd9, 0x38, 0x9a, 0xa4, 0x8c, 0xac, 0xad, 0xd3,
+	0x95, 0x43, 0x5e, 0xc0, 0x8e, 0x91, 0xb5, 0x68, 0x3a, 0x53, 0xb6, 0xba, 0x59, 0xc8, 0xa5, 0xa0,
+	0xb9, 0xeb, 0xcd, 0x30, 0xc8, 0x33, 0xaf, 0x16, 0xc7, 0xb0, 0x65, 0x27, 0x8d, 0xe4, 0x10, 0xb6,
+	0x16, 0xf6, 0x10, 0x36, 0x63, 0xb4, 0x39, 0x26, 0x4b, 0x30, 0x6f, 0x17, 0xbf, 0x22, 0xd8, 0x3e,
+	0x17, 0x88, 0x76, 0xe9, 0x0f, 0x60, 0xe8, 0xdb, 0xf5, 0xf7, 0x7a, 0x78, 0x75, 0xb5, 0x1e, 0xcf,
+	0x20, 0xb3, 0xeb, 0xe1, 0xfb, 0x85, 0x61, 0x45, 0x40, 0x75, 0xb5, 0xef, 0x15, 0xda, 0xe9, 0x58,
+	0xc0, 0xd7, 0x8f, 0x9d, 0x9d, 0xaa, 0xae, 0xf6, 0x0f, 0x7b, 0x0b, 0xe0, 0x77, 0xc8, 0xda, 0x34,
+	0x79, 0x60, 0x89, 0xfc, 0xbe, 0xd9, 0x9b, 0xc5, 0x3b, 0x48, 0xc3, 0x43, 0x91, 0x1c, 0x43, 0x8a,
+	0xe1, 0x1c, 0x02, 0xee, 0x6e, 0x7e, 0x45, 0xe0, 0xd8, 0x1a, 0x2a, 0x7e, 0x46, 0x90, 0x7c, 0x41,
+	0xa1, 0xff, 0x37, 0xe3, 0x1e, 0xe4, 0x3e, 0x63, 0x28, 0xe2, 0x43, 0x66, 0x2e, 0x64, 0x78, 0xc3,
+	0x7b, 0x18, 0xf8, 0x20, 0x01, 0x7a, 0xf0, 0x07, 0x91, 0x3b, 0x3c, 0xdc, 0xb7, 0x93, 0xb2, 0x0f,
+	0x72, 0x93, 0xea, 0xec, 0xe1, 0x5f, 0x93, 0xb2, 0x04, 0xf3, 0xf6, 0x45, 0xcf, 0xfd, 0x6b, 0xbd,
+	0xfe, 0x33, 0x00, 0x00, 0x69, 0x85, 0xad, 0xc9, 0x04, 0x00, 0x00,
 }
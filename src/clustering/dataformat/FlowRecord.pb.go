@@ -0,0 +1,812 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: FlowRecord.proto
+
+package dataformat
+
+import (
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+// The metrics of a flow as exported by the flow mode of the analysis.
+// The files contain a sequence of FlowRecord messages, each prefixed by its size in bytes (8 bytes, big endian).
+// The groups of fields are only set if the corresponding metric was selected.
+type FlowRecord struct {
+	// Version of the record layout (FlowRecordVersion of the package metrics/flows)
+	Version  uint32        `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	Protocol *FlowProtocol `protobuf:"bytes,2,opt,name=protocol,proto3" json:"protocol,omitempty"`
+	Duration *FlowDuration `protobuf:"bytes,3,opt,name=duration,proto3" json:"duration,omitempty"`
+	Rates    *FlowRates    `protobuf:"bytes,4,opt,name=rates,proto3" json:"rates,omitempty"`
+	Size     *FlowSize     `protobuf:"bytes,5,opt,name=size,proto3" json:"size,omitempty"`
+	Packets  *FlowPackets  `protobuf:"bytes,6,opt,name=packets,proto3" json:"packets,omitempty"`
+	// Payload sizes of request and response
+	Rrps *RRPs `protobuf:"bytes,7,opt,name=rrps,proto3" json:"rrps,omitempty"`
+	// Values of metrics of other packages as JSON object, empty if there are none
+	Extra                string           `protobuf:"bytes,8,opt,name=extra,proto3" json:"extra,omitempty"`
+	ConnState            *FlowConnState   `protobuf:"bytes,9,opt,name=conn_state,json=connState,proto3" json:"conn_state,omitempty"`
+	TcpFlags             *FlowTCPFlags    `protobuf:"bytes,10,opt,name=tcp_flags,json=tcpFlags,proto3" json:"tcp_flags,omitempty"`
+	Termination          *FlowTermination `protobuf:"bytes,11,opt,name=termination,proto3" json:"termination,omitempty"`
+	Fragment             *FlowFragment    `protobuf:"bytes,12,opt,name=fragment,proto3" json:"fragment,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}         `json:"-"`
+	XXX_unrecognized     []byte           `json:"-"`
+	XXX_sizecache        int32            `json:"-"`
+}
+
+func (m *FlowRecord) Reset()         { *m = FlowRecord{} }
+func (m *FlowRecord) String() string { return proto.CompactTextString(m) }
+func (*FlowRecord) ProtoMessage()    {}
+func (*FlowRecord) Descriptor() ([]byte, []int) {
+	return fileDescriptor_51c3f267ac6a83b7, []int{0}
+}
+
+func (m *FlowRecord) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FlowRecord.Unmarshal(m, b)
+}
+func (m *FlowRecord) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FlowRecord.Marshal(b, m, deterministic)
+}
+func (m *FlowRecord) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FlowRecord.Merge(m, src)
+}
+func (m *FlowRecord) XXX_Size() int {
+	return xxx_messageInfo_FlowRecord.Size(m)
+}
+func (m *FlowRecord) XXX_DiscardUnknown() {
+	xxx_messageInfo_FlowRecord.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FlowRecord proto.InternalMessageInfo
+
+func (m *FlowRecord) GetVersion() uint32 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *FlowRecord) GetProtocol() *FlowProtocol {
+	if m != nil {
+		return m.Protocol
+	}
+	return nil
+}
+
+func (m *FlowRecord) GetDuration() *FlowDuration {
+	if m != nil {
+		return m.Duration
+	}
+	return nil
+}
+
+func (m *FlowRecord) GetRates() *FlowRates {
+	if m != nil {
+		return m.Rates
+	}
+	return nil
+}
+
+func (m *FlowRecord) GetSize() *FlowSize {
+	if m != nil {
+		return m.Size
+	}
+	return nil
+}
+
+func (m *FlowRecord) GetPackets() *FlowPackets {
+	if m != nil {
+		return m.Packets
+	}
+	return nil
+}
+
+func (m *FlowRecord) GetRrps() *RRPs {
+	if m != nil {
+		return m.Rrps
+	}
+	return nil
+}
+
+func (m *FlowRecord) GetExtra() string {
+	if m != nil {
+		return m.Extra
+	}
+	return ""
+}
+
+func (m *FlowRecord) GetConnState() *FlowConnState {
+	if m != nil {
+		return m.ConnState
+	}
+	return nil
+}
+
+func (m *FlowRecord) GetTcpFlags() *FlowTCPFlags {
+	if m != nil {
+		return m.TcpFlags
+	}
+	return nil
+}
+
+func (m *FlowRecord) GetTermination() *FlowTermination {
+	if m != nil {
+		return m.Termination
+	}
+	return nil
+}
+
+func (m *FlowRecord) GetFragment() *FlowFragment {
+	if m != nil {
+		return m.Fragment
+	}
+	return nil
+}
+
+type FlowProtocol struct {
+	Protocol            string `protobuf:"bytes,1,opt,name=protocol,proto3" json:"protocol,omitempty"`
+	PortClient          uint32 `protobuf:"varint,2,opt,name=port_client,json=portClient,proto3" json:"port_client,omitempty"`
+	PortServer          uint32 `protobuf:"varint,3,opt,name=port_server,json=portServer,proto3" json:"port_server,omitempty"`
+	AddressClient       int64  `protobuf:"varint,4,opt,name=address_client,json=addressClient,proto3" json:"address_client,omitempty"`
+	AddressServer       int64  `protobuf:"varint,5,opt,name=address_server,json=addressServer,proto3" json:"address_server,omitempty"`
+	ClientInterface     []byte `protobuf:"bytes,6,opt,name=client_interface,json=clientInterface,proto3" json:"client_interface,omitempty"`
+	ServerInterface     []byte `protobuf:"bytes,7,opt,name=server_interface,json=serverInterface,proto3" json:"server_interface,omitempty"`
+	ServerClientUnclear bool   `protobuf:"varint,8,opt,name=server_client_unclear,json=serverClientUnclear,proto3" json:"server_client_unclear,omitempty"`
+	// 4 or 16 bytes, empty if unknown
+	FullClientAddr     []byte `protobuf:"bytes,9,opt,name=full_client_addr,json=fullClientAddr,proto3" json:"full_client_addr,omitempty"`
+	FullServerAddr     []byte `protobuf:"bytes,10,opt,name=full_server_addr,json=fullServerAddr,proto3" json:"full_server_addr,omitempty"`
+	FirstPacketWasZmap bool   `protobuf:"varint,11,opt,name=first_packet_was_zmap,json=firstPacketWasZmap,proto3" json:"first_packet_was_zmap,omitempty"`
+	AllPacketsZmap     bool   `protobuf:"varint,12,opt,name=all_packets_zmap,json=allPacketsZmap,proto3" json:"all_packets_zmap,omitempty"`
+	// Community ID (version 1), empty if the full addresses are unknown
+	CommunityId          string   `protobuf:"bytes,13,opt,name=community_id,json=communityId,proto3" json:"community_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *FlowProtocol) Reset()         { *m = FlowProtocol{} }
+func (m *FlowProtocol) String() string { return proto.CompactTextString(m) }
+func (*FlowProtocol) ProtoMessage()    {}
+func (*FlowProtocol) Descriptor() ([]byte, []int) {
+	return fileDescriptor_51c3f267ac6a83b7, []int{1}
+}
+
+func (m *FlowProtocol) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FlowProtocol.Unmarshal(m, b)
+}
+func (m *FlowProtocol) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FlowProtocol.Marshal(b, m, deterministic)
+}
+func (m *FlowProtocol) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FlowProtocol.Merge(m, src)
+}
+func (m *FlowProtocol) XXX_Size() int {
+	return xxx_messageInfo_FlowProtocol.Size(m)
+}
+func (m *FlowProtocol) XXX_DiscardUnknown() {
+	xxx_messageInfo_FlowProtocol.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FlowProtocol proto.InternalMessageInfo
+
+func (m *FlowProtocol) GetProtocol() string {
+	if m != nil {
+		return m.Protocol
+	}
+	return ""
+}
+
+func (m *FlowProtocol) GetPortClient() uint32 {
+	if m != nil {
+		return m.PortClient
+	}
+	return 0
+}
+
+func (m *FlowProtocol) GetPortServer() uint32 {
+	if m != nil {
+		return m.PortServer
+	}
+	return 0
+}
+
+func (m *FlowProtocol) GetAddressClient() int64 {
+	if m != nil {
+		return m.AddressClient
+	}
+	return 0
+}
+
+func (m *FlowProtocol) GetAddressServer() int64 {
+	if m != nil {
+		return m.AddressServer
+	}
+	return 0
+}
+
+func (m *FlowProtocol) GetClientInterface() []byte {
+	if m != nil {
+		return m.ClientInterface
+	}
+	return nil
+}
+
+func (m *FlowProtocol) GetServerInterface() []byte {
+	if m != nil {
+		return m.ServerInterface
+	}
+	return nil
+}
+
+func (m *FlowProtocol) GetServerClientUnclear() bool {
+	if m != nil {
+		return m.ServerClientUnclear
+	}
+	return false
+}
+
+func (m *FlowProtocol) GetFullClientAddr() []byte {
+	if m != nil {
+		return m.FullClientAddr
+	}
+	return nil
+}
+
+func (m *FlowProtocol) GetFullServerAddr() []byte {
+	if m != nil {
+		return m.FullServerAddr
+	}
+	return nil
+}
+
+func (m *FlowProtocol) GetFirstPacketWasZmap() bool {
+	if m != nil {
+		return m.FirstPacketWasZmap
+	}
+	return false
+}
+
+func (m *FlowProtocol) GetAllPacketsZmap() bool {
+	if m != nil {
+		return m.AllPacketsZmap
+	}
+	return false
+}
+
+func (m *FlowProtocol) GetCommunityId() string {
+	if m != nil {
+		return m.CommunityId
+	}
+	return ""
+}
+
+// Timestamps in ns
+type FlowDuration struct {
+	Start                int64    `protobuf:"varint,1,opt,name=start,proto3" json:"start,omitempty"`
+	End                  int64    `protobuf:"varint,2,opt,name=end,proto3" json:"end,omitempty"`
+	Duration             int64    `protobuf:"varint,3,opt,name=duration,proto3" json:"duration,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *FlowDuration) Reset()         { *m = FlowDuration{} }
+func (m *FlowDuration) String() string { return proto.CompactTextString(m) }
+func (*FlowDuration) ProtoMessage()    {}
+func (*FlowDuration) Descriptor() ([]byte, []int) {
+	return fileDescriptor_51c3f267ac6a83b7, []int{2}
+}
+
+func (m *FlowDuration) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FlowDuration.Unmarshal(m, b)
+}
+func (m *FlowDuration) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FlowDuration.Marshal(b, m, deterministic)
+}
+func (m *FlowDuration) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FlowDuration.Merge(m, src)
+}
+func (m *FlowDuration) XXX_Size() int {
+	return xxx_messageInfo_FlowDuration.Size(m)
+}
+func (m *FlowDuration) XXX_DiscardUnknown() {
+	xxx_messageInfo_FlowDuration.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FlowDuration proto.InternalMessageInfo
+
+func (m *FlowDuration) GetStart() int64 {
+	if m != nil {
+		return m.Start
+	}
+	return 0
+}
+
+func (m *FlowDuration) GetEnd() int64 {
+	if m != nil {
+		return m.End
+	}
+	return 0
+}
+
+func (m *FlowDuration) GetDuration() int64 {
+	if m != nil {
+		return m.Duration
+	}
+	return 0
+}
+
+// Rates in bytes per second
+type FlowRates struct {
+	Total                []uint64 `protobuf:"varint,1,rep,packed,name=total,proto3" json:"total,omitempty"`
+	Client               []uint64 `protobuf:"varint,2,rep,packed,name=client,proto3" json:"client,omitempty"`
+	Server               []uint64 `protobuf:"varint,3,rep,packed,name=server,proto3" json:"server,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *FlowRates) Reset()         { *m = FlowRates{} }
+func (m *FlowRates) String() string { return proto.CompactTextString(m) }
+func (*FlowRates) ProtoMessage()    {}
+func (*FlowRates) Descriptor() ([]byte, []int) {
+	return fileDescriptor_51c3f267ac6a83b7, []int{3}
+}
+
+func (m *FlowRates) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FlowRates.Unmarshal(m, b)
+}
+func (m *FlowRates) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FlowRates.Marshal(b, m, deterministic)
+}
+func (m *FlowRates) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FlowRates.Merge(m, src)
+}
+func (m *FlowRates) XXX_Size() int {
+	return xxx_messageInfo_FlowRates.Size(m)
+}
+func (m *FlowRates) XXX_DiscardUnknown() {
+	xxx_messageInfo_FlowRates.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FlowRates proto.InternalMessageInfo
+
+func (m *FlowRates) GetTotal() []uint64 {
+	if m != nil {
+		return m.Total
+	}
+	return nil
+}
+
+func (m *FlowRates) GetClient() []uint64 {
+	if m != nil {
+		return m.Client
+	}
+	return nil
+}
+
+func (m *FlowRates) GetServer() []uint64 {
+	if m != nil {
+		return m.Server
+	}
+	return nil
+}
+
+// Payload in bytes
+type FlowSize struct {
+	Total                uint64   `protobuf:"varint,1,opt,name=total,proto3" json:"total,omitempty"`
+	Client               uint64   `protobuf:"varint,2,opt,name=client,proto3" json:"client,omitempty"`
+	Server               uint64   `protobuf:"varint,3,opt,name=server,proto3" json:"server,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *FlowSize) Reset()         { *m = FlowSize{} }
+func (m *FlowSize) String() string { return proto.CompactTextString(m) }
+func (*FlowSize) ProtoMessage()    {}
+func (*FlowSize) Descriptor() ([]byte, []int) {
+	return fileDescriptor_51c3f267ac6a83b7, []int{4}
+}
+
+func (m *FlowSize) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FlowSize.Unmarshal(m, b)
+}
+func (m *FlowSize) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FlowSize.Marshal(b, m, deterministic)
+}
+func (m *FlowSize) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FlowSize.Merge(m, src)
+}
+func (m *FlowSize) XXX_Size() int {
+	return xxx_messageInfo_FlowSize.Size(m)
+}
+func (m *FlowSize) XXX_DiscardUnknown() {
+	xxx_messageInfo_FlowSize.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FlowSize proto.InternalMessageInfo
+
+func (m *FlowSize) GetTotal() uint64 {
+	if m != nil {
+		return m.Total
+	}
+	return 0
+}
+
+func (m *FlowSize) GetClient() uint64 {
+	if m != nil {
+		return m.Client
+	}
+	return 0
+}
+
+func (m *FlowSize) GetServer() uint64 {
+	if m != nil {
+		return m.Server
+	}
+	return 0
+}
+
+type FlowPackets struct {
+	Total                uint32   `protobuf:"varint,1,opt,name=total,proto3" json:"total,omitempty"`
+	Client               uint32   `protobuf:"varint,2,opt,name=client,proto3" json:"client,omitempty"`
+	Server               uint32   `protobuf:"varint,3,opt,name=server,proto3" json:"server,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *FlowPackets) Reset()         { *m = FlowPackets{} }
+func (m *FlowPackets) String() string { return proto.CompactTextString(m) }
+func (*FlowPackets) ProtoMessage()    {}
+func (*FlowPackets) Descriptor() ([]byte, []int) {
+	return fileDescriptor_51c3f267ac6a83b7, []int{5}
+}
+
+func (m *FlowPackets) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FlowPackets.Unmarshal(m, b)
+}
+func (m *FlowPackets) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FlowPackets.Marshal(b, m, deterministic)
+}
+func (m *FlowPackets) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FlowPackets.Merge(m, src)
+}
+func (m *FlowPackets) XXX_Size() int {
+	return xxx_messageInfo_FlowPackets.Size(m)
+}
+func (m *FlowPackets) XXX_DiscardUnknown() {
+	xxx_messageInfo_FlowPackets.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FlowPackets proto.InternalMessageInfo
+
+func (m *FlowPackets) GetTotal() uint32 {
+	if m != nil {
+		return m.Total
+	}
+	return 0
+}
+
+func (m *FlowPackets) GetClient() uint32 {
+	if m != nil {
+		return m.Client
+	}
+	return 0
+}
+
+func (m *FlowPackets) GetServer() uint32 {
+	if m != nil {
+		return m.Server
+	}
+	return 0
+}
+
+// State and history of the connection as in the conn.log of Zeek
+type FlowConnState struct {
+	State                string   `protobuf:"bytes,1,opt,name=state,proto3" json:"state,omitempty"`
+	History              string   `protobuf:"bytes,2,opt,name=history,proto3" json:"history,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *FlowConnState) Reset()         { *m = FlowConnState{} }
+func (m *FlowConnState) String() string { return proto.CompactTextString(m) }
+func (*FlowConnState) ProtoMessage()    {}
+func (*FlowConnState) Descriptor() ([]byte, []int) {
+	return fileDescriptor_51c3f267ac6a83b7, []int{6}
+}
+
+func (m *FlowConnState) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FlowConnState.Unmarshal(m, b)
+}
+func (m *FlowConnState) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FlowConnState.Marshal(b, m, deterministic)
+}
+func (m *FlowConnState) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FlowConnState.Merge(m, src)
+}
+func (m *FlowConnState) XXX_Size() int {
+	return xxx_messageInfo_FlowConnState.Size(m)
+}
+func (m *FlowConnState) XXX_DiscardUnknown() {
+	xxx_messageInfo_FlowConnState.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FlowConnState proto.InternalMessageInfo
+
+func (m *FlowConnState) GetState() string {
+	if m != nil {
+		return m.State
+	}
+	return ""
+}
+
+func (m *FlowConnState) GetHistory() string {
+	if m != nil {
+		return m.History
+	}
+	return ""
+}
+
+// Bitmaps of the TCP flags as in the TCP header (FIN 0x01, SYN 0x02, RST 0x04, ACK 0x10), only set for TCP flows
+type FlowTCPFlags struct {
+	Total  uint32 `protobuf:"varint,1,opt,name=total,proto3" json:"total,omitempty"`
+	Client uint32 `protobuf:"varint,2,opt,name=client,proto3" json:"client,omitempty"`
+	Server uint32 `protobuf:"varint,3,opt,name=server,proto3" json:"server,omitempty"`
+	// Flags of the first and the last packet
+	First uint32 `protobuf:"varint,4,opt,name=first,proto3" json:"first,omitempty"`
+	Last  uint32 `protobuf:"varint,5,opt,name=last,proto3" json:"last,omitempty"`
+	// SYN, SYN ACK and ACK were seen in this order
+	HandshakeCompleted   bool     `protobuf:"varint,6,opt,name=handshake_completed,json=handshakeCompleted,proto3" json:"handshake_completed,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *FlowTCPFlags) Reset()         { *m = FlowTCPFlags{} }
+func (m *FlowTCPFlags) String() string { return proto.CompactTextString(m) }
+func (*FlowTCPFlags) ProtoMessage()    {}
+func (*FlowTCPFlags) Descriptor() ([]byte, []int) {
+	return fileDescriptor_51c3f267ac6a83b7, []int{7}
+}
+
+func (m *FlowTCPFlags) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FlowTCPFlags.Unmarshal(m, b)
+}
+func (m *FlowTCPFlags) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FlowTCPFlags.Marshal(b, m, deterministic)
+}
+func (m *FlowTCPFlags) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FlowTCPFlags.Merge(m, src)
+}
+func (m *FlowTCPFlags) XXX_Size() int {
+	return xxx_messageInfo_FlowTCPFlags.Size(m)
+}
+func (m *FlowTCPFlags) XXX_DiscardUnknown() {
+	xxx_messageInfo_FlowTCPFlags.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FlowTCPFlags proto.InternalMessageInfo
+
+func (m *FlowTCPFlags) GetTotal() uint32 {
+	if m != nil {
+		return m.Total
+	}
+	return 0
+}
+
+func (m *FlowTCPFlags) GetClient() uint32 {
+	if m != nil {
+		return m.Client
+	}
+	return 0
+}
+
+func (m *FlowTCPFlags) GetServer() uint32 {
+	if m != nil {
+		return m.Server
+	}
+	return 0
+}
+
+func (m *FlowTCPFlags) GetFirst() uint32 {
+	if m != nil {
+		return m.First
+	}
+	return 0
+}
+
+func (m *FlowTCPFlags) GetLast() uint32 {
+	if m != nil {
+		return m.Last
+	}
+	return 0
+}
+
+func (m *FlowTCPFlags) GetHandshakeCompleted() bool {
+	if m != nil {
+		return m.HandshakeCompleted
+	}
+	return false
+}
+
+type FlowTermination struct {
+	// Reason why the flow was flushed: idle, fin, rst, forced, shutdown or active
+	Reason string `protobuf:"bytes,1,opt,name=reason,proto3" json:"reason,omitempty"`
+	// Name of the timeout profile of the flow, or default if the global timeouts apply
+	TimeoutProfile       string   `protobuf:"bytes,2,opt,name=timeout_profile,json=timeoutProfile,proto3" json:"timeout_profile,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *FlowTermination) Reset()         { *m = FlowTermination{} }
+func (m *FlowTermination) String() string { return proto.CompactTextString(m) }
+func (*FlowTermination) ProtoMessage()    {}
+func (*FlowTermination) Descriptor() ([]byte, []int) {
+	return fileDescriptor_51c3f267ac6a83b7, []int{8}
+}
+
+func (m *FlowTermination) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FlowTermination.Unmarshal(m, b)
+}
+func (m *FlowTermination) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FlowTermination.Marshal(b, m, deterministic)
+}
+func (m *FlowTermination) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FlowTermination.Merge(m, src)
+}
+func (m *FlowTermination) XXX_Size() int {
+	return xxx_messageInfo_FlowTermination.Size(m)
+}
+func (m *FlowTermination) XXX_DiscardUnknown() {
+	xxx_messageInfo_FlowTermination.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FlowTermination proto.InternalMessageInfo
+
+func (m *FlowTermination) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+func (m *FlowTermination) GetTimeoutProfile() string {
+	if m != nil {
+		return m.TimeoutProfile
+	}
+	return ""
+}
+
+type FlowFragment struct {
+	// Sequence number of the record of the flow, starting at 0 (see the active timeout)
+	Sequence uint32 `protobuf:"varint,1,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	// Whether this is the last record of the flow
+	Last                 bool     `protobuf:"varint,2,opt,name=last,proto3" json:"last,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *FlowFragment) Reset()         { *m = FlowFragment{} }
+func (m *FlowFragment) String() string { return proto.CompactTextString(m) }
+func (*FlowFragment) ProtoMessage()    {}
+func (*FlowFragment) Descriptor() ([]byte, []int) {
+	return fileDescriptor_51c3f267ac6a83b7, []int{9}
+}
+
+func (m *FlowFragment) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FlowFragment.Unmarshal(m, b)
+}
+func (m *FlowFragment) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FlowFragment.Marshal(b, m, deterministic)
+}
+func (m *FlowFragment) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FlowFragment.Merge(m, src)
+}
+func (m *FlowFragment) XXX_Size() int {
+	return xxx_messageInfo_FlowFragment.Size(m)
+}
+func (m *FlowFragment) XXX_DiscardUnknown() {
+	xxx_messageInfo_FlowFragment.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FlowFragment proto.InternalMessageInfo
+
+func (m *FlowFragment) GetSequence() uint32 {
+	if m != nil {
+		return m.Sequence
+	}
+	return 0
+}
+
+func (m *FlowFragment) GetLast() bool {
+	if m != nil {
+		return m.Last
+	}
+	return false
+}
+
+func init() {
+	proto.RegisterType((*FlowRecord)(nil), "dataformat.FlowRecord")
+	proto.RegisterType((*FlowProtocol)(nil), "dataformat.FlowProtocol")
+	proto.RegisterType((*FlowDuration)(nil), "dataformat.FlowDuration")
+	proto.RegisterType((*FlowRates)(nil), "dataformat.FlowRates")
+	proto.RegisterType((*FlowSize)(nil), "dataformat.FlowSize")
+	proto.RegisterType((*FlowPackets)(nil), "dataformat.FlowPackets")
+	proto.RegisterType((*FlowConnState)(nil), "dataformat.FlowConnState")
+	proto.RegisterType((*FlowTCPFlags)(nil), "dataformat.FlowTCPFlags")
+	proto.RegisterType((*FlowTermination)(nil), "dataformat.FlowTermination")
+	proto.RegisterType((*FlowFragment)(nil), "dataformat.FlowFragment")
+}
+
+func init() { proto.RegisterFile("FlowRecord.proto", fileDescriptor_51c3f267ac6a83b7) }
+
+var fileDescriptor_51c3f267ac6a83b7 = []byte{
+	// 802 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x95, 0xdf, 0x6e, 0xeb, 0x44,
+	0x10, 0xc6, 0xe5, 0x3a, 0x69, 0x92, 0x89, 0x9d, 0x46, 0x7b, 0x4e, 0xc1, 0x1c, 0x2e, 0x28, 0x16,
+	0x88, 0x20, 0xa4, 0xa2, 0x73, 0x00, 0x89, 0x1b, 0x40, 0x28, 0x55, 0xa4, 0xde, 0x85, 0x0d, 0x08,
+	0x89, 0x1b, 0x6b, 0xb1, 0x37, 0xad, 0x55, 0xdb, 0x6b, 0x76, 0x37, 0x2d, 0xed, 0x93, 0xf0, 0x16,
+	0xbc, 0x01, 0xcf, 0x86, 0x76, 0x76, 0xfd, 0x27, 0x69, 0x7a, 0x77, 0xee, 0x76, 0x66, 0x7e, 0xf3,
+	0x79, 0x77, 0xf3, 0xed, 0x04, 0xe6, 0xab, 0x42, 0x3c, 0x50, 0x9e, 0x0a, 0x99, 0x5d, 0xd6, 0x52,
+	0x68, 0x41, 0x20, 0x63, 0x9a, 0x6d, 0x85, 0x2c, 0x99, 0x7e, 0x33, 0xbf, 0x62, 0x9a, 0xad, 0x70,
+	0x6d, 0xab, 0xf1, 0x7f, 0x03, 0x80, 0xae, 0x85, 0x44, 0x30, 0xba, 0xe7, 0x52, 0xe5, 0xa2, 0x8a,
+	0xbc, 0x0b, 0x6f, 0x11, 0xd2, 0x26, 0x24, 0xdf, 0xc2, 0x18, 0x3b, 0x52, 0x51, 0x44, 0x27, 0x17,
+	0xde, 0x62, 0xfa, 0x2e, 0xba, 0xec, 0x94, 0x2f, 0x8d, 0xc6, 0xda, 0xd5, 0x69, 0x4b, 0x9a, 0xae,
+	0x6c, 0x27, 0x99, 0x36, 0x82, 0xfe, 0xf1, 0xae, 0x2b, 0x57, 0xa7, 0x2d, 0x49, 0xbe, 0x82, 0xa1,
+	0x64, 0x9a, 0xab, 0x68, 0x80, 0x2d, 0xe7, 0x87, 0x2d, 0xd4, 0x14, 0xa9, 0x65, 0xc8, 0x02, 0x06,
+	0x2a, 0x7f, 0xe2, 0xd1, 0x10, 0xd9, 0xd7, 0x87, 0xec, 0x26, 0x7f, 0xe2, 0x14, 0x09, 0xf2, 0x16,
+	0x46, 0x35, 0x4b, 0xef, 0xb8, 0x56, 0xd1, 0x29, 0xc2, 0x1f, 0x3e, 0x3b, 0x81, 0x2d, 0xd3, 0x86,
+	0x23, 0x9f, 0xc1, 0x40, 0xca, 0x5a, 0x45, 0x23, 0xe4, 0xe7, 0x7d, 0x9e, 0xd2, 0xb5, 0xa2, 0x58,
+	0x25, 0xaf, 0x61, 0xc8, 0xff, 0xd6, 0x92, 0x45, 0xe3, 0x0b, 0x6f, 0x31, 0xa1, 0x36, 0x20, 0xdf,
+	0x03, 0xa4, 0xa2, 0xaa, 0x12, 0xa5, 0x99, 0xe6, 0xd1, 0x04, 0x15, 0x3e, 0x3a, 0xfc, 0xe2, 0x52,
+	0x54, 0xd5, 0xc6, 0x00, 0x74, 0x92, 0x36, 0x4b, 0xf2, 0x1d, 0x4c, 0x74, 0x5a, 0x27, 0xdb, 0x82,
+	0xdd, 0xa8, 0x08, 0x8e, 0x5f, 0xdb, 0xaf, 0xcb, 0xf5, 0xca, 0xd4, 0xe9, 0x58, 0xa7, 0x35, 0xae,
+	0xc8, 0x0f, 0x30, 0xd5, 0x5c, 0x96, 0x79, 0x65, 0xef, 0x7b, 0x8a, 0x8d, 0x1f, 0x3f, 0x6b, 0xec,
+	0x10, 0xda, 0xe7, 0xcd, 0x6f, 0xb5, 0x95, 0xec, 0xa6, 0xe4, 0x95, 0x8e, 0x82, 0xe3, 0x1f, 0x5d,
+	0xb9, 0x3a, 0x6d, 0xc9, 0xf8, 0x9f, 0x01, 0x04, 0xfd, 0x1f, 0x9f, 0xbc, 0xe9, 0x19, 0xc5, 0xc3,
+	0xfb, 0x68, 0x63, 0xf2, 0x09, 0x4c, 0x6b, 0x21, 0x75, 0x92, 0x16, 0xb9, 0xf9, 0xca, 0x09, 0x5a,
+	0x0c, 0x4c, 0x6a, 0x89, 0x99, 0x16, 0x50, 0x5c, 0xde, 0x73, 0x19, 0xf9, 0x1d, 0xb0, 0xc1, 0x0c,
+	0xf9, 0x1c, 0x66, 0x2c, 0xcb, 0x24, 0x57, 0xaa, 0x11, 0x31, 0x1e, 0xf1, 0x69, 0xe8, 0xb2, 0x4e,
+	0xa7, 0x87, 0x39, 0xa9, 0xe1, 0x1e, 0xe6, 0xd4, 0xbe, 0x84, 0xb9, 0x55, 0x49, 0xf2, 0x4a, 0x73,
+	0xb9, 0x65, 0x29, 0x47, 0x6b, 0x04, 0xf4, 0xcc, 0xe6, 0xaf, 0x9b, 0xb4, 0x41, 0xad, 0x52, 0x0f,
+	0x1d, 0x59, 0xd4, 0xe6, 0x3b, 0xf4, 0x1d, 0x9c, 0x3b, 0xd4, 0x89, 0xef, 0xaa, 0xb4, 0xe0, 0x4c,
+	0xa2, 0x3d, 0xc6, 0xf4, 0x95, 0x2d, 0xda, 0x9d, 0xfe, 0x66, 0x4b, 0x64, 0x01, 0xf3, 0xed, 0xae,
+	0x28, 0x9a, 0x0e, 0xb3, 0x4d, 0xb4, 0x4c, 0x40, 0x67, 0x26, 0x6f, 0xe1, 0x9f, 0xb3, 0xac, 0x23,
+	0xdd, 0x27, 0x90, 0x84, 0x8e, 0xb4, 0x27, 0x43, 0xf2, 0x2d, 0x9c, 0x6f, 0x73, 0xa9, 0x74, 0x62,
+	0xdd, 0x9c, 0x3c, 0x30, 0x95, 0x3c, 0x95, 0xac, 0x46, 0x67, 0x8c, 0x29, 0xc1, 0xa2, 0xb5, 0xfc,
+	0xef, 0x4c, 0xfd, 0x51, 0xb2, 0xda, 0x88, 0xb3, 0xa2, 0x70, 0x0d, 0x8e, 0x0e, 0x90, 0x9e, 0xb1,
+	0xa2, 0x70, 0xcf, 0x03, 0xc9, 0x4f, 0x21, 0x48, 0x45, 0x59, 0xee, 0xaa, 0x5c, 0x3f, 0x26, 0x79,
+	0x16, 0x85, 0xf8, 0x53, 0x4f, 0xdb, 0xdc, 0x75, 0x16, 0x53, 0x08, 0xfa, 0x0f, 0xdc, 0x3c, 0x13,
+	0xa5, 0x99, 0xd4, 0x68, 0x0b, 0x9f, 0xda, 0x80, 0xcc, 0xc1, 0xe7, 0x55, 0x86, 0x5e, 0xf0, 0xa9,
+	0x59, 0x1a, 0x07, 0xed, 0x0d, 0x0d, 0xbf, 0x1b, 0x0d, 0xf1, 0x2f, 0x30, 0x69, 0x27, 0x80, 0x11,
+	0xd4, 0x42, 0x33, 0xe3, 0x33, 0x7f, 0x31, 0xa0, 0x36, 0x20, 0x1f, 0xc0, 0x69, 0xeb, 0x2f, 0x93,
+	0x76, 0x91, 0xc9, 0xb7, 0xb6, 0xc2, 0xbc, 0x8d, 0xe2, 0x35, 0x8c, 0x9b, 0x41, 0xd1, 0x57, 0xf4,
+	0x8e, 0x2b, 0x7a, 0x2f, 0x28, 0x7a, 0x3d, 0xc5, 0x0d, 0x4c, 0x7b, 0xd3, 0x64, 0x5f, 0x34, 0x3c,
+	0x2e, 0x1a, 0xbe, 0x20, 0x1a, 0xb6, 0xa2, 0x3f, 0x41, 0xb8, 0x37, 0x30, 0xdc, 0x75, 0x6a, 0xee,
+	0x5e, 0x99, 0x0d, 0xcc, 0x04, 0xbf, 0xcd, 0x95, 0x16, 0xf2, 0x11, 0x75, 0x27, 0xb4, 0x09, 0xe3,
+	0x7f, 0x3d, 0x08, 0xfa, 0x93, 0xe3, 0xfd, 0xec, 0xcb, 0xa8, 0xa0, 0x91, 0xf0, 0x21, 0x86, 0xd4,
+	0x06, 0x84, 0xc0, 0xa0, 0x60, 0x4a, 0xe3, 0xb3, 0x0b, 0x29, 0xae, 0xc9, 0xd7, 0xf0, 0xea, 0x96,
+	0x55, 0x99, 0xba, 0x65, 0x77, 0x3c, 0x49, 0x45, 0x59, 0x17, 0x5c, 0xf3, 0x0c, 0x1f, 0xdc, 0x98,
+	0x92, 0xb6, 0xb4, 0x6c, 0x2a, 0x31, 0x85, 0xb3, 0x83, 0x89, 0x65, 0x76, 0x21, 0x39, 0x53, 0xee,
+	0xff, 0x69, 0x42, 0x5d, 0x44, 0xbe, 0x80, 0x33, 0x9d, 0x97, 0x5c, 0xec, 0x74, 0x52, 0x4b, 0xb1,
+	0xcd, 0x0b, 0xee, 0x8e, 0x3f, 0x73, 0xe9, 0xb5, 0xcd, 0xc6, 0x3f, 0x42, 0xd0, 0x9f, 0x64, 0xc6,
+	0x6c, 0x8a, 0xff, 0xb5, 0xe3, 0x55, 0xca, 0xdd, 0x3d, 0xb4, 0x71, 0x7b, 0x88, 0x13, 0xdc, 0x21,
+	0xae, 0xff, 0x3c, 0xc5, 0x61, 0xf6, 0xcd, 0xff, 0x03, 0x00, 0x4e, 0x4f, 0x23, 0xe9, 0x69, 0x07,
+	0x00, 0x00,
+}
@@ -0,0 +1,109 @@
+package dataformat
+
+// This file contains the reader and writer of the flow record files.
+// Like the batches of the cluster info files, each FlowRecord message is prefixed by its size in bytes (8 bytes, big endian).
+// As the number of flows is not known in advance, the files do not start with the number of entries.
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// maxFlowRecordSize is the maximal size of a marshaled FlowRecord accepted by FlowRecordReader
+const maxFlowRecordSize = 64 * 1024 * 1024
+
+// FlowRecordWriter writes length-delimited FlowRecord messages
+type FlowRecordWriter struct {
+	w         io.Writer
+	sizeBytes [8]byte
+}
+
+// NewFlowRecordWriter returns a writer writing to w. The writes are not buffered.
+func NewFlowRecordWriter(w io.Writer) *FlowRecordWriter {
+	return &FlowRecordWriter{w: w}
+}
+
+// Write marshals record and writes it
+func (fw *FlowRecordWriter) Write(record *FlowRecord) error {
+	buf, err := proto.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return fw.WriteMarshaled(buf)
+}
+
+// WriteMarshaled writes a FlowRecord, which was already marshaled
+func (fw *FlowRecordWriter) WriteMarshaled(buf []byte) error {
+	binary.BigEndian.PutUint64(fw.sizeBytes[:], uint64(len(buf)))
+	if _, err := fw.w.Write(fw.sizeBytes[:]); err != nil {
+		return err
+	}
+	_, err := fw.w.Write(buf)
+	return err
+}
+
+// FlowRecordReader reads length-delimited FlowRecord messages
+type FlowRecordReader struct {
+	r         *bufio.Reader
+	sizeBytes [8]byte
+	buf       []byte
+}
+
+// NewFlowRecordReader returns a buffered reader reading from r
+func NewFlowRecordReader(r io.Reader) *FlowRecordReader {
+	return &FlowRecordReader{r: bufio.NewReader(r)}
+}
+
+// Read returns the next record. At the end of the input, io.EOF is returned.
+// If the input ends within a record, io.ErrUnexpectedEOF is returned.
+func (fr *FlowRecordReader) Read() (*FlowRecord, error) {
+	if _, err := io.ReadFull(fr.r, fr.sizeBytes[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint64(fr.sizeBytes[:])
+	if size > maxFlowRecordSize {
+		return nil, fmt.Errorf("size of flow record %d exceeds the limit of %d bytes", size, maxFlowRecordSize)
+	}
+	if uint64(cap(fr.buf)) < size {
+		fr.buf = make([]byte, size)
+	}
+	fr.buf = fr.buf[:size]
+	if _, err := io.ReadFull(fr.r, fr.buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	record := &FlowRecord{}
+	if err := proto.Unmarshal(fr.buf, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// LoadFlowRecords reads all records of a flow record file
+func LoadFlowRecords(filename string) ([]*FlowRecord, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []*FlowRecord
+	reader := NewFlowRecordReader(file)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error while reading flow record %d of %s: %v", len(records), filename, err)
+		}
+		records = append(records, record)
+	}
+}
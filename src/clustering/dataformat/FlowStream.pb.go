@@ -0,0 +1,218 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: FlowStream.proto
+
+package dataformat
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+// Filters of a subscription. A flow is sent if it matches each of the filters which are set.
+// Flows without the metric protocol only match if no filter is set.
+type FlowFilter struct {
+	// Layer 4 protocols as in FlowProtocol.protocol (TCP, UDP), case insensitive
+	Protocols []string `protobuf:"bytes,1,rep,name=protocols,proto3" json:"protocols,omitempty"`
+	// Ports of the client or the server
+	Ports []uint32 `protobuf:"varint,2,rep,packed,name=ports,proto3" json:"ports,omitempty"`
+	// Prefixes of the address of the client or the server in CIDR notation, e.g. 10.0.0.0/8
+	AddressPrefixes      []string `protobuf:"bytes,3,rep,name=address_prefixes,json=addressPrefixes,proto3" json:"address_prefixes,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *FlowFilter) Reset()         { *m = FlowFilter{} }
+func (m *FlowFilter) String() string { return proto.CompactTextString(m) }
+func (*FlowFilter) ProtoMessage()    {}
+func (*FlowFilter) Descriptor() ([]byte, []int) {
+	return fileDescriptor_52e3ccbf4b86660c, []int{0}
+}
+
+func (m *FlowFilter) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FlowFilter.Unmarshal(m, b)
+}
+func (m *FlowFilter) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FlowFilter.Marshal(b, m, deterministic)
+}
+func (m *FlowFilter) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FlowFilter.Merge(m, src)
+}
+func (m *FlowFilter) XXX_Size() int {
+	return xxx_messageInfo_FlowFilter.Size(m)
+}
+func (m *FlowFilter) XXX_DiscardUnknown() {
+	xxx_messageInfo_FlowFilter.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FlowFilter proto.InternalMessageInfo
+
+func (m *FlowFilter) GetProtocols() []string {
+	if m != nil {
+		return m.Protocols
+	}
+	return nil
+}
+
+func (m *FlowFilter) GetPorts() []uint32 {
+	if m != nil {
+		return m.Ports
+	}
+	return nil
+}
+
+func (m *FlowFilter) GetAddressPrefixes() []string {
+	if m != nil {
+		return m.AddressPrefixes
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*FlowFilter)(nil), "dataformat.FlowFilter")
+}
+
+func init() { proto.RegisterFile("FlowStream.proto", fileDescriptor_52e3ccbf4b86660c) }
+
+var fileDescriptor_52e3ccbf4b86660c = []byte{
+	// 179 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x64, 0xce, 0xc1, 0x0b, 0x82, 0x30,
+	0x14, 0xc7, 0x71, 0x4c, 0x0a, 0x7c, 0x10, 0xc9, 0x88, 0x10, 0xe9, 0x20, 0x9d, 0xec, 0x22, 0x51,
+	0xe7, 0xae, 0x5e, 0xba, 0x84, 0xfe, 0x01, 0x31, 0xdd, 0x13, 0x24, 0xe5, 0xc9, 0xdb, 0xa2, 0xfe,
+	0xfc, 0x68, 0x13, 0x76, 0xe8, 0xb8, 0xcf, 0x8f, 0xf1, 0xbe, 0x10, 0x97, 0x03, 0xbd, 0x6b, 0xc3,
+	0x28, 0xc7, 0x62, 0x62, 0x32, 0x24, 0x40, 0x49, 0x23, 0x3b, 0xe2, 0x51, 0x9a, 0xd4, 0xae, 0x15,
+	0xb6, 0xc4, 0xca, 0xad, 0x87, 0x27, 0xc0, 0xcf, 0xca, 0x7e, 0x30, 0xc8, 0x62, 0x0f, 0x91, 0xe5,
+	0x96, 0x06, 0x9d, 0x04, 0x59, 0x98, 0x47, 0x95, 0x07, 0xb1, 0x85, 0xe5, 0x44, 0x6c, 0x74, 0xb2,
+	0xc8, 0xc2, 0x7c, 0x5d, 0xb9, 0x87, 0x38, 0x42, 0x2c, 0x95, 0x62, 0xd4, 0xfa, 0x31, 0x31, 0x76,
+	0xfd, 0x07, 0x75, 0x12, 0xda, 0xaf, 0x9b, 0xd9, 0xef, 0x33, 0x9f, 0x6f, 0xee, 0x98, 0xcb, 0x13,
+	0x57, 0x88, 0xea, 0x57, 0xa3, 0x5b, 0xee, 0x1b, 0x14, 0xbb, 0xc2, 0x67, 0x16, 0xbe, 0x28, 0xfd,
+	0x73, 0x57, 0x7f, 0x0a, 0x9a, 0x95, 0x0d, 0xbb, 0x7c, 0x07, 0x00, 0xba, 0x68, 0xd5, 0xaa, 0xf2,
+	0x00, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// FlowStreamClient is the client API for FlowStream service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type FlowStreamClient interface {
+	// Sends the flows matching the filter until the analysis ends.
+	// Flows are dropped for this subscriber if it does not receive them fast enough.
+	Subscribe(ctx context.Context, in *FlowFilter, opts ...grpc.CallOption) (FlowStream_SubscribeClient, error)
+}
+
+type flowStreamClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewFlowStreamClient(cc *grpc.ClientConn) FlowStreamClient {
+	return &flowStreamClient{cc}
+}
+
+func (c *flowStreamClient) Subscribe(ctx context.Context, in *FlowFilter, opts ...grpc.CallOption) (FlowStream_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_FlowStream_serviceDesc.Streams[0], "/dataformat.FlowStream/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &flowStreamSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type FlowStream_SubscribeClient interface {
+	Recv() (*FlowRecord, error)
+	grpc.ClientStream
+}
+
+type flowStreamSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *flowStreamSubscribeClient) Recv() (*FlowRecord, error) {
+	m := new(FlowRecord)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// FlowStreamServer is the server API for FlowStream service.
+type FlowStreamServer interface {
+	// Sends the flows matching the filter until the analysis ends.
+	// Flows are dropped for this subscriber if it does not receive them fast enough.
+	Subscribe(*FlowFilter, FlowStream_SubscribeServer) error
+}
+
+// UnimplementedFlowStreamServer can be embedded to have forward compatible implementations.
+type UnimplementedFlowStreamServer struct {
+}
+
+func (*UnimplementedFlowStreamServer) Subscribe(req *FlowFilter, srv FlowStream_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+
+func RegisterFlowStreamServer(s *grpc.Server, srv FlowStreamServer) {
+	s.RegisterService(&_FlowStream_serviceDesc, srv)
+}
+
+func _FlowStream_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(FlowFilter)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FlowStreamServer).Subscribe(m, &flowStreamSubscribeServer{stream})
+}
+
+type FlowStream_SubscribeServer interface {
+	Send(*FlowRecord) error
+	grpc.ServerStream
+}
+
+type flowStreamSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *flowStreamSubscribeServer) Send(m *FlowRecord) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _FlowStream_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "dataformat.FlowStream",
+	HandlerType: (*FlowStreamServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _FlowStream_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "FlowStream.proto",
+}
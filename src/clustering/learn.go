@@ -43,14 +43,18 @@ func checkFlags() {
 		if utils.DirectoryExists(*outputDirectory) {
 			log.Fatalln("Output directory does already exist. (Re)move it before execution.")
 		} else {
-			utils.CreateDir(*outputDirectory)
+			if err := utils.CreateDir(*outputDirectory); err != nil {
+				log.Fatalln(err)
+			}
 		}
 	}
 	if *evaluationDirectory != "" {
 		if utils.DirectoryExists(*evaluationDirectory) {
 			log.Fatalln("Evaluation directory does already exist. (Re)move it before execution.")
 		} else {
-			utils.CreateDir(*evaluationDirectory)
+			if err := utils.CreateDir(*evaluationDirectory); err != nil {
+				log.Fatalln(err)
+			}
 		}
 	}
 	if *numClusters <= 0 {
@@ -125,7 +129,9 @@ func trainModel(data [][]float64, modelName, filenameWithoutExt string) {
 		fileSplit := strings.Split(filenameWithoutExt, "_")
 
 		if !utils.DirectoryExists(path.Join(*outputDirectory, modelName)) {
-			utils.CreateDir(path.Join(*outputDirectory, modelName))
+			if err := utils.CreateDir(path.Join(*outputDirectory, modelName)); err != nil {
+				log.Fatalln(err)
+			}
 		}
 
 		outputFile := path.Join(*outputDirectory, modelName, fileSplit[0]+"_"+fileSplit[1]+".json")
@@ -161,7 +167,10 @@ func main() {
 		// Load Training data
 		filenameWithoutExt := strings.Split(path.Base(filename), ".")[0]
 		fmt.Println("--------------------------")
-		rrps := clustering.LoadRRPData(filename)
+		rrps, err := clustering.LoadRRPData(filename)
+		if err != nil {
+			log.Fatalln("Error while loading training data", err)
+		}
 		fmt.Println(*numClusters, "Clusters of", filenameWithoutExt)
 		fmt.Println("Use", len(rrps.Rrps), "RRPs in ", *numIterations, "iterations")
 
@@ -180,7 +189,10 @@ func main() {
 		// Load Training data
 		filenameWithoutExt := strings.Split(path.Base(filename), ".")[0]
 		fmt.Println("--------------------------")
-		flows := clustering.LoadFlowData(filename)
+		flows, err := clustering.LoadFlowData(filename)
+		if err != nil {
+			log.Fatalln("Error while loading training data", err)
+		}
 		fmt.Println(*numClusters, "Clusters of", filenameWithoutExt)
 		fmt.Println("Use", len(flows.Flows), "Flows in ", *numIterations, "iterations")
 
@@ -199,7 +211,10 @@ func main() {
 		// Load Training data
 		filenameWithoutExt := strings.Split(path.Base(filename), ".")[0]
 		fmt.Println("--------------------------")
-		sessions := clustering.LoadSessionData(filename)
+		sessions, err := clustering.LoadSessionData(filename)
+		if err != nil {
+			log.Fatalln("Error while loading training data", err)
+		}
 		fmt.Println(*numClusters, "Clusters of", filenameWithoutExt)
 		fmt.Println("Use", len(sessions.Sessions), "Sessions in ", *numIterations, "iterations")
 
@@ -218,7 +233,10 @@ func main() {
 		// Load Training data
 		filenameWithoutExt := strings.Split(path.Base(filename), ".")[0]
 		fmt.Println("--------------------------")
-		users := clustering.LoadUserData(filename)
+		users, err := clustering.LoadUserData(filename)
+		if err != nil {
+			log.Fatalln("Error while loading training data", err)
+		}
 		fmt.Println(*numClusters, "Clusters of", filenameWithoutExt)
 		fmt.Println("Use", len(users.Users), "Users in ", *numIterations, "iterations")
 